@@ -0,0 +1,219 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	calog "github.com/hyperledger/fabric-ca/internal/pkg/log"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type approvalArgs struct {
+	status string
+	reject api.RejectApprovalRequest
+}
+
+func (c *ClientCmd) newApprovalCommand() *cobra.Command {
+	approvalCmd := &cobra.Command{
+		Use:   "approval",
+		Short: "Manage requests pending approval",
+		Long:  "List, approve and reject the register, identity and revoke requests which need the approval of other registrars",
+	}
+	approvalCmd.AddCommand(c.newListApprovalCommand())
+	approvalCmd.AddCommand(c.newGetApprovalCommand())
+	approvalCmd.AddCommand(c.newApproveCommand())
+	approvalCmd.AddCommand(c.newRejectCommand())
+	return approvalCmd
+}
+
+func (c *ClientCmd) newListApprovalCommand() *cobra.Command {
+	approvalListCmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List approval requests",
+		Long:    "List the requests the caller made or can approve, by default those pending approval",
+		Example: "fabric-ca-client approval list --status executed",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			c.SetDefaultLogLevel(calog.WARNING)
+			err := c.ConfigInit()
+			if err != nil {
+				return err
+			}
+
+			log.Debugf("Client configuration settings: %+v", c.clientCfg)
+
+			return nil
+		},
+		RunE: c.runListApproval,
+	}
+	flags := approvalListCmd.Flags()
+	flags.StringVarP(
+		&c.approvalParams.status, "status", "", "", "List the requests with this status: pending, approved, executed, failed or rejected (default pending)")
+	return approvalListCmd
+}
+
+func (c *ClientCmd) newGetApprovalCommand() *cobra.Command {
+	approvalGetCmd := &cobra.Command{
+		Use:     "get <id>",
+		Short:   "Get an approval request",
+		Long:    "Get an approval request",
+		Example: "fabric-ca-client approval get 5f1c0b2a9e6d4c3b8a7f6e5d4c3b2a19",
+		PreRunE: c.approvalPreRunE,
+		RunE:    c.runGetApproval,
+	}
+	return approvalGetCmd
+}
+
+func (c *ClientCmd) newApproveCommand() *cobra.Command {
+	approveCmd := &cobra.Command{
+		Use:     "approve <id>",
+		Short:   "Approve a pending request",
+		Long:    "Approve a pending request, which runs once it has all the approvals it needs; the response of the request, such as the secret of a registered identity, is then printed",
+		Example: "fabric-ca-client approval approve 5f1c0b2a9e6d4c3b8a7f6e5d4c3b2a19",
+		PreRunE: c.approvalPreRunE,
+		RunE:    c.runApprove,
+	}
+	return approveCmd
+}
+
+func (c *ClientCmd) newRejectCommand() *cobra.Command {
+	rejectCmd := &cobra.Command{
+		Use:     "reject <id>",
+		Short:   "Reject a pending request",
+		Long:    "Reject a pending request, or withdraw a request the caller made",
+		Example: "fabric-ca-client approval reject 5f1c0b2a9e6d4c3b8a7f6e5d4c3b2a19 --reason 'not expected'",
+		PreRunE: c.approvalPreRunE,
+		RunE:    c.runReject,
+	}
+	flags := rejectCmd.Flags()
+	flags.StringVarP(
+		&c.approvalParams.reject.Reason, "reason", "", "", "Reason for rejecting the request")
+	return rejectCmd
+}
+
+// The client side logic for listing approval requests
+func (c *ClientCmd) runListApproval(cmd *cobra.Command, args []string) error {
+	log.Debugf("Entered runListApproval: %+v", c.approvalParams)
+
+	id, err := c.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	resp, err := id.GetApprovals(c.approvalParams.status, c.clientCfg.CAName)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range resp.Approvals {
+		printApproval(&info)
+	}
+	return nil
+}
+
+// The client side logic for getting an approval request
+func (c *ClientCmd) runGetApproval(cmd *cobra.Command, args []string) error {
+	log.Debugf("Entered runGetApproval: %+v", c.approvalParams)
+
+	id, err := c.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	resp, err := id.GetApproval(args[0], c.clientCfg.CAName)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(&resp.ApprovalInfo, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal the approval request")
+	}
+	fmt.Printf("%s\n", out)
+	return nil
+}
+
+// The client side logic for approving a request
+func (c *ClientCmd) runApprove(cmd *cobra.Command, args []string) error {
+	log.Debugf("Entered runApprove: %+v", c.approvalParams)
+
+	id, err := c.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	resp, err := id.Approve(args[0], c.clientCfg.CAName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully approved request '%s' (%d of %d approvals), which is now %s\n",
+		resp.ID, len(resp.ApprovedBy), resp.Required, resp.Status)
+	if resp.Reason != "" {
+		fmt.Printf("Reason: %s\n", resp.Reason)
+	}
+	if len(resp.Result) > 0 {
+		out, err := json.MarshalIndent(resp.Result, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "Failed to marshal the response of the request")
+		}
+		fmt.Printf("Response: %s\n", out)
+	}
+	return nil
+}
+
+// The client side logic for rejecting a request
+func (c *ClientCmd) runReject(cmd *cobra.Command, args []string) error {
+	log.Debugf("Entered runReject: %+v", c.approvalParams)
+
+	id, err := c.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	req := &c.approvalParams.reject
+	req.ID = args[0]
+	req.CAName = c.clientCfg.CAName
+	resp, err := id.Reject(req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully rejected request '%s'\n", resp.ID)
+	return nil
+}
+
+func (c *ClientCmd) approvalPreRunE(cmd *cobra.Command, args []string) error {
+	err := argsCheck(args, "approval request")
+	if err != nil {
+		return err
+	}
+
+	err = c.ConfigInit()
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Client configuration settings: %+v", c.clientCfg)
+
+	return nil
+}
+
+func printApproval(info *api.ApprovalInfo) {
+	fmt.Printf("ID: %s, Operation: %s, Target: %s, Caller: %s, Policy: %s, Approvals: %d of %d, Approved By: [%s], Status: %s, Created: %s\n",
+		info.ID, info.Operation, info.Target, info.Caller, info.Policy, len(info.ApprovedBy), info.Required,
+		strings.Join(info.ApprovedBy, ", "), info.Status, info.CreatedAt.Format(time.RFC3339))
+	if info.Reason != "" {
+		fmt.Printf("   Reason: %s\n", info.Reason)
+	}
+}
@@ -61,11 +61,24 @@ type crlArgs struct {
 	ExpireAfter string `help:"Generate CRL with certificates that expire after this UTC timestamp (in RFC3339 format)"`
 	// Genenerate CRL with all the certificates that expire before this timestamp
 	ExpireBefore string `help:"Generate CRL with certificates that expire before this UTC timestamp (in RFC3339 format)"`
+	// Genenerate CRL with the certificates issued by the key of the CA with this subject key identifier
+	AKI string `help:"Generate CRL with certificates issued by the key of the CA with this subject key identifier (hex encoded); the CRL is signed by that key"`
 }
 
 type revokeArgs struct {
 	// GenCRL specifies whether to generate a CRL
 	GenCRL bool `def:"false" json:"gencrl,omitempty" opt:"" help:"Generates a CRL that contains all revoked certificates"`
+	// Release specifies whether to release certificates on hold
+	Release bool `def:"false" json:"release,omitempty" opt:"" help:"Releases the certificates on hold instead of revoking certificates"`
+}
+
+type batchArgs struct {
+	// file is the YAML or CSV file of the identities to register or modify
+	file string
+	// bestEffort stores the valid identities even if others are not valid
+	bestEffort bool
+	// output is the format of the results, json or csv
+	output string
 }
 
 // ClientCmd encapsulates cobra command that provides command line interface
@@ -98,6 +111,8 @@ type ClientCmd struct {
 	crlParams crlArgs
 	// revoke command argument values
 	revokeParams revokeArgs
+	// register --batch command argument values
+	batchParams batchArgs
 	// profileMode is the profiling mode, cpu or mem or empty
 	profileMode string
 	// profileInst is the profiling instance object
@@ -108,6 +123,10 @@ type ClientCmd struct {
 	dynamicIdentity identityArgs
 	// Dynamically configuring affiliations
 	dynamicAffiliation affiliationArgs
+	// approval command argument values
+	approvalParams approvalArgs
+	// role command argument values
+	roleParams roleArgs
 	// Set to log level
 	logLevel string
 }
@@ -159,7 +178,10 @@ func (c *ClientCmd) init() {
 		c.newGenCRLCommand(),
 		c.newIdentityCommand(),
 		c.newAffiliationCommand(),
-		createCertificateCommand(c))
+		c.newApprovalCommand(),
+		c.newRoleCommand(),
+		createCertificateCommand(c),
+		createCPABECommand(c))
 	c.rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
 		Short: "Prints Fabric CA Client version",
@@ -163,6 +163,8 @@ csr:
 #  maxenrollments - The maximum number of times the secret can be reused to enroll.
 #                   Specially, -1 means unlimited; 0 means to use CA's max enrollment
 #                   value.
+#  secretexpiry - Duration for which the secret is valid (e.g. 24h); empty means
+#                 to use CA's secret expiry value.
 #  attributes - List of name/value pairs of attribute for identity
 #############################################################################
 id:
@@ -170,6 +172,7 @@ id:
   type:
   affiliation:
   maxenrollments: 0
+  secretexpiry:
   attributes:
    # - name:
    #   value:
@@ -179,10 +182,19 @@ id:
 #
 #  profile - Name of the signing profile to use in issuing the certificate
 #  label - Label to use in HSM operations
+#  idtokenfile - File containing an OpenID Connect ID token to enroll with
+#                instead of a secret, if the server enables OpenID Connect
+#  externalcertfile - File of a certificate issued by a trusted external CA
+#                to enroll with instead of a secret, if the server enables
+#                enrollment with the certificates of external CAs
+#  externalkeyfile - File of the private key of the external CA certificate
 #############################################################################
 enrollment:
   profile:
   label:
+  idtokenfile:
+  externalcertfile:
+  externalkeyfile:
 
 #############################################################################
 # Name of the CA to connect to within the fabric-ca server
@@ -330,7 +342,14 @@ func (c *ClientCmd) createDefaultConfigFile() error {
 	if c.requiresUser() {
 		user, _, err = util.GetUser(c.myViper)
 		if err != nil {
-			return err
+			// An enrollment with an ID token or a certificate has no
+			// secret in the URL
+			if c.myViper.GetString("enrollment.idtokenfile") == "" &&
+				c.myViper.GetString("enrollment.externalcertfile") == "" &&
+				c.myViper.GetString("tls.client.certfile") == "" {
+				return err
+			}
+			user = ""
 		}
 	}
 	cfg = strings.Replace(cfg, "<<<ENROLLMENT_ID>>>", user, 1)
@@ -348,21 +367,8 @@ func (c *ClientCmd) createDefaultConfigFile() error {
 // processAttributes parses attributes from command line or env variable
 func processAttributes(cfgAttrs []string, cfg *lib.ClientConfig) error {
 	if cfgAttrs != nil {
-		attrMap := make(map[string]string)
-		for _, attr := range cfgAttrs {
-			// skipping empty attributes
-			if len(attr) == 0 {
-				continue
-			}
-			sattr := strings.SplitN(attr, "=", 2)
-			if len(sattr) != 2 {
-				return errors.Errorf("Attribute '%s' is missing '=' ; it "+
-					"must be of the form <name>=<value>", attr)
-			}
-			attrMap[sattr[0]] = sattr[1]
-		}
 		var err error
-		cfg.ID.Attributes, err = attr.ConvertAttrs(attrMap)
+		cfg.ID.Attributes, err = parseAttributes(cfgAttrs)
 		if err != nil {
 			return err
 		}
@@ -370,6 +376,24 @@ func processAttributes(cfgAttrs []string, cfg *lib.ClientConfig) error {
 	return nil
 }
 
+// parseAttributes parses attributes of the form <name>=<value>[:ecert]
+func parseAttributes(cfgAttrs []string) ([]api.Attribute, error) {
+	attrMap := make(map[string]string)
+	for _, attr := range cfgAttrs {
+		// skipping empty attributes
+		if len(attr) == 0 {
+			continue
+		}
+		sattr := strings.SplitN(attr, "=", 2)
+		if len(sattr) != 2 {
+			return nil, errors.Errorf("Attribute '%s' is missing '=' ; it "+
+				"must be of the form <name>=<value>", attr)
+		}
+		attrMap[sattr[0]] = sattr[1]
+	}
+	return attr.ConvertAttrs(attrMap)
+}
+
 // processAttributeRequests parses attribute requests from command line or env variable
 // Each string is of the form: <attrName>[:opt] where "opt" means the attribute is
 // optional and will not return an error if the identity does not possess the attribute.
@@ -0,0 +1,185 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	calog "github.com/hyperledger/fabric-ca/internal/pkg/log"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type cpabeCommand struct {
+	command      Command
+	file         string
+	passwordFile string
+}
+
+// createCPABECommand will create the cpabe cobra command
+func createCPABECommand(clientCmd Command) *cobra.Command {
+	return addCPABECommand(&cpabeCommand{command: clientCmd})
+}
+
+func addCPABECommand(c *cpabeCommand) *cobra.Command {
+	cpabeCmd := &cobra.Command{
+		Use:   "cpabe",
+		Short: "Manage CP-ABE keys",
+		Long:  "Manage CP-ABE keys",
+	}
+	keyCmd := &cobra.Command{
+		Use:   "key",
+		Short: "Manage CP-ABE keys",
+		Long:  "Export and import CP-ABE keys",
+	}
+	keyCmd.AddCommand(newExportCPABEKeyCommand(c), newImportCPABEKeyCommand(c))
+	cpabeCmd.AddCommand(keyCmd)
+	return cpabeCmd
+}
+
+func newExportCPABEKeyCommand(c *cpabeCommand) *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:     "export",
+		Short:   "Export the CP-ABE key",
+		Long:    "Export the CP-ABE key to a PEM file protected by a password or, if no password is given, by the enrollment certificate's key",
+		Example: "fabric-ca-client cpabe key export --file cpabe-key.pem --passwordfile cpabe-key.pwd",
+		PreRunE: c.preRunCPABE,
+		RunE:    c.runExportCPABEKey,
+	}
+	c.addFlags(exportCmd, "File to write the CP-ABE key to", "File holding the password to encrypt the CP-ABE key with")
+	return exportCmd
+}
+
+func newImportCPABEKeyCommand(c *cpabeCommand) *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:     "import",
+		Short:   "Import a CP-ABE key",
+		Long:    "Import a CP-ABE key from a PEM file created by the export command",
+		Example: "fabric-ca-client cpabe key import --file cpabe-key.pem --passwordfile cpabe-key.pwd",
+		PreRunE: c.preRunCPABE,
+		RunE:    c.runImportCPABEKey,
+	}
+	c.addFlags(importCmd, "File to read the CP-ABE key from", "File holding the password the CP-ABE key was encrypted with")
+	return importCmd
+}
+
+func (c *cpabeCommand) addFlags(cmd *cobra.Command, fileHelp, passwordFileHelp string) {
+	flags := cmd.Flags()
+	flags.StringVarP(&c.file, "file", "", "", fileHelp)
+	flags.StringVarP(&c.passwordFile, "passwordfile", "", "", passwordFileHelp)
+}
+
+func (c *cpabeCommand) preRunCPABE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errors.Errorf(extraArgsError, args, cmd.UsageString())
+	}
+	if c.file == "" {
+		return errors.New("The '--file' option is required")
+	}
+	c.command.SetDefaultLogLevel(calog.WARNING)
+	err := c.command.ConfigInit()
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Client configuration settings: %+v", c.command.GetClientCfg())
+
+	return nil
+}
+
+// The client side logic for executing the export CP-ABE key command
+func (c *cpabeCommand) runExportCPABEKey(cmd *cobra.Command, args []string) error {
+	log.Debug("Entered runExportCPABEKey")
+
+	id, err := c.command.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	keyPEM, info, err := id.ExportCPABEKey(password)
+	if err != nil {
+		return err
+	}
+	file := c.absFile()
+	err = util.WriteFile(file, keyPEM, 0600)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to write the CP-ABE key")
+	}
+	fmt.Printf("Exported the CP-ABE key to %s\n", file)
+	printCPABEKeyInfo(info)
+	return nil
+}
+
+// The client side logic for executing the import CP-ABE key command
+func (c *cpabeCommand) runImportCPABEKey(cmd *cobra.Command, args []string) error {
+	log.Debug("Entered runImportCPABEKey")
+
+	id, err := c.command.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	file := c.absFile()
+	keyPEM, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read the CP-ABE key from %s", file)
+	}
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	info, err := id.ImportCPABEKey(keyPEM, password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported the CP-ABE key from %s\n", file)
+	printCPABEKeyInfo(info)
+	return nil
+}
+
+func (c *cpabeCommand) absFile() string {
+	if filepath.IsAbs(c.file) {
+		return c.file
+	}
+	return filepath.Join(c.command.GetHomeDirectory(), c.file)
+}
+
+// readPassword returns the password stored in the password file, without
+// the trailing line break, or nil if no password file was given
+func (c *cpabeCommand) readPassword() ([]byte, error) {
+	if c.passwordFile == "" {
+		return nil, nil
+	}
+	file := c.passwordFile
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(c.command.GetHomeDirectory(), file)
+	}
+	password, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read the password from %s", file)
+	}
+	password = []byte(strings.TrimRight(string(password), "\r\n"))
+	if len(password) == 0 {
+		return nil, errors.Errorf("The password file %s is empty", file)
+	}
+	return password, nil
+}
+
+func printCPABEKeyInfo(info *lib.CPABEKeyInfo) {
+	fmt.Printf("Params version: %s\n", info.ParamsVersion)
+	fmt.Printf("Attributes: %s\n", strings.Join(info.Attributes, ", "))
+}
@@ -116,6 +116,7 @@ func (c *ClientCmd) runGenCRL() error {
 		RevokedBefore: revokedBefore,
 		ExpireAfter:   expireAfter,
 		ExpireBefore:  expireBefore,
+		AKI:           c.crlParams.AKI,
 	}
 	resp, err := id.GenCRL(req)
 	if err != nil {
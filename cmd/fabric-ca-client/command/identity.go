@@ -18,6 +18,7 @@ package command
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
 	calog "github.com/hyperledger/fabric-ca/internal/pkg/log"
@@ -34,6 +35,8 @@ type identityArgs struct {
 	add    api.AddIdentityRequest
 	modify api.ModifyIdentityRequest
 	remove api.RemoveIdentityRequest
+	reset  api.ResetSecretRequest
+	totp   api.TOTPRequest
 }
 
 func (c *ClientCmd) newIdentityCommand() *cobra.Command {
@@ -46,6 +49,8 @@ func (c *ClientCmd) newIdentityCommand() *cobra.Command {
 	identityCmd.AddCommand(c.newAddIdentityCommand())
 	identityCmd.AddCommand(c.newModifyIdentityCommand())
 	identityCmd.AddCommand(c.newRemoveIdentityCommand())
+	identityCmd.AddCommand(c.newResetSecretIdentityCommand())
+	identityCmd.AddCommand(c.newTOTPIdentityCommand())
 	return identityCmd
 }
 
@@ -96,7 +101,7 @@ func (c *ClientCmd) newModifyIdentityCommand() *cobra.Command {
 		Use:     "modify <id>",
 		Short:   "Modify identity",
 		Long:    "Modify an existing identity",
-		Example: "fabric-ca-client identity modify user1 --type peer",
+		Example: "fabric-ca-client identity modify user1 --type peer\nfabric-ca-client identity modify user1 --suspend --hold",
 		PreRunE: c.identityPreRunE,
 		RunE:    c.runModifyIdentity,
 	}
@@ -127,6 +132,34 @@ func (c *ClientCmd) newRemoveIdentityCommand() *cobra.Command {
 	return identityRemoveCmd
 }
 
+func (c *ClientCmd) newResetSecretIdentityCommand() *cobra.Command {
+	identityResetSecretCmd := &cobra.Command{
+		Use:     "resetsecret <id>",
+		Short:   "Reset the secret of an identity",
+		Long:    "Replace the enrollment secret of an identity with a new random secret",
+		Example: "fabric-ca-client identity resetsecret user1 --secretexpiry 24h",
+		PreRunE: c.identityPreRunE,
+		RunE:    c.runResetSecretIdentity,
+	}
+	flags := identityResetSecretCmd.Flags()
+	util.RegisterFlags(c.myViper, flags, &c.dynamicIdentity.reset, nil)
+	return identityResetSecretCmd
+}
+
+func (c *ClientCmd) newTOTPIdentityCommand() *cobra.Command {
+	identityTOTPCmd := &cobra.Command{
+		Use:     "totp <id>",
+		Short:   "Set or remove the TOTP seed of an identity",
+		Long:    "Give an identity a new TOTP seed, which it must enroll with, or remove its seed",
+		Example: "fabric-ca-client identity totp admin2",
+		PreRunE: c.identityPreRunE,
+		RunE:    c.runTOTPIdentity,
+	}
+	flags := identityTOTPCmd.Flags()
+	util.RegisterFlags(c.myViper, flags, &c.dynamicIdentity.totp, nil)
+	return identityTOTPCmd
+}
+
 // The client side logic for executing list identity command
 func (c *ClientCmd) runListIdentity(cmd *cobra.Command, args []string) error {
 	log.Debug("Entered runListIdentity")
@@ -142,7 +175,7 @@ func (c *ClientCmd) runListIdentity(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
-		fmt.Printf("Name: %s, Type: %s, Affiliation: %s, Max Enrollments: %d, Attributes: %+v\n", resp.ID, resp.Type, resp.Affiliation, resp.MaxEnrollments, resp.Attributes)
+		fmt.Printf("Name: %s, Type: %s, Affiliation: %s, Max Enrollments: %d, Secret: %s, Suspended: %t, Roles: %v, Reissue: %t, Attributes: %+v\n", resp.ID, resp.Type, resp.Affiliation, resp.MaxEnrollments, lib.SecretStateString(resp.SecretState, resp.SecretExpiry), resp.Suspended, resp.Roles, resp.Reissue, resp.Attributes)
 		return nil
 	}
 
@@ -186,6 +219,7 @@ func (c *ClientCmd) runAddIdentity(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Printf("Successfully added identity - Name: %s, Type: %s, Affiliation: %s, Max Enrollments: %d, Secret: %s, Attributes: %+v\n", resp.ID, resp.Type, resp.Affiliation, resp.MaxEnrollments, resp.Secret, resp.Attributes)
+	printTOTPSeed(resp.TOTPSeed, resp.TOTPURI)
 	return nil
 }
 
@@ -220,7 +254,8 @@ func (c *ClientCmd) runModifyIdentity(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	fmt.Printf("Successfully modified identity - Name: %s, Type: %s, Affiliation: %s, Max Enrollments: %d, Secret: %s, Attributes: %+v\n", resp.ID, resp.Type, resp.Affiliation, resp.MaxEnrollments, resp.Secret, resp.Attributes)
+	fmt.Printf("Successfully modified identity - Name: %s, Type: %s, Affiliation: %s, Max Enrollments: %d, Secret: %s, Suspended: %t, Attributes: %+v\n", resp.ID, resp.Type, resp.Affiliation, resp.MaxEnrollments, resp.Secret, resp.Suspended, resp.Attributes)
+	printTOTPSeed(resp.TOTPSeed, resp.TOTPURI)
 	return nil
 }
 
@@ -245,6 +280,66 @@ func (c *ClientCmd) runRemoveIdentity(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// The client side logic for resetting the secret of an identity
+func (c *ClientCmd) runResetSecretIdentity(cmd *cobra.Command, args []string) error {
+	log.Debugf("Entered runResetSecretIdentity: %+v", c.dynamicIdentity)
+
+	id, err := c.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	req := &c.dynamicIdentity.reset
+	req.ID = args[0]
+	req.CAName = c.clientCfg.CAName
+	resp, err := id.ResetSecret(req)
+	if err != nil {
+		return err
+	}
+
+	if resp.SecretExpiry != nil {
+		fmt.Printf("Successfully reset the secret of identity - Name: %s, Secret: %s, Secret Expiry: %s\n", resp.ID, resp.Secret, resp.SecretExpiry.Format(time.RFC3339))
+		return nil
+	}
+	fmt.Printf("Successfully reset the secret of identity - Name: %s, Secret: %s\n", resp.ID, resp.Secret)
+	return nil
+}
+
+// The client side logic for setting or removing the TOTP seed of an identity
+func (c *ClientCmd) runTOTPIdentity(cmd *cobra.Command, args []string) error {
+	log.Debugf("Entered runTOTPIdentity: %+v", c.dynamicIdentity)
+
+	id, err := c.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	req := &c.dynamicIdentity.totp
+	req.ID = args[0]
+	req.CAName = c.clientCfg.CAName
+	resp, err := id.SetTOTP(req)
+	if err != nil {
+		return err
+	}
+
+	if req.Disable {
+		fmt.Printf("Successfully removed the TOTP seed of identity - Name: %s\n", resp.ID)
+		return nil
+	}
+	fmt.Printf("Successfully set the TOTP seed of identity - Name: %s\n", resp.ID)
+	printTOTPSeed(resp.TOTPSeed, resp.TOTPURI)
+	return nil
+}
+
+// printTOTPSeed prints the TOTP seed of an identity which enrolls with a
+// TOTP, and its key URI for authenticator applications
+func printTOTPSeed(seed, uri string) {
+	if seed == "" {
+		return
+	}
+	fmt.Printf("TOTP Seed: %s\nTOTP URI: %s\n", seed, uri)
+}
+
 func (c *ClientCmd) identityPreRunE(cmd *cobra.Command, args []string) error {
 	err := argsCheck(args, "Identity")
 	if err != nil {
@@ -266,7 +361,7 @@ func (c *ClientCmd) identityPreRunE(cmd *cobra.Command, args []string) error {
 // flags. This is a workaround until this bug is addressed in Viper.
 // Viper Bug: https://github.com/spf13/viper/issues/276
 func checkOtherFlags(cmd *cobra.Command) bool {
-	checkFlags := []string{"id", "type", "affiliation", "secret", "maxenrollments", "attrs"}
+	checkFlags := []string{"id", "type", "affiliation", "secret", "secretexpiry", "totp", "maxenrollments", "suspend", "resume", "hold", "attrs"}
 	flags := cmd.Flags()
 	for _, checkFlag := range checkFlags {
 		flag := flags.Lookup(checkFlag)
@@ -28,9 +28,10 @@ import (
 
 func (c *ClientCmd) newRegisterCommand() *cobra.Command {
 	registerCmd := &cobra.Command{
-		Use:   "register",
-		Short: "Register an identity",
-		Long:  "Register an identity with Fabric CA server",
+		Use:     "register",
+		Short:   "Register an identity",
+		Long:    "Register an identity with Fabric CA server, or register and modify the identities of a YAML or CSV file in one request",
+		Example: "fabric-ca-client register --id.name user1 --id.affiliation org1\nfabric-ca-client register --batch identities.csv --output csv",
 		// PreRunE block for this command will check to make sure enrollment
 		// information exists before running the command
 		PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -56,6 +57,13 @@ func (c *ClientCmd) newRegisterCommand() *cobra.Command {
 			return nil
 		},
 	}
+	flags := registerCmd.Flags()
+	flags.StringVarP(
+		&c.batchParams.file, "batch", "", "", "YAML or CSV file of the identities to register or modify in one request")
+	flags.BoolVarP(
+		&c.batchParams.bestEffort, "besteffort", "", false, "With --batch, store the valid identities even if other identities are not valid")
+	flags.StringVarP(
+		&c.batchParams.output, "output", "", "json", "With --batch, the format of the results: json or csv")
 	return registerCmd
 }
 
@@ -73,6 +81,10 @@ func (c *ClientCmd) runRegister() error {
 		return err
 	}
 
+	if c.batchParams.file != "" {
+		return c.runBatchRegister(id)
+	}
+
 	c.clientCfg.ID.CAName = c.clientCfg.CAName
 	resp, err := id.Register(&c.clientCfg.ID)
 	if err != nil {
@@ -80,6 +92,7 @@ func (c *ClientCmd) runRegister() error {
 	}
 
 	fmt.Printf("Password: %s\n", resp.Secret)
+	printTOTPSeed(resp.TOTPSeed, resp.TOTPURI)
 
 	return nil
 }
@@ -0,0 +1,254 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package command
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// The columns of the results of a batch request in CSV format
+var batchResultColumns = []string{"id", "status", "secret", "totp_seed", "totp_uri", "code", "error"}
+
+// runBatchRegister registers and modifies the identities of the batch file
+// in one request, and prints the result of each identity
+func (c *ClientCmd) runBatchRegister(id *lib.Identity) error {
+	log.Debugf("Entered runBatchRegister with file '%s'", c.batchParams.file)
+
+	output := strings.ToLower(c.batchParams.output)
+	if output != "json" && output != "csv" {
+		return errors.Errorf("Invalid output format '%s'; it must be either 'json' or 'csv'", c.batchParams.output)
+	}
+
+	identities, err := readBatchFile(c.batchParams.file)
+	if err != nil {
+		return err
+	}
+
+	resp, err := id.Batch(&api.BatchRequest{
+		Identities: identities,
+		BestEffort: c.batchParams.bestEffort,
+		CAName:     c.clientCfg.CAName,
+	})
+	if err != nil {
+		return err
+	}
+
+	if output == "csv" {
+		err = printBatchResultsCSV(os.Stdout, resp.Results)
+	} else {
+		err = printBatchResultsJSON(os.Stdout, resp.Results)
+	}
+	if err != nil {
+		return err
+	}
+
+	notStored := 0
+	for _, result := range resp.Results {
+		if result.Status == api.BatchFailed || result.Status == api.BatchSkipped {
+			notStored++
+		}
+	}
+	if notStored > 0 {
+		return errors.Errorf("%d of the %d identities of the batch were not stored", notStored, len(resp.Results))
+	}
+	return nil
+}
+
+// readBatchFile reads the identities of a batch request from a YAML or CSV
+// file, which is chosen by the extension of the file
+func readBatchFile(file string) ([]api.BatchIdentity, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read batch file '%s'", file)
+	}
+	var identities []api.BatchIdentity
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		identities, err = parseBatchYAML(data)
+	case ".csv":
+		identities, err = parseBatchCSV(data)
+	default:
+		return nil, errors.Errorf("Batch file '%s' must have a .yaml, .yml or .csv extension", file)
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Invalid batch file '%s'", file)
+	}
+	if len(identities) == 0 {
+		return nil, errors.Errorf("No identities in batch file '%s'", file)
+	}
+	return identities, nil
+}
+
+// parseBatchYAML parses a YAML document whose 'identities' list has the
+// fields of the JSON batch request
+func parseBatchYAML(data []byte) ([]api.BatchIdentity, error) {
+	vp := viper.New()
+	vp.SetConfigType("yaml")
+	err := vp.ReadConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse YAML")
+	}
+	body, err := json.Marshal(jsonValue(vp.Get("identities")))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to convert YAML")
+	}
+	var identities []api.BatchIdentity
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&identities)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid list of identities")
+	}
+	return identities, nil
+}
+
+// jsonValue converts the maps of a parsed YAML value, whose keys need not be
+// strings, to maps which can be marshaled to JSON
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, value := range v {
+			l[i] = jsonValue(value)
+		}
+		return l
+	}
+	return v
+}
+
+// parseBatchCSV parses CSV records whose header names the fields of each
+// identity. The attrs column is a list of comma-separated attributes of the
+// form <name>=<value>[:ecert], as for the --id.attrs flag.
+func parseBatchCSV(data []byte) ([]api.BatchIdentity, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read the CSV header")
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var identities []api.BatchIdentity
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read CSV record")
+		}
+		var entry api.BatchIdentity
+		for i, value := range record {
+			err = setBatchField(&entry, header[i], strings.TrimSpace(value))
+			if err != nil {
+				return nil, errors.WithMessagef(err, "Invalid CSV record %d", len(identities)+1)
+			}
+		}
+		identities = append(identities, entry)
+	}
+	return identities, nil
+}
+
+// setBatchField sets the field of an identity named by a CSV column
+func setBatchField(entry *api.BatchIdentity, column, value string) error {
+	if value == "" {
+		return nil
+	}
+	var err error
+	switch column {
+	case "id":
+		entry.Name = value
+	case "type":
+		entry.Type = value
+	case "affiliation":
+		entry.Affiliation = value
+	case "secret":
+		entry.Secret = value
+	case "secret_expiry":
+		entry.SecretExpiry = value
+	case "max_enrollments":
+		entry.MaxEnrollments, err = strconv.Atoi(value)
+	case "totp":
+		entry.TOTP, err = strconv.ParseBool(value)
+	case "modify":
+		entry.Modify, err = strconv.ParseBool(value)
+	case "attrs":
+		// The attributes are split as those of the --id.attrs flag
+		var attrs []string
+		attrs, err = csv.NewReader(strings.NewReader(value)).Read()
+		if err == nil {
+			entry.Attributes, err = parseAttributes(attrs)
+		}
+	default:
+		return errors.Errorf("Unknown column '%s'", column)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Invalid value '%s' of column '%s'", value, column)
+	}
+	return nil
+}
+
+// printBatchResultsJSON prints the results of a batch request as a JSON list
+func printBatchResultsJSON(w io.Writer, results []api.BatchResult) error {
+	out, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal the results of the batch request")
+	}
+	_, err = fmt.Fprintf(w, "%s\n", out)
+	return err
+}
+
+// printBatchResultsCSV prints the results of a batch request as CSV records
+// with a header
+func printBatchResultsCSV(w io.Writer, results []api.BatchResult) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(batchResultColumns)
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		code := ""
+		if result.Code != 0 {
+			code = strconv.Itoa(result.Code)
+		}
+		err = cw.Write([]string{result.ID, result.Status, result.Secret, result.TOTPSeed, result.TOTPURI, code, result.Error})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -91,19 +91,24 @@ func (c *ClientCmd) runRevoke(cmd *cobra.Command) error {
 	}
 
 	req := &api.RevocationRequest{
-		Name:   c.clientCfg.Revoke.Name,
-		Serial: c.clientCfg.Revoke.Serial,
-		AKI:    c.clientCfg.Revoke.AKI,
-		Reason: c.clientCfg.Revoke.Reason,
-		GenCRL: c.revokeParams.GenCRL,
-		CAName: c.clientCfg.CAName,
+		Name:    c.clientCfg.Revoke.Name,
+		Serial:  c.clientCfg.Revoke.Serial,
+		AKI:     c.clientCfg.Revoke.AKI,
+		Reason:  c.clientCfg.Revoke.Reason,
+		GenCRL:  c.revokeParams.GenCRL,
+		Release: c.revokeParams.Release,
+		CAName:  c.clientCfg.CAName,
 	}
 	result, err := id.Revoke(req)
 
 	if err != nil {
 		return err
 	}
-	log.Infof("Successfully revoked certificates: %+v", result.RevokedCerts)
+	if req.Release {
+		log.Infof("Successfully released certificates: %+v", result.ReleasedCerts)
+	} else {
+		log.Infof("Successfully revoked certificates: %+v", result.RevokedCerts)
+	}
 
 	if req.GenCRL {
 		return storeCRL(c.clientCfg, result.CRL)
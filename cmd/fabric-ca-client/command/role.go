@@ -0,0 +1,236 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	calog "github.com/hyperledger/fabric-ca/internal/pkg/log"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/spf13/cobra"
+)
+
+type roleArgs struct {
+	name   string
+	modify api.ModifyRoleRequest
+	remove api.RemoveRoleRequest
+}
+
+func (c *ClientCmd) newRoleCommand() *cobra.Command {
+	roleCmd := &cobra.Command{
+		Use:   "role",
+		Short: "Manage roles",
+		Long:  "Manage the named roles, which give the identities listing them in their 'hf.Roles' attribute a set of attributes",
+	}
+	roleCmd.AddCommand(c.newListRoleCommand())
+	roleCmd.AddCommand(c.newAddRoleCommand())
+	roleCmd.AddCommand(c.newModifyRoleCommand())
+	roleCmd.AddCommand(c.newRemoveRoleCommand())
+	return roleCmd
+}
+
+func (c *ClientCmd) newListRoleCommand() *cobra.Command {
+	roleListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List roles",
+		Long:  "List the roles with their attributes and members",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			c.SetDefaultLogLevel(calog.WARNING)
+			err := c.ConfigInit()
+			if err != nil {
+				return err
+			}
+
+			log.Debugf("Client configuration settings: %+v", c.clientCfg)
+
+			return nil
+		},
+		RunE: c.runListRole,
+	}
+	flags := roleListCmd.Flags()
+	flags.StringVarP(
+		&c.roleParams.name, "name", "", "", "Get role information from the fabric-ca server")
+	return roleListCmd
+}
+
+func (c *ClientCmd) newAddRoleCommand() *cobra.Command {
+	roleAddCmd := &cobra.Command{
+		Use:     "add <role>",
+		Short:   "Add role",
+		Long:    "Add a role which gives its members a set of attributes",
+		Example: "fabric-ca-client role add auditor --attrs 'department=audit,hf.GenCRL=true'",
+		PreRunE: c.rolePreRunE,
+		RunE:    c.runAddRole,
+	}
+	flags := roleAddCmd.Flags()
+	flags.StringSliceVarP(
+		&c.cfgAttrs, "attrs", "", nil, "A list of comma-separated attributes of the form <name>=<value> (e.g. foo=foo1,bar=bar1)")
+	return roleAddCmd
+}
+
+func (c *ClientCmd) newModifyRoleCommand() *cobra.Command {
+	roleModifyCmd := &cobra.Command{
+		Use:     "modify <role>",
+		Short:   "Modify role",
+		Long:    "Replace the attributes of a role, which updates the attributes of all of its members",
+		Example: "fabric-ca-client role modify auditor --attrs 'department=audit,hf.Revoker=true' --reissue",
+		PreRunE: c.rolePreRunE,
+		RunE:    c.runModifyRole,
+	}
+	flags := roleModifyCmd.Flags()
+	flags.StringSliceVarP(
+		&c.cfgAttrs, "attrs", "", nil, "A list of comma-separated attributes of the form <name>=<value> (e.g. foo=foo1,bar=bar1)")
+	flags.BoolVarP(
+		&c.roleParams.modify.Reissue, "reissue", "", false, "Flags the members whose attributes change to reissue their certificates")
+	return roleModifyCmd
+}
+
+func (c *ClientCmd) newRemoveRoleCommand() *cobra.Command {
+	roleRemoveCmd := &cobra.Command{
+		Use:     "remove <role>",
+		Short:   "Remove role",
+		Long:    "Remove a role",
+		PreRunE: c.rolePreRunE,
+		RunE:    c.runRemoveRole,
+	}
+	flags := roleRemoveCmd.Flags()
+	flags.BoolVarP(
+		&c.roleParams.remove.Force, "force", "", false, "Forces removal of a role which has members, taking the role and its attributes away from them")
+	flags.BoolVarP(
+		&c.roleParams.remove.Reissue, "reissue", "", false, "Flags the members whose attributes change to reissue their certificates")
+	return roleRemoveCmd
+}
+
+// The client side logic for listing role information
+func (c *ClientCmd) runListRole(cmd *cobra.Command, args []string) error {
+	log.Debugf("Entered runListRole: %+v", c.roleParams)
+
+	id, err := c.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	if c.roleParams.name != "" {
+		resp, err := id.GetRole(c.roleParams.name, c.clientCfg.CAName)
+		if err != nil {
+			return err
+		}
+
+		printRole(&resp.RoleInfo)
+		return nil
+	}
+
+	resp, err := id.GetAllRoles(c.clientCfg.CAName)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range resp.Roles {
+		printRole(&info)
+	}
+	return nil
+}
+
+// The client side logic for adding a role
+func (c *ClientCmd) runAddRole(cmd *cobra.Command, args []string) error {
+	log.Debugf("Entered runAddRole: %+v", c.roleParams)
+
+	id, err := c.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	req := &api.AddRoleRequest{}
+	req.Name = args[0]
+	req.Attributes = c.clientCfg.ID.Attributes
+	req.CAName = c.clientCfg.CAName
+
+	resp, err := id.AddRole(req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully added role: %s\n", resp.Name)
+
+	return nil
+}
+
+// The client side logic for modifying a role
+func (c *ClientCmd) runModifyRole(cmd *cobra.Command, args []string) error {
+	log.Debugf("Entered runModifyRole: %+v", c.roleParams)
+
+	id, err := c.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	req := &c.roleParams.modify
+	req.Name = args[0]
+	req.Attributes = c.clientCfg.ID.Attributes
+	req.CAName = c.clientCfg.CAName
+
+	resp, err := id.ModifyRole(req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully modified role: %s, Updated members: %v\n", resp.Name, resp.Updated)
+
+	return nil
+}
+
+// The client side logic for removing a role
+func (c *ClientCmd) runRemoveRole(cmd *cobra.Command, args []string) error {
+	log.Debugf("Entered runRemoveRole: %+v", c.roleParams)
+
+	id, err := c.LoadMyIdentity()
+	if err != nil {
+		return err
+	}
+
+	req := &c.roleParams.remove
+	req.Name = args[0]
+	req.CAName = c.clientCfg.CAName
+
+	resp, err := id.RemoveRole(req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully removed role: %s, Updated members: %v\n", resp.Name, resp.Updated)
+
+	return nil
+}
+
+func (c *ClientCmd) rolePreRunE(cmd *cobra.Command, args []string) error {
+	err := argsCheck(args, "role")
+	if err != nil {
+		return err
+	}
+
+	err = c.ConfigInit()
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Client configuration settings: %+v", c.clientCfg)
+
+	return nil
+}
+
+func printRole(info *api.RoleInfo) {
+	attrs := make([]string, len(info.Attributes))
+	for i, a := range info.Attributes {
+		attrs[i] = fmt.Sprintf("%s=%s", a.Name, a.Value)
+		if a.ECert {
+			attrs[i] += ":ecert"
+		}
+	}
+	fmt.Printf("Role: %s, Attributes: [%s], Members: %v\n", info.Name, strings.Join(attrs, ","), info.Members)
+}
@@ -0,0 +1,43 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// newAuditCmd returns the audit command and its subcommands
+func (s *ServerCmd) newAuditCmd() *cobra.Command {
+	var caName string
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Manage the audit logs of the CAs",
+	}
+	auditCmd.PersistentFlags().StringVar(&caName, "caname", "", "Name of the CA (default is the default CA)")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the chain of hashes of the audit log of a CA",
+		Long: "Check that no entry of the audit log of a CA was modified, inserted or removed, by verifying " +
+			"the chain of hashes from its first entry to its last one.",
+	}
+	verifyCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			return errors.Errorf(extraArgsError, args, verifyCmd.UsageString())
+		}
+		n, err := s.getServer().VerifyAuditLog(caName)
+		if err != nil {
+			return err
+		}
+		log.Infof("The audit log is valid; it has %d entries", n)
+		return nil
+	}
+	auditCmd.AddCommand(verifyCmd)
+	return auditCmd
+}
@@ -0,0 +1,140 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// newCACmd returns the ca command and its subcommands
+func (s *ServerCmd) newCACmd() *cobra.Command {
+	var caName string
+	caCmd := &cobra.Command{
+		Use:   "ca",
+		Short: "Manage the CAs and their certificates",
+	}
+	caCmd.PersistentFlags().StringVar(&caName, "caname", "", "Name of the CA (default is the default CA)")
+
+	renewCmd := &cobra.Command{
+		Use:   "renew",
+		Short: "Renew the certificate of a root CA with the same key",
+		Long: "Re-issue the self-signed certificate of a root CA with the same key, subject and validity period, " +
+			"starting now. The server must not be running.",
+	}
+	renewCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			return errors.Errorf(extraArgsError, args, renewCmd.UsageString())
+		}
+		err := s.getServer().RenewCA(caName)
+		if err != nil {
+			return err
+		}
+		log.Info("The CA certificate was renewed; restart the server to use it")
+		return nil
+	}
+	caCmd.AddCommand(renewCmd)
+
+	rolloverCmd := &cobra.Command{
+		Use:   "rollover",
+		Short: "Roll over the key of a CA to a new key and certificate",
+		Long: "Create a new key and certificate for a CA, and cross certificates of the old and new keys, which are " +
+			"added to the CA's chain file. The old key is kept to sign CRLs until its certificate expires. " +
+			"The server must not be running.",
+	}
+	rolloverCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			return errors.Errorf(extraArgsError, args, rolloverCmd.UsageString())
+		}
+		err := s.getServer().RolloverCA(caName)
+		if err != nil {
+			return err
+		}
+		log.Info("The CA key was rolled over; restart the server to use it")
+		return nil
+	}
+	caCmd.AddCommand(rolloverCmd)
+
+	var caFile string
+	addCmd := &cobra.Command{
+		Use:   "add",
+		Short: "Add a CA to the server",
+		Long: "Add a CA with its own home directory and database to the server. The CA is loaded from the " +
+			"configuration file given by --cafile or, if none is given, from a configuration file created in the " +
+			"'ca/<caname>' directory of the server. The CA is served when the server is started or its configuration " +
+			"is reloaded.",
+	}
+	addCmd.Flags().StringVar(&caFile, "cafile", "", "Configuration file of the CA")
+	addCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			return errors.Errorf(extraArgsError, args, addCmd.UsageString())
+		}
+		status, err := s.getServer().AddCA(caName, caFile)
+		if err != nil {
+			return err
+		}
+		log.Infof("Added CA '%s' in %s; start the server or reload its configuration to serve it", status.Name, status.HomeDir)
+		return nil
+	}
+	caCmd.AddCommand(addCmd)
+
+	disableCmd := &cobra.Command{
+		Use:   "disable",
+		Short: "Disable a CA of the server",
+		Long: "Stop serving a CA. The home directory and database of the CA are kept, so the CA can be added again. " +
+			"The CA is no longer served when the server is started or its configuration is reloaded.",
+	}
+	disableCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			return errors.Errorf(extraArgsError, args, disableCmd.UsageString())
+		}
+		if caName == "" {
+			return errors.New("The --caname option is required")
+		}
+		_, err := s.getServer().DisableCA(caName)
+		if err != nil {
+			return err
+		}
+		log.Infof("Disabled CA '%s'; restart the server or reload its configuration to stop serving it", caName)
+		return nil
+	}
+	caCmd.AddCommand(disableCmd)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the CAs of the server",
+	}
+	listCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			return errors.Errorf(extraArgsError, args, listCmd.UsageString())
+		}
+		cas, err := s.getServer().ListCAs()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSTATUS\tHOME")
+		for _, ca := range cas {
+			status := "enabled"
+			if !ca.Enabled {
+				status = "disabled"
+			}
+			if ca.Default {
+				status += " (default)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", ca.Name, status, ca.HomeDir)
+		}
+		return w.Flush()
+	}
+	caCmd.AddCommand(listCmd)
+	return caCmd
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
 	"github.com/hyperledger/fabric-ca/lib"
 	"github.com/hyperledger/fabric-ca/lib/metadata"
+	"github.com/hyperledger/fabric-ca/lib/server/oidc"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
 	"github.com/pkg/errors"
 )
@@ -85,6 +86,47 @@ debug: false
 # Size limit of an acceptable CRL in bytes (default: 512000)
 crlsizelimit: 512000
 
+# Serve the EST (RFC 7030) endpoints cacerts, simpleenroll, simplereenroll
+# and csrattrs under /.well-known/est/ on the server's listening port. A CA
+# other than the default one is selected with a CA label, for example
+# /.well-known/est/<caname>/simpleenroll. simpleenroll is authenticated with
+# basic authentication and simplereenroll with a fabric-ca token.
+est:
+  enabled: false
+
+# Limits the rate of requests to the API endpoints with token buckets: each
+# client can make 'burst' requests at once, and then 'rate' requests per
+# minute. 'identity' limits the requests of each authenticated enrollment ID
+# of each CA, 'ip' the requests from each client IP address and 'endpoints'
+# the requests from all clients to an endpoint, such as 'enroll',
+# 'register' or 'certificates'. A rate of 0 disables a limit. Requests which
+# exceed a limit get a 429 (Too Many Requests) response with a Retry-After
+# header, and are counted by the api_request_throttled metric.
+ratelimit:
+  enabled: false
+  identity:
+    rate: 600
+    burst: 100
+  ip:
+    rate: 1200
+    burst: 200
+  endpoints:
+#    - name: enroll
+#      rate: 60
+#      burst: 10
+
+# Rejects replayed x509 authorization tokens. A token carries the time at
+# which it was created and a random nonce; the server rejects the tokens
+# whose time differs from its own by more than 'clockskew', and remembers
+# the nonces until the tokens expire to reject the tokens which are used
+# again. 'noncestore' is 'db' to remember the nonces in the database of the
+# CA, which the servers of a cluster share, or 'memory'. Tokens without a time
+# and nonce, from clients of version 1.4 and earlier, are accepted unless the
+# FABRIC_CA_SERVER_COMPATIBILITY_MODE_V1_4 environment variable is false.
+token:
+  clockskew: 5m
+  noncestore: db
+
 #############################################################################
 #  TLS section for the server's listening port
 #
@@ -136,6 +178,127 @@ crl:
   # specified by this property is added to the UTC time, the resulting time
   # is used to set the 'Next Update' date of the CRL.
   expiry: 24h
+  # When the publisher is enabled, the CRL is regenerated on the interval and
+  # after each revocation, written to the file and served without
+  # authentication at the /api/v1/crl endpoint.
+  publish:
+    enabled: false
+    interval: 1h
+    file: crl.pem
+
+#############################################################################
+#  OCSP section
+#  When enabled, the CA answers OCSP requests for the certificates it issued
+#  at the /api/v1/ocsp endpoint. Responses are signed by the CA unless a
+#  delegated OCSP signing certificate, issued by the CA with the OCSP signing
+#  extended key usage, and its key are specified.
+#############################################################################
+ocsp:
+  enabled: false
+  certfile:
+  keyfile:
+  # Specifies how long an OCSP response is valid. The duration is added to the
+  # time the response is signed to set its 'Next Update' date; signed responses
+  # are cached in the database until then or until the certificate is revoked.
+  expiry: 24h
+  # Serve the OCSP responder on the operations listener too, at /ocsp
+  operations: false
+
+#############################################################################
+#  ACME section
+#  When enabled, the CA issues TLS certificates to ACME (RFC 8555) clients
+#  at /acme/directory, or /acme/ca/<caname>/directory for a CA other than
+#  the default CA. ACME accounts must be bound to an identity with an
+#  external account binding key, which the identity gets from the
+#  /api/v1/acmeaccounts endpoint. Certificates are issued to the identity
+#  for the DNS names validated by http-01 or dns-01 challenges.
+#############################################################################
+acme:
+  enabled: false
+  # Signing profile used to issue the certificates; the default profile is
+  # used if not set
+  profile:
+  # Port on which http-01 challenges are validated; only change it from the
+  # standard port 80 for testing
+  httpport: 80
+  # Specifies how long orders and their authorizations are valid
+  expiry: 24h
+
+#############################################################################
+#  Audit section
+#  When enabled, every request to the /api/v1 endpoints of the CA, such as
+#  register, enroll, revoke and identity and affiliation changes, is
+#  recorded in an append-only audit log: the caller, the CA, the action, its
+#  target, a hash of the request and the result. Each entry holds the hash of
+#  the previous one, so that changes can be detected with the
+#  'fabric-ca-server audit verify' command. Registrars can read the audit log
+#  from the /api/v1/audit endpoint.
+#############################################################################
+audit:
+  enabled: false
+  # File the audit log is written to, one JSON entry per line; the audit log
+  # is stored in the audit_log table of the CA's database if not set
+  file:
+
+#############################################################################
+#  Webhooks section
+#  When enabled, the CA posts JSON events to the endpoints when certificates
+#  are issued or revoked and when identities and affiliations are
+#  registered, added, modified or removed. Events are first stored in the
+#  webhook_events table of the CA's database and are retried until the
+#  endpoint accepts them with a 2xx status or they expire, so an event may
+#  be delivered more than once. The body of each event is signed with the
+#  secret of the endpoint; the signature is in the X-Fabric-CA-Signature
+#  header as 'sha256=<hex-encoded HMAC-SHA256>'.
+#############################################################################
+webhooks:
+  enabled: false
+  # Timeout of the delivery of an event to an endpoint
+  timeout: 10s
+  # Interval after which a failed delivery is first retried; the interval
+  # doubles with each failed attempt, up to an hour
+  retryinterval: 30s
+  # Time after which an event that could not be delivered is discarded
+  expiry: 168h
+  # The endpoints the events are sent to. 'events' lists the types of the
+  # events sent to an endpoint, such as 'certificate.issued' or 'identity.*';
+  # all events are sent if it is empty. 'tls.certfiles' are the trusted root
+  # certificates of an https endpoint; the system's roots are used if empty.
+  endpoints:
+#    - url: https://hooks.example.com/fabric-ca
+#      secret: hooksecret
+#      events:
+#        - certificate.*
+#        - identity.*
+#      tls:
+#        certfiles:
+#        client:
+#          certfile:
+#          keyfile:
+
+#############################################################################
+#  Approvals section
+#  Requests to which an approval policy applies do not run at once: they are
+#  stored in the approvals table of the CA's database until as many other
+#  registrars as the policy requires approve them, and then run as the
+#  registrar who made them with the usual authorization checks. The operations
+#  of a policy are 'register' (register requests and requests to add an
+#  identity), 'modify' (requests to modify an identity) and 'revoke'. If
+#  'attributes' is set, the policy only applies to the requests which
+#  register or modify an identity with any of the attributes, or which
+#  revoke an identity, or a certificate of an identity, which has any of them.
+#############################################################################
+approvals:
+  # Time after which a request pending approval can no longer be approved
+  expiry: 168h
+  policies:
+#    - name: registrars
+#      operations:
+#        - register
+#        - modify
+#      attributes:
+#        - hf.Registrar.Roles
+#      approvals: 2
 
 #############################################################################
 #  The registry section controls how the fabric-ca-server does two things:
@@ -151,12 +314,92 @@ crl:
 #     calls the LDAP server to perform these tasks.
 #     This is true if "ldap.enabled" in the ldap section below is true,
 #     which means this "registry" section is ignored.
+#  An OpenID Connect identity provider may also be the registry; see the
+#  oidc section below.
 #############################################################################
 registry:
   # Maximum number of times a password/secret can be reused for enrollment
   # (default: -1, which means there is no limit)
   maxenrollments: -1
 
+  # Maximum and default time for which a secret is valid after it is issued by
+  # a registration or a secret reset; a registration may ask for a shorter time.
+  # (default: 0, which means that secrets do not expire)
+  secretexpiry: 0
+
+  # The policy which the secrets chosen by registrars, in a registration or a
+  # modification of an identity, must follow. Generated secrets are at least
+  # "minlength" characters long. The secrets of the identities below are not
+  # checked. The deny list is not case sensitive.
+  passwordpolicy:
+    # Minimum number of characters (default: 0)
+    minlength: 0
+    # Minimum number of the classes lowercase letters, uppercase letters,
+    # digits and other characters that a secret must contain (default: 0)
+    charclasses: 0
+    # Secrets which are not allowed
+    denylist:
+    # File which lists secrets which are not allowed, one per line; lines
+    # starting with '#' are ignored
+    denyfile:
+
+  # How the secrets of identities are stored. The algorithm is "bcrypt" or
+  # "argon2id". The cost is the cost of bcrypt (default: 10), or the number of
+  # passes of argon2id (default: 3); 0 uses the default of the algorithm.
+  # When the algorithm or cost is changed, the stored hash of a secret is
+  # upgraded the next time the secret is used successfully.
+  passwordhash:
+    algorithm: bcrypt
+    cost: 0
+
+  # Time-based one-time passwords (TOTP, RFC 6238) which identities enroll with
+  # in addition to their secret. An identity which has a TOTP seed must send a
+  # TOTP of its seed to enroll. A registrar gives an identity a seed when it
+  # registers it with "totp" set, or later with the "identity totp" command.
+  # Identities registered with, or modified to have, any of the "attributes"
+  # below with a value other than "false" are given a seed which cannot be
+  # removed. The seeds are encrypted with the key of "keyfile", which is created
+  # if it does not exist and must be shared by the servers of a cluster. "skew"
+  # is the number of 30 second time steps before and after the current one in
+  # which a TOTP is accepted. "issuer" is the issuer of the key URIs of the
+  # seeds, which is the name of the CA by default.
+  totp:
+    keyfile: totp.key
+    attributes:
+    skew: 1
+    issuer:
+
+  # Schemas of custom attributes, which are checked when identities are
+  # registered, added or modified, and when attributes are read from LDAP.
+  # "type" is "string" (the default), "int", "bool", "enum" or "list" (a
+  # comma-separated list). "values" are the allowed values, or the allowed
+  # elements of a list, and "regex" is a regular expression which the whole
+  # value, or each element of a list, must match. "requiredfor" lists the
+  # types of identities which must have the attribute ("*" for all types),
+  # and an "immutable" attribute cannot be changed or removed once it is set.
+  # The schemas are returned by the cainfo endpoint. For example:
+  #   attributeschemas:
+  #     - name: department
+  #       type: enum
+  #       values: [sales, engineering]
+  #       requiredfor: [client, user]
+  #     - name: employeeid
+  #       regex: "[0-9]{6}"
+  #       immutable: true
+  attributeschemas:
+
+  # Roles are named sets of attributes. An identity is given the attributes
+  # of the roles listed in its 'hf.Roles' attribute, and changing a role
+  # updates all of its members. The roles below are added when the server
+  # starts if they do not exist; after that, they are managed with the
+  # 'role' command of the client. For example:
+  #   roles:
+  #     - name: auditor
+  #       attrs:
+  #         department: audit
+  #         hf.GenCRL: true
+  roles:
+
   # Contains identity information which is used when LDAP is disabled
   identities:
      - name: <<<ADMIN>>>
@@ -171,6 +414,7 @@ registry:
           hf.GenCRL: true
           hf.Registrar.Attributes: "*"
           hf.AffiliationMgr: true
+          hf.RoleMgr: true
 
 #############################################################################
 #  Database section
@@ -252,6 +496,113 @@ ldap:
             - name:
               value:
 
+#############################################################################
+#  OpenID Connect section
+#  If OpenID Connect is enabled, an enroll request may authenticate with an
+#  ID token of the identity provider instead of an enrollment secret, in an
+#  "Authorization: Bearer <token>" header. The enrollment ID, affiliation and
+#  attributes of the identity are mapped from the claims of the token.
+#  There are two modes:
+#  1) alongside - the identity of a token is added to the registry of the
+#     fabric-ca-server when it first enrolls, and its attributes are updated
+#     from the claims when it enrolls again. Identities with enrollment
+#     secrets can still enroll.
+#  2) registry - the identity provider is the registry, as an LDAP server is
+#     when LDAP is enabled, so the "registry" section is ignored. LDAP must
+#     not be enabled.
+#############################################################################
+oidc:
+   # Enables or disables enrollment with ID tokens (default: false)
+   enabled: false
+   # 'alongside' or 'registry' (default: alongside)
+   mode: alongside
+   # The 'iss' claim of the ID tokens
+   issuer:
+   # A value of the 'aud' claim of the ID tokens, usually the client ID of
+   # the CA at the identity provider
+   audience:
+   # The JSON web key set with the public keys which sign the ID tokens,
+   # either in a file or at a URL. The key set of the URL is fetched again
+   # every 'jwksrefresh', and when a token is signed with an unknown key.
+   jwksfile:
+   jwksurl:
+   jwksrefresh: 1h
+   # Maximum difference between the times of the ID tokens and the time of
+   # the server
+   clockskew: 1m
+   # The type of the identities of the ID tokens
+   usertype: client
+   # TLS configuration for the connection to the JSON web key set URL; the
+   # trusted roots of the system are used if no certfiles are given
+   tls:
+      certfiles:
+      client:
+         certfile:
+         keyfile:
+   # The claims whose values are the enrollment ID and the affiliation of
+   # the identity; the root affiliation if no affiliation claim is set. In
+   # alongside mode, the affiliation must be defined.
+   claims:
+      enrollmentid: sub
+      affiliation:
+   # Mapping of the claims to attributes, as for LDAP. The values of the
+   # claims in 'names' become attributes of the same names; the values of
+   # array claims are separated by commas. The expressions of 'converters'
+   # use 'claim("name")' in place of 'attr("name")', and may use the 'map'
+   # function with the maps of the 'maps' section. For example, the
+   # following makes identities in the 'admins' group of the 'groups' claim
+   # revokers.
+   #    converters:
+   #       - name: hf.Revoker
+   #         value: claim("groups") =~ "admins"
+   attribute:
+      names: ['email']
+      converters:
+         - name:
+           value:
+      maps:
+         groups:
+            - name:
+              value:
+
+#############################################################################
+#  External CA section
+#  If enabled, an enroll request may authenticate with a certificate issued
+#  by a trusted external CA, such as a corporate CA or the CA of a partner
+#  organization, instead of an enrollment secret. The certificate is either
+#  in an x509 token of the authorization header, signed with its private key,
+#  or is the TLS client certificate of a request without an authorization
+#  header; the latter requires 'tls.clientauth.type' to request client
+#  certificates. The certificate is mapped to the enrollment ID of an
+#  identity of the registry.
+#############################################################################
+externalca:
+   # Enables or disables enrollment with the certificates of external CAs
+   # (default: false)
+   enabled: false
+   # PEM-encoded certificates of the external CAs. The self-signed
+   # certificates are trusted, and the others are intermediate CAs which
+   # chain to them.
+   certfiles:
+   # The field of the certificate which is mapped to the enrollment ID:
+   # 'cn' for the common name of the subject, or 'email', 'dns' or 'uri' for
+   # the subject alternative names. If 'pattern' is set, the first value of
+   # the field which matches the regular expression is used, and the
+   # enrollment ID is its first group, if it has one. For example, the
+   # pattern '(.+)@example\.com' maps 'user1@example.com' to 'user1'.
+   # Without a pattern, a certificate only maps to an identity which was
+   # registered automatically for a certificate of an external CA.
+   mapping:
+      source: cn
+      pattern:
+   # If enabled, the identity of a certificate which is not in the registry
+   # is registered, with the following affiliation and type, when it first
+   # enrolls; otherwise, it must have been registered
+   autoregister:
+      enabled: false
+      affiliation:
+      type: client
+
 #############################################################################
 # Affiliations section. Fabric CA server can be bootstrapped with the
 # affiliations specified in this section. Affiliations are specified as maps.
@@ -378,6 +729,24 @@ idemix:
   #  The value is expressed in the time.Duration format (see https://golang.org/pkg/time/#ParseDuration)
   noncesweepinterval: 15m
 
+###########################################################################
+# Each CA derives a CP-ABE private key for every enrollment request whose
+# certificate carries attributes. This section controls how those keys are
+# derived.
+###########################################################################
+cpabe:
+  # Maximum number of CP-ABE keys that are derived at the same time. Requests
+  # above this limit wait for a free worker. By default, it is the number of CPUs.
+  workers:
+
+  # Number of derived CP-ABE keys that are cached in memory, keyed by the
+  # attribute set of the key, so that reenrolling with unchanged attributes does
+  # not derive the key again. The cache is disabled by default: a cached key is
+  # returned to every identity with the same attributes, which gives up the
+  # per-identity randomness of the keys that keeps identities from colluding.
+  # Enable it only if that is acceptable.
+  cachesize: 0
+
 #############################################################################
 # BCCSP (BlockChain Crypto Service Provider) section is used to select which
 # crypto library implementation to use
@@ -564,8 +933,14 @@ func (s *ServerCmd) configInit() (err error) {
 		log.Infof("Configuration file location: %s", s.cfgFileName)
 	}
 
+	return s.readConfig(s.cfg)
+}
+
+// readConfig reads the configuration file into cfg, applying the flags and
+// environment variables
+func (s *ServerCmd) readConfig(cfg *lib.ServerConfig) error {
 	// Read the config
-	err = lib.UnmarshalConfig(s.cfg, s.myViper, s.cfgFileName, true)
+	err := lib.UnmarshalConfig(cfg, s.myViper, s.cfgFileName, true)
 	if err != nil {
 		return err
 	}
@@ -574,7 +949,7 @@ func (s *ServerCmd) configInit() (err error) {
 	if s.myViper.GetBool("operations.tls.enabled") {
 		cf := s.myViper.GetString("operations.tls.cert.file")
 		if cf == "" {
-			cf = s.cfg.Operations.TLS.CertFile
+			cf = cfg.Operations.TLS.CertFile
 		}
 		if !filepath.IsAbs(cf) {
 			cf = filepath.Join(s.homeDirectory, cf)
@@ -582,11 +957,11 @@ func (s *ServerCmd) configInit() (err error) {
 		if !util.FileExists(cf) {
 			return errors.Errorf("failed to read certificate file: %s", cf)
 		}
-		s.cfg.Operations.TLS.CertFile = cf
+		cfg.Operations.TLS.CertFile = cf
 
 		kf := s.myViper.GetString("operations.tls.key.file")
 		if kf == "" {
-			kf = s.cfg.Operations.TLS.KeyFile
+			kf = cfg.Operations.TLS.KeyFile
 		}
 		if !filepath.IsAbs(kf) {
 			kf = filepath.Join(s.homeDirectory, kf)
@@ -594,7 +969,7 @@ func (s *ServerCmd) configInit() (err error) {
 		if !util.FileExists(kf) {
 			return errors.Errorf("failed to read key file: %s", kf)
 		}
-		s.cfg.Operations.TLS.KeyFile = kf
+		cfg.Operations.TLS.KeyFile = kf
 	}
 
 	// The pathlength field controls how deep the CA hierarchy when requesting
@@ -602,14 +977,14 @@ func (s *ServerCmd) configInit() (err error) {
 	// true as CFSSL expects.
 	pl := "csr.ca.pathlength"
 	if s.myViper.IsSet(pl) && s.myViper.GetInt(pl) == 0 {
-		s.cfg.CAcfg.CSR.CA.PathLenZero = true
+		cfg.CAcfg.CSR.CA.PathLenZero = true
 	}
 	// The maxpathlen field controls how deep the CA hierarchy when issuing
 	// a CA certificate. If it is explicitly set to 0, set the PathLenZero
 	// field to true as CFSSL expects.
 	pl = "signing.profiles.ca.caconstraint.maxpathlen"
 	if s.myViper.IsSet(pl) && s.myViper.GetInt(pl) == 0 {
-		s.cfg.CAcfg.Signing.Profiles["ca"].CAConstraint.MaxPathLenZero = true
+		cfg.CAcfg.Signing.Profiles["ca"].CAConstraint.MaxPathLenZero = true
 	}
 
 	return nil
@@ -621,7 +996,9 @@ func (s *ServerCmd) createDefaultConfigFile() error {
 	// by using LDAP authentication; therefore, no bootstrap username and password
 	// are required.
 	ldapEnabled := s.myViper.GetBool("ldap.enabled")
-	if !ldapEnabled {
+	// Nor are they when an OpenID Connect identity provider is the registry
+	oidcRegistry := s.myViper.GetBool("oidc.enabled") && s.myViper.GetString("oidc.mode") == oidc.RegistryMode
+	if !ldapEnabled && !oidcRegistry {
 		// When LDAP is disabled, the fabric-ca-server functions as its own
 		// identity registry; therefore, we require that the default configuration
 		// file have a bootstrap username and password that is used to enroll a
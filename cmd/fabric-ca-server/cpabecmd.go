@@ -0,0 +1,171 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/cpabe"
+	"github.com/pkg/errors"
+	"github.com/privacy-protection/common/abe/parser"
+	"github.com/spf13/cobra"
+)
+
+// reencryptArgs are the arguments of the cpabe reencrypt command
+type reencryptArgs struct {
+	input     string
+	output    string
+	policy    string
+	newPolicy string
+	oldCert   string
+	newCert   string
+	dryRun    bool
+}
+
+// newCPABECmd returns the cpabe command and its subcommands
+func (s *ServerCmd) newCPABECmd() *cobra.Command {
+	cpabeCmd := &cobra.Command{
+		Use:   "cpabe",
+		Short: "Manage CP-ABE encrypted data",
+	}
+
+	args := &reencryptArgs{}
+	reencryptCmd := &cobra.Command{
+		Use:   "reencrypt",
+		Short: "Re-encrypt CP-ABE ciphertexts under new params or a new policy",
+		Long: "Decrypt CP-ABE ciphertexts with a key derived from the CA's master key and encrypt them " +
+			"again under the params of a new CA certificate and/or a new policy. The server must not be running.",
+	}
+	reencryptCmd.RunE = func(cmd *cobra.Command, cmdArgs []string) error {
+		if len(cmdArgs) > 0 {
+			return errors.Errorf(extraArgsError, cmdArgs, reencryptCmd.UsageString())
+		}
+		return s.reencrypt(args)
+	}
+	flags := reencryptCmd.Flags()
+	flags.StringVarP(&args.input, "input", "i", "", "File or directory of CP-ABE ciphertexts to re-encrypt")
+	flags.StringVarP(&args.output, "output", "o", "", "File or directory to write the re-encrypted ciphertexts to")
+	flags.StringVar(&args.policy, "policy", "", "Policy the ciphertexts are encrypted under")
+	flags.StringVar(&args.newPolicy, "newpolicy", "", "Policy to encrypt the ciphertexts under (default is the current policy)")
+	flags.StringVar(&args.oldCert, "oldcert", "", "CA certificate holding the params the ciphertexts are encrypted under (default is the CA's certificate)")
+	flags.StringVar(&args.newCert, "newcert", "", "CA certificate holding the params to encrypt the ciphertexts under (default is the CA's certificate)")
+	flags.BoolVar(&args.dryRun, "dryrun", false, "Only report which ciphertexts can be re-encrypted without writing anything")
+	cpabeCmd.AddCommand(reencryptCmd)
+	return cpabeCmd
+}
+
+// reencrypt re-encrypts the ciphertexts and prints a report
+func (s *ServerCmd) reencrypt(args *reencryptArgs) error {
+	if args.input == "" {
+		return errors.New("The '--input' option is required")
+	}
+	if args.output == "" && !args.dryRun {
+		return errors.New("The '--output' option is required unless '--dryrun' is set")
+	}
+	if args.policy == "" {
+		return errors.New("The '--policy' option is required")
+	}
+	if args.newPolicy == "" {
+		args.newPolicy = args.policy
+	}
+
+	r, err := s.getReencryptor(args)
+	if err != nil {
+		return err
+	}
+	results, err := r.ReencryptFiles(args.input, args.output, args.dryRun)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Printf("%s: failed: %s\n", result.File, result.Err)
+		case args.dryRun:
+			fmt.Printf("%s: can be re-encrypted\n", result.File)
+		default:
+			fmt.Printf("%s: re-encrypted\n", result.File)
+		}
+	}
+	if args.dryRun {
+		fmt.Printf("%d of %d files can be re-encrypted\n", len(results)-failed, len(results))
+	} else {
+		fmt.Printf("Re-encrypted %d of %d files\n", len(results)-failed, len(results))
+	}
+	if failed > 0 {
+		return errors.Errorf("Failed to re-encrypt %d files", failed)
+	}
+	return nil
+}
+
+// getReencryptor loads the CA's master key and the new params from the
+// CA's keystore and returns a Reencryptor for the policies
+func (s *ServerCmd) getReencryptor(args *reencryptArgs) (*cpabe.Reencryptor, error) {
+	policy, err := parser.ParsePolicy(args.policy)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid policy '%s'", args.policy)
+	}
+	newPolicy, err := parser.ParsePolicy(args.newPolicy)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid policy '%s'", args.newPolicy)
+	}
+
+	caHome := filepath.Dir(s.cfgFileName)
+	csp, err := util.InitBCCSP(&s.cfg.CAcfg.CSP, "", caHome)
+	if err != nil {
+		return nil, err
+	}
+	caCert := s.cfg.CAcfg.CA.Certfile
+	if caCert == "" {
+		caCert = "ca-cert.pem"
+	}
+	oldCert, err := s.certFile(args.oldCert, caCert, caHome)
+	if err != nil {
+		return nil, err
+	}
+	newCert, err := s.certFile(args.newCert, caCert, caHome)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, err := util.BccspBackedCPABEMasterKey(oldCert, csp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to load the CP-ABE master key for '%s'", oldCert)
+	}
+	if masterKey == nil {
+		return nil, errors.Errorf("Certificate '%s' does not contain CP-ABE params", oldCert)
+	}
+	params, err := util.BccspBackedCPABEParams(newCert, csp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to load the CP-ABE params from '%s'", newCert)
+	}
+	if params == nil {
+		return nil, errors.Errorf("Certificate '%s' does not contain CP-ABE params", newCert)
+	}
+
+	return &cpabe.Reencryptor{
+		CSP:       csp,
+		MasterKey: masterKey,
+		Params:    params,
+		Policy:    policy,
+		NewPolicy: newPolicy,
+	}, nil
+}
+
+// certFile returns the absolute path of the certificate file, or of the
+// CA's certificate if file is empty
+func (s *ServerCmd) certFile(file, caCert, caHome string) (string, error) {
+	if file == "" {
+		return util.MakeFileAbs(caCert, caHome)
+	}
+	return filepath.Abs(file)
+}
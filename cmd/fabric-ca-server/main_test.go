@@ -116,6 +116,9 @@ func TestErrors(t *testing.T) {
 		{[]string{cmdName, "start", "--csr.keyrequest.algo", "fakeAlgo"}, "Invalid algorithm: fakeAlgo"},
 		{[]string{cmdName, "start", "--csr.keyrequest.algo", "ecdsa", "--csr.keyrequest.size", "12345"}, "Invalid ECDSA key size: 12345"},
 		{[]string{cmdName, "start", "-c", startYaml, "-b", "user:pass", "ca.key"}, "Unrecognized arguments found"},
+		{[]string{cmdName, "cpabe", "reencrypt", "-c", initYaml, "-b", "user:pass"}, "'--input' option is required"},
+		{[]string{cmdName, "cpabe", "reencrypt", "-c", initYaml, "-b", "user:pass", "-i", "in"}, "'--output' option is required"},
+		{[]string{cmdName, "cpabe", "reencrypt", "-c", initYaml, "-b", "user:pass", "-i", "in", "--dryrun"}, "'--policy' option is required"},
 	}
 
 	for _, e := range errorCases {
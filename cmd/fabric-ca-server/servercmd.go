@@ -18,8 +18,11 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
 	"github.com/hyperledger/fabric-ca/lib"
@@ -37,7 +40,7 @@ const (
 // ServerCmd encapsulates cobra command that provides command line interface
 // for the Fabric CA server and the configuration used by the Fabric CA server
 type ServerCmd struct {
-	// name of the fabric-ca-server command (init, start, version)
+	// name of the fabric-ca-server command (init, start, version, cpabe)
 	name string
 	// rootCmd is the cobra command
 	rootCmd *cobra.Command
@@ -118,7 +121,9 @@ func (s *ServerCmd) init() {
 		if len(args) > 0 {
 			return errors.Errorf(extraArgsError, args, startCmd.UsageString())
 		}
-		err := s.getServer().Start()
+		srv := s.getServer()
+		reloadOnSIGHUP(srv)
+		err := srv.Start()
 		if err != nil {
 			return err
 		}
@@ -134,6 +139,9 @@ func (s *ServerCmd) init() {
 		},
 	}
 	s.rootCmd.AddCommand(versionCmd)
+	s.rootCmd.AddCommand(s.newCPABECmd())
+	s.rootCmd.AddCommand(s.newCACmd())
+	s.rootCmd.AddCommand(s.newAuditCmd())
 	s.registerFlags()
 }
 
@@ -188,5 +196,32 @@ func (s *ServerCmd) getServer() *lib.Server {
 			Config:         &s.cfg.CAcfg,
 			ConfigFilePath: s.cfgFileName,
 		},
+		ConfigLoader: s.loadConfig,
 	}
 }
+
+// loadConfig reads the configuration of the server again when it is reloaded
+func (s *ServerCmd) loadConfig() (*lib.ServerConfig, error) {
+	cfg := &lib.ServerConfig{}
+	err := s.readConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// reloadOnSIGHUP reloads the configuration of the server whenever the
+// process receives SIGHUP
+func reloadOnSIGHUP(srv *lib.Server) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			log.Info("Received SIGHUP")
+			_, err := srv.Reload()
+			if err != nil {
+				log.Errorf("Failed to reload configuration: %s", err)
+			}
+		}
+	}()
+}
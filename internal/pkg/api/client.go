@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package api
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
@@ -26,6 +27,13 @@ type RegistrationRequest struct {
 	// MaxEnrollments is the maximum number of times the secret can
 	// be reused to enroll.
 	MaxEnrollments int `json:"max_enrollments,omitempty" help:"The maximum number of times the secret can be reused to enroll (default CA's Max Enrollment)"`
+	// SecretExpiry is the duration for which the secret is valid, such as
+	// "24h". It defaults to, and may not exceed, the secret expiry of the CA.
+	SecretExpiry string `json:"secret_expiry,omitempty" help:"Duration for which the secret is valid (e.g. 24h) (default CA's Secret Expiry)"`
+	// TOTP requires the identity to enroll with a time-based one-time
+	// password in addition to its secret. The seed of the TOTPs is returned
+	// in the response.
+	TOTP bool `json:"totp,omitempty" help:"Require the identity to enroll with a time-based one-time password (TOTP) in addition to its secret"`
 	// is returned in the response.
 	// The identity's affiliation.
 	// For example, an affiliation of "org1.department1" associates the identity with "department1" in "org1".
@@ -44,6 +52,12 @@ func (rr *RegistrationRequest) String() string {
 type RegistrationResponse struct {
 	// The secret returned from a successful registration response
 	Secret string `json:"secret"`
+	// TOTPSeed is the base32 encoded TOTP seed of an identity which enrolls
+	// with a TOTP
+	TOTPSeed string `json:"totp_seed,omitempty"`
+	// TOTPURI is the key URI of the TOTP seed, which authenticator
+	// applications can import
+	TOTPURI string `json:"totp_uri,omitempty"`
 }
 
 // EnrollmentRequest is a request to enroll an identity
@@ -52,6 +66,19 @@ type EnrollmentRequest struct {
 	Name string `json:"name" skip:"true"`
 	// The secret returned via Register
 	Secret string `json:"secret,omitempty" skip:"true" mask:"password"`
+	// IDToken is an OpenID Connect ID token to authenticate with instead of
+	// the secret
+	IDToken string `json:"-" skip:"true" mask:"password"`
+	// IDTokenFile is the file from which the ID token is read
+	IDTokenFile string `json:"-" help:"File containing an OpenID Connect ID token to enroll with instead of a secret"`
+	// ExternalCertFile is a certificate issued by a trusted external CA,
+	// which with its private key of ExternalKeyFile signs the authorization
+	// token of the request instead of the secret
+	ExternalCertFile string `json:"-" help:"File of a certificate issued by a trusted external CA to enroll with instead of a secret"`
+	ExternalKeyFile  string `json:"-" help:"File of the private key of the certificate issued by a trusted external CA"`
+	// TOTP is the time-based one-time password of an identity which enrolls
+	// with one; it is sent in a header rather than in the request body
+	TOTP string `json:"-" mask:"password" help:"Time-based one-time password (TOTP) of an identity which enrolls with one"`
 	// CAName is the name of the CA to connect to
 	CAName string `json:"caname,omitempty" skip:"true"`
 	// AttrReqs are requests for attributes to add to the certificate.
@@ -110,12 +137,17 @@ type RevocationRequest struct {
 	CAName string `json:"caname,omitempty" skip:"true"`
 	// GenCRL specifies whether to generate a CRL
 	GenCRL bool `def:"false" skip:"true" json:"gencrl,omitempty"`
+	// Release specifies whether to release the certificates on hold, which
+	// are good again, instead of revoking certificates
+	Release bool `def:"false" skip:"true" json:"release,omitempty"`
 }
 
 // RevocationResponse represents response from the server for a revocation request
 type RevocationResponse struct {
 	// RevokedCerts is an array of certificates that were revoked
 	RevokedCerts []RevokedCert
+	// ReleasedCerts is an array of certificates on hold that were released
+	ReleasedCerts []RevokedCert
 	// CRL is PEM-encoded certificate revocation list (CRL) that contains all unexpired revoked certificates
 	CRL []byte
 }
@@ -140,6 +172,34 @@ type GenCRLRequest struct {
 	RevokedBefore time.Time `json:"revokedbefore,omitempty"`
 	ExpireAfter   time.Time `json:"expireafter,omitempty"`
 	ExpireBefore  time.Time `json:"expirebefore,omitempty"`
+	// AKI selects the key of the CA that signs the CRL of the certificates
+	// it issued; it is the current key of the CA if not set
+	AKI string `json:"aki,omitempty"`
+}
+
+// ACMEAccountRequest is a request for the external account binding key of
+// an ACME account bound to an identity
+type ACMEAccountRequest struct {
+	// ID is the identity the account is bound to; it is the caller if not set
+	ID     string `json:"id,omitempty"`
+	CAName string `json:"caname,omitempty" skip:"true"`
+}
+
+// ACMEAccountResponse is the external account binding key of an ACME account
+type ACMEAccountResponse struct {
+	// KeyID is the key identifier the ACME client uses for the binding
+	KeyID string
+	// HMACKey is the base64url encoded HMAC key of the binding
+	HMACKey string
+}
+
+// GetAuditLogRequest is a request for the entries of the audit log of a CA
+type GetAuditLogRequest struct {
+	// From is the sequence number of the first entry; it is 1 if not set
+	From int64
+	// Limit is the maximum number of entries; the server's default if not set
+	Limit  int
+	CAName string
 }
 
 // GenCRLResponse represents a response to get CRL
@@ -170,8 +230,10 @@ type AddIdentityRequest struct {
 	// Secret is an optional password.  If not specified,
 	// a random secret is generated.  In both cases, the secret
 	// is returned in the RegistrationResponse.
-	Secret string `json:"secret,omitempty" mask:"password" help:"The enrollment secret for the identity being added"`
-	CAName string `json:"caname,omitempty" skip:"true"`
+	Secret       string `json:"secret,omitempty" mask:"password" help:"The enrollment secret for the identity being added"`
+	SecretExpiry string `json:"secret_expiry,omitempty" help:"Duration for which the secret is valid (e.g. 24h) (default CA's Secret Expiry)"`
+	TOTP         bool   `json:"totp,omitempty" help:"Require the identity to enroll with a time-based one-time password (TOTP) in addition to its secret"`
+	CAName       string `json:"caname,omitempty" skip:"true"`
 }
 
 // ModifyIdentityRequest represents the request to modify an existing identity on the
@@ -183,7 +245,14 @@ type ModifyIdentityRequest struct {
 	Attributes     []Attribute `mapstructure:"attrs" json:"attrs"`
 	MaxEnrollments int         `mapstructure:"max_enrollments" json:"max_enrollments" help:"The maximum number of times the secret can be reused to enroll"`
 	Secret         string      `json:"secret,omitempty" mask:"password" help:"The enrollment secret for the identity"`
-	CAName         string      `json:"caname,omitempty" skip:"true"`
+	// Suspend suspends the identity, which blocks its requests until it is
+	// resumed; unlike a revocation, a suspension is reversible
+	Suspend bool `json:"suspend,omitempty" help:"Suspend the identity, which blocks its requests until it is resumed"`
+	Resume  bool `json:"resume,omitempty" help:"Resume a suspended identity"`
+	// Hold places the current certificates of the identity on hold when it
+	// is suspended, and releases its certificates on hold when it is resumed
+	Hold   bool   `json:"hold,omitempty" help:"With --suspend, place the current certificates of the identity on hold; with --resume, release them"`
+	CAName string `json:"caname,omitempty" skip:"true"`
 }
 
 // RemoveIdentityRequest represents the request to remove an existing identity from the
@@ -201,6 +270,11 @@ type GetIDResponse struct {
 	Affiliation    string      `json:"affiliation"`
 	Attributes     []Attribute `json:"attrs" mapstructure:"attrs" `
 	MaxEnrollments int         `json:"max_enrollments" mapstructure:"max_enrollments"`
+	SecretState    string      `json:"secret_state,omitempty"`
+	SecretExpiry   *time.Time  `json:"secret_expiry,omitempty"`
+	Suspended      bool        `json:"suspended,omitempty"`
+	Roles          []string    `json:"roles,omitempty"`
+	Reissue        bool        `json:"reissue,omitempty"`
 	CAName         string      `json:"caname,omitempty"`
 }
 
@@ -218,6 +292,9 @@ type IdentityResponse struct {
 	Attributes     []Attribute `json:"attrs,omitempty" mapstructure:"attrs"`
 	MaxEnrollments int         `json:"max_enrollments,omitempty" mapstructure:"max_enrollments"`
 	Secret         string      `json:"secret,omitempty"`
+	TOTPSeed       string      `json:"totp_seed,omitempty"`
+	TOTPURI        string      `json:"totp_uri,omitempty"`
+	Suspended      bool        `json:"suspended,omitempty"`
 	CAName         string      `json:"caname,omitempty"`
 }
 
@@ -228,6 +305,138 @@ type IdentityInfo struct {
 	Affiliation    string      `json:"affiliation"`
 	Attributes     []Attribute `json:"attrs" mapstructure:"attrs"`
 	MaxEnrollments int         `json:"max_enrollments" mapstructure:"max_enrollments"`
+	SecretState    string      `json:"secret_state,omitempty"`
+	SecretExpiry   *time.Time  `json:"secret_expiry,omitempty"`
+	Suspended      bool        `json:"suspended,omitempty"`
+	// Roles are the named roles of the identity, and Reissue is true if a
+	// change of its roles requires it to reissue its certificates
+	Roles   []string `json:"roles,omitempty"`
+	Reissue bool     `json:"reissue,omitempty"`
+}
+
+// ResetSecretRequest represents the request to replace the enrollment secret
+// of an identity with a new random secret. The enrollments made with the old
+// secret no longer count against the maximum enrollments of the identity.
+type ResetSecretRequest struct {
+	ID           string `json:"-" skip:"true"`
+	SecretExpiry string `json:"secret_expiry,omitempty" help:"Duration for which the new secret is valid (e.g. 24h) (default CA's Secret Expiry)"`
+	CAName       string `json:"caname,omitempty" skip:"true"`
+}
+
+// ResetSecretResponse is the response from the reset secret call
+type ResetSecretResponse struct {
+	ID           string     `json:"id"`
+	Secret       string     `json:"secret"`
+	SecretExpiry *time.Time `json:"secret_expiry,omitempty"`
+	CAName       string     `json:"caname,omitempty"`
+}
+
+// TOTPRequest represents the request to give an identity a new TOTP seed,
+// which it must enroll with, or to remove its seed
+type TOTPRequest struct {
+	ID      string `json:"-" skip:"true"`
+	Disable bool   `json:"disable,omitempty" help:"Remove the TOTP seed of the identity, so that it enrolls with its secret alone"`
+	CAName  string `json:"caname,omitempty" skip:"true"`
+}
+
+// TOTPResponse is the response from the TOTP call; the seed and its key URI
+// are empty if the seed was removed
+type TOTPResponse struct {
+	ID       string `json:"id"`
+	TOTPSeed string `json:"totp_seed,omitempty"`
+	TOTPURI  string `json:"totp_uri,omitempty"`
+	CAName   string `json:"caname,omitempty"`
+}
+
+// The status of an entry of a batch request
+const (
+	// BatchRegistered is the status of an identity which was registered
+	BatchRegistered = "registered"
+	// BatchModified is the status of an identity which was modified
+	BatchModified = "modified"
+	// BatchFailed is the status of an entry which is not valid
+	BatchFailed = "failed"
+	// BatchSkipped is the status of a valid entry which was not stored
+	// because another entry of an all-or-nothing batch failed
+	BatchSkipped = "skipped"
+)
+
+// BatchIdentity is an entry of a batch request. It registers a new identity,
+// or modifies an existing identity if Modify is set.
+type BatchIdentity struct {
+	RegistrationRequest
+	// Modify modifies the identity instead of registering it
+	Modify bool `json:"modify,omitempty"`
+}
+
+// BatchRequest represents the request to register or modify many identities
+// in one transaction. Unless BestEffort is set, no identity is stored if any
+// entry is not valid.
+type BatchRequest struct {
+	Identities []BatchIdentity `json:"identities"`
+	BestEffort bool            `json:"best_effort,omitempty"`
+	CAName     string          `json:"caname,omitempty" skip:"true"`
+}
+
+// BatchResult is the result of an entry of a batch request. The secret of a
+// registered identity is returned whether it was chosen or generated.
+type BatchResult struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Secret   string `json:"secret,omitempty"`
+	TOTPSeed string `json:"totp_seed,omitempty"`
+	TOTPURI  string `json:"totp_uri,omitempty"`
+	Code     int    `json:"code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BatchResponse is the response from the batch call, with one result for
+// each entry of the request in the same order
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+	CAName  string        `json:"caname,omitempty"`
+}
+
+// ApprovalInfo is a request which needs the approval of other registrars
+// before it runs. The result is the response of an approved request which
+// ran; it is only returned to the registrar whose approval ran the request.
+type ApprovalInfo struct {
+	ID          string          `json:"id"`
+	Caller      string          `json:"caller"`
+	Operation   string          `json:"operation"`
+	Policy      string          `json:"policy"`
+	Target      string          `json:"target"`
+	Affiliation string          `json:"affiliation"`
+	Type        string          `json:"type"`
+	Required    int             `json:"required_approvals"`
+	ApprovedBy  []string        `json:"approved_by,omitempty"`
+	Status      string          `json:"status"`
+	Reason      string          `json:"reason,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ApprovalResponse is the response from the calls which get, approve or
+// reject a request pending approval
+type ApprovalResponse struct {
+	ApprovalInfo
+	CAName string `json:"caname,omitempty"`
+}
+
+// GetApprovalsResponse is the response from the call which lists the
+// requests pending approval
+type GetApprovalsResponse struct {
+	Approvals []ApprovalInfo `json:"approvals"`
+	CAName    string         `json:"caname,omitempty"`
+}
+
+// RejectApprovalRequest represents the request to reject a request pending
+// approval, which the caller which made it may also do to withdraw it
+type RejectApprovalRequest struct {
+	ID     string `json:"-" skip:"true"`
+	Reason string `json:"reason,omitempty"`
+	CAName string `json:"caname,omitempty" skip:"true"`
 }
 
 // AddAffiliationRequest represents the request to add a new affiliation to the
@@ -269,6 +478,56 @@ type AffiliationInfo struct {
 	Identities   []IdentityInfo    `json:"identities,omitempty"`
 }
 
+// AddRoleRequest represents the request to define a new role, which gives
+// the identities assigned to it its attributes
+type AddRoleRequest struct {
+	Name       string      `json:"name"`
+	Attributes []Attribute `json:"attrs"`
+	CAName     string      `json:"caname,omitempty"`
+}
+
+// ModifyRoleRequest represents the request to change the attributes of a
+// role, which updates the attributes of its members. If Reissue is true,
+// the members whose attributes changed are flagged to reissue their
+// certificates.
+type ModifyRoleRequest struct {
+	Name       string      `json:"-"`
+	Attributes []Attribute `json:"attrs"`
+	Reissue    bool        `json:"reissue,omitempty"`
+	CAName     string      `json:"caname,omitempty"`
+}
+
+// RemoveRoleRequest represents the request to remove a role. A role which
+// has members is only removed if Force is true, which also takes the role
+// and its attributes away from its members.
+type RemoveRoleRequest struct {
+	Name    string
+	Force   bool
+	Reissue bool
+	CAName  string `json:"caname,omitempty"`
+}
+
+// RoleInfo contains the name, attributes and members of a role
+type RoleInfo struct {
+	Name       string      `json:"name"`
+	Attributes []Attribute `json:"attrs"`
+	Members    []string    `json:"members,omitempty"`
+}
+
+// RoleResponse contains the response for get, add, modify, and remove a
+// role. Updated are the members whose attributes the request changed.
+type RoleResponse struct {
+	RoleInfo
+	Updated []string `json:"updated,omitempty"`
+	CAName  string   `json:"caname,omitempty"`
+}
+
+// GetRolesResponse is the response from the call which lists the roles
+type GetRolesResponse struct {
+	Roles  []RoleInfo `json:"roles"`
+	CAName string     `json:"caname,omitempty"`
+}
+
 // CSRInfo is Certificate Signing Request (CSR) Information
 type CSRInfo struct {
 	CN           string        `json:"CN"`
@@ -332,6 +591,23 @@ func (a *Attribute) GetValue() string {
 	return a.Value
 }
 
+// AttributeSchema defines the type and the allowed values of a custom
+// attribute of identities. The type is 'string' (the default), 'int',
+// 'bool', 'enum' or 'list', whose value is a comma-separated list. Values
+// are the allowed values of an enum, and limit those of a string, an int or
+// the elements of a list if set. Regex is a regular expression which a
+// string, or each element of a list, must match. RequiredFor lists the
+// types of the identities which must have the attribute, '*' being all
+// types. An immutable attribute cannot be changed or removed once it is set.
+type AttributeSchema struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type,omitempty"`
+	Values      []string `json:"values,omitempty"`
+	Regex       string   `json:"regex,omitempty"`
+	RequiredFor []string `json:"required_for,omitempty"`
+	Immutable   bool     `json:"immutable,omitempty"`
+}
+
 // AttributeRequest is a request for an attribute.
 // This implements the certmgr/AttributeRequest interface.
 type AttributeRequest struct {
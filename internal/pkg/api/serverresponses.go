@@ -9,6 +9,9 @@ package api
 const (
 	// IdemixTokenVersion1 represents version 1 of the authorization token created using Idemix credential
 	IdemixTokenVersion1 = "1"
+	// TOTPHeader is the HTTP header of an enroll request with the TOTP of
+	// an identity which enrolls with one
+	TOTPHeader = "X-Fabric-CA-TOTP"
 )
 
 // CAInfoResponseNet is the response to the GET /info request
@@ -23,6 +26,9 @@ type CAInfoResponseNet struct {
 	IssuerRevocationPublicKey string
 	// Version of the server
 	Version string
+	// AttributeSchemas are the schemas of the custom attributes of the
+	// identities of the CA
+	AttributeSchemas []AttributeSchema `json:",omitempty"`
 }
 
 // EnrollmentResponseNet is the response to the /enroll request
@@ -9,6 +9,7 @@ package util
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
@@ -26,6 +27,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -127,11 +129,13 @@ func Unmarshal(from []byte, to interface{}, what string) error {
 //      <algorithm,claims,signature>
 // where each part is base64-encoded string separated by a period.
 // In this JWT-like token, there are two differences:
-// 1) the claims section is a certificate, so the format is:
-//      <certificate,signature>
+// 1) the claims section is a certificate, the time at which the token was
+//    created in seconds since the epoch, and a random nonce, so the format is:
+//      <certificate,time,nonce,signature>
 // 2) the signature uses the private key associated with the certificate,
-//    and the signature is across both the certificate and the "body" argument,
-//    which is the body of an HTTP request, though could be any arbitrary bytes.
+//    and the signature is across the method, URI and "body" argument, which
+//    is the body of an HTTP request, though could be any arbitrary bytes,
+//    and the claims. The time and nonce let the server reject replayed tokens.
 // @param cert The pem-encoded certificate
 // @param key The pem-encoded key
 // @param method http method of the request
@@ -164,17 +168,48 @@ func CreateToken(csp bccsp.BCCSP, cert []byte, key bccsp.Key, method, uri string
 	return token, nil
 }
 
-//GenECDSAToken signs the http body and cert with ECDSA using EC private key
+// tokenNonceLen is the number of random bytes of the nonce of a token
+const tokenNonceLen = 16
+
+// TokenNonce is the time at which a token was created and its nonce, which
+// the server uses to reject replayed tokens
+type TokenNonce struct {
+	Time  time.Time
+	Nonce string
+}
+
+//GenECDSAToken signs the http method, URI, body and cert, the current time and
+//a random nonce with ECDSA using EC private key
 func GenECDSAToken(csp bccsp.BCCSP, cert []byte, key bccsp.Key, method, uri string, body []byte) (string, error) {
+	nonce := make([]byte, tokenNonceLen)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to generate token nonce")
+	}
 	b64body := B64Encode(body)
 	b64cert := B64Encode(cert)
 	b64uri := B64Encode([]byte(uri))
-	payload := method + "." + b64uri + "." + b64body + "." + b64cert
+	claims := strconv.FormatInt(time.Now().Unix(), 10) + "." + B64Encode(nonce)
+	payload := method + "." + b64uri + "." + b64body + "." + b64cert + "." + claims
 
-	return genECDSAToken(csp, key, b64cert, payload)
+	b64sig, err := signTokenPayload(csp, key, payload)
+	if err != nil {
+		return "", err
+	}
+	return b64cert + "." + claims + "." + b64sig, nil
 }
 
+// genECDSAToken creates a token without a time and nonce, as created by
+// the clients of version 1.4 and earlier
 func genECDSAToken(csp bccsp.BCCSP, key bccsp.Key, b64cert, payload string) (string, error) {
+	b64sig, err := signTokenPayload(csp, key, payload)
+	if err != nil {
+		return "", err
+	}
+	return b64cert + "." + b64sig, nil
+}
+
+func signTokenPayload(csp bccsp.BCCSP, key bccsp.Key, payload string) (string, error) {
 	digest, digestError := csp.Hash([]byte(payload), &bccsp.SHAOpts{})
 	if digestError != nil {
 		return "", errors.WithMessage(digestError, fmt.Sprintf("Hash failed on '%s'", payload))
@@ -188,11 +223,7 @@ func genECDSAToken(csp bccsp.BCCSP, key bccsp.Key, b64cert, payload string) (str
 		return "", errors.New("BCCSP signature creation failed. Signature must be different than nil")
 	}
 
-	b64sig := B64Encode(ecSignature)
-	token := b64cert + "." + b64sig
-
-	return token, nil
-
+	return B64Encode(ecSignature), nil
 }
 
 // VerifyToken verifies token signed by either ECDSA or RSA and
@@ -200,55 +231,93 @@ func genECDSAToken(csp bccsp.BCCSP, key bccsp.Key, b64cert, payload string) (str
 //
 // TODO(mjs): Move to consumer (lib/serverRequestContextImpl#verifyX509Token)
 func VerifyToken(csp bccsp.BCCSP, token string, method, uri string, body []byte, compMode1_3 bool) (*x509.Certificate, error) {
+	cert, _, err := VerifyTokenNonce(csp, token, method, uri, body, compMode1_3)
+	return cert, err
+}
+
+// VerifyTokenNonce verifies token signed by either ECDSA or RSA and returns
+// the associated certificate, along with the time and nonce of the token;
+// the TokenNonce is nil if the token was created by a client of version 1.4
+// or earlier, which has no time and nonce
+func VerifyTokenNonce(csp bccsp.BCCSP, token string, method, uri string, body []byte, compMode1_3 bool) (*x509.Certificate, *TokenNonce, error) {
 	if csp == nil {
-		return nil, errors.New("BCCSP instance is not present")
+		return nil, nil, errors.New("BCCSP instance is not present")
+	}
+	var tokenNonce *TokenNonce
+	var claims string
+	parts := strings.Split(token, ".")
+	if len(parts) == 4 {
+		var err error
+		tokenNonce, err = decodeTokenNonce(parts[1], parts[2])
+		if err != nil {
+			return nil, nil, err
+		}
+		claims = "." + parts[1] + "." + parts[2]
+		token = parts[0] + "." + parts[3]
 	}
 	x509Cert, b64Cert, b64Sig, err := decodeToken(token)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	sig, err := B64Decode(b64Sig)
 	if err != nil {
-		return nil, errors.WithMessage(err, "Invalid base64 encoded signature in token")
+		return nil, nil, errors.WithMessage(err, "Invalid base64 encoded signature in token")
 	}
 	b64Body := B64Encode(body)
 	b64uri := B64Encode([]byte(uri))
-	sigString := method + "." + b64uri + "." + b64Body + "." + b64Cert
+	sigString := method + "." + b64uri + "." + b64Body + "." + b64Cert + claims
 
 	pk2, err := csp.KeyImport(x509Cert, &bccsp.X509PublicKeyImportOpts{Temporary: true})
 	if err != nil {
-		return nil, errors.WithMessage(err, "Public Key import into BCCSP failed with error")
+		return nil, nil, errors.WithMessage(err, "Public Key import into BCCSP failed with error")
 	}
 	if pk2 == nil {
-		return nil, errors.New("Public Key Cannot be imported into BCCSP")
+		return nil, nil, errors.New("Public Key Cannot be imported into BCCSP")
 	}
 
 	//bccsp.X509PublicKeyImportOpts
 	//Using default hash algo
 	digest, digestError := csp.Hash([]byte(sigString), &bccsp.SHAOpts{})
 	if digestError != nil {
-		return nil, errors.WithMessage(digestError, "Message digest failed")
+		return nil, nil, errors.WithMessage(digestError, "Message digest failed")
 	}
 
 	valid, validErr := csp.Verify(pk2, sig, digest, nil)
-	if compMode1_3 && !valid {
+	if compMode1_3 && !valid && tokenNonce == nil {
 		log.Debugf("Failed to verify token based on new authentication header requirements: %s", err)
 		sigString := b64Body + "." + b64Cert
 		digest, digestError := csp.Hash([]byte(sigString), &bccsp.SHAOpts{})
 		if digestError != nil {
-			return nil, errors.WithMessage(digestError, "Message digest failed")
+			return nil, nil, errors.WithMessage(digestError, "Message digest failed")
 		}
 		valid, validErr = csp.Verify(pk2, sig, digest, nil)
 	}
 
 	if validErr != nil {
-		return nil, errors.WithMessage(validErr, "Token signature validation failure")
+		return nil, nil, errors.WithMessage(validErr, "Token signature validation failure")
 	}
 	if !valid {
-		return nil, errors.New("Token signature validation failed")
+		return nil, nil, errors.New("Token signature validation failed")
 	}
 
-	return x509Cert, nil
+	return x509Cert, tokenNonce, nil
+}
+
+// decodeTokenNonce decodes the time and base64 encoded nonce of a token
+func decodeTokenNonce(timestamp, b64nonce string) (*TokenNonce, error) {
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid time in token")
+	}
+	nonce, err := B64Decode(b64nonce)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid base64 encoded nonce in token")
+	}
+	if len(nonce) < tokenNonceLen || len(nonce) > 4*tokenNonceLen {
+		return nil, errors.Errorf("Invalid nonce in token; it must have between %d and %d bytes", tokenNonceLen, 4*tokenNonceLen)
+	}
+	// Encode the nonce again so that every encoding of it is the same nonce
+	return &TokenNonce{Time: time.Unix(secs, 0), Nonce: B64Encode(nonce)}, nil
 }
 
 // decodeToken extracts an X509 certificate and base64 encoded signature from a token
@@ -258,7 +327,7 @@ func decodeToken(token string) (*x509.Certificate, string, string, error) {
 	}
 	parts := strings.Split(token, ".")
 	if len(parts) != 2 {
-		return nil, "", "", errors.New("Invalid token format; expecting 2 parts separated by '.'")
+		return nil, "", "", errors.New("Invalid token format; expecting 2 or 4 parts separated by '.'")
 	}
 	b64cert := parts[0]
 	certDecoded, err := B64Decode(b64cert)
@@ -21,6 +21,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp/factory"
 	"github.com/spf13/viper"
@@ -73,6 +74,38 @@ func TestECCreateToken(t *testing.T) {
 	_, err = VerifyToken(bccsp, tok, "GET", "/enroll", append(body, byte('T')), false)
 	assert.Error(t, err, "VerifyToken should have failed as the body was changed")
 
+	// The token carries the time at which it was created and a nonce
+	_, tn, err := VerifyTokenNonce(bccsp, tok, "GET", "/enroll", body, false)
+	assert.NoError(t, err, "VerifyTokenNonce failed")
+	if assert.NotNil(t, tn) {
+		assert.WithinDuration(t, time.Now(), tn.Time, time.Minute)
+		assert.NotEmpty(t, tn.Nonce)
+	}
+	tok2, err := CreateToken(bccsp, cert, privKey, "GET", "/enroll", body)
+	assert.NoError(t, err, "CreateToken failed")
+	_, tn2, err := VerifyTokenNonce(bccsp, tok2, "GET", "/enroll", body, false)
+	assert.NoError(t, err, "VerifyTokenNonce failed")
+	if tn != nil && assert.NotNil(t, tn2) {
+		assert.NotEqual(t, tn.Nonce, tn2.Nonce, "Each token should have its own nonce")
+	}
+	parts := strings.Split(tok, ".")
+	parts[1] = "1"
+	_, err = VerifyToken(bccsp, strings.Join(parts, "."), "GET", "/enroll", body, false)
+	assert.Error(t, err, "VerifyToken should have failed as the time was changed")
+	parts = strings.Split(tok, ".")
+	parts[2] = B64Encode([]byte("short"))
+	_, err = VerifyToken(bccsp, strings.Join(parts, "."), "GET", "/enroll", body, false)
+	assert.Error(t, err, "VerifyToken should have failed as the nonce is too short")
+
+	// A token of a 1.4 client has no time and nonce
+	b64Cert := B64Encode(cert)
+	payload := "GET." + B64Encode([]byte("/enroll")) + "." + B64Encode(body) + "." + b64Cert
+	legacyToken, err := genECDSAToken(bccsp, privKey, b64Cert, payload)
+	FatalError(t, err, "Failed to create token")
+	_, tn, err = VerifyTokenNonce(bccsp, legacyToken, "GET", "/enroll", body, false)
+	assert.NoError(t, err, "Failed to verify token of a 1.4 client")
+	assert.Nil(t, tn)
+
 	ski, err := ioutil.ReadFile(filepath.Join("testdata", "ec-key.ski"))
 	assert.NoError(t, err, "failed to read ec-key.ski")
 
@@ -81,8 +114,7 @@ func TestECCreateToken(t *testing.T) {
 	assert.Equal(t, "", tok)
 
 	// With comptability mode disabled, using old token should fail
-	b64Cert := B64Encode(cert)
-	payload := B64Encode(body) + "." + b64Cert
+	payload = B64Encode(body) + "." + b64Cert
 	oldToken, err := genECDSAToken(bccsp, privKey, b64Cert, payload)
 	FatalError(t, err, "Failed to create token")
 	_, err = VerifyToken(bccsp, oldToken, "GET", "/enroll", body, false)
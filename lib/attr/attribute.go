@@ -48,6 +48,9 @@ const (
 	EnrollmentID   = "hf.EnrollmentID"
 	Type           = "hf.Type"
 	Affiliation    = "hf.Affiliation"
+	RoleMgr        = "hf.RoleMgr"
+	AssignedRoles  = "hf.Roles"
+	ProvisionedBy  = "hf.ProvisionedBy"
 )
 
 // CanRegisterRequestedAttributes validates that the registrar can register the requested attributes
@@ -108,7 +111,7 @@ var attributeMap = initAttrs()
 func initAttrs() map[string]*attributeControl {
 	var attributeMap = make(map[string]*attributeControl)
 
-	booleanAttributes := []string{Revoker, IntermediateCA, GenCRL, AffiliationMgr}
+	booleanAttributes := []string{Revoker, IntermediateCA, GenCRL, AffiliationMgr, RoleMgr}
 
 	for _, attr := range booleanAttributes {
 		attributeMap[attr] = &attributeControl{
@@ -128,7 +131,7 @@ func initAttrs() map[string]*attributeControl {
 		}
 	}
 
-	fixedValueAttributes := []string{EnrollmentID, Type, Affiliation}
+	fixedValueAttributes := []string{EnrollmentID, Type, Affiliation, ProvisionedBy}
 
 	for _, attr := range fixedValueAttributes {
 		attributeMap[attr] = &attributeControl{
@@ -138,6 +141,14 @@ func initAttrs() map[string]*attributeControl {
 		}
 	}
 
+	// The roles of an identity are checked by checking the attributes
+	// they give it
+	attributeMap[AssignedRoles] = &attributeControl{
+		name:              AssignedRoles,
+		requiresOwnership: false,
+		attrType:          CUSTOM,
+	}
+
 	return attributeMap
 }
 
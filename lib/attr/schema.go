@@ -0,0 +1,235 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package attr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/pkg/errors"
+)
+
+// The types of the values of custom attributes
+const (
+	// SchemaString is the type of an attribute whose value is any string
+	SchemaString = "string"
+	// SchemaInt is the type of an attribute whose value is an integer
+	SchemaInt = "int"
+	// SchemaBool is the type of an attribute whose value is a boolean
+	SchemaBool = "bool"
+	// SchemaEnum is the type of an attribute whose value is one of a set
+	SchemaEnum = "enum"
+	// SchemaList is the type of an attribute whose value is a comma-separated
+	// list
+	SchemaList = "list"
+)
+
+// Schemas checks the values of custom attributes against their schemas
+type Schemas struct {
+	list    []api.AttributeSchema
+	schemas map[string]*schema
+}
+
+type schema struct {
+	api.AttributeSchema
+	regex *regexp.Regexp
+}
+
+// NewSchemas returns the checker of the attribute schemas, or an error if a
+// schema is not valid
+func NewSchemas(cfg []api.AttributeSchema) (*Schemas, error) {
+	s := &Schemas{
+		list:    cfg,
+		schemas: map[string]*schema{},
+	}
+	for _, c := range cfg {
+		if c.Name == "" {
+			return nil, errors.New("Attribute schema has no name")
+		}
+		if strings.HasPrefix(c.Name, "hf.") {
+			return nil, errors.Errorf("Attribute schema '%s' uses the reserved prefix 'hf.'", c.Name)
+		}
+		if s.schemas[c.Name] != nil {
+			return nil, errors.Errorf("Attribute '%s' has more than one schema", c.Name)
+		}
+		sc := &schema{AttributeSchema: c}
+		if sc.Type == "" {
+			sc.Type = SchemaString
+		}
+		switch sc.Type {
+		case SchemaString, SchemaInt, SchemaList:
+		case SchemaBool:
+			if len(sc.Values) > 0 || sc.Regex != "" {
+				return nil, errors.Errorf("Boolean attribute '%s' cannot have values or a regex", c.Name)
+			}
+		case SchemaEnum:
+			if len(sc.Values) == 0 {
+				return nil, errors.Errorf("Enum attribute '%s' has no values", c.Name)
+			}
+		default:
+			return nil, errors.Errorf("Invalid type '%s' of attribute '%s'; it must be 'string', 'int', 'bool', 'enum' or 'list'", c.Type, c.Name)
+		}
+		if sc.Type == SchemaInt {
+			for _, v := range sc.Values {
+				if _, err := strconv.Atoi(v); err != nil {
+					return nil, errors.Errorf("Value '%s' of integer attribute '%s' is not an integer", v, c.Name)
+				}
+			}
+		}
+		if sc.Regex != "" {
+			var err error
+			// The whole value must match
+			sc.regex, err = regexp.Compile("^(?:" + sc.Regex + ")$")
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid regex of attribute '%s'", c.Name)
+			}
+		}
+		s.schemas[c.Name] = sc
+	}
+	return s, nil
+}
+
+// List returns the attribute schemas
+func (s *Schemas) List() []api.AttributeSchema {
+	if s == nil {
+		return nil
+	}
+	return s.list
+}
+
+// CheckValue returns an error if the value of an attribute does not match
+// its schema. An empty value, which removes the attribute, and the
+// attributes without a schema are not checked.
+func (s *Schemas) CheckValue(a *api.Attribute) error {
+	if s == nil || a.Value == "" {
+		return nil
+	}
+	sc := s.schemas[a.Name]
+	if sc == nil {
+		return nil
+	}
+	err := sc.check(a.Value)
+	if err != nil {
+		return errors.WithMessagef(err, "Invalid value '%s' of attribute '%s'", a.Value, a.Name)
+	}
+	return nil
+}
+
+// CheckRegistration returns an error if the attributes of an identity which
+// is registered with a type do not match their schemas, or if an attribute
+// which the identities of the type must have is missing
+func (s *Schemas) CheckRegistration(idType string, attrs []api.Attribute) error {
+	if s == nil {
+		return nil
+	}
+	for i := range attrs {
+		err := s.CheckValue(&attrs[i])
+		if err != nil {
+			return err
+		}
+	}
+	return s.checkRequired(idType, attrs)
+}
+
+// CheckModification returns an error if the attributes which a modification
+// of an identity changes do not match their schemas, if it changes or
+// removes an immutable attribute, or if the identity, with its new type and
+// attributes, lacks an attribute which identities of its type must have
+func (s *Schemas) CheckModification(idType string, prev, next []api.Attribute) error {
+	if s == nil {
+		return nil
+	}
+	for _, c := range s.list {
+		sc := s.schemas[c.Name]
+		old, hadAttr := attrValue(prev, sc.Name)
+		value, hasAttr := attrValue(next, sc.Name)
+		if hadAttr == hasAttr && old == value {
+			continue
+		}
+		if sc.Immutable && hadAttr && old != "" {
+			return errors.Errorf("Attribute '%s' is immutable and cannot be changed or removed", sc.Name)
+		}
+		err := s.CheckValue(&api.Attribute{Name: sc.Name, Value: value})
+		if err != nil {
+			return err
+		}
+	}
+	return s.checkRequired(idType, next)
+}
+
+// checkRequired returns an error if an identity of a type lacks an attribute
+// which the identities of the type must have
+func (s *Schemas) checkRequired(idType string, attrs []api.Attribute) error {
+	for _, sc := range s.list {
+		if !contains(sc.RequiredFor, idType) && !contains(sc.RequiredFor, "*") {
+			continue
+		}
+		if value, _ := attrValue(attrs, sc.Name); value == "" {
+			return errors.Errorf("Attribute '%s' is required for identities of type '%s'", sc.Name, idType)
+		}
+	}
+	return nil
+}
+
+// check returns an error if a value does not match the schema
+func (sc *schema) check(value string) error {
+	switch sc.Type {
+	case SchemaBool:
+		_, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("The value must be a boolean")
+		}
+		return nil
+	case SchemaInt:
+		_, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("The value must be an integer")
+		}
+	case SchemaList:
+		for _, elem := range strings.Split(value, ",") {
+			err := sc.checkElement(strings.TrimSpace(elem))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return sc.checkElement(value)
+}
+
+// checkElement returns an error if a value, or an element of a list, is not
+// one of the allowed values or does not match the regex
+func (sc *schema) checkElement(value string) error {
+	if len(sc.Values) > 0 && !contains(sc.Values, value) {
+		return errors.Errorf("'%s' is not one of the allowed values %v", value, sc.Values)
+	}
+	if sc.regex != nil && !sc.regex.MatchString(value) {
+		return errors.Errorf("'%s' does not match the regex '%s'", value, sc.Regex)
+	}
+	return nil
+}
+
+// attrValue returns the value of an attribute, and whether it is present
+func attrValue(attrs []api.Attribute, name string) (string, bool) {
+	for _, a := range attrs {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
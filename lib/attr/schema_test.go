@@ -0,0 +1,129 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package attr
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSchemas(t *testing.T) {
+	invalid := [][]api.AttributeSchema{
+		{{Type: SchemaString}},
+		{{Name: "hf.Revoker", Type: SchemaBool}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Type: "float"}},
+		{{Name: "a", Type: SchemaBool, Values: []string{"true"}}},
+		{{Name: "a", Type: SchemaEnum}},
+		{{Name: "a", Type: SchemaInt, Values: []string{"one"}}},
+		{{Name: "a", Regex: "("}},
+	}
+	for _, cfg := range invalid {
+		_, err := NewSchemas(cfg)
+		assert.Error(t, err, "Schemas %+v should not be valid", cfg)
+	}
+
+	cfg := []api.AttributeSchema{{Name: "a"}, {Name: "b", Type: SchemaEnum, Values: []string{"x"}}}
+	s, err := NewSchemas(cfg)
+	if assert.NoError(t, err) {
+		assert.Equal(t, cfg, s.List())
+	}
+
+	// A nil checker does not check anything
+	s = nil
+	assert.Nil(t, s.List())
+	assert.NoError(t, s.CheckRegistration("client", []api.Attribute{{Name: "a", Value: "b"}}))
+	assert.NoError(t, s.CheckModification("client", nil, nil))
+}
+
+func TestCheckValue(t *testing.T) {
+	s, err := NewSchemas([]api.AttributeSchema{
+		{Name: "str", Regex: "[a-z]+"},
+		{Name: "int", Type: SchemaInt},
+		{Name: "bool", Type: SchemaBool},
+		{Name: "enum", Type: SchemaEnum, Values: []string{"x", "y"}},
+		{Name: "list", Type: SchemaList, Values: []string{"x", "y"}},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	valid := []api.Attribute{
+		{Name: "str", Value: "abc"},
+		{Name: "int", Value: "-12"},
+		{Name: "bool", Value: "true"},
+		{Name: "enum", Value: "y"},
+		{Name: "list", Value: "x, y"},
+		{Name: "str", Value: ""},
+		{Name: "other", Value: "anything"},
+	}
+	for i := range valid {
+		assert.NoError(t, s.CheckValue(&valid[i]), "Attribute %+v should be valid", valid[i])
+	}
+
+	invalid := []api.Attribute{
+		{Name: "str", Value: "abc1"},
+		{Name: "int", Value: "1.5"},
+		{Name: "bool", Value: "yes"},
+		{Name: "enum", Value: "z"},
+		{Name: "list", Value: "x,z"},
+	}
+	for i := range invalid {
+		assert.Error(t, s.CheckValue(&invalid[i]), "Attribute %+v should not be valid", invalid[i])
+	}
+}
+
+func TestCheckRegistration(t *testing.T) {
+	s, err := NewSchemas([]api.AttributeSchema{
+		{Name: "dept", Type: SchemaEnum, Values: []string{"sales"}, RequiredFor: []string{"client"}},
+		{Name: "id", RequiredFor: []string{"*"}},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	err = s.CheckRegistration("peer", []api.Attribute{{Name: "id", Value: "1"}})
+	assert.NoError(t, err)
+	err = s.CheckRegistration("peer", nil)
+	assert.Error(t, err, "An attribute required for all types should be required")
+	err = s.CheckRegistration("client", []api.Attribute{{Name: "id", Value: "1"}})
+	assert.Error(t, err, "An attribute required for clients should be required")
+	err = s.CheckRegistration("client", []api.Attribute{{Name: "id", Value: "1"}, {Name: "dept", Value: "hr"}})
+	assert.Error(t, err, "An attribute with an invalid value should fail")
+	err = s.CheckRegistration("client", []api.Attribute{{Name: "id", Value: "1"}, {Name: "dept", Value: "sales"}})
+	assert.NoError(t, err)
+}
+
+func TestCheckModification(t *testing.T) {
+	s, err := NewSchemas([]api.AttributeSchema{
+		{Name: "dept", Type: SchemaEnum, Values: []string{"sales", "hr"}, RequiredFor: []string{"client"}},
+		{Name: "id", Type: SchemaInt, Immutable: true},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	prev := []api.Attribute{{Name: "dept", Value: "sales"}, {Name: "id", Value: "1"}}
+	err = s.CheckModification("client", prev, []api.Attribute{{Name: "dept", Value: "hr"}, {Name: "id", Value: "1"}})
+	assert.NoError(t, err)
+	err = s.CheckModification("client", prev, []api.Attribute{{Name: "dept", Value: "it"}, {Name: "id", Value: "1"}})
+	assert.Error(t, err, "A changed attribute with an invalid value should fail")
+	err = s.CheckModification("client", prev, []api.Attribute{{Name: "dept", Value: "sales"}, {Name: "id", Value: "2"}})
+	assert.Error(t, err, "An immutable attribute should not be changed")
+	err = s.CheckModification("client", prev, []api.Attribute{{Name: "dept", Value: "sales"}})
+	assert.Error(t, err, "An immutable attribute should not be removed")
+	err = s.CheckModification("client", prev, []api.Attribute{{Name: "id", Value: "1"}})
+	assert.Error(t, err, "A required attribute should not be removed")
+	err = s.CheckModification("peer", prev, []api.Attribute{{Name: "id", Value: "1"}})
+	assert.NoError(t, err, "An attribute which is not required for the new type can be removed")
+
+	// An immutable attribute which is not set can be set once
+	err = s.CheckModification("peer", nil, []api.Attribute{{Name: "id", Value: "3"}})
+	assert.NoError(t, err)
+}
@@ -33,6 +33,8 @@ import (
 	"github.com/hyperledger/fabric-ca/lib/caerrors"
 	"github.com/hyperledger/fabric-ca/lib/cpabe"
 	"github.com/hyperledger/fabric-ca/lib/metadata"
+	"github.com/hyperledger/fabric-ca/lib/server/acme"
+	"github.com/hyperledger/fabric-ca/lib/server/audit"
 	"github.com/hyperledger/fabric-ca/lib/server/db"
 	cadb "github.com/hyperledger/fabric-ca/lib/server/db"
 	cadbfactory "github.com/hyperledger/fabric-ca/lib/server/db/factory"
@@ -40,16 +42,24 @@ import (
 	"github.com/hyperledger/fabric-ca/lib/server/db/postgres"
 	"github.com/hyperledger/fabric-ca/lib/server/db/sqlite"
 	dbutil "github.com/hyperledger/fabric-ca/lib/server/db/util"
+	"github.com/hyperledger/fabric-ca/lib/server/externalca"
 	idemix "github.com/hyperledger/fabric-ca/lib/server/idemix"
 	"github.com/hyperledger/fabric-ca/lib/server/ldap"
+	"github.com/hyperledger/fabric-ca/lib/server/oidc"
+	"github.com/hyperledger/fabric-ca/lib/server/password"
+	"github.com/hyperledger/fabric-ca/lib/server/replay"
+	"github.com/hyperledger/fabric-ca/lib/server/role"
+	"github.com/hyperledger/fabric-ca/lib/server/totp"
 	"github.com/hyperledger/fabric-ca/lib/server/user"
 	cadbuser "github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
 	"github.com/hyperledger/fabric-ca/lib/tls"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/certdb"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/config"
 	cfcsr "github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/csr"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/initca"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	cfocsp "github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/ocsp"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/signer"
 	cflocalsigner "github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/signer/local"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp"
@@ -91,14 +101,50 @@ type CA struct {
 	certDBAccessor *CertDBAccessor
 	// The user registry
 	registry user.Registry
+	// The OpenID Connect identity provider; nil if enrollment with ID
+	// tokens is disabled
+	oidc *oidc.Provider
+	// The verifier of the certificates of external CAs; nil if enrollment
+	// with them is disabled
+	externalCA *externalca.Verifier
+	// The policy of the secrets chosen by registrars
+	passwordPolicy *password.Policy
+	// The hasher of the secrets stored in the registry
+	passwordHasher *password.Hasher
+	// The authenticator of the TOTPs identities enroll with
+	totp *totp.Authenticator
+	// The checker of the values of custom attributes
+	attrSchemas *attr.Schemas
 	// The signer used for enrollment
 	enrollSigner signer.Signer
 	// Idemix issuer
 	issuer idemix.Issuer
 	// The cpabe key
 	cpabeKey bccsp.Key
+	// The deriver of cpabe private keys
+	cpabeDeriver *cpabe.KeyDeriver
+	// The signer of OCSP responses; nil if the OCSP responder is disabled
+	ocspSigner cfocsp.Signer
+	// The issuer of the certificates the OCSP signer answers for
+	ocspIssuer *x509.Certificate
+	// The signers of OCSP responses for the certificates issued by the keys
+	// the CA rolled over from, keyed by the subject key identifier of the key
+	ocspRetiredSigners map[string]cfocsp.Signer
+	// The CRL publisher; nil if CRL publishing is disabled
+	crlPublisher *crlPublisher
+	// The ACME server; nil if ACME is disabled
+	acme *acme.Server
+	// The audit log; nil if auditing is disabled
+	audit *audit.Log
+	// The dispatcher of webhook events; nil if webhooks are disabled
+	webhooks *webhook.Dispatcher
+	// The keys the CA rolled over from, which sign the CRLs of the
+	// certificates they issued; keyed by subject key identifier
+	retiredSigners map[string]*retiredSigner
 	// The options to use in verifying a signature in token-based authentication
 	verifyOptions *x509.VerifyOptions
+	// The guard which rejects replayed authorization tokens
+	replayGuard *replay.Guard
 	// The attribute manager
 	attrMgr *attrmgr.Mgr
 	// The server hosting this CA
@@ -107,6 +153,10 @@ type CA struct {
 	levels *dbutil.Levels
 	// CA mutex
 	mutex sync.Mutex
+	// stateMutex guards the settings which a reload of the configuration
+	// swaps. A request holds a read lock while it uses the CA, so that it
+	// sees the settings of a single configuration.
+	stateMutex sync.RWMutex
 }
 
 const (
@@ -171,6 +221,36 @@ func (ca *CA) init(renew bool) (err error) {
 		return err
 	}
 
+	// Initialize the password policy and hasher
+	err = ca.initPasswords()
+	if err != nil {
+		return err
+	}
+
+	// Initialize the checker of the custom attributes
+	err = ca.initAttributeSchemas()
+	if err != nil {
+		return err
+	}
+
+	// Initialize the authenticator of TOTPs
+	err = ca.initTOTP()
+	if err != nil {
+		return err
+	}
+
+	// Initialize the verifier of the certificates of external CAs
+	err = ca.initExternalCA()
+	if err != nil {
+		return err
+	}
+
+	// Check the approval policies
+	err = ca.Config.Approvals.Validate()
+	if err != nil {
+		return errors.WithMessage(err, "Invalid approval configuration")
+	}
+
 	// Initialize the database
 	err = ca.initDB(ca.server.dbMetrics)
 	if err != nil {
@@ -180,16 +260,55 @@ func (ca *CA) init(renew bool) (err error) {
 			return err
 		}
 	}
+	// Initialize the rejection of replayed authorization tokens
+	err = ca.initReplayGuard()
+	if err != nil {
+		return err
+	}
 	// Initialize the enrollment signer
 	err = ca.initEnrollmentSigner()
 	if err != nil {
 		return err
 	}
+	// Load the keys the CA rolled over from
+	err = ca.initRetiredSigners()
+	if err != nil {
+		return err
+	}
 	// Initialize the cpabe key
 	err = ca.initCPABEKey()
 	if err != nil {
 		return err
 	}
+	// Initialize the OCSP signer
+	err = ca.initOCSPSigner()
+	if err != nil {
+		return err
+	}
+	// Create the CRL publisher; it is started by the server
+	if ca.crlPublisher != nil {
+		ca.crlPublisher.Stop()
+		ca.crlPublisher = nil
+	}
+	if ca.Config.CRL.Publish.Enabled {
+		ca.crlPublisher = newCRLPublisher(ca)
+	}
+	// Create the webhook dispatcher; it is started by the server
+	if ca.webhooks != nil {
+		ca.webhooks.Stop()
+		ca.webhooks = nil
+	}
+	if ca.Config.Webhooks.Enabled {
+		ca.webhooks, err = webhook.NewDispatcher(&ca.Config.Webhooks, ca.Config.CA.Name, ca.db, ca.csp)
+		if err != nil {
+			return errors.WithMessage(err, "Failed to create webhook dispatcher")
+		}
+	}
+	// Create the ACME server
+	ca.acme = nil
+	if ca.Config.ACME.Enabled {
+		ca.acme = acme.NewServer(&ca.Config.ACME, &acmeCA{ca: ca})
+	}
 	// Create the attribute manager
 	ca.attrMgr = attrmgr.New()
 	log.Debug("CA initialization successful")
@@ -576,20 +695,9 @@ func (ca *CA) initDB(metrics *db.Metrics) error {
 
 	dbCfg := &ca.Config.DB
 	dbError := false
-	var err error
-
-	if dbCfg.Type == "" || dbCfg.Type == defaultDatabaseType {
-
-		dbCfg.Type = defaultDatabaseType
-
-		if dbCfg.Datasource == "" {
-			dbCfg.Datasource = "fabric-ca-server.db"
-		}
-
-		dbCfg.Datasource, err = util.MakeFileAbs(dbCfg.Datasource, ca.HomeDir)
-		if err != nil {
-			return err
-		}
+	err := normalizeDBConfig(dbCfg, ca.HomeDir)
+	if err != nil {
+		return err
 	}
 
 	// Strip out user:pass from datasource for logging
@@ -622,6 +730,12 @@ func (ca *CA) initDB(metrics *db.Metrics) error {
 	ca.db = sqlxdb
 	// Set the certificate DB accessor
 	ca.certDBAccessor = NewCertDBAccessor(ca.db, ca.levels.Certificate)
+	ca.certDBAccessor.issued = ca.certificateIssued
+	// Set the audit log, which is kept in the database unless a file is set
+	ca.initAuditLog()
+	if ca.webhooks != nil {
+		ca.webhooks.SetDB(ca.db)
+	}
 
 	// If DB initialization fails and we need to reinitialize DB, need to make sure to set the DB accessor for the signer
 	if ca.enrollSigner != nil {
@@ -653,8 +767,17 @@ func (ca *CA) initDB(metrics *db.Metrics) error {
 		return errors.Wrap(err, "Failed to migrate database")
 	}
 
-	// If not using LDAP, migrate database if needed to latest version and load the users and affiliations table
-	if !ca.Config.LDAP.Enabled {
+	// If not using LDAP or OpenID Connect, migrate database if needed to latest version and load the users and affiliations table
+	if ca.hasDBRegistry() {
+		err = ca.loadRolesTable()
+		if err != nil {
+			log.Error(err)
+			dbError = true
+			if caerrors.IsFatalError(err) {
+				return err
+			}
+		}
+
 		err = ca.loadUsersTable()
 		if err != nil {
 			log.Error(err)
@@ -681,6 +804,26 @@ func (ca *CA) initDB(metrics *db.Metrics) error {
 	return nil
 }
 
+// normalizeDBConfig sets the defaults of the database configuration: a
+// sqlite database in the CA's home directory
+func normalizeDBConfig(dbCfg *CAConfigDB, homeDir string) error {
+	var err error
+	if dbCfg.Type == "" || dbCfg.Type == defaultDatabaseType {
+
+		dbCfg.Type = defaultDatabaseType
+
+		if dbCfg.Datasource == "" {
+			dbCfg.Datasource = "fabric-ca-server.db"
+		}
+
+		dbCfg.Datasource, err = util.MakeFileAbs(dbCfg.Datasource, homeDir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Close CA's DB
 func (ca *CA) closeDB() error {
 	if ca.db != nil {
@@ -699,11 +842,31 @@ func (ca *CA) initUserRegistry() error {
 	var err error
 	ldapCfg := &ca.Config.LDAP
 
+	ca.oidc = nil
+	if ca.Config.OIDC.Enabled {
+		ca.oidc, err = oidc.NewProvider(&ca.Config.OIDC, ca.server.csp)
+		if err != nil {
+			return errors.WithMessage(err, "Failed to initialize OpenID Connect provider")
+		}
+		if ca.oidc.IsRegistry() {
+			if ldapCfg.Enabled {
+				return errors.New("The OpenID Connect identity provider cannot be the identity registry when LDAP is enabled")
+			}
+			// Use the OpenID Connect identity provider for the user registry
+			ca.registry = ca.oidc
+			log.Info("Initialized OpenID Connect identity registry")
+			return nil
+		}
+	}
+
 	if ldapCfg.Enabled {
 		// Use LDAP for the user registry
-		ca.registry, err = ldap.NewClient(ldapCfg, ca.server.csp)
+		var lc *ldap.Client
+		lc, err = ldap.NewClient(ldapCfg, ca.server.csp)
 		log.Debugf("Initialized LDAP identity registry; err=%s", err)
 		if err == nil {
+			lc.SetAttributeSchemas(ca.attrSchemas)
+			ca.registry = lc
 			log.Info("Successfully initialized LDAP client")
 		} else {
 			log.Warningf("Failed to initialize LDAP client; err=%s", err)
@@ -712,11 +875,124 @@ func (ca *CA) initUserRegistry() error {
 	}
 
 	// Use the DB for the user registry
-	ca.registry = NewDBAccessor(ca.db)
+	accessor := NewDBAccessor(ca.db)
+	accessor.SetPasswordHasher(ca.passwordHasher)
+	ca.registry = accessor
 	log.Debug("Initialized DB identity registry")
 	return nil
 }
 
+// hasDBRegistry returns true if the identities and affiliations of the CA
+// are in its database, rather than in an LDAP directory or an OpenID Connect
+// identity provider
+func (ca *CA) hasDBRegistry() bool {
+	oidcCfg := &ca.Config.OIDC
+	return !ca.Config.LDAP.Enabled && !(oidcCfg.Enabled && oidcCfg.Mode == oidc.RegistryMode)
+}
+
+// initReplayGuard initializes the guard which rejects replayed
+// authorization tokens; the CA has none if its database is not initialized,
+// in which case it cannot authenticate requests anyway
+func (ca *CA) initReplayGuard() (err error) {
+	ca.replayGuard = nil
+	if ca.db == nil {
+		return nil
+	}
+	ca.replayGuard, err = replay.NewGuard(&ca.server.Config.Token, ca.db)
+	return err
+}
+
+// initPasswords initializes the policy of the secrets chosen by registrars
+// and the hasher of the secrets stored in the registry
+func (ca *CA) initPasswords() (err error) {
+	ca.passwordPolicy, err = password.NewPolicy(&ca.Config.Registry.PasswordPolicy)
+	if err != nil {
+		return err
+	}
+	ca.passwordHasher, err = password.NewHasher(&ca.Config.Registry.PasswordHash)
+	return err
+}
+
+// initAttributeSchemas initializes the checker of the values of custom
+// attributes, which also checks the attributes mapped from LDAP
+func (ca *CA) initAttributeSchemas() (err error) {
+	ca.attrSchemas, err = attr.NewSchemas(ca.Config.Registry.AttributeSchemas)
+	if err != nil {
+		return errors.WithMessage(err, "Invalid attribute schemas")
+	}
+	return nil
+}
+
+// checkRegistrationAttrs returns an error if the attributes of a
+// registration request do not match their schemas
+func (ca *CA) checkRegistrationAttrs(req *api.RegistrationRequest) error {
+	err := ca.attrSchemas.CheckRegistration(req.Type, req.Attributes)
+	if err != nil {
+		return caerrors.NewHTTPErr(400, caerrors.ErrAttrSchema, "Registration of '%s' failed: %s", req.Name, err)
+	}
+	return nil
+}
+
+// checkModifiedAttrs returns an error if the attributes of an identity, as
+// a modify request changes them, do not match their schemas
+func (ca *CA) checkModifiedAttrs(id, idType string, prev, next []api.Attribute) error {
+	err := ca.attrSchemas.CheckModification(idType, prev, next)
+	if err != nil {
+		return caerrors.NewHTTPErr(400, caerrors.ErrAttrSchema, "Modification of '%s' failed: %s", id, err)
+	}
+	return nil
+}
+
+// initTOTP initializes the authenticator of the TOTPs identities enroll
+// with, creating the key file which encrypts their seeds if it does not exist.
+// The key file is totp.key in the home directory of the CA unless one is set.
+func (ca *CA) initTOTP() (err error) {
+	cfg := &ca.Config.Registry.TOTP
+	if cfg.KeyFile == "" {
+		cfg.KeyFile = filepath.Join(ca.HomeDir, "totp.key")
+	}
+	ca.totp, err = totp.NewAuthenticator(cfg, ca.Config.CA.Name)
+	return err
+}
+
+// initExternalCA initializes the verifier of the certificates of the external
+// CAs which identities may enroll with
+func (ca *CA) initExternalCA() (err error) {
+	ca.externalCA = nil
+	cfg := &ca.Config.ExternalCA
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.AutoRegister.Enabled && !ca.hasDBRegistry() {
+		return errors.New("The identities of external CA certificates cannot be registered automatically when LDAP or an OpenID Connect identity registry is used")
+	}
+	ca.externalCA, err = externalca.NewVerifier(cfg)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to initialize the verifier of external CA certificates")
+	}
+	return nil
+}
+
+// checkPasswordPolicy returns an error if a secret chosen by a registrar
+// does not follow the password policy
+func (ca *CA) checkPasswordPolicy(secret string) error {
+	err := ca.passwordPolicy.Check(secret)
+	if err != nil {
+		return caerrors.NewHTTPErr(400, caerrors.ErrPasswordPolicy, "The secret does not follow the password policy: %s", err)
+	}
+	return nil
+}
+
+// newSecret returns a random enrollment secret which is at least as long
+// as the password policy requires
+func (ca *CA) newSecret() string {
+	length := 12
+	if min := ca.passwordPolicy.MinLength(); min > length {
+		length = min
+	}
+	return util.RandomString(length)
+}
+
 // Initialize the enrollment signer
 func (ca *CA) initEnrollmentSigner() (err error) {
 	log.Debug("Initializing enrollment signer")
@@ -761,6 +1037,7 @@ func (ca *CA) initCPABEKey() (err error) {
 		return nil
 	}
 	ca.cpabeKey = k
+	ca.cpabeDeriver = cpabe.NewKeyDeriver(ca.csp, k, &ca.Config.CPABE)
 	return nil
 }
 
@@ -779,6 +1056,20 @@ func (ca *CA) loadUsersTable() error {
 	return nil
 }
 
+// loadRolesTable adds the configured roles to the table if not already found
+func (ca *CA) loadRolesTable() error {
+	log.Debug("Loading roles table")
+	for _, r := range ca.Config.Registry.Roles {
+		log.Debugf("Loading role '%s'", r.Name)
+		err := ca.addRole(&r)
+		if err != nil {
+			return errors.WithMessage(err, "Failed to load roles table")
+		}
+	}
+	log.Debug("Successfully loaded roles table")
+	return nil
+}
+
 // loadAffiliationsTable adds the configured affiliations to the table
 func (ca *CA) loadAffiliationsTable() error {
 	log.Debug("Loading affiliations table")
@@ -856,6 +1147,14 @@ func (ca *CA) addIdentity(id *CAConfigIdentity, errIfFound bool) error {
 		return err
 	}
 
+	// Give the identity the attributes of its roles
+	req := &api.RegistrationRequest{Name: id.Name, Attributes: attrs}
+	err = ca.addRoleAttributes(req, nil)
+	if err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("Failed to give identity '%s' its roles", id.Name))
+	}
+	attrs = req.Attributes
+
 	rec := cadbuser.Info{
 		Name:           id.Name,
 		Pass:           id.Pass,
@@ -873,6 +1172,34 @@ func (ca *CA) addIdentity(id *CAConfigIdentity, errIfFound bool) error {
 	return nil
 }
 
+// addRole adds a configured role, unless a role with its name exists. The
+// roles which exist are not changed, since changing a role updates its
+// members; this is done with the role endpoint instead.
+func (ca *CA) addRole(cfg *CAConfigRole) error {
+	_, err := ca.roles().Get(cfg.Name)
+	if err == nil {
+		log.Debugf("Role '%s' already exists, loaded role", cfg.Name)
+		return nil
+	}
+	err = role.ValidateName(cfg.Name)
+	if err != nil {
+		return caerrors.NewFatalError(caerrors.ErrConfig, "Configuration Error: %s", err)
+	}
+	attrs, err := attr.ConvertAttrs(cfg.Attrs)
+	if err != nil {
+		return err
+	}
+	err = role.ValidateAttributes(attrs)
+	if err != nil {
+		return caerrors.NewFatalError(caerrors.ErrConfig, "Configuration Error: Invalid attributes of role '%s': %s", cfg.Name, err)
+	}
+	rec, err := role.NewRecord(cfg.Name, attrs)
+	if err != nil {
+		return err
+	}
+	return ca.roles().Insert(rec)
+}
+
 func (ca *CA) addAffiliation(path, parentPath string) error {
 	return ca.registry.InsertAffiliation(path, parentPath, ca.levels.Affiliation)
 }
@@ -916,6 +1243,13 @@ func (ca *CA) makeFileNamesAbsolute() error {
 		&ca.Config.CA.Certfile,
 		&ca.Config.CA.Keyfile,
 		&ca.Config.CA.Chainfile,
+		&ca.Config.OCSP.Certfile,
+		&ca.Config.OCSP.Keyfile,
+		&ca.Config.CRL.Publish.File,
+		&ca.Config.Audit.File,
+		&ca.Config.Registry.PasswordPolicy.DenyFile,
+		&ca.Config.Registry.TOTP.KeyFile,
+		&ca.Config.OIDC.JWKSFile,
 	}
 	err := util.MakeFileNamesAbsolute(fields, ca.HomeDir)
 	if err != nil {
@@ -929,6 +1263,23 @@ func (ca *CA) makeFileNamesAbsolute() error {
 	if err != nil {
 		return err
 	}
+	err = tls.AbsTLSClient(&ca.Config.OIDC.TLS, ca.HomeDir)
+	if err != nil {
+		return err
+	}
+	for i := range ca.Config.Webhooks.Endpoints {
+		err = tls.AbsTLSClient(&ca.Config.Webhooks.Endpoints[i].TLS, ca.HomeDir)
+		if err != nil {
+			return err
+		}
+	}
+	certFiles := ca.Config.ExternalCA.CertFiles
+	for i := range certFiles {
+		certFiles[i], err = util.MakeFileAbs(certFiles[i], ca.HomeDir)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -938,6 +1289,11 @@ func (ca *CA) normalizeStringSlices() {
 		&ca.Config.CSR.Hosts,
 		&ca.Config.DB.TLS.CertFiles,
 		&ca.Config.LDAP.TLS.CertFiles,
+		&ca.Config.OIDC.TLS.CertFiles,
+		&ca.Config.OIDC.Attribute.Names,
+		&ca.Config.Registry.PasswordPolicy.DenyList,
+		&ca.Config.Registry.TOTP.Attributes,
+		&ca.Config.ExternalCA.CertFiles,
 	}
 	for _, namePtr := range fields {
 		norm := util.NormalizeStringSlice(*namePtr)
@@ -1023,6 +1379,7 @@ func (ca *CA) fillCAInfo(info *api.CAInfoResponseNet) error {
 	}
 	info.IssuerPublicKey = util.B64Encode(ipkBytes)
 	info.IssuerRevocationPublicKey = util.B64Encode(rpkBytes)
+	info.AttributeSchemas = ca.attrSchemas.List()
 	return nil
 }
 
@@ -1357,15 +1714,31 @@ func (ca *CA) GenerateCPABEKeyBytes(extensions []signer.Extension) ([]byte, erro
 				attributeID = append(attributeID, int32(utils.Hash(attrString)))
 			}
 			// Generate the cpabe key
-			k, err := ca.csp.KeyDeriv(ca.cpabeKey, &bccsp.CPABEDeriverOpts{AttributeID: attributeID, Temporary: true})
+			start := time.Now()
+			key, cached, err := ca.cpabeDeriver.DeriveKey(attributeID)
 			if err != nil {
-				return nil, fmt.Errorf("cpabe key derive error, %v", err)
+				return nil, err
 			}
-			// Marshal the cpabe key
-			return k.Bytes()
+			ca.recordCPABEKeyMetrics(time.Since(start), cached, len(attributeID))
+			return key, nil
 		}
 	}
 
 	// There is no attributes in the extension, don't generate the cpabe key
 	return nil, nil
 }
+
+func (ca *CA) recordCPABEKeyMetrics(duration time.Duration, cached bool, attrCount int) {
+	if ca.server == nil {
+		return
+	}
+	cache := "miss"
+	if cached {
+		cache = "hit"
+	}
+	caName := ca.Config.CA.Name
+	m := ca.server.Metrics
+	m.CPABEKeyCounter.With("ca_name", caName, "cache", cache).Add(1)
+	m.CPABEKeyDuration.With("ca_name", caName, "cache", cache).Observe(duration.Seconds())
+	m.CPABEKeyAttributes.With("ca_name", caName).Observe(float64(attrCount))
+}
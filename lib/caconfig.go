@@ -11,9 +11,18 @@ import (
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/cpabe"
+	"github.com/hyperledger/fabric-ca/lib/server/acme"
+	"github.com/hyperledger/fabric-ca/lib/server/approval"
+	"github.com/hyperledger/fabric-ca/lib/server/audit"
 	dbutil "github.com/hyperledger/fabric-ca/lib/server/db/util"
+	"github.com/hyperledger/fabric-ca/lib/server/externalca"
 	"github.com/hyperledger/fabric-ca/lib/server/idemix"
 	"github.com/hyperledger/fabric-ca/lib/server/ldap"
+	"github.com/hyperledger/fabric-ca/lib/server/oidc"
+	"github.com/hyperledger/fabric-ca/lib/server/password"
+	"github.com/hyperledger/fabric-ca/lib/server/totp"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
 	"github.com/hyperledger/fabric-ca/lib/tls"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/config"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp/factory"
@@ -87,6 +96,8 @@ type CAConfig struct {
 	Registry     CAConfigRegistry
 	Affiliations map[string]interface{}
 	LDAP         ldap.Config
+	OIDC         oidc.Config
+	ExternalCA   externalca.Config
 	DB           CAConfigDB
 	CSP          *factory.FactoryOpts `yaml:"bccsp" mapstructure:"bccsp" hide:"true"`
 	// Optional client config for an intermediate server which acts as a client
@@ -94,7 +105,13 @@ type CAConfig struct {
 	Client       *ClientConfig `skip:"true"`
 	Intermediate IntermediateCA
 	CRL          CRLConfig
+	OCSP         OCSPConfig
 	Idemix       idemix.Config
+	CPABE        cpabe.Config
+	ACME         acme.Config
+	Audit        audit.Config
+	Webhooks     webhook.Config
+	Approvals    approval.Config
 }
 
 // CfgOptions is a CA configuration that allows for setting different options
@@ -140,8 +157,24 @@ func (c CAConfigDB) String() string {
 
 // CAConfigRegistry is the registry part of the server's config
 type CAConfigRegistry struct {
-	MaxEnrollments int `def:"-1" help:"Maximum number of enrollments; valid if LDAP not enabled"`
-	Identities     []CAConfigIdentity
+	MaxEnrollments int           `def:"-1" help:"Maximum number of enrollments; valid if LDAP not enabled"`
+	SecretExpiry   time.Duration `def:"0" help:"Maximum and default time an enrollment secret is valid for after it is issued; 0 means that secrets do not expire"`
+	PasswordPolicy password.PolicyConfig
+	PasswordHash   password.HashConfig
+	TOTP           totp.Config
+	// AttributeSchemas define the types and allowed values of custom
+	// attributes
+	AttributeSchemas []api.AttributeSchema
+	// Roles are named sets of attributes, which identities are given by
+	// listing the roles in their 'hf.Roles' attribute
+	Roles      []CAConfigRole
+	Identities []CAConfigIdentity
+}
+
+// CAConfigRole is a role in the server's config
+type CAConfigRole struct {
+	Name  string
+	Attrs map[string]string
 }
 
 // CAConfigIdentity is identity information in the server's config
@@ -175,6 +208,31 @@ type CRLConfig struct {
 	// The number of hours specified by this property is added to the UTC time, resulting time
 	// is used to set the 'Next Update' date of the CRL
 	Expiry time.Duration `def:"24h" help:"Expiration for the CRL generated by the gencrl request"`
+	// Publish contains the options of the CRL publisher
+	Publish CRLPublishConfig
+}
+
+// CRLPublishConfig contains configuration options used by the CRL publisher,
+// which regenerates the CRL periodically and after each revocation
+type CRLPublishConfig struct {
+	Enabled bool `def:"false" help:"Enable the CRL publisher for the CA"`
+	// Specifies how often the CRL is regenerated; it should be shorter than
+	// the CRL expiry so that a valid CRL is always published
+	Interval time.Duration `def:"1h" help:"Interval at which the CRL publisher regenerates the CRL"`
+	File     string        `def:"crl.pem" help:"File the CRL publisher writes the PEM-encoded CRL to"`
+}
+
+// OCSPConfig contains configuration options used by the OCSP responder
+type OCSPConfig struct {
+	// Enables the OCSP responder for this CA
+	Enabled bool `def:"false" help:"Enable the OCSP responder for the CA"`
+	// Delegated OCSP signing certificate and key; if not set, responses are
+	// signed by the CA itself
+	Certfile string `help:"PEM-encoded delegated OCSP signing certificate file; responses are signed by the CA if not set"`
+	Keyfile  string `help:"PEM-encoded key file of the delegated OCSP signing certificate"`
+	// Specifies how long an OCSP response is valid and cached
+	// The duration is added to the time of signing to set the 'Next Update' date of the response
+	Expiry time.Duration `def:"24h" help:"Expiration for the OCSP responses generated by the CA"`
 }
 
 func (cc CAConfigIdentity) String() string {
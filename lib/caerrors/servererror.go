@@ -185,6 +185,34 @@ const (
 	ErrAttrExt = 81
 	// Error for invalid max enrolment registration value
 	ErrInvalidMaxEnroll = 82
+	// Error occurred reading the audit log
+	ErrAuditLog = 83
+	// Request was rejected because a rate limit was exceeded
+	ErrRateLimited = 84
+	// Error for invalid secret expiry registration value
+	ErrInvalidSecretExpiry = 85
+	// A secret chosen by a registrar does not follow the password policy
+	ErrPasswordPolicy = 86
+	// An authorization token was already used or is outside the clock skew
+	ErrTokenReplayed = 87
+	// An OpenID Connect ID token is not valid or its enrollment is not enabled
+	ErrInvalidIDToken = 88
+	// A TOTP required to enroll is missing, not valid or was already used
+	ErrInvalidTOTP = 89
+	// The TOTP seed of an identity could not be set
+	ErrTOTPSeed = 90
+	// The identity is suspended
+	ErrIdentitySuspended = 91
+	// The certificate to be released is not on hold
+	ErrCertNotOnHold = 92
+	// A batch request to register or modify identities is not valid
+	ErrBatchRequest = 93
+	// A request to approve or reject a pending request is not valid
+	ErrApprovalRequest = 95
+	// An attribute does not match its schema
+	ErrAttrSchema = 96
+	// A request to define, change, remove or assign a role is not valid
+	ErrRoleRequest = 97
 )
 
 // CreateHTTPErr constructs a new HTTP error.
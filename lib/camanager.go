@@ -0,0 +1,466 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	dbutil "github.com/hyperledger/fabric-ca/lib/server/db/util"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// managedCAsFile is the file in the server's home directory which
+	// records the CAs added and disabled at runtime
+	managedCAsFile = "managed-cas.json"
+	// casPath is the path of the endpoint of the operations listener which
+	// manages the CAs of the server
+	casPath = "/cas"
+)
+
+// caNameRegexp matches the names of the CAs which can be added at runtime;
+// the name is used as the name of the CA's home directory
+var caNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ManagedCA is a CA which was added or disabled at runtime
+type ManagedCA struct {
+	// Name is the name of the CA
+	Name string `json:"name"`
+	// ConfigFile is the configuration file of the CA; the home directory of
+	// the CA is its directory
+	ConfigFile string `json:"configfile,omitempty"`
+	// Disabled is true if the CA is not served
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// CAStatus describes a CA of the server
+type CAStatus struct {
+	Name       string `json:"name"`
+	HomeDir    string `json:"homedir"`
+	ConfigFile string `json:"configfile,omitempty"`
+	// Default is true for the default CA of the server
+	Default bool `json:"default,omitempty"`
+	// Managed is true if the CA was added or disabled at runtime
+	Managed bool `json:"managed,omitempty"`
+	Enabled bool `json:"enabled"`
+}
+
+// AddCA adds a CA to the server and records it so that it is also served
+// after a restart. The CA is loaded from its configuration file; if none is
+// given, the configuration file of a CA which was disabled is used, or a
+// configuration file is created in the 'ca/<name>' directory of the server.
+// If the server is running, the CA is initialized and served right away.
+func (s *Server) AddCA(name, configFile string) (*CAStatus, error) {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+	err := s.initHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" && configFile == "" {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrConfig, "The name or the configuration file of the CA is required")
+	}
+	if name != "" && !caNameRegexp.MatchString(name) {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrConfig, "Invalid CA name '%s'", name)
+	}
+	managed, err := s.readManagedCAs()
+	if err != nil {
+		return nil, err
+	}
+	if configFile != "" {
+		configFile, err = util.MakeFileAbs(configFile, s.HomeDir)
+		if err != nil {
+			return nil, err
+		}
+	} else if m := findManagedCA(managed, name); m != nil && m.ConfigFile != "" {
+		configFile = m.ConfigFile
+	} else {
+		configFile, err = s.createCAConfig(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cfg, err := s.loadCAConfig(configFile, s.caConfigDefaults())
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrConfig, "Invalid CA configuration: %s", err)
+	}
+	if name == "" {
+		name = cfg.CA.Name
+	} else if cfg.CA.Name != name {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrConfig, "The name of the CA in '%s' is '%s', not '%s'", configFile, cfg.CA.Name, name)
+	}
+	cas, err := s.ListCAs()
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range cas {
+		if status.Name == name && status.Enabled {
+			return nil, caerrors.NewHTTPErr(409, caerrors.ErrConfig, "CA '%s' already exists", name)
+		}
+	}
+	managed = setManagedCA(managed, ManagedCA{Name: name, ConfigFile: configFile})
+	status := &CAStatus{Name: name, HomeDir: filepath.Dir(configFile), ConfigFile: configFile, Managed: true, Enabled: true}
+
+	if s.listener == nil {
+		err = s.writeManagedCAs(managed)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Added CA '%s' from %s; it is served when the server is started", name, configFile)
+		return status, nil
+	}
+
+	log.Infof("Loading CA '%s' from %s", name, configFile)
+	ca, err := newCA(configFile, cfg, s, false)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Failed to initialize CA '%s'", name)
+	}
+	s.caMapMutex.Lock()
+	err = s.checkCAConflicts(ca)
+	if err != nil {
+		err = caerrors.NewHTTPErr(409, caerrors.ErrConfig, "%s", err)
+	} else {
+		err = s.writeManagedCAs(managed)
+	}
+	if err != nil {
+		s.caMapMutex.Unlock()
+		err2 := ca.closeDB()
+		if err2 != nil {
+			log.Errorf("Close DB failed: %s", err2)
+		}
+		return nil, err
+	}
+	s.caMap[name] = ca
+	s.caMapMutex.Unlock()
+	ca.startWorkers()
+	log.Infof("Added CA '%s'", name)
+	return status, nil
+}
+
+// DisableCA stops serving a CA and records it so that it is not served
+// after a restart either. The home directory and database of the CA are
+// kept, so the CA can be added again. The default CA cannot be disabled.
+func (s *Server) DisableCA(name string) (*CAStatus, error) {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+	err := s.initHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	cas, err := s.ListCAs()
+	if err != nil {
+		return nil, err
+	}
+	var status *CAStatus
+	for i := range cas {
+		if cas[i].Name == name && cas[i].Enabled {
+			status = &cas[i]
+		}
+	}
+	if status == nil {
+		return nil, caerrors.NewHTTPErr(404, caerrors.ErrCANotFound, "CA '%s' does not exist", name)
+	}
+	if status.Default {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrConfig, "The default CA cannot be disabled")
+	}
+	managed, err := s.readManagedCAs()
+	if err != nil {
+		return nil, err
+	}
+	managed = setManagedCA(managed, ManagedCA{Name: name, ConfigFile: status.ConfigFile, Disabled: true})
+	status.Managed = true
+	status.Enabled = false
+
+	if s.listener == nil {
+		err = s.writeManagedCAs(managed)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Disabled CA '%s'", name)
+		return status, nil
+	}
+
+	s.caMapMutex.Lock()
+	err = s.writeManagedCAs(managed)
+	if err != nil {
+		s.caMapMutex.Unlock()
+		return nil, err
+	}
+	ca := s.caMap[name]
+	delete(s.caMap, name)
+	s.caMapMutex.Unlock()
+	if ca != nil {
+		s.retireCA(ca)
+	}
+	log.Infof("Disabled CA '%s'", name)
+	return status, nil
+}
+
+// retireCA stops the background work of a CA which is no longer served.
+// Requests in flight may still use the CA, so its database is only closed
+// when the server is stopped.
+func (s *Server) retireCA(ca *CA) {
+	ca.stopWorkers()
+	s.mutex.Lock()
+	s.retiredCAs = append(s.retiredCAs, ca)
+	s.mutex.Unlock()
+}
+
+// ListCAs returns the CAs of the server, including the disabled ones. If
+// the server is not running, the CAs are those of its configuration.
+func (s *Server) ListCAs() ([]CAStatus, error) {
+	err := s.initHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	managed, err := s.readManagedCAs()
+	if err != nil {
+		return nil, err
+	}
+	var cas []CAStatus
+	add := func(name, configFile, homeDir string, enabled bool) {
+		m := findManagedCA(managed, name)
+		cas = append(cas, CAStatus{
+			Name:       name,
+			HomeDir:    homeDir,
+			ConfigFile: configFile,
+			Managed:    m != nil,
+			Enabled:    enabled && (m == nil || !m.Disabled),
+		})
+	}
+	if s.listener != nil {
+		for _, ca := range s.getCAs() {
+			if ca != &s.CA {
+				add(ca.Config.CA.Name, ca.ConfigFilePath, ca.HomeDir, true)
+			}
+		}
+	} else {
+		caFiles, err := s.configuredCAFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range managed {
+			if !m.Disabled {
+				caFiles = append(caFiles, m.ConfigFile)
+			}
+		}
+		loaded := map[string]bool{}
+		for _, caFile := range caFiles {
+			if loaded[caFile] {
+				continue
+			}
+			loaded[caFile] = true
+			cfg, err := s.loadCAConfig(caFile, s.CA.Config)
+			if err != nil {
+				return nil, err
+			}
+			if !isCADisabled(managed, cfg.CA.Name) {
+				add(cfg.CA.Name, caFile, filepath.Dir(caFile), true)
+			}
+		}
+	}
+	for _, m := range managed {
+		if m.Disabled {
+			add(m.Name, m.ConfigFile, filepath.Dir(m.ConfigFile), false)
+		}
+	}
+	sort.Slice(cas, func(i, j int) bool { return cas[i].Name < cas[j].Name })
+	status := CAStatus{
+		Name:       s.CA.Config.CA.Name,
+		HomeDir:    s.HomeDir,
+		ConfigFile: s.CA.ConfigFilePath,
+		Default:    true,
+		Enabled:    true,
+	}
+	return append([]CAStatus{status}, cas...), nil
+}
+
+// configuredCAFiles returns the CA files of the server's configuration,
+// including the ones of the CAs of the cacount option
+func (s *Server) configuredCAFiles() ([]string, error) {
+	if s.Config == nil {
+		return nil, nil
+	}
+	caFiles, err := util.NormalizeFileList(s.Config.CAfiles, s.HomeDir)
+	if err != nil {
+		return nil, err
+	}
+	caFiles = util.NormalizeStringSlice(caFiles)
+	for i := 1; i <= s.Config.CAcount; i++ {
+		caFile := filepath.Join(s.HomeDir, "ca", fmt.Sprintf("ca%d", i), "fabric-ca-config.yaml")
+		if util.FileExists(caFile) {
+			caFiles = append(caFiles, caFile)
+		}
+	}
+	return caFiles, nil
+}
+
+// caConfigDefaults returns the configuration of the default CA, from which
+// the missing values of the configuration of the other CAs are taken
+func (s *Server) caConfigDefaults() *CAConfig {
+	if s.caDefaults != nil {
+		return s.caDefaults
+	}
+	return s.CA.Config
+}
+
+// createCAConfig creates the configuration file of a CA in the 'ca/<name>'
+// directory of the server, unless it exists, and returns its path
+func (s *Server) createCAConfig(name string) (string, error) {
+	if name == "" {
+		return "", caerrors.NewHTTPErr(400, caerrors.ErrConfig, "The name of the CA is required")
+	}
+	configFile := filepath.Join(s.HomeDir, "ca", name, "fabric-ca-config.yaml")
+	if util.FileExists(configFile) {
+		return configFile, nil
+	}
+	defaults := s.caConfigDefaults()
+	dbType := defaults.DB.Type
+	if dbType == "" {
+		dbType = defaultDatabaseType
+	}
+	datasource := defaults.DB.Datasource
+	if datasource == "" {
+		datasource = "fabric-ca-server.db"
+	}
+	cfg := strings.Replace(defaultCACfgTemplate, "<<<CANAME>>>", name, 1)
+	cfg = strings.Replace(cfg, "<<<COMMONNAME>>>", "fabric-ca-server-"+name, 1)
+	cfg = strings.Replace(cfg, "<<<DATASOURCE>>>", dbutil.GetNamedCADataSource(dbType, datasource, name), 1)
+	err := os.MkdirAll(filepath.Dir(configFile), 0755)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to create the home directory of the CA")
+	}
+	err = ioutil.WriteFile(configFile, []byte(cfg), 0644)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to write the configuration file of the CA")
+	}
+	return configFile, nil
+}
+
+// readManagedCAs reads the CAs added and disabled at runtime
+func (s *Server) readManagedCAs() ([]ManagedCA, error) {
+	file := filepath.Join(s.HomeDir, managedCAsFile)
+	if !util.FileExists(file) {
+		return nil, nil
+	}
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read '%s'", file)
+	}
+	var cas []ManagedCA
+	err = json.Unmarshal(buf, &cas)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid format of '%s'", file)
+	}
+	return cas, nil
+}
+
+// writeManagedCAs records the CAs added and disabled at runtime
+func (s *Server) writeManagedCAs(cas []ManagedCA) error {
+	file := filepath.Join(s.HomeDir, managedCAsFile)
+	buf, err := json.MarshalIndent(cas, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal managed CAs")
+	}
+	// Write to a temporary file first so that the file is never partial
+	err = ioutil.WriteFile(file+".tmp", buf, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write '%s'", file)
+	}
+	err = os.Rename(file+".tmp", file)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write '%s'", file)
+	}
+	s.managedCAs = cas
+	return nil
+}
+
+// isCADisabled returns true if the CA was disabled at runtime
+func isCADisabled(managed []ManagedCA, name string) bool {
+	m := findManagedCA(managed, name)
+	return m != nil && m.Disabled
+}
+
+func findManagedCA(managed []ManagedCA, name string) *ManagedCA {
+	for i := range managed {
+		if managed[i].Name == name {
+			return &managed[i]
+		}
+	}
+	return nil
+}
+
+// setManagedCA adds or replaces the record of a CA
+func setManagedCA(managed []ManagedCA, ca ManagedCA) []ManagedCA {
+	if m := findManagedCA(managed, ca.Name); m != nil {
+		*m = ca
+		return managed
+	}
+	return append(managed, ca)
+}
+
+// registerCAsHandler registers the endpoint of the operations listener
+// which manages the CAs of the server
+func (s *Server) registerCAsHandler() {
+	s.Operations.RegisterHandler(casPath, http.HandlerFunc(s.serveCAs))
+}
+
+// serveCAs lists the CAs on GET /cas, adds a CA on POST /cas and disables
+// a CA on DELETE /cas/<name>. The caller must authenticate with a client
+// certificate issued by one of the client CAs of the operations listener.
+func (s *Server) serveCAs(w http.ResponseWriter, r *http.Request) {
+	caller, ok := operationsCaller(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, casPath), "/")
+	var result interface{}
+	var err error
+	status := http.StatusOK
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		result, err = s.ListCAs()
+	case r.Method == http.MethodPost && name == "":
+		var req ManagedCA
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Infof("'%s' is adding CA '%s'", caller, req.Name)
+		result, err = s.AddCA(req.Name, req.ConfigFile)
+		status = http.StatusCreated
+	case r.Method == http.MethodDelete && name != "":
+		log.Infof("'%s' is disabling CA '%s'", caller, name)
+		result, err = s.DisableCA(name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		status = http.StatusInternalServerError
+		if httpErr := caerrors.GetCause(err); httpErr != nil {
+			status = httpErr.GetStatusCode()
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManageCAs(t *testing.T) {
+	srv := TestGetRootServer(t)
+	srv.Config.Operations.ListenAddress = "localhost:0"
+	defer os.RemoveAll(rootDir)
+
+	// A CA added while the server is not running is served when it starts
+	status, err := srv.AddCA("managed1", "")
+	util.FatalError(t, err, "Failed to add CA")
+	assert.Equal(t, filepath.Join(srv.HomeDir, "ca", "managed1"), status.HomeDir)
+	assert.FileExists(t, filepath.Join(srv.HomeDir, "ca", "managed1", "fabric-ca-config.yaml"))
+	_, err = srv.AddCA("managed1", "")
+	assert.Error(t, err, "Adding a CA twice should fail")
+	_, err = srv.AddCA("../managed", "")
+	assert.Error(t, err, "Adding a CA with an invalid name should fail")
+
+	err = srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+	_, err = srv.GetCA("managed1")
+	assert.NoError(t, err, "The CA added before the start should be served")
+
+	// A CA added while the server is running is served right away
+	_, err = srv.AddCA("managed2", "")
+	util.FatalError(t, err, "Failed to add CA")
+	_, err = srv.GetCA("managed2")
+	assert.NoError(t, err, "The added CA should be served")
+
+	_, err = srv.DisableCA(srv.CA.Config.CA.Name)
+	assert.Error(t, err, "Disabling the default CA should fail")
+	_, err = srv.DisableCA("unknown")
+	assert.Error(t, err, "Disabling an unknown CA should fail")
+	_, err = srv.DisableCA("managed1")
+	util.FatalError(t, err, "Failed to disable CA")
+	_, err = srv.GetCA("managed1")
+	assert.Error(t, err, "The disabled CA should not be served")
+
+	cas, err := srv.ListCAs()
+	util.FatalError(t, err, "Failed to list CAs")
+	enabled := map[string]bool{}
+	for _, ca := range cas {
+		enabled[ca.Name] = ca.Enabled
+	}
+	assert.Equal(t, map[string]bool{srv.CA.Config.CA.Name: true, "managed1": false, "managed2": true}, enabled)
+
+	// The changes are kept across restarts
+	managed, err := srv.readManagedCAs()
+	util.FatalError(t, err, "Failed to read managed CAs")
+	assert.Equal(t, []ManagedCA{
+		{Name: "managed1", ConfigFile: filepath.Join(srv.HomeDir, "ca", "managed1", "fabric-ca-config.yaml"), Disabled: true},
+		{Name: "managed2", ConfigFile: filepath.Join(srv.HomeDir, "ca", "managed2", "fabric-ca-config.yaml")},
+	}, managed)
+
+	// A disabled CA can be added again
+	_, err = srv.AddCA("managed1", "")
+	util.FatalError(t, err, "Failed to add disabled CA again")
+	_, err = srv.GetCA("managed1")
+	assert.NoError(t, err, "The CA added again should be served")
+
+	// The operations endpoint requires a client certificate
+	resp, err := http.Get("http://" + srv.Operations.Addr() + casPath)
+	util.FatalError(t, err, "Failed to send list request")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
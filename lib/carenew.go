@@ -0,0 +1,505 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/cpabe"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/csr"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp"
+	cspsigner "github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp/signer"
+	"github.com/pkg/errors"
+)
+
+const (
+	// retiredDir is the directory, next to the CA certificate file, holding
+	// the certificates and key files of the keys the CA rolled over from
+	retiredDir = "retired"
+	// crossCertsSuffix is the suffix of the file in the retired directory
+	// holding the cross certificates of a rollover
+	crossCertsSuffix = "-cross.pem"
+)
+
+// retiredSigner is a key the CA rolled over from. It is kept to sign the
+// CRLs of the certificates it issued until its certificate expires.
+type retiredSigner struct {
+	cert   *x509.Certificate
+	signer crypto.Signer
+}
+
+// RenewCA re-issues the certificate of the CA with the same key and the
+// same validity period, starting now. caName is the name of the CA, or
+// empty for the default CA. The server must not be running.
+func (s *Server) RenewCA(caName string) error {
+	ca, err := s.getOfflineCA(caName)
+	if err != nil {
+		return err
+	}
+	return ca.renewCert()
+}
+
+// RolloverCA creates a new key and certificate for the CA, along with cross
+// certificates of the old key signed by the new key and of the new key
+// signed by the old key. The old key is kept to sign the CRLs of the
+// certificates it issued. caName is the name of the CA, or empty for the
+// default CA. The server must not be running.
+func (s *Server) RolloverCA(caName string) error {
+	ca, err := s.getOfflineCA(caName)
+	if err != nil {
+		return err
+	}
+	return ca.rolloverKey()
+}
+
+// getOfflineCA returns the CA with its configuration and crypto layer
+// initialized, but not its key material or database, so that a CA whose
+// certificate has expired can be renewed, or a CA of a server which is not
+// running can be inspected
+func (s *Server) getOfflineCA(caName string) (*CA, error) {
+	err := s.initHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	var ca *CA
+	if caName == "" || caName == s.CA.Config.CA.Name {
+		ca = &s.CA
+		ca.HomeDir = s.HomeDir
+	} else {
+		caFiles, err := s.configuredCAFiles()
+		if err != nil {
+			return nil, err
+		}
+		managed, err := s.readManagedCAs()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range managed {
+			caFiles = append(caFiles, m.ConfigFile)
+		}
+		for _, caFile := range caFiles {
+			cfg, err := s.loadCAConfig(caFile, s.CA.Config)
+			if err != nil {
+				return nil, err
+			}
+			if cfg.CA.Name == caName {
+				ca = &CA{HomeDir: filepath.Dir(caFile), Config: cfg, ConfigFilePath: caFile}
+				break
+			}
+		}
+	}
+	if ca == nil {
+		return nil, errors.Errorf("CA '%s' does not exist", caName)
+	}
+	ca.server = s
+	err = ca.initConfig()
+	if err != nil {
+		return nil, err
+	}
+	err = ca.makeFileNamesAbsolute()
+	if err != nil {
+		return nil, err
+	}
+	ca.csp, err = util.InitBCCSP(&ca.Config.CSP, "", ca.HomeDir)
+	if err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// renewCert re-issues the self-signed certificate of a root CA with the
+// same key. Certificates issued by the CA remain valid as the subject and
+// key of the CA do not change.
+func (ca *CA) renewCert() error {
+	if ca.Config.Intermediate.ParentServer.URL != "" {
+		return errors.Errorf("The certificate of intermediate CA '%s' is issued by its parent CA; use rollover to enroll for a new certificate", ca.Config.CA.Name)
+	}
+	oldCert, signer, err := ca.loadCertAndSigner()
+	if err != nil {
+		return err
+	}
+	notBefore := time.Now().Round(time.Minute).Add(-5 * time.Minute).UTC()
+	template, err := caCertTemplate(oldCert, notBefore, notBefore.Add(oldCert.NotAfter.Sub(oldCert.NotBefore)))
+	if err != nil {
+		return err
+	}
+	newCert, err := createCertPEM(template, template, oldCert.PublicKey, signer)
+	if err != nil {
+		return err
+	}
+	err = writeFile(ca.Config.CA.Certfile, newCert, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Failed to store certificate")
+	}
+	// Replace the old certificate in the chain
+	chain := newCert
+	if util.FileExists(ca.Config.CA.Chainfile) {
+		chain, err = ioutil.ReadFile(ca.Config.CA.Chainfile)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read chain file '%s'", ca.Config.CA.Chainfile)
+		}
+		chain = replaceCertInChain(chain, oldCert, newCert)
+	}
+	err = writeFile(ca.Config.CA.Chainfile, chain, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Failed to store chain file")
+	}
+	log.Infof("Renewed the certificate of CA '%s'; it expires on %s", ca.Config.CA.Name, template.NotAfter)
+	return nil
+}
+
+// rolloverKey creates a new key and certificate for the CA. The old
+// certificate and key file, if any, are moved to the retired directory and
+// the chain file gets the cross certificates, so that relying parties
+// trusting either certificate can validate the certificates issued by
+// either key. All of the files are written under temporary names first and
+// only renamed once they are all written, so that a failure leaves the CA
+// as it was.
+func (ca *CA) rolloverKey() (err error) {
+	oldCert, oldSigner, err := ca.loadCertAndSigner()
+	if err != nil {
+		return err
+	}
+	ski := skiString(oldCert.SubjectKeyId)
+	if ski == "" {
+		return errors.Errorf("The certificate of CA '%s' has no subject key identifier", ca.Config.CA.Name)
+	}
+	dir := filepath.Join(filepath.Dir(ca.Config.CA.Certfile), retiredDir)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create the retired CA key directory")
+	}
+	files := &stagedFiles{}
+	defer func() {
+		if err != nil {
+			files.discard()
+		}
+	}()
+
+	var newCertPEM, chain []byte
+	var newSigner crypto.Signer
+	if ca.Config.Intermediate.ParentServer.URL != "" {
+		// Enroll with the parent CA, which stores the new chain file; it is
+		// staged like the other files
+		chainFile := ca.Config.CA.Chainfile
+		files.add(chainFile)
+		ca.Config.CA.Chainfile = files.name(chainFile)
+		newCertPEM, err = ca.getCACert()
+		ca.Config.CA.Chainfile = chainFile
+		if err != nil {
+			return err
+		}
+		chain, err = ioutil.ReadFile(files.name(chainFile))
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read chain file '%s'", files.name(chainFile))
+		}
+		cert, err := BytesToX509Cert(newCertPEM)
+		if err != nil {
+			return err
+		}
+		_, newSigner, err = util.GetSignerFromCert(cert, ca.csp)
+		if err != nil {
+			return errors.WithMessage(err, "Failed to get the signer of the new CA certificate")
+		}
+	} else {
+		kr := ca.Config.CSR.KeyRequest
+		if kr == nil || (kr.Algo == "" && kr.Size == 0) {
+			kr = GetKeyRequest(ca.Config)
+		}
+		var key bccsp.Key
+		key, newSigner, err = util.BCCSPKeyRequestGenerate(&csr.CertificateRequest{
+			KeyRequest: &csr.KeyRequest{A: kr.Algo, S: kr.Size},
+		}, ca.csp)
+		if err != nil {
+			return err
+		}
+		notBefore := time.Now().Round(time.Minute).Add(-5 * time.Minute).UTC()
+		template, err := caCertTemplate(oldCert, notBefore, notBefore.Add(oldCert.NotAfter.Sub(oldCert.NotBefore)))
+		if err != nil {
+			return err
+		}
+		template.SubjectKeyId = key.SKI()
+		newCertPEM, err = createCertPEM(template, template, newSigner.Public(), newSigner)
+		if err != nil {
+			return err
+		}
+		chain = newCertPEM
+	}
+	newCert, err := BytesToX509Cert(newCertPEM)
+	if err != nil {
+		return err
+	}
+
+	// Certify the old key with the new key and the new key with the old key
+	now := time.Now().UTC()
+	template, err := caCertTemplate(oldCert, now, oldCert.NotAfter)
+	if err != nil {
+		return err
+	}
+	oldWithNew, err := createCertPEM(template, newCert, oldCert.PublicKey, newSigner)
+	if err != nil {
+		return err
+	}
+	notAfter := newCert.NotAfter
+	if oldCert.NotAfter.Before(notAfter) {
+		notAfter = oldCert.NotAfter
+	}
+	template, err = caCertTemplate(newCert, now, notAfter)
+	if err != nil {
+		return err
+	}
+	newWithOld, err := createCertPEM(template, oldCert, newCert.PublicKey, oldSigner)
+	if err != nil {
+		return err
+	}
+	crossCerts := append(newWithOld, oldWithNew...)
+
+	oldCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: oldCert.Raw})
+	err = files.write(filepath.Join(dir, ski+".pem"), oldCertPEM, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Failed to store the retired CA certificate")
+	}
+	err = files.write(filepath.Join(dir, ski+crossCertsSuffix), crossCerts, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Failed to store the cross certificates")
+	}
+	err = files.write(ca.Config.CA.Chainfile, append(chain, crossCerts...), 0644)
+	if err != nil {
+		return errors.Wrap(err, "Failed to store chain file")
+	}
+	err = files.write(ca.Config.CA.Certfile, newCertPEM, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Failed to store certificate")
+	}
+	// The new key is stored by BCCSP, so the key file must not shadow it
+	if util.FileExists(ca.Config.CA.Keyfile) {
+		files.move(ca.Config.CA.Keyfile, filepath.Join(dir, ski+"_sk"))
+	}
+	err = files.commit()
+	if err != nil {
+		return err
+	}
+	log.Infof("Rolled over the key of CA '%s'; the retired key is kept for CRL signing until %s", ca.Config.CA.Name, oldCert.NotAfter)
+	return nil
+}
+
+// stagedFiles are files written under temporary names, which replace the
+// files only once all of them are written
+type stagedFiles struct {
+	// files are the names of the files, in the order they were written
+	files []string
+	// moves are the files to rename, with their new names, once the written
+	// files replaced theirs
+	moves [][2]string
+}
+
+// name returns the temporary name of a file
+func (s *stagedFiles) name(file string) string {
+	return file + ".tmp"
+}
+
+// add adds a file which is written under its temporary name by others
+func (s *stagedFiles) add(file string) {
+	for _, f := range s.files {
+		if f == file {
+			return
+		}
+	}
+	s.files = append(s.files, file)
+}
+
+// write writes the file under its temporary name
+func (s *stagedFiles) write(file string, buf []byte, perm os.FileMode) error {
+	s.add(file)
+	return writeFile(s.name(file), buf, perm)
+}
+
+// move renames a file once the written files replaced theirs
+func (s *stagedFiles) move(from, to string) {
+	s.moves = append(s.moves, [2]string{from, to})
+}
+
+// commit renames the written files to their names and then moves the
+// files to move
+func (s *stagedFiles) commit() error {
+	for _, file := range s.files {
+		err := os.Rename(s.name(file), file)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to store '%s'", file)
+		}
+	}
+	s.files = nil
+	for _, m := range s.moves {
+		err := os.Rename(m[0], m[1])
+		if err != nil {
+			return errors.Wrapf(err, "Failed to move '%s' to '%s'", m[0], m[1])
+		}
+	}
+	return nil
+}
+
+// discard removes the written files which were not committed
+func (s *stagedFiles) discard() {
+	for _, file := range s.files {
+		os.Remove(s.name(file))
+	}
+}
+
+// initRetiredSigners loads the unexpired keys the CA rolled over from
+func (ca *CA) initRetiredSigners() error {
+	ca.retiredSigners = map[string]*retiredSigner{}
+	dir := filepath.Join(filepath.Dir(ca.Config.CA.Certfile), retiredDir)
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return errors.Wrap(err, "Failed to list the retired CA certificates")
+	}
+	now := time.Now()
+	for _, file := range files {
+		if strings.HasSuffix(file, crossCertsSuffix) {
+			continue
+		}
+		certPEM, err := ioutil.ReadFile(file)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read retired CA certificate '%s'", file)
+		}
+		cert, err := BytesToX509Cert(certPEM)
+		if err != nil {
+			return err
+		}
+		if now.After(cert.NotAfter) {
+			log.Debugf("Retired CA certificate '%s' has expired", file)
+			continue
+		}
+		ski := skiString(cert.SubjectKeyId)
+		signer, err := getCertSigner(cert, filepath.Join(dir, ski+"_sk"), ca.csp)
+		if err != nil {
+			log.Warningf("The key of retired CA certificate '%s' is not available; CRLs cannot be signed by it: %s", file, err)
+			continue
+		}
+		ca.retiredSigners[ski] = &retiredSigner{cert: cert, signer: signer}
+		log.Debugf("Loaded retired CA key %s, which expires on %s", ski, cert.NotAfter)
+	}
+	return nil
+}
+
+// loadCertAndSigner returns the certificate of the CA and its signer
+func (ca *CA) loadCertAndSigner() (*x509.Certificate, crypto.Signer, error) {
+	cert, err := getCACert(ca)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, err := getCertSigner(cert, ca.Config.CA.Keyfile, ca.csp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, signer, nil
+}
+
+// getCertSigner returns the signer of the key of the certificate, looking
+// the key up in the keystore and falling back to the key file
+func getCertSigner(cert *x509.Certificate, keyFile string, csp bccsp.BCCSP) (crypto.Signer, error) {
+	_, signer, err := util.GetSignerFromCert(cert, csp)
+	if err == nil {
+		return signer, nil
+	}
+	log.Debugf("No key found in BCCSP keystore, attempting fallback")
+	key, err := util.ImportBCCSPKeyFromPEM(keyFile, csp, false)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not find the private key in BCCSP keystore nor in keyfile "+keyFile)
+	}
+	signer, err = cspsigner.New(csp, key)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed initializing CryptoSigner")
+	}
+	return signer, nil
+}
+
+// caCertTemplate returns a template of a new certificate of the CA
+// certificate's subject and key, keeping its CP-ABE params
+func caCertTemplate(cert *x509.Certificate, notBefore, notAfter time.Time) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 159))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate serial number")
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		RawSubject:            cert.RawSubject,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              cert.KeyUsage,
+		ExtKeyUsage:           cert.ExtKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            cert.MaxPathLen,
+		MaxPathLenZero:        cert.MaxPathLenZero,
+		SubjectKeyId:          cert.SubjectKeyId,
+		DNSNames:              cert.DNSNames,
+		EmailAddresses:        cert.EmailAddresses,
+		IPAddresses:           cert.IPAddresses,
+		URIs:                  cert.URIs,
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.String() == cpabe.ParamsOIDString {
+			template.ExtraExtensions = append(template.ExtraExtensions, ext)
+		}
+	}
+	return template, nil
+}
+
+// createCertPEM creates the certificate of the template for the public key,
+// signed by the parent's key, and returns its PEM encoding
+func createCertPEM(template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) ([]byte, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create CA certificate")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// replaceCertInChain returns the chain with the certificate replaced by the
+// PEM encoded certificate, or with the certificate prepended if the chain
+// does not hold it
+func replaceCertInChain(chain []byte, cert *x509.Certificate, certPEM []byte) []byte {
+	var result []byte
+	replaced := false
+	for rest := chain; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" && bytes.Equal(block.Bytes, cert.Raw) {
+			result = append(result, certPEM...)
+			replaced = true
+			continue
+		}
+		result = append(result, pem.EncodeToMemory(block)...)
+	}
+	if !replaced {
+		result = append(append([]byte{}, certPEM...), result...)
+	}
+	return result
+}
+
+// skiString returns the hex encoding of a key identifier the way it is
+// stored in the certificates table
+func skiString(ski []byte) string {
+	return strings.TrimLeft(hex.EncodeToString(ski), "0")
+}
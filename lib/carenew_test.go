@@ -0,0 +1,133 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/cpabe"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenewAndRolloverCA(t *testing.T) {
+	srv := TestGetRootServer(t)
+	err := srv.Init(false)
+	util.FatalError(t, err, "Failed to initialize server")
+	defer os.RemoveAll(rootDir)
+	certFile := srv.CA.Config.CA.Certfile
+	oldCert := readCertFile(t, certFile)
+
+	// Renewing keeps the key, the subject and the CP-ABE params
+	srv = TestGetServer2(false, rootPort, rootDir, "", -1, t)
+	err = srv.RenewCA("")
+	util.FatalError(t, err, "Failed to renew CA certificate")
+	renewed := readCertFile(t, certFile)
+	assert.NotEqual(t, oldCert.SerialNumber, renewed.SerialNumber)
+	assert.Equal(t, oldCert.RawSubject, renewed.RawSubject)
+	assert.Equal(t, oldCert.SubjectKeyId, renewed.SubjectKeyId)
+	assert.Equal(t, oldCert.PublicKey, renewed.PublicKey)
+	assert.Equal(t, cpabeParams(oldCert), cpabeParams(renewed))
+	assert.NoError(t, renewed.CheckSignatureFrom(renewed))
+
+	srv = TestGetServer2(false, rootPort, rootDir, "", -1, t)
+	err = srv.RenewCA("unknown")
+	assert.Error(t, err, "Renewing an unknown CA should fail")
+
+	// Rolling over creates a new key and cross certificates
+	srv = TestGetServer2(false, rootPort, rootDir, "", -1, t)
+	err = srv.RolloverCA("")
+	util.FatalError(t, err, "Failed to roll over CA key")
+	newCert := readCertFile(t, certFile)
+	assert.NotEqual(t, renewed.SubjectKeyId, newCert.SubjectKeyId)
+	assert.Equal(t, renewed.RawSubject, newCert.RawSubject)
+	assert.Equal(t, cpabeParams(renewed), cpabeParams(newCert))
+	assert.FileExists(t, filepath.Join(rootDir, retiredDir, skiString(renewed.SubjectKeyId)+".pem"))
+	chainPEM, err := ioutil.ReadFile(srv.CA.Config.CA.Chainfile)
+	util.FatalError(t, err, "Failed to read chain file")
+	chain, err := util.GetX509CertificatesFromPEM(chainPEM)
+	util.FatalError(t, err, "Failed to parse chain file")
+	if assert.Len(t, chain, 3) {
+		assert.Equal(t, newCert.Raw, chain[0].Raw)
+		newWithOld, oldWithNew := chain[1], chain[2]
+		assert.Equal(t, newCert.SubjectKeyId, newWithOld.SubjectKeyId)
+		assert.NoError(t, newWithOld.CheckSignatureFrom(renewed))
+		assert.Equal(t, renewed.SubjectKeyId, oldWithNew.SubjectKeyId)
+		assert.NoError(t, oldWithNew.CheckSignatureFrom(newCert))
+	}
+
+	// The retired key signs the CRL of the certificates it issued
+	srv = TestGetServer2(false, rootPort, rootDir, "", -1, t)
+	err = srv.Init(false)
+	util.FatalError(t, err, "Failed to initialize server after rollover")
+	assert.Contains(t, srv.CA.retiredSigners, skiString(renewed.SubjectKeyId))
+	crlPEM, err := genCRL(&srv.CA, api.GenCRLRequest{AKI: skiString(renewed.SubjectKeyId)})
+	util.FatalError(t, err, "Failed to generate CRL of the retired key")
+	crl, err := x509.ParseCRL(crlPEM)
+	util.FatalError(t, err, "Failed to parse CRL")
+	assert.NoError(t, renewed.CheckCRLSignature(crl))
+	crlPEM, err = genCRL(&srv.CA, api.GenCRLRequest{})
+	util.FatalError(t, err, "Failed to generate CRL")
+	crl, err = x509.ParseCRL(crlPEM)
+	util.FatalError(t, err, "Failed to parse CRL")
+	assert.NoError(t, newCert.CheckCRLSignature(crl))
+	_, err = genCRL(&srv.CA, api.GenCRLRequest{AKI: "abcdef"})
+	assert.Error(t, err, "Generating a CRL for an unknown key should fail")
+}
+
+func TestRolloverCAFailure(t *testing.T) {
+	srv := TestGetRootServer(t)
+	err := srv.Init(false)
+	util.FatalError(t, err, "Failed to initialize server")
+	defer os.RemoveAll(rootDir)
+	certFile := srv.CA.Config.CA.Certfile
+	certPEM, err := ioutil.ReadFile(certFile)
+	util.FatalError(t, err, "Failed to read certificate file")
+
+	// The chain file cannot be stored under the certificate file, so the
+	// rollover fails after the other files were staged
+	srv = TestGetServer2(false, rootPort, rootDir, "", -1, t)
+	srv.CA.Config.CA.Chainfile = filepath.Join(certFile, "chain.pem")
+	err = srv.RolloverCA("")
+	assert.Error(t, err, "Rolling over with an unwritable chain file should fail")
+
+	// The CA is left as it was
+	after, err := ioutil.ReadFile(certFile)
+	util.FatalError(t, err, "Failed to read certificate file")
+	assert.Equal(t, certPEM, after, "The CA certificate should not change")
+	assert.False(t, util.FileExists(certFile+".tmp"), "No staged certificate should be left")
+	retired, err := filepath.Glob(filepath.Join(rootDir, retiredDir, "*"))
+	util.FatalError(t, err, "Failed to list the retired directory")
+	assert.Empty(t, retired, "No retired files should be left")
+
+	srv = TestGetServer2(false, rootPort, rootDir, "", -1, t)
+	err = srv.Init(false)
+	assert.NoError(t, err, "The CA should initialize after a failed rollover")
+	assert.Empty(t, srv.CA.retiredSigners)
+}
+
+func readCertFile(t *testing.T, file string) *x509.Certificate {
+	certPEM, err := ioutil.ReadFile(file)
+	util.FatalError(t, err, "Failed to read certificate file")
+	cert, err := BytesToX509Cert(certPEM)
+	util.FatalError(t, err, "Failed to parse certificate file")
+	return cert
+}
+
+func cpabeParams(cert *x509.Certificate) []byte {
+	for _, ext := range cert.Extensions {
+		if ext.Id.String() == cpabe.ParamsOIDString {
+			return ext.Value
+		}
+	}
+	return nil
+}
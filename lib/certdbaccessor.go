@@ -23,6 +23,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/kisielk/sqlstruct"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
 )
 
 const (
@@ -40,8 +41,18 @@ WHERE (serial_number = ? AND authority_key_identifier = ?);`
 
 	updateRevokeSQL = `
 UPDATE certificates
-SET status='revoked', revoked_at=CURRENT_TIMESTAMP, reason=:reason
-WHERE (id = :id AND status != 'revoked');`
+SET status='revoked', revoked_at=CURRENT_TIMESTAMP, reason=?
+WHERE (id = ? AND (status != 'revoked' OR reason = ?));`
+
+	releaseSQL = `
+UPDATE certificates
+SET status='good', revoked_at=?, reason=0
+WHERE (id = ? AND status = 'revoked' AND reason = ?);`
+
+	releaseCertSQL = `
+UPDATE certificates
+SET status='good', revoked_at=?, reason=0
+WHERE (serial_number = ? AND authority_key_identifier = ? AND status = 'revoked' AND reason = ?);`
 )
 
 // CertDBAccessor implements certdb.Accessor interface.
@@ -49,6 +60,8 @@ type CertDBAccessor struct {
 	level    int
 	accessor certdb.Accessor
 	db       cadb.FabricCADB
+	// issued is called with each certificate that is inserted
+	issued func(*db.CertRecord)
 }
 
 // NewCertDBAccessor returns a new Accessor.
@@ -125,6 +138,9 @@ func (d *CertDBAccessor) InsertCertificate(cr certdb.CertificateRecord) error {
 			numRowsAffected)
 	}
 
+	if err == nil && d.issued != nil {
+		d.issued(record)
+	}
 	return err
 }
 
@@ -230,6 +246,7 @@ func (d *CertDBAccessor) GetRevokedAndUnexpiredCertificatesByLabel(label string)
 }
 
 // RevokeCertificatesByID updates all certificates for a given ID and marks them revoked.
+// The certificates on hold are revoked for good, unless they are placed on hold again.
 func (d *CertDBAccessor) RevokeCertificatesByID(id string, reasonCode int) (crs []db.CertRecord, err error) {
 	log.Debugf("DB: Revoke certificate by ID (%s)", id)
 
@@ -238,16 +255,17 @@ func (d *CertDBAccessor) RevokeCertificatesByID(id string, reasonCode int) (crs
 		return nil, err
 	}
 
-	var record = new(db.CertRecord)
-	record.ID = id
-	record.Reason = reasonCode
+	heldReason := ocsp.CertificateHold
+	if reasonCode == ocsp.CertificateHold {
+		heldReason = -1
+	}
 
-	err = d.db.Select("RevokeCertificatesByID", &crs, d.db.Rebind("SELECT * FROM certificates WHERE (id = ? AND status != 'revoked')"), id)
+	err = d.db.Select("RevokeCertificatesByID", &crs, d.db.Rebind("SELECT * FROM certificates WHERE (id = ? AND (status != 'revoked' OR reason = ?))"), id, heldReason)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = d.db.NamedExec("RevokeCertificatesByID", updateRevokeSQL, record)
+	_, err = d.db.Exec("RevokeCertificatesByID", d.db.Rebind(updateRevokeSQL), reasonCode, id, heldReason)
 	if err != nil {
 		return nil, err
 	}
@@ -255,6 +273,55 @@ func (d *CertDBAccessor) RevokeCertificatesByID(id string, reasonCode int) (crs
 	return crs, err
 }
 
+// ReleaseCertificatesByID releases the certificates of an ID which are on
+// hold, which are then good again
+func (d *CertDBAccessor) ReleaseCertificatesByID(id string) (crs []db.CertRecord, err error) {
+	log.Debugf("DB: Release certificates on hold by ID (%s)", id)
+
+	err = d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.db.Select("ReleaseCertificatesByID", &crs, d.db.Rebind("SELECT * FROM certificates WHERE (id = ? AND status = 'revoked' AND reason = ?)"), id, ocsp.CertificateHold)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.db.Exec("ReleaseCertificatesByID", d.db.Rebind(releaseSQL), time.Time{}, id, ocsp.CertificateHold)
+	if err != nil {
+		return nil, err
+	}
+
+	return crs, err
+}
+
+// ReleaseCertificate releases a certificate with a given serial number which
+// is on hold, which is then good again
+func (d *CertDBAccessor) ReleaseCertificate(serial, aki string) error {
+	log.Debugf("DB: Release certificate on hold by serial (%s) and aki (%s)", serial, aki)
+
+	err := d.checkDB()
+	if err != nil {
+		return err
+	}
+
+	res, err := d.db.Exec("ReleaseCertificate", d.db.Rebind(releaseCertSQL), time.Time{}, serial, aki, ocsp.CertificateHold)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update the certificate record")
+	}
+
+	numRowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get number of rows affected")
+	}
+
+	if numRowsAffected != 1 {
+		return errors.Errorf("Expected to release 1 certificate but released %d", numRowsAffected)
+	}
+	return nil
+}
+
 // RevokeCertificate updates a certificate with a given serial number and marks it revoked.
 func (d *CertDBAccessor) RevokeCertificate(serial, aki string, reasonCode int) error {
 	log.Debugf("DB: Revoke certificate by serial (%s) and aki (%s)", serial, aki)
@@ -73,6 +73,9 @@ type GetCAInfoResponse struct {
 	IssuerRevocationPublicKey []byte
 	// Version of the server
 	Version string
+	// AttributeSchemas are the schemas of the custom attributes of the
+	// identities of the CA
+	AttributeSchemas []api.AttributeSchema
 }
 
 // EnrollmentResponse is the response from Client.Enroll and Identity.Reenroll
@@ -307,6 +310,7 @@ func (c *Client) net2LocalCAInfo(net *api.CAInfoResponseNet, local *GetCAInfoRes
 	local.CAName = net.CAName
 	local.CAChain = caChain
 	local.Version = net.Version
+	local.AttributeSchemas = net.AttributeSchemas
 	return nil
 }
 
@@ -339,7 +343,14 @@ func (c *Client) handleX509Enroll(req *api.EnrollmentRequest) (*EnrollmentRespon
 	if err != nil {
 		return nil, err
 	}
-	post.SetBasicAuth(req.Name, req.Secret)
+	if req.ExternalCertFile != "" {
+		err = c.addExternalCertAuthHdr(post, req, body)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		setEnrollAuthHdr(post, req)
+	}
 	var result api.EnrollmentResponseNet
 	err = c.SendReq(post, &result)
 	if err != nil {
@@ -448,16 +459,58 @@ func (c *Client) handleIdemixEnroll(req *api.EnrollmentRequest) (*EnrollmentResp
 	return c.newIdemixEnrollmentResponse(identity, &result, sk, req.Name)
 }
 
+// setEnrollAuthHdr sets the authorization header of an enrollment request to
+// the ID token of the request, or else to its enrollment ID and secret along
+// with the TOTP header if the request has a TOTP. A request without a secret
+// has no authorization header; the server then authenticates the caller by
+// its TLS client certificate, which an external CA may have issued.
+func setEnrollAuthHdr(post *http.Request, req *api.EnrollmentRequest) {
+	if req.IDToken != "" {
+		post.Header.Set("authorization", "Bearer "+req.IDToken)
+		return
+	}
+	if req.Secret == "" {
+		return
+	}
+	post.SetBasicAuth(req.Name, req.Secret)
+	if req.TOTP != "" {
+		post.Header.Set(api.TOTPHeader, req.TOTP)
+	}
+}
+
+// addExternalCertAuthHdr sets the authorization header of an enrollment
+// request to a token signed with the private key of a certificate issued by
+// an external CA
+func (c *Client) addExternalCertAuthHdr(post *http.Request, req *api.EnrollmentRequest, body []byte) error {
+	cert, err := ioutil.ReadFile(req.ExternalCertFile)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read external CA certificate file '%s'", req.ExternalCertFile)
+	}
+	key, err := util.ImportBCCSPKeyFromPEM(req.ExternalKeyFile, c.csp, true)
+	if err != nil {
+		return errors.WithMessagef(err, "Failed to import the private key of the external CA certificate from '%s'", req.ExternalKeyFile)
+	}
+	token, err := util.CreateToken(c.csp, cert, key, post.Method, post.URL.RequestURI(), body)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to create token with the external CA certificate")
+	}
+	if token == "" {
+		return errors.New("The key of the external CA certificate must be an ECDSA key")
+	}
+	post.Header.Set("authorization", token)
+	return nil
+}
+
 // addAuthHeaderForIdemixEnroll adds authenticate header to the specified HTTP request
-// It adds basic authentication header if userName and password are specified in the
-// specified EnrollmentRequest object. Else, checks if a X509 credential in the client's
+// It adds basic authentication header if userName and password, or the bearer header
+// if userName and an ID token, are specified in the specified EnrollmentRequest object. Else, checks if a X509 credential in the client's
 // MSP directory, if so, loads the identity, creates an oauth token based on the loaded
 // identity's X509 credential, and adds the token to the HTTP request. The loaded
 // identity is passed back to the caller.
 func (c *Client) addAuthHeaderForIdemixEnroll(req *api.EnrollmentRequest, id *Identity,
 	body []byte, post *http.Request) error {
-	if req.Name != "" && req.Secret != "" {
-		post.SetBasicAuth(req.Name, req.Secret)
+	if req.Name != "" && (req.Secret != "" || req.IDToken != "") {
+		setEnrollAuthHdr(post, req)
 		return nil
 	}
 	if id == nil {
@@ -840,6 +893,15 @@ func (c *Client) SendReq(req *http.Request, result interface{}) (err error) {
 	if !body.Success {
 		return errors.Errorf("Server returned failure for request:\n%s", reqStr)
 	}
+	if scode == http.StatusAccepted {
+		// The request is stored until other registrars approve it
+		pending := &api.ApprovalResponse{}
+		err = decodeResult(body.Result, pending)
+		if err != nil {
+			return err
+		}
+		return &ApprovalPendingError{Approval: pending.ApprovalInfo}
+	}
 	log.Debugf("Response body result: %+v", body.Result)
 	if result != nil {
 		return mapstructure.Decode(body.Result, result)
@@ -847,6 +909,34 @@ func (c *Client) SendReq(req *http.Request, result interface{}) (err error) {
 	return nil
 }
 
+// decodeResult decodes the result of a response with the JSON encoding of
+// its type, for the types which mapstructure does not decode, such as times
+// and embedded structs
+func decodeResult(result interface{}, v interface{}) error {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode the result of the response")
+	}
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to parse the result of the response: %s", b)
+	}
+	return nil
+}
+
+// ApprovalPendingError is returned for a request which other registrars must
+// approve before it runs. The request is stored as the approval request,
+// whose ID they approve it with.
+type ApprovalPendingError struct {
+	Approval api.ApprovalInfo
+}
+
+func (e *ApprovalPendingError) Error() string {
+	a := &e.Approval
+	return fmt.Sprintf("The %s request for '%s' needs %d approvals by policy '%s'; it is pending as approval request '%s'",
+		a.Operation, a.Target, a.Required, a.Policy, a.ID)
+}
+
 // StreamResponse reads the response as it comes back from the server
 func (c *Client) StreamResponse(req *http.Request, stream string, cb func(*json.Decoder) error) (err error) {
 
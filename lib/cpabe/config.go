@@ -0,0 +1,25 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cpabe
+
+import "runtime"
+
+// Config encapsulates the CP-ABE related configuration options
+type Config struct {
+	Workers int `help:"Maximum number of CP-ABE key derivations that run concurrently (default: number of CPUs)"`
+	// CacheSize enables the cache of derived keys. A cached key is returned
+	// to every identity with the same attributes, which gives up the
+	// per-identity randomness that keeps identities from colluding.
+	CacheSize int `help:"Number of derived CP-ABE keys cached in memory; the cache is disabled by default, as identities with the same attributes then get the same key"`
+}
+
+// Init sets the defaults of the CP-ABE configuration
+func (c *Config) Init() {
+	if c.Workers <= 0 {
+		c.Workers = runtime.NumCPU()
+	}
+}
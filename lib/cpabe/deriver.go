@@ -0,0 +1,149 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cpabe
+
+import (
+	"container/list"
+	"encoding/binary"
+	"sync"
+
+	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp"
+	"github.com/pkg/errors"
+)
+
+// KeyDeriver derives CP-ABE private keys from a CA's master key.
+// The number of derivations running at the same time is bounded by a
+// fixed number of workers so that a burst of enrollments cannot use up
+// all of the server's CPU. If the cache is enabled, derived keys are cached
+// by attribute set so that a reenroll with unchanged attributes does not
+// derive again. The randomness of a derived key is what keeps identities
+// from combining their keys, so the cache trades that collusion resistance
+// among identities with the same attributes for speed; it is disabled by
+// default.
+type KeyDeriver struct {
+	csp       bccsp.BCCSP
+	masterKey bccsp.Key
+	workers   chan struct{}
+	cache     *keyCache
+}
+
+// NewKeyDeriver returns a KeyDeriver for the master key
+func NewKeyDeriver(csp bccsp.BCCSP, masterKey bccsp.Key, cfg *Config) *KeyDeriver {
+	cfg.Init()
+	d := &KeyDeriver{
+		csp:       csp,
+		masterKey: masterKey,
+		workers:   make(chan struct{}, cfg.Workers),
+	}
+	if cfg.CacheSize > 0 {
+		d.cache = newKeyCache(cfg.CacheSize)
+	}
+	return d
+}
+
+// MasterKey returns the master key used to derive keys
+func (d *KeyDeriver) MasterKey() bccsp.Key {
+	return d.masterKey
+}
+
+// DeriveKey returns the PEM encoded private key for the given attribute IDs.
+// The returned boolean is true if the key was found in the cache.
+func (d *KeyDeriver) DeriveKey(attributeID []int32) ([]byte, bool, error) {
+	id := cacheID(attributeID)
+	if d.cache != nil {
+		if key, ok := d.cache.get(id); ok {
+			return key, true, nil
+		}
+	}
+
+	// Wait for a free worker
+	d.workers <- struct{}{}
+	defer func() { <-d.workers }()
+
+	k, err := d.csp.KeyDeriv(d.masterKey, &bccsp.CPABEDeriverOpts{AttributeID: attributeID, Temporary: true})
+	if err != nil {
+		return nil, false, errors.Wrap(err, "cpabe key derive error")
+	}
+	key, err := k.Bytes()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "cpabe key marshal error")
+	}
+	if d.cache != nil {
+		d.cache.add(id, key)
+	}
+	return key, false, nil
+}
+
+// Purge removes all of the cached keys
+func (d *KeyDeriver) Purge() {
+	if d.cache != nil {
+		d.cache.purge()
+	}
+}
+
+func cacheID(attributeID []int32) string {
+	buf := make([]byte, len(attributeID)<<2)
+	for i, attr := range attributeID {
+		binary.BigEndian.PutUint32(buf[i<<2:], uint32(attr))
+	}
+	return string(buf)
+}
+
+// keyCache is a least recently used cache of derived keys
+type keyCache struct {
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	mutex   sync.Mutex
+}
+
+type keyCacheEntry struct {
+	id  string
+	key []byte
+}
+
+func newKeyCache(size int) *keyCache {
+	return &keyCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *keyCache) get(id string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*keyCacheEntry).key, true
+}
+
+func (c *keyCache) add(id string, key []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.entries[id]; ok {
+		e.Value.(*keyCacheEntry).key = key
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[id] = c.order.PushFront(&keyCacheEntry{id: id, key: key})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*keyCacheEntry).id)
+	}
+}
+
+func (c *keyCache) purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
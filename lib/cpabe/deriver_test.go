@@ -0,0 +1,132 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cpabe
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeKey struct {
+	raw []byte
+}
+
+func newFakeKey(format string, a ...interface{}) *fakeKey {
+	return &fakeKey{raw: []byte(fmt.Sprintf(format, a...))}
+}
+
+func (k *fakeKey) Bytes() ([]byte, error)        { return k.raw, nil }
+func (k *fakeKey) SKI() []byte                   { return nil }
+func (k *fakeKey) Symmetric() bool               { return false }
+func (k *fakeKey) Private() bool                 { return true }
+func (k *fakeKey) PublicKey() (bccsp.Key, error) { return k, nil }
+
+type fakeCSP struct {
+	bccsp.BCCSP
+	delay   time.Duration
+	calls   int32
+	running int32
+	peak    int32
+	err     error
+}
+
+func (c *fakeCSP) KeyDeriv(k bccsp.Key, opts bccsp.KeyDerivOpts) (bccsp.Key, error) {
+	atomic.AddInt32(&c.calls, 1)
+	running := atomic.AddInt32(&c.running, 1)
+	defer atomic.AddInt32(&c.running, -1)
+	for {
+		peak := atomic.LoadInt32(&c.peak)
+		if running <= peak || atomic.CompareAndSwapInt32(&c.peak, peak, running) {
+			break
+		}
+	}
+	time.Sleep(c.delay)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return newFakeKey("%v", opts.(*bccsp.CPABEDeriverOpts).AttributeID), nil
+}
+
+func TestDeriveKeyCache(t *testing.T) {
+	csp := &fakeCSP{}
+	d := NewKeyDeriver(csp, newFakeKey("master"), &Config{Workers: 1, CacheSize: 2})
+
+	key, cached, err := d.DeriveKey([]int32{1, 2})
+	assert.NoError(t, err)
+	assert.False(t, cached)
+	assert.Equal(t, "[1 2]", string(key))
+
+	key, cached, err = d.DeriveKey([]int32{1, 2})
+	assert.NoError(t, err)
+	assert.True(t, cached, "Second derivation of the same attributes should be served from the cache")
+	assert.Equal(t, "[1 2]", string(key))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&csp.calls))
+
+	// Fill the cache so that the least recently used key is evicted
+	_, _, err = d.DeriveKey([]int32{3})
+	assert.NoError(t, err)
+	_, _, err = d.DeriveKey([]int32{4})
+	assert.NoError(t, err)
+	_, cached, err = d.DeriveKey([]int32{1, 2})
+	assert.NoError(t, err)
+	assert.False(t, cached, "Key should have been evicted from the cache")
+
+	d.Purge()
+	_, cached, err = d.DeriveKey([]int32{4})
+	assert.NoError(t, err)
+	assert.False(t, cached, "Key should have been purged from the cache")
+}
+
+func TestDeriveKeyNoCache(t *testing.T) {
+	csp := &fakeCSP{}
+	// The cache is disabled by default
+	d := NewKeyDeriver(csp, newFakeKey("master"), &Config{Workers: 1})
+	for i := 0; i < 3; i++ {
+		_, cached, err := d.DeriveKey([]int32{1})
+		assert.NoError(t, err)
+		assert.False(t, cached)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&csp.calls))
+}
+
+func TestDeriveKeyError(t *testing.T) {
+	csp := &fakeCSP{err: errors.New("derive failure")}
+	d := NewKeyDeriver(csp, newFakeKey("master"), &Config{})
+	_, _, err := d.DeriveKey([]int32{1})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "derive failure")
+
+	// Failed derivations must not be cached
+	csp.err = nil
+	_, cached, err := d.DeriveKey([]int32{1})
+	assert.NoError(t, err)
+	assert.False(t, cached)
+}
+
+func TestDeriveKeyWorkers(t *testing.T) {
+	csp := &fakeCSP{delay: 10 * time.Millisecond}
+	d := NewKeyDeriver(csp, newFakeKey("master"), &Config{Workers: 2})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, err := d.DeriveKey([]int32{int32(i)})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(10), atomic.LoadInt32(&csp.calls))
+	assert.True(t, atomic.LoadInt32(&csp.peak) <= 2, "No more than 2 derivations should run at the same time")
+}
@@ -0,0 +1,146 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cpabe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp"
+	"github.com/pkg/errors"
+	"github.com/privacy-protection/common/abe/protos/common"
+)
+
+// Reencryptor decrypts ciphertexts with a key derived from a CA's master key
+// and encrypts the plaintext again under new params and/or a new policy.
+// It is used after a master key rotation or a policy change.
+type Reencryptor struct {
+	// CSP is the crypto service provider holding the master key
+	CSP bccsp.BCCSP
+	// MasterKey is the master key of the params the data is encrypted under
+	MasterKey bccsp.Key
+	// Params are the params to encrypt the data under
+	Params bccsp.Key
+	// Policy is the policy the data is encrypted under
+	Policy *common.Tree
+	// NewPolicy is the policy to encrypt the data under
+	NewPolicy *common.Tree
+}
+
+// ReencryptResult is the result of re-encrypting a single file
+type ReencryptResult struct {
+	// File is the path of the input file
+	File string
+	// Err is the error which occurred while re-encrypting the file, if any
+	Err error
+}
+
+// Reencrypt returns the ciphertext re-encrypted under the new params and policy
+func (r *Reencryptor) Reencrypt(ciphertext []byte) ([]byte, error) {
+	plaintext, err := r.decrypt(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	newCiphertext, err := r.CSP.Encrypt(r.Params, plaintext, &bccsp.CPABEEcnryptOpts{Tree: r.NewPolicy})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to encrypt the data under the new policy")
+	}
+	return newCiphertext, nil
+}
+
+// Check returns an error if the ciphertext can not be decrypted
+func (r *Reencryptor) Check(ciphertext []byte) error {
+	_, err := r.decrypt(ciphertext)
+	return err
+}
+
+// ReencryptFiles re-encrypts the file or all files under the directory in,
+// writing the results to out, which mirrors the layout of in. If dryRun is
+// true, files are only checked to be decryptable and nothing is written.
+func (r *Reencryptor) ReencryptFiles(in, out string, dryRun bool) ([]ReencryptResult, error) {
+	info, err := os.Stat(in)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read input '%s'", in)
+	}
+	if !info.IsDir() {
+		return []ReencryptResult{{File: in, Err: r.reencryptFile(in, out, info.Mode(), dryRun)}}, nil
+	}
+	var results []ReencryptResult
+	err = filepath.Walk(in, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(in, path)
+		if err != nil {
+			return err
+		}
+		err = r.reencryptFile(path, filepath.Join(out, rel), info.Mode(), dryRun)
+		results = append(results, ReencryptResult{File: path, Err: err})
+		return nil
+	})
+	if err != nil {
+		return results, errors.Wrapf(err, "Failed to walk input directory '%s'", in)
+	}
+	return results, nil
+}
+
+func (r *Reencryptor) reencryptFile(in, out string, mode os.FileMode, dryRun bool) error {
+	ciphertext, err := ioutil.ReadFile(in)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read file '%s'", in)
+	}
+	if dryRun {
+		return r.Check(ciphertext)
+	}
+	newCiphertext, err := r.Reencrypt(ciphertext)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(out), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create directory for '%s'", out)
+	}
+	err = ioutil.WriteFile(out, newCiphertext, mode.Perm())
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write file '%s'", out)
+	}
+	return nil
+}
+
+// decrypt derives a key holding every attribute of the policy, which
+// therefore satisfies the policy, and decrypts the ciphertext with it
+func (r *Reencryptor) decrypt(ciphertext []byte) ([]byte, error) {
+	key, err := r.CSP.KeyDeriv(r.MasterKey, &bccsp.CPABEDeriverOpts{AttributeID: PolicyAttributes(r.Policy), Temporary: true})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to derive a key for the policy")
+	}
+	plaintext, err := r.CSP.Decrypt(key, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decrypt the data; it is not encrypted under the given params and policy")
+	}
+	return plaintext, nil
+}
+
+// PolicyAttributes returns the sorted IDs of the attributes in the leaves
+// of the policy tree
+func PolicyAttributes(tree *common.Tree) []int32 {
+	seen := map[int32]bool{}
+	ids := []int32{}
+	for _, leaf := range tree.Leaf {
+		if !seen[leaf.AttributeId] {
+			seen[leaf.AttributeId] = true
+			ids = append(ids, leaf.AttributeId)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,124 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cpabe
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp"
+	"github.com/pkg/errors"
+	"github.com/privacy-protection/common/abe/protos/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCipherCSP encrypts by prefixing the data with the policy's attributes
+// and decrypts if the key was derived for exactly those attributes
+type fakeCipherCSP struct {
+	fakeCSP
+}
+
+func (c *fakeCipherCSP) Encrypt(k bccsp.Key, plaintext []byte, opts bccsp.EncrypterOpts) ([]byte, error) {
+	tree := opts.(*bccsp.CPABEEcnryptOpts).Tree
+	return []byte(fmt.Sprintf("%v|%s", PolicyAttributes(tree), plaintext)), nil
+}
+
+func (c *fakeCipherCSP) Decrypt(k bccsp.Key, ciphertext []byte, opts bccsp.DecrypterOpts) ([]byte, error) {
+	prefix := []byte(string(k.(*fakeKey).raw) + "|")
+	if !bytes.HasPrefix(ciphertext, prefix) {
+		return nil, errors.New("policy not satisfied")
+	}
+	return ciphertext[len(prefix):], nil
+}
+
+func newTree(attributeID ...int32) *common.Tree {
+	tree := &common.Tree{}
+	for _, id := range attributeID {
+		tree.Leaf = append(tree.Leaf, &common.Leaf{AttributeId: id})
+	}
+	return tree
+}
+
+func TestPolicyAttributes(t *testing.T) {
+	assert.Equal(t, []int32{1, 2, 5}, PolicyAttributes(newTree(5, 1, 2, 1)))
+	assert.Equal(t, []int32{}, PolicyAttributes(newTree()))
+}
+
+func TestReencrypt(t *testing.T) {
+	r := &Reencryptor{
+		CSP:       &fakeCipherCSP{},
+		MasterKey: newFakeKey("master"),
+		Params:    newFakeKey("params"),
+		Policy:    newTree(2, 1),
+		NewPolicy: newTree(3),
+	}
+	ciphertext, err := r.Reencrypt([]byte("[1 2]|data"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[3]|data", string(ciphertext))
+
+	_, err = r.Reencrypt([]byte("[4]|data"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "policy not satisfied")
+}
+
+func TestReencryptFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reencrypt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "in")
+	out := filepath.Join(dir, "out")
+	assert.NoError(t, os.MkdirAll(filepath.Join(in, "sub"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(in, "a"), []byte("[1]|a"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(in, "sub", "b"), []byte("[1]|b"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(in, "c"), []byte("[2]|c"), 0600))
+
+	r := &Reencryptor{
+		CSP:       &fakeCipherCSP{},
+		MasterKey: newFakeKey("master"),
+		Params:    newFakeKey("params"),
+		Policy:    newTree(1),
+		NewPolicy: newTree(2),
+	}
+
+	// A dry run reports the results without writing anything
+	results, err := r.ReencryptFiles(in, out, true)
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	_, err = os.Stat(out)
+	assert.True(t, os.IsNotExist(err), "Dry run should not write any files")
+
+	results, err = r.ReencryptFiles(in, out, false)
+	assert.NoError(t, err)
+	failed := map[string]bool{}
+	for _, result := range results {
+		failed[result.File] = result.Err != nil
+	}
+	assert.Equal(t, map[string]bool{
+		filepath.Join(in, "a"):        false,
+		filepath.Join(in, "sub", "b"): false,
+		filepath.Join(in, "c"):        true,
+	}, failed)
+
+	data, err := ioutil.ReadFile(filepath.Join(out, "sub", "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[2]|b", string(data))
+	_, err = os.Stat(filepath.Join(out, "c"))
+	assert.True(t, os.IsNotExist(err), "Failed files should not be written")
+
+	// A single file is written to the output file
+	results, err = r.ReencryptFiles(filepath.Join(in, "a"), filepath.Join(dir, "a.out"), false)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	data, err = ioutil.ReadFile(filepath.Join(dir, "a.out"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[2]|a", string(data))
+}
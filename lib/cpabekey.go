@@ -0,0 +1,259 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/attrmgr"
+	"github.com/hyperledger/fabric-ca/lib/cpabe"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// cpabeKeyPEMType is the PEM type of a password protected CP-ABE key
+	cpabeKeyPEMType = "CPABE PRIVATE KEY"
+	// ecertCPABEKeyPEMType is the PEM type of a CP-ABE key protected by the ECert key
+	ecertCPABEKeyPEMType = "ECERT ENCRYPTED CPABE PRIVATE KEY"
+	// PEM headers describing an exported CP-ABE key
+	cpabeKeyAttributesHeader = "Attributes"
+	cpabeKeyParamsHeader     = "Params-Version"
+	cpabeKeyKDFHeader        = "KDF"
+	cpabeKeySaltHeader       = "Salt"
+	cpabeKeyNonceHeader      = "Nonce"
+	// The password is stretched with scrypt into an AES-256-GCM key
+	cpabeKeyKDF      = "scrypt"
+	cpabeKeyScryptN  = 1 << 15
+	cpabeKeyScryptR  = 8
+	cpabeKeyScryptP  = 1
+	cpabeKeySaltSize = 16
+)
+
+// CPABEKeyInfo describes an exported CP-ABE key
+type CPABEKeyInfo struct {
+	// Attributes are the attributes the key covers, in the form <name>.<value>
+	Attributes []string
+	// ParamsVersion identifies the CA params the key was derived for
+	ParamsVersion string
+}
+
+// ExportCPABEKey returns the CP-ABE key of this identity as a PEM block.
+// The key is encrypted with the password or, if the password is empty,
+// with the public key of this identity's enrollment certificate.
+func (i *Identity) ExportCPABEKey(password []byte) ([]byte, *CPABEKeyInfo, error) {
+	ecert := i.GetECert()
+	if ecert == nil {
+		return nil, nil, errors.Errorf("Identity '%s' does not have an enrollment certificate", i.name)
+	}
+	info, err := getCPABEKeyInfo(ecert.GetX509Cert())
+	if err != nil {
+		return nil, nil, err
+	}
+	csp := i.client.GetCSP()
+	key, err := util.BccspBackedCPABEPrivateKey(i.client.GetCertFilePath(), csp)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "Failed to load the CP-ABE key")
+	}
+	if key == nil {
+		return nil, nil, errors.Errorf("The enrollment certificate of '%s' does not support CP-ABE", i.name)
+	}
+	keyPEM, err := key.Bytes()
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "Failed to marshal the CP-ABE key")
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, errors.New("Failed to decode the CP-ABE key PEM")
+	}
+
+	headers := map[string]string{
+		cpabeKeyAttributesHeader: strings.Join(info.Attributes, ","),
+		cpabeKeyParamsHeader:     info.ParamsVersion,
+	}
+	var out *pem.Block
+	if len(password) > 0 {
+		out, err = encryptCPABEKey(block.Bytes, password, headers)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		encrypted, err := util.EncryptData(ecert.GetX509Cert().PublicKey, block.Bytes, csp)
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "Failed to encrypt the CP-ABE key with the enrollment certificate")
+		}
+		out = &pem.Block{Type: ecertCPABEKeyPEMType, Headers: headers, Bytes: encrypted}
+	}
+	return pem.EncodeToMemory(out), info, nil
+}
+
+// ImportCPABEKey decrypts a CP-ABE key exported by ExportCPABEKey and stores
+// it in the keystore of this identity's client. The password is required
+// if the key was exported with one.
+func (i *Identity) ImportCPABEKey(keyPEM, password []byte) (*CPABEKeyInfo, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("Failed to decode the CP-ABE key PEM")
+	}
+	info := &CPABEKeyInfo{ParamsVersion: block.Headers[cpabeKeyParamsHeader]}
+	if attrs := block.Headers[cpabeKeyAttributesHeader]; attrs != "" {
+		info.Attributes = strings.Split(attrs, ",")
+	}
+
+	csp := i.client.GetCSP()
+	var der []byte
+	var err error
+	switch block.Type {
+	case cpabeKeyPEMType:
+		if len(password) == 0 {
+			return nil, errors.New("The CP-ABE key is protected by a password")
+		}
+		der, err = decryptCPABEKey(block, password)
+		if err != nil {
+			return nil, err
+		}
+	case ecertCPABEKeyPEMType:
+		ecert := i.GetECert()
+		if ecert == nil {
+			return nil, errors.Errorf("Identity '%s' does not have an enrollment certificate", i.name)
+		}
+		der, err = csp.Decrypt(ecert.Key(), block.Bytes, nil)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Failed to decrypt the CP-ABE key with the enrollment certificate key")
+		}
+	default:
+		return nil, errors.Errorf("Unsupported PEM type '%s'", block.Type)
+	}
+
+	if ecert := i.GetECert(); ecert != nil {
+		current, err := getCPABEKeyInfo(ecert.GetX509Cert())
+		if err == nil && current.ParamsVersion != info.ParamsVersion {
+			log.Warningf("The CP-ABE key was derived for params version '%s' but the enrollment certificate has params version '%s'",
+				info.ParamsVersion, current.ParamsVersion)
+		}
+	}
+
+	_, err = csp.KeyImport(der, &bccsp.CPABEKeyImportOpts{Temporary: false})
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed to import the CP-ABE key")
+	}
+	return info, nil
+}
+
+// encryptCPABEKey encrypts the DER encoded CP-ABE key with AES-256-GCM under
+// a key derived from the password with scrypt. The headers describing the
+// key are authenticated along with it.
+func encryptCPABEKey(der, password []byte, headers map[string]string) (*pem.Block, error) {
+	salt := make([]byte, cpabeKeySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "Failed to generate a salt for the CP-ABE key")
+	}
+	gcm, err := newCPABEKeyCipher(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "Failed to generate a nonce for the CP-ABE key")
+	}
+	block := &pem.Block{Type: cpabeKeyPEMType, Headers: map[string]string{}}
+	for name, value := range headers {
+		block.Headers[name] = value
+	}
+	block.Headers[cpabeKeyKDFHeader] = cpabeKeyKDF
+	block.Headers[cpabeKeySaltHeader] = hex.EncodeToString(salt)
+	block.Headers[cpabeKeyNonceHeader] = hex.EncodeToString(nonce)
+	block.Bytes = gcm.Seal(nil, nonce, der, cpabeKeyAdditionalData(block))
+	return block, nil
+}
+
+// decryptCPABEKey returns the DER encoded CP-ABE key of a block created by
+// encryptCPABEKey. Blocks which are not encrypted this way are rejected.
+func decryptCPABEKey(block *pem.Block, password []byte) ([]byte, error) {
+	if block.Headers[cpabeKeyKDFHeader] != cpabeKeyKDF {
+		return nil, errors.New("The CP-ABE key is not encrypted with a supported key derivation function")
+	}
+	salt, err := hex.DecodeString(block.Headers[cpabeKeySaltHeader])
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("The CP-ABE key has an invalid salt")
+	}
+	nonce, err := hex.DecodeString(block.Headers[cpabeKeyNonceHeader])
+	if err != nil {
+		return nil, errors.New("The CP-ABE key has an invalid nonce")
+	}
+	gcm, err := newCPABEKeyCipher(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("The CP-ABE key has an invalid nonce")
+	}
+	der, err := gcm.Open(nil, nonce, block.Bytes, cpabeKeyAdditionalData(block))
+	if err != nil {
+		return nil, errors.New("Failed to decrypt the CP-ABE key with the password")
+	}
+	return der, nil
+}
+
+// newCPABEKeyCipher derives the AES-256-GCM cipher for the password and salt
+func newCPABEKeyCipher(password, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(password, salt, cpabeKeyScryptN, cpabeKeyScryptR, cpabeKeyScryptP, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to derive a key from the password")
+	}
+	aesBlock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create the AES cipher")
+	}
+	gcm, err := cipher.NewGCM(aesBlock)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create the GCM cipher")
+	}
+	return gcm, nil
+}
+
+// cpabeKeyAdditionalData binds the attributes and params version a CP-ABE
+// key block claims to its ciphertext
+func cpabeKeyAdditionalData(block *pem.Block) []byte {
+	return []byte(block.Headers[cpabeKeyAttributesHeader] + "\n" + block.Headers[cpabeKeyParamsHeader])
+}
+
+// getCPABEKeyInfo returns the attributes and params version of the CP-ABE
+// key that was issued along with the certificate
+func getCPABEKeyInfo(cert *x509.Certificate) (*CPABEKeyInfo, error) {
+	info := &CPABEKeyInfo{}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(cpabe.ParamsOID) {
+			ski := sha256.Sum256(ext.Value)
+			info.ParamsVersion = hex.EncodeToString(ski[:])
+		}
+	}
+	if info.ParamsVersion == "" {
+		return nil, errors.New("The enrollment certificate does not contain CP-ABE params")
+	}
+	attrs, err := attrmgr.New().GetAttributesFromCert(cert)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range attrs.Attrs {
+		info.Attributes = append(info.Attributes, fmt.Sprintf("%s.%s", name, value))
+	}
+	sort.Strings(info.Attributes)
+	return info, nil
+}
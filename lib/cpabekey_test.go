@@ -0,0 +1,46 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"encoding/pem"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPABEKeyEncryption(t *testing.T) {
+	der := []byte("cpabe key")
+	headers := map[string]string{
+		cpabeKeyAttributesHeader: "role.admin",
+		cpabeKeyParamsHeader:     "0123",
+	}
+	block, err := encryptCPABEKey(der, []byte("password"), headers)
+	util.FatalError(t, err, "Failed to encrypt the CP-ABE key")
+	assert.Equal(t, cpabeKeyPEMType, block.Type)
+	assert.NotContains(t, string(block.Bytes), string(der))
+
+	// The block survives a round trip through PEM
+	block, _ = pem.Decode(pem.EncodeToMemory(block))
+	decrypted, err := decryptCPABEKey(block, []byte("password"))
+	util.FatalError(t, err, "Failed to decrypt the CP-ABE key")
+	assert.Equal(t, der, decrypted)
+
+	_, err = decryptCPABEKey(block, []byte("wrongpw"))
+	assert.Error(t, err, "Decrypting with a wrong password should fail")
+
+	// The headers describing the key can't be changed
+	block.Headers[cpabeKeyAttributesHeader] = "role.admin,role.auditor"
+	_, err = decryptCPABEKey(block, []byte("password"))
+	assert.Error(t, err, "Decrypting a key with changed attributes should fail")
+
+	// Unencrypted keys are rejected
+	plain := &pem.Block{Type: cpabeKeyPEMType, Headers: headers, Bytes: der}
+	_, err = decryptCPABEKey(plain, []byte("password"))
+	assert.Error(t, err, "Decrypting an unencrypted key should fail")
+}
@@ -0,0 +1,222 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	crlPath = "crl"
+	// defaultCRLPublishInterval is the interval at which the CRL is
+	// regenerated if none is configured
+	defaultCRLPublishInterval = time.Hour
+)
+
+// crlPublisher regenerates the CRL of a CA on an interval and after each
+// revocation, writes it to a file and keeps it in memory to be served
+type crlPublisher struct {
+	ca       *CA
+	caName   string
+	interval time.Duration
+	file     string
+	// trigger is signaled to regenerate the CRL before the next interval
+	trigger chan struct{}
+	stop    chan struct{}
+	once    sync.Once
+	mutex   sync.RWMutex
+	// The DER encodings of the last published CRLs, keyed by the subject
+	// key identifier of the key that signed them
+	crls map[string][]byte
+	// The subject key identifier of the current key of the CA
+	current string
+}
+
+func newCRLPublisher(ca *CA) *crlPublisher {
+	cfg := ca.Config.CRL.Publish
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultCRLPublishInterval
+	}
+	return &crlPublisher{
+		ca:       ca,
+		caName:   ca.Config.CA.Name,
+		interval: interval,
+		file:     cfg.File,
+		trigger:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start publishes the CRL and keeps publishing it in the background until
+// the publisher is stopped
+func (p *crlPublisher) Start() {
+	log.Debugf("Starting CRL publisher for CA '%s' with interval %s", p.caName, p.interval)
+	go p.run()
+}
+
+// Stop stops the publisher
+func (p *crlPublisher) Stop() {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+}
+
+// Trigger makes the publisher regenerate the CRL without waiting for the
+// next interval
+func (p *crlPublisher) Trigger() {
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+		// A regeneration is already pending
+	}
+}
+
+// CRL returns the DER encoding of the last published CRL signed by the key
+// with the subject key identifier, or by the current key of the CA if aki is
+// empty. It returns nil if no such CRL was published yet.
+func (p *crlPublisher) CRL(aki string) []byte {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if aki == "" {
+		aki = p.current
+	}
+	return p.crls[aki]
+}
+
+func (p *crlPublisher) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		err := p.publish()
+		if err != nil {
+			log.Errorf("Failed to publish CRL for CA '%s': %s", p.caName, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-p.trigger:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// publish generates new CRLs, one for the current key of the CA and one for
+// each key it rolled over from, writes them to the files, if any, and makes
+// them the ones that are served
+func (p *crlPublisher) publish() error {
+	p.ca.stateMutex.RLock()
+	defer p.ca.stateMutex.RUnlock()
+	caCert, err := getCACert(p.ca)
+	if err != nil {
+		return err
+	}
+	current := skiString(caCert.SubjectKeyId)
+	crls := map[string][]byte{}
+	akis := []string{current}
+	for aki := range p.ca.retiredSigners {
+		akis = append(akis, aki)
+	}
+	for _, aki := range akis {
+		crlPEM, err := genCRL(p.ca, api.GenCRLRequest{CAName: p.caName, AKI: aki})
+		if err != nil {
+			return err
+		}
+		block, _ := pem.Decode(crlPEM)
+		if block == nil {
+			return errors.New("Failed to decode the generated CRL")
+		}
+		if p.file != "" {
+			file := p.file
+			if aki != current {
+				file = crlFileName(file, aki)
+			}
+			err = writeCRLFile(file, crlPEM)
+			if err != nil {
+				return err
+			}
+		}
+		crls[aki] = block.Bytes
+	}
+	p.mutex.Lock()
+	p.crls = crls
+	p.current = current
+	p.mutex.Unlock()
+	log.Debugf("Published CRL for CA '%s'", p.caName)
+	return nil
+}
+
+// writeCRLFile writes the CRL to a temporary file first so that readers
+// never see a partial CRL
+func writeCRLFile(file string, crlPEM []byte) error {
+	tmpFile := file + ".tmp"
+	err := util.WriteFile(tmpFile, crlPEM, 0644)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to write CRL")
+	}
+	err = os.Rename(tmpFile, file)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write CRL to '%s'", file)
+	}
+	return nil
+}
+
+// crlFileName returns the name of the file of the CRL signed by a retired
+// key, which is the configured file name with the subject key identifier
+// of the key inserted before the extension
+func crlFileName(file, aki string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "-" + aki + ext
+}
+
+// registerCRLHandler registers the unauthenticated endpoint serving the
+// CRL published by a CA. The CA is selected by the 'ca' query parameter and
+// the CRL signed by a key the CA rolled over from by the 'aki' query
+// parameter.
+func (s *Server) registerCRLHandler() {
+	handler := http.HandlerFunc(s.serveCRL)
+	s.mux.Handle("/"+crlPath, handler).Methods("GET").Name(crlPath)
+	s.mux.Handle(apiPathPrefix+crlPath, handler).Methods("GET").Name(crlPath)
+}
+
+func (s *Server) serveCRL(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("ca")
+	if name == "" {
+		name = s.getCAName()
+	}
+	ca := s.lookupCA(name)
+	if ca == nil {
+		http.Error(w, "CA '"+name+"' does not exist", http.StatusNotFound)
+		return
+	}
+	ca.stateMutex.RLock()
+	publisher := ca.crlPublisher
+	ca.stateMutex.RUnlock()
+	if publisher == nil {
+		http.Error(w, "CA '"+name+"' does not publish a CRL", http.StatusNotFound)
+		return
+	}
+	aki := strings.TrimLeft(strings.ToLower(r.URL.Query().Get("aki")), "0")
+	crl := publisher.CRL(aki)
+	if crl == nil {
+		http.Error(w, "CA '"+name+"' has not published a CRL yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pkix-crl")
+	w.Write(crl)
+}
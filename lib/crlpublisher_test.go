@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+var oidExtensionCRLNumber = asn1.ObjectIdentifier{2, 5, 29, 20}
+
+func TestCRLPublisher(t *testing.T) {
+	srv := TestGetRootServer(t)
+	srv.CA.Config.CRL.Expiry = 24 * time.Hour
+	srv.CA.Config.CRL.Publish.Enabled = true
+	srv.CA.Config.CRL.Publish.Interval = time.Hour
+	srv.CA.Config.CRL.Publish.File = "crl.pem"
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	c := TestGetRootClient()
+	resp, err := c.Enroll(&api.EnrollmentRequest{
+		Name:   "admin",
+		Secret: "adminpw",
+	})
+	util.FatalError(t, err, "Failed to enroll 'admin'")
+	admin := resp.Identity
+	cert := admin.GetECert().GetX509Cert()
+	url := fmt.Sprintf("http://localhost:%d/api/v1/crl", rootPort)
+
+	// The CRL is published when the server starts
+	crl := waitForCRL(t, url, func(crl *pkix.CertificateList) bool { return true })
+	assert.Empty(t, crl.TBSCertList.RevokedCertificates)
+	number := getCRLNumber(t, crl)
+	_, err = os.Stat(filepath.Join(srv.CA.HomeDir, "crl.pem"))
+	assert.NoError(t, err, "The CRL should have been written to the file")
+
+	// The CRL is published again after a revocation
+	_, err = admin.Revoke(&api.RevocationRequest{
+		Serial: util.GetSerialAsHex(cert.SerialNumber),
+		AKI:    hex.EncodeToString(cert.AuthorityKeyId),
+		Reason: "keycompromise",
+	})
+	util.FatalError(t, err, "Failed to revoke the certificate of 'admin'")
+	crl = waitForCRL(t, url, func(crl *pkix.CertificateList) bool {
+		return len(crl.TBSCertList.RevokedCertificates) > 0
+	})
+	assert.True(t, getCRLNumber(t, crl).Cmp(number) > 0, "The CRL number should increase")
+	revoked := crl.TBSCertList.RevokedCertificates[0]
+	assert.Equal(t, cert.SerialNumber, revoked.SerialNumber)
+	if assert.Len(t, revoked.Extensions, 1) {
+		assert.True(t, revoked.Extensions[0].Id.Equal(oidExtensionReasonCode))
+		var reason asn1.Enumerated
+		_, err = asn1.Unmarshal(revoked.Extensions[0].Value, &reason)
+		assert.NoError(t, err)
+		assert.Equal(t, asn1.Enumerated(ocsp.KeyCompromise), reason)
+	}
+
+	// The CRL is served only for existing CAs
+	httpResp, err := http.Get(url + "?ca=unknown")
+	util.FatalError(t, err, "Failed to get CRL")
+	httpResp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, httpResp.StatusCode)
+}
+
+// waitForCRL polls the CRL endpoint until the served CRL satisfies the condition
+func waitForCRL(t *testing.T, url string, cond func(*pkix.CertificateList) bool) *pkix.CertificateList {
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get(url)
+		util.FatalError(t, err, "Failed to get CRL")
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		util.FatalError(t, err, "Failed to read CRL")
+		if resp.StatusCode == http.StatusOK {
+			crl, err := x509.ParseDERCRL(body)
+			util.FatalError(t, err, "Failed to parse CRL")
+			if cond(crl) {
+				return crl
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for the CRL to be published")
+	return nil
+}
+
+func getCRLNumber(t *testing.T, crl *pkix.CertificateList) *big.Int {
+	for _, ext := range crl.TBSCertList.Extensions {
+		if ext.Id.Equal(oidExtensionCRLNumber) {
+			number := new(big.Int)
+			_, err := asn1.Unmarshal(ext.Value, &number)
+			util.FatalError(t, err, "Failed to parse CRL number")
+			return number
+		}
+	}
+	t.Fatal("CRL does not have a CRL number")
+	return nil
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/hyperledger/fabric-ca/lib/caerrors"
 	"github.com/hyperledger/fabric-ca/lib/server/db"
 	cadbutil "github.com/hyperledger/fabric-ca/lib/server/db/util"
+	"github.com/hyperledger/fabric-ca/lib/server/password"
+	"github.com/hyperledger/fabric-ca/lib/server/role"
 	"github.com/hyperledger/fabric-ca/lib/server/user"
 	cadbuser "github.com/hyperledger/fabric-ca/lib/server/user"
 	"github.com/hyperledger/fabric-ca/lib/spi"
@@ -23,7 +25,6 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/kisielk/sqlstruct"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/ocsp"
 )
 
@@ -34,8 +35,8 @@ func init() {
 
 const (
 	insertUser = `
-INSERT INTO users (id, token, type, affiliation, attributes, state, max_enrollments, level, incorrect_password_attempts)
-VALUES (:id, :token, :type, :affiliation, :attributes, :state, :max_enrollments, :level, :incorrect_password_attempts);`
+INSERT INTO users (id, token, type, affiliation, attributes, state, max_enrollments, level, incorrect_password_attempts, secret_expiry, totp_seed)
+VALUES (:id, :token, :type, :affiliation, :attributes, :state, :max_enrollments, :level, :incorrect_password_attempts, :secret_expiry, :totp_seed);`
 
 	deleteUser = `
 DELETE FROM users
@@ -43,7 +44,7 @@ DELETE FROM users
 
 	updateUser = `
 UPDATE users
-SET token = :token, type = :type, affiliation = :affiliation, attributes = :attributes, state = :state, max_enrollments = :max_enrollments, level = :level, incorrect_password_attempts = :incorrect_password_attempts
+SET token = :token, type = :type, affiliation = :affiliation, attributes = :attributes, state = :state, max_enrollments = :max_enrollments, level = :level, incorrect_password_attempts = :incorrect_password_attempts, secret_expiry = :secret_expiry
 	WHERE (id = :id);`
 
 	getUser = `
@@ -74,11 +75,27 @@ SELECT * FROM users
 UPDATE affiliations
 	SET name = ?, prekey = ?
 	WHERE (name = ?)`
+
+	getRoleMembers = `
+SELECT * FROM users
+	WHERE (attributes LIKE ?)`
+
+	updateAttributes = `
+UPDATE users
+	SET attributes = ?
+	WHERE (id = ?)`
+
+	flagReissue = `
+UPDATE users
+	SET reissue = 1
+	WHERE (id = ?)`
 )
 
 // Accessor implements db.Accessor interface.
 type Accessor struct {
 	db db.FabricCADB
+	// The hasher of the passwords; bcrypt with its default cost if nil
+	hasher *password.Hasher
 }
 
 // NewDBAccessor is a constructor for the database API
@@ -100,6 +117,23 @@ func (d *Accessor) SetDB(db db.FabricCADB) {
 	d.db = db
 }
 
+// SetPasswordHasher changes the hasher of the passwords stored by the Accessor
+func (d *Accessor) SetPasswordHasher(hasher *password.Hasher) {
+	d.hasher = hasher
+}
+
+func (d *Accessor) hashPassword(pwd []byte) ([]byte, error) {
+	hasher := d.hasher
+	if hasher == nil {
+		var err error
+		hasher, err = password.NewHasher(&password.HashConfig{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hasher.Hash(pwd)
+}
+
 // InsertUser inserts user into database
 func (d *Accessor) InsertUser(user *cadbuser.Info) error {
 	if user == nil {
@@ -112,31 +146,14 @@ func (d *Accessor) InsertUser(user *cadbuser.Info) error {
 		return err
 	}
 
-	attrBytes, err := json.Marshal(user.Attributes)
-	if err != nil {
-		return err
-	}
-
 	// Hash the password before storing it
-	pwd := []byte(user.Pass)
-	pwd, err = bcrypt.GenerateFromPassword(pwd, bcrypt.DefaultCost)
+	rec, err := d.newUserRecord(user, true)
 	if err != nil {
-		return errors.Wrap(err, "Failed to hash password")
+		return err
 	}
 
 	// Store the user record in the DB
-	res, err := d.db.NamedExec("InsertUser", insertUser, &cadbuser.Record{
-		Name:                      user.Name,
-		Pass:                      pwd,
-		Type:                      user.Type,
-		Affiliation:               user.Affiliation,
-		Attributes:                string(attrBytes),
-		State:                     user.State,
-		MaxEnrollments:            user.MaxEnrollments,
-		Level:                     user.Level,
-		IncorrectPasswordAttempts: 0,
-	})
-
+	res, err := d.db.NamedExec("InsertUser", insertUser, rec)
 	if err != nil {
 		return errors.Wrapf(err, "Error adding identity '%s' to the database", user.Name)
 	}
@@ -190,12 +207,8 @@ func (d *Accessor) deleteUserTx(tx *sqlx.Tx, args ...interface{}) (interface{},
 		return nil, caerrors.NewHTTPErr(500, caerrors.ErrDBDeleteUser, "Error deleting identity '%s': %s", id, err)
 	}
 
-	record := &db.CertRecord{
-		ID: id,
-	}
-	record.Reason = reason
-
-	_, err = tx.NamedExec(tx.Rebind(updateRevokeSQL), record)
+	// The certificates on hold of the identity are revoked for good
+	_, err = tx.Exec(tx.Rebind(updateRevokeSQL), reason, id, ocsp.CertificateHold)
 	if err != nil {
 		return nil, caerrors.NewHTTPErr(500, caerrors.ErrDBDeleteUser, "Error encountered while revoking certificates for identity '%s' that is being deleted: %s", id, err)
 	}
@@ -215,22 +228,49 @@ func (d *Accessor) UpdateUser(user *cadbuser.Info, updatePass bool) error {
 		return err
 	}
 
+	// Hash the password before storing it
+	rec, err := d.newUserRecord(user, updatePass)
+	if err != nil {
+		return err
+	}
+
+	// Store the updated user entry
+	res, err := d.db.NamedExec("UpdateUser", updateUser, rec)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update identity record")
+	}
+
+	numRowsAffected, err := res.RowsAffected()
+
+	if numRowsAffected == 0 {
+		return errors.New("No identity records were updated")
+	}
+
+	if numRowsAffected != 1 {
+		return errors.Errorf("Expected one identity record to be updated, but %d records were updated", numRowsAffected)
+	}
+
+	return err
+
+}
+
+// newUserRecord returns the database record of a user, whose password is
+// hashed if hashPass is true
+func (d *Accessor) newUserRecord(user *cadbuser.Info, hashPass bool) (*cadbuser.Record, error) {
 	attributes, err := json.Marshal(user.Attributes)
 	if err != nil {
-		return errors.Wrap(err, "Failed to marshal user attributes")
+		return nil, errors.Wrap(err, "Failed to marshal user attributes")
 	}
 
-	// Hash the password before storing it
 	pwd := []byte(user.Pass)
-	if updatePass {
-		pwd, err = bcrypt.GenerateFromPassword(pwd, bcrypt.DefaultCost)
+	if hashPass {
+		pwd, err = d.hashPassword(pwd)
 		if err != nil {
-			return errors.Wrap(err, "Failed to hash password")
+			return nil, err
 		}
 	}
 
-	// Store the updated user entry
-	res, err := d.db.NamedExec("UpdateUser", updateUser, cadbuser.Record{
+	return &cadbuser.Record{
 		Name:                      user.Name,
 		Pass:                      pwd,
 		Type:                      user.Type,
@@ -240,24 +280,144 @@ func (d *Accessor) UpdateUser(user *cadbuser.Info, updatePass bool) error {
 		MaxEnrollments:            user.MaxEnrollments,
 		Level:                     user.Level,
 		IncorrectPasswordAttempts: user.IncorrectPasswordAttempts,
-	})
+		SecretExpiry:              user.SecretExpiry,
+		TOTPSeed:                  user.TOTPSeed,
+	}, nil
+}
 
-	if err != nil {
-		return errors.Wrap(err, "Failed to update identity record")
+// batchUser is an identity to be inserted or updated by a batch request
+type batchUser struct {
+	info       *cadbuser.Info
+	insert     bool
+	updatePass bool
+}
+
+// updateUsers inserts and updates identities in one transaction, so that
+// either all of them or none of them are stored
+func (d *Accessor) updateUsers(users []*batchUser) error {
+	log.Debugf("DB: Store a batch of %d identities", len(users))
+	_, err := d.doTransaction(d.updateUsersTx, users)
+	return err
+}
+
+func (d *Accessor) updateUsersTx(tx *sqlx.Tx, args ...interface{}) (interface{}, error) {
+	users := args[0].([]*batchUser)
+
+	for _, u := range users {
+		rec, err := d.newUserRecord(u.info, u.insert || u.updatePass)
+		if err != nil {
+			return nil, err
+		}
+		query := updateUser
+		if u.insert {
+			query = insertUser
+		}
+		res, err := tx.NamedExec(query, rec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to store identity '%s'", rec.Name)
+		}
+		numRowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if numRowsAffected != 1 {
+			return nil, errors.Errorf("Expected to store one record of identity '%s', but %d records were stored", rec.Name, numRowsAffected)
+		}
 	}
 
-	numRowsAffected, err := res.RowsAffected()
+	return nil, nil
+}
 
-	if numRowsAffected == 0 {
-		return errors.New("No identity records were updated")
+// roleMember is the change of the attributes of a member of a role
+type roleMember struct {
+	name        string
+	typ         string
+	affiliation string
+	attributes  []api.Attribute
+}
+
+// roleUpdate is a change of a role, which is stored with the changes of the
+// attributes of its members
+type roleUpdate struct {
+	rec     *role.Record
+	remove  bool
+	members []*roleMember
+	// Whether the members need new certificates with their new attributes
+	reissue bool
+}
+
+// updateRole changes or removes a role and updates its members in one
+// transaction, so that the members always have the attributes of their roles
+func (d *Accessor) updateRole(update *roleUpdate) error {
+	log.Debugf("DB: Update role %s and %d of its members", update.rec.Name, len(update.members))
+	_, err := d.doTransaction(d.updateRoleTx, update)
+	return err
+}
+
+func (d *Accessor) updateRoleTx(tx *sqlx.Tx, args ...interface{}) (interface{}, error) {
+	update := args[0].(*roleUpdate)
+
+	var err error
+	if update.remove {
+		_, err = tx.Exec(tx.Rebind(role.DeleteRole), update.rec.Name)
+	} else {
+		_, err = tx.NamedExec(role.UpdateRole, update.rec)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to update role '%s'", update.rec.Name)
+	}
+	// Only the attributes of the members change, so that the other state of
+	// the members, such as their enrollments, is left as it is
+	for _, m := range update.members {
+		attrs, err := json.Marshal(m.attributes)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to marshal user attributes")
+		}
+		res, err := tx.Exec(tx.Rebind(updateAttributes), string(attrs), m.name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to update the attributes of identity '%s'", m.name)
+		}
+		numRowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if numRowsAffected != 1 {
+			return nil, errors.Errorf("Expected to update one record of identity '%s', but %d records were updated", m.name, numRowsAffected)
+		}
+		if update.reissue {
+			_, err = tx.Exec(tx.Rebind(flagReissue), m.name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to flag identity '%s' for certificate reissue", m.name)
+			}
+		}
 	}
 
-	if numRowsAffected != 1 {
-		return errors.Errorf("Expected one identity record to be updated, but %d records were updated", numRowsAffected)
+	return nil, nil
+}
+
+// getRoleMembers returns the identities which have at least one role
+func (d *Accessor) getRoleMembers() ([]*cadbuser.Impl, error) {
+	log.Debug("DB: Getting the identities with roles")
+	err := d.checkDB()
+	if err != nil {
+		return nil, err
 	}
 
-	return err
+	var recs []cadbuser.Record
+	err = d.db.Select("GetRoleMembers", &recs, d.db.Rebind(getRoleMembers), "%\""+attr.AssignedRoles+"\"%")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get the identities with roles")
+	}
 
+	var members []*cadbuser.Impl
+	for i := range recs {
+		u := cadbuser.New(&recs[i], d.db)
+		u.SetPasswordHasher(d.hasher)
+		if len(userRoles(u)) > 0 {
+			members = append(members, u)
+		}
+	}
+	return members, nil
 }
 
 // GetUser gets user from database
@@ -275,7 +435,9 @@ func (d *Accessor) GetUser(id string, attrs []string) (user.User, error) {
 		return nil, cadbutil.GetError(err, "User")
 	}
 
-	return cadbuser.New(&userRec, d.db), nil
+	u := cadbuser.New(&userRec, d.db)
+	u.SetPasswordHasher(d.hasher)
+	return u, nil
 }
 
 // InsertAffiliation inserts affiliation into database
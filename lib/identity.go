@@ -199,7 +199,7 @@ func (i *Identity) Revoke(req *api.RevocationRequest) (*api.RevocationResponse,
 	if err != nil {
 		return nil, err
 	}
-	return &api.RevocationResponse{RevokedCerts: result.RevokedCerts, CRL: crl}, nil
+	return &api.RevocationResponse{RevokedCerts: result.RevokedCerts, ReleasedCerts: result.ReleasedCerts, CRL: crl}, nil
 }
 
 // RevokeSelf revokes the current identity and all certificates
@@ -248,6 +248,57 @@ func (i *Identity) GetCRI(req *api.GetCRIRequest) (*api.GetCRIResponse, error) {
 	return &result, nil
 }
 
+// CreateACMEAccount creates an ACME account bound to an identity and
+// returns its external account binding key
+func (i *Identity) CreateACMEAccount(req *api.ACMEAccountRequest) (*api.ACMEAccountResponse, error) {
+	log.Debugf("Entering identity.CreateACMEAccount %+v", req)
+	reqBody, err := util.Marshal(req, "ACMEAccountRequest")
+	if err != nil {
+		return nil, err
+	}
+	var result api.ACMEAccountResponse
+	err = i.Post("acmeaccounts", reqBody, &result, nil)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Successfully created ACME account %s", result.KeyID)
+	return &result, nil
+}
+
+// GetAuditLog returns entries of the audit log of the CA. The caller must
+// be a registrar.
+func (i *Identity) GetAuditLog(req *api.GetAuditLogRequest) (*AuditLogResponse, error) {
+	log.Debugf("Entering identity.GetAuditLog %+v", req)
+	queryParam := make(map[string]string)
+	if req.From > 0 {
+		queryParam["from"] = strconv.FormatInt(req.From, 10)
+	}
+	if req.Limit > 0 {
+		queryParam["limit"] = strconv.Itoa(req.Limit)
+	}
+	queryParam["ca"] = req.CAName
+	httpReq, err := i.client.newGet("audit")
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range queryParam {
+		if value != "" {
+			addQueryParm(httpReq, key, value)
+		}
+	}
+	err = i.addTokenAuthHdr(httpReq, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &AuditLogResponse{}
+	err = i.client.SendReq(httpReq, result)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Successfully retrieved %d audit log entries", len(result.Records))
+	return result, nil
+}
+
 // GetIdentity returns information about the requested identity
 func (i *Identity) GetIdentity(id, caname string) (*api.GetIDResponse, error) {
 	log.Debugf("Entering identity.GetIdentity %s", id)
@@ -320,6 +371,78 @@ func (i *Identity) ModifyIdentity(req *api.ModifyIdentityRequest) (*api.Identity
 	return result, nil
 }
 
+// ResetSecret replaces the enrollment secret of an identity with a new random
+// secret, which is returned
+func (i *Identity) ResetSecret(req *api.ResetSecretRequest) (*api.ResetSecretResponse, error) {
+	log.Debugf("Entering identity.ResetSecret with request: %+v", req)
+	if req.ID == "" {
+		return nil, errors.New("Name of the identity whose secret is reset not specified")
+	}
+
+	reqBody, err := util.Marshal(req, "resetSecret")
+	if err != nil {
+		return nil, err
+	}
+
+	// Send a post to the "identities/<id>/secret" endpoint with req as body
+	result := &api.ResetSecretResponse{}
+	err = i.Post(fmt.Sprintf("identities/%s/secret", req.ID), reqBody, result, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully reset the secret of identity '%s'", result.ID)
+	return result, nil
+}
+
+// Batch registers or modifies many identities in one request, and returns
+// the result of each identity
+func (i *Identity) Batch(req *api.BatchRequest) (*api.BatchResponse, error) {
+	log.Debugf("Entering identity.Batch with %d identities", len(req.Identities))
+	if len(req.Identities) == 0 {
+		return nil, errors.New("No identities in batch request")
+	}
+
+	reqBody, err := util.Marshal(req, "batch")
+	if err != nil {
+		return nil, err
+	}
+
+	// Send a post to the "identities/batch" endpoint with req as body
+	result := &api.BatchResponse{}
+	err = i.Post("identities/batch", reqBody, result, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully sent the batch request of %d identities", len(req.Identities))
+	return result, nil
+}
+
+// SetTOTP gives an identity a new TOTP seed, which is returned, or removes
+// its seed
+func (i *Identity) SetTOTP(req *api.TOTPRequest) (*api.TOTPResponse, error) {
+	log.Debugf("Entering identity.SetTOTP with request: %+v", req)
+	if req.ID == "" {
+		return nil, errors.New("Name of the identity whose TOTP seed is set not specified")
+	}
+
+	reqBody, err := util.Marshal(req, "setTOTP")
+	if err != nil {
+		return nil, err
+	}
+
+	// Send a post to the "identities/<id>/totp" endpoint with req as body
+	result := &api.TOTPResponse{}
+	err = i.Post(fmt.Sprintf("identities/%s/totp", req.ID), reqBody, result, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully updated the TOTP seed of identity '%s'", result.ID)
+	return result, nil
+}
+
 // RemoveIdentity removes a new identity from the server
 func (i *Identity) RemoveIdentity(req *api.RemoveIdentityRequest) (*api.IdentityResponse, error) {
 	log.Debugf("Entering identity.RemoveIdentity with request: %+v", req)
@@ -342,6 +465,111 @@ func (i *Identity) RemoveIdentity(req *api.RemoveIdentityRequest) (*api.Identity
 	return result, nil
 }
 
+// GetApprovals returns the requests with a status, by default those pending
+// approval, which the caller made or can approve
+func (i *Identity) GetApprovals(status, caname string) (*api.GetApprovalsResponse, error) {
+	log.Debugf("Entering identity.GetApprovals with status '%s'", status)
+	req, err := i.client.newGet("approvals")
+	if err != nil {
+		return nil, err
+	}
+	if status != "" {
+		addQueryParm(req, "status", status)
+	}
+	if caname != "" {
+		addQueryParm(req, "ca", caname)
+	}
+	err = i.addTokenAuthHdr(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	err = i.client.SendReq(req, &raw)
+	if err != nil {
+		return nil, err
+	}
+	result := &api.GetApprovalsResponse{}
+	err = decodeResult(raw, result)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully retrieved %d approval requests", len(result.Approvals))
+	return result, nil
+}
+
+// GetApproval returns a request which needs approval
+func (i *Identity) GetApproval(id, caname string) (*api.ApprovalResponse, error) {
+	log.Debugf("Entering identity.GetApproval %s", id)
+	var raw interface{}
+	err := i.Get(fmt.Sprintf("approvals/%s", id), caname, &raw)
+	if err != nil {
+		return nil, err
+	}
+	result := &api.ApprovalResponse{}
+	err = decodeResult(raw, result)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully retrieved approval request: %+v", result)
+	return result, nil
+}
+
+// Approve approves a pending request, which runs once it has all the
+// approvals it needs. The response of the request is returned as the result
+// if it ran.
+func (i *Identity) Approve(id, caname string) (*api.ApprovalResponse, error) {
+	log.Debugf("Entering identity.Approve %s", id)
+	if id == "" {
+		return nil, errors.New("ID of the approval request not specified")
+	}
+	queryParam := make(map[string]string)
+	if caname != "" {
+		queryParam["ca"] = caname
+	}
+	var raw interface{}
+	err := i.Post(fmt.Sprintf("approvals/%s/approve", id), nil, &raw, queryParam)
+	if err != nil {
+		return nil, err
+	}
+	result := &api.ApprovalResponse{}
+	err = decodeResult(raw, result)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully approved request '%s', which is %s", id, result.Status)
+	return result, nil
+}
+
+// Reject rejects a pending request, or withdraws a request of the caller
+func (i *Identity) Reject(req *api.RejectApprovalRequest) (*api.ApprovalResponse, error) {
+	log.Debugf("Entering identity.Reject with request: %+v", req)
+	if req.ID == "" {
+		return nil, errors.New("ID of the approval request not specified")
+	}
+
+	reqBody, err := util.Marshal(req, "rejectApproval")
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	err = i.Post(fmt.Sprintf("approvals/%s/reject", req.ID), reqBody, &raw, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &api.ApprovalResponse{}
+	err = decodeResult(raw, result)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully rejected request '%s'", req.ID)
+	return result, nil
+}
+
 // GetAffiliation returns information about the requested affiliation
 func (i *Identity) GetAffiliation(affiliation, caname string) (*api.AffiliationResponse, error) {
 	log.Debugf("Entering identity.GetAffiliation %+v", affiliation)
@@ -443,6 +671,103 @@ func (i *Identity) RemoveAffiliation(req *api.RemoveAffiliationRequest) (*api.Af
 	return result, nil
 }
 
+// GetRole returns a role with its members
+func (i *Identity) GetRole(name, caname string) (*api.RoleResponse, error) {
+	log.Debugf("Entering identity.GetRole %s", name)
+	result := &api.RoleResponse{}
+	err := i.Get(fmt.Sprintf("roles/%s", name), caname, result)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Successfully retrieved role: %+v", result)
+	return result, nil
+}
+
+// GetAllRoles returns all the roles with their members
+func (i *Identity) GetAllRoles(caname string) (*api.GetRolesResponse, error) {
+	log.Debugf("Entering identity.GetAllRoles")
+	result := &api.GetRolesResponse{}
+	err := i.Get("roles", caname, result)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Successfully retrieved %d roles", len(result.Roles))
+	return result, nil
+}
+
+// AddRole adds a new role to the server
+func (i *Identity) AddRole(req *api.AddRoleRequest) (*api.RoleResponse, error) {
+	log.Debugf("Entering identity.AddRole with request: %+v", req)
+	if req.Name == "" {
+		return nil, errors.New("Role to add was not specified")
+	}
+
+	reqBody, err := util.Marshal(req, "addRole")
+	if err != nil {
+		return nil, err
+	}
+
+	// Send a post to the "roles" endpoint with req as body
+	result := &api.RoleResponse{}
+	queryParam := make(map[string]string)
+	queryParam["ca"] = req.CAName
+	err = i.Post("roles", reqBody, result, queryParam)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully added new role")
+	return result, nil
+}
+
+// ModifyRole replaces the attributes of a role, which updates the attributes
+// of its members
+func (i *Identity) ModifyRole(req *api.ModifyRoleRequest) (*api.RoleResponse, error) {
+	log.Debugf("Entering identity.ModifyRole with request: %+v", req)
+	if req.Name == "" {
+		return nil, errors.New("Role to modify was not specified")
+	}
+
+	reqBody, err := util.Marshal(req, "modifyRole")
+	if err != nil {
+		return nil, err
+	}
+
+	// Send a put to the "roles" endpoint with req as body
+	result := &api.RoleResponse{}
+	queryParam := make(map[string]string)
+	queryParam["ca"] = req.CAName
+	err = i.Put(fmt.Sprintf("roles/%s", req.Name), reqBody, queryParam, result)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully modified role, which updated %d members", len(result.Updated))
+	return result, nil
+}
+
+// RemoveRole removes a role from the server, and with force from its members
+func (i *Identity) RemoveRole(req *api.RemoveRoleRequest) (*api.RoleResponse, error) {
+	log.Debugf("Entering identity.RemoveRole with request: %+v", req)
+	if req.Name == "" {
+		return nil, errors.New("Role to remove was not specified")
+	}
+
+	// Send a delete to the "roles" endpoint with the role as a path parameter
+	result := &api.RoleResponse{}
+	queryParam := make(map[string]string)
+	queryParam["force"] = strconv.FormatBool(req.Force)
+	queryParam["reissue"] = strconv.FormatBool(req.Reissue)
+	queryParam["ca"] = req.CAName
+	err := i.Delete(fmt.Sprintf("roles/%s", req.Name), result, queryParam)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully removed role")
+	return result, nil
+}
+
 // GetCertificates returns all certificates that the caller is authorized to see
 func (i *Identity) GetCertificates(req *api.GetCertificatesRequest, cb func(*json.Decoder) error) error {
 	log.Debugf("Entering identity.GetCertificates, sending request: %+v", req)
@@ -20,7 +20,7 @@ import (
 // requires database migration
 const (
 	// IdentityLevel is the current level of identities
-	IdentityLevel = 2
+	IdentityLevel = 6
 	// AffiliationLevel is the current level of affiliations
 	AffiliationLevel = 1
 	// CertificateLevel is the current level of certificates
@@ -78,6 +78,10 @@ var versionToLevelsMapping = []versionLevels{
 		version: "1.4.0",
 		levels:  &db.Levels{Identity: 2, Affiliation: 1, Certificate: 1, Credential: 1, RAInfo: 1, Nonce: 1},
 	},
+	{
+		version: "1.5.0",
+		levels:  &db.Levels{Identity: 6, Affiliation: 1, Certificate: 1, Credential: 1, RAInfo: 1, Nonce: 1},
+	},
 }
 
 type versionLevels struct {
@@ -37,6 +37,7 @@ func TestVersion(t *testing.T) {
 	cmpLevels(t, "1.1.0", 1, 1, 1)
 	cmpLevels(t, "1.1.1", 1, 1, 1)
 	cmpLevels(t, "1.2.1", 1, 1, 1)
+	cmpLevels(t, "1.5.0", 6, 1, 1)
 	// Negative test cases
 	_, err := metadata.CmpVersion("1.x.2.0", "1.7.8")
 	if err == nil {
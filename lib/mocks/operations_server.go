@@ -2,6 +2,7 @@
 package mocks
 
 import (
+	http "net/http"
 	sync "sync"
 
 	healthz "github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric-lib-go/healthz"
@@ -64,6 +65,18 @@ type OperationsServer struct {
 	registerCheckerReturnsOnCall map[int]struct {
 		result1 error
 	}
+	RegisterHandlerStub        func(string, http.Handler)
+	registerHandlerMutex       sync.RWMutex
+	registerHandlerArgsForCall []struct {
+		arg1 string
+		arg2 http.Handler
+	}
+	RegisterRawHandlerStub        func(string, http.Handler)
+	registerRawHandlerMutex       sync.RWMutex
+	registerRawHandlerArgsForCall []struct {
+		arg1 string
+		arg2 http.Handler
+	}
 	StartStub        func() error
 	startMutex       sync.RWMutex
 	startArgsForCall []struct {
@@ -381,6 +394,70 @@ func (fake *OperationsServer) RegisterCheckerReturnsOnCall(i int, result1 error)
 	}{result1}
 }
 
+func (fake *OperationsServer) RegisterHandler(arg1 string, arg2 http.Handler) {
+	fake.registerHandlerMutex.Lock()
+	fake.registerHandlerArgsForCall = append(fake.registerHandlerArgsForCall, struct {
+		arg1 string
+		arg2 http.Handler
+	}{arg1, arg2})
+	fake.recordInvocation("RegisterHandler", []interface{}{arg1, arg2})
+	fake.registerHandlerMutex.Unlock()
+	if fake.RegisterHandlerStub != nil {
+		fake.RegisterHandlerStub(arg1, arg2)
+	}
+}
+
+func (fake *OperationsServer) RegisterHandlerCallCount() int {
+	fake.registerHandlerMutex.RLock()
+	defer fake.registerHandlerMutex.RUnlock()
+	return len(fake.registerHandlerArgsForCall)
+}
+
+func (fake *OperationsServer) RegisterHandlerCalls(stub func(string, http.Handler)) {
+	fake.registerHandlerMutex.Lock()
+	defer fake.registerHandlerMutex.Unlock()
+	fake.RegisterHandlerStub = stub
+}
+
+func (fake *OperationsServer) RegisterHandlerArgsForCall(i int) (string, http.Handler) {
+	fake.registerHandlerMutex.RLock()
+	defer fake.registerHandlerMutex.RUnlock()
+	argsForCall := fake.registerHandlerArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *OperationsServer) RegisterRawHandler(arg1 string, arg2 http.Handler) {
+	fake.registerRawHandlerMutex.Lock()
+	fake.registerRawHandlerArgsForCall = append(fake.registerRawHandlerArgsForCall, struct {
+		arg1 string
+		arg2 http.Handler
+	}{arg1, arg2})
+	fake.recordInvocation("RegisterRawHandler", []interface{}{arg1, arg2})
+	fake.registerRawHandlerMutex.Unlock()
+	if fake.RegisterRawHandlerStub != nil {
+		fake.RegisterRawHandlerStub(arg1, arg2)
+	}
+}
+
+func (fake *OperationsServer) RegisterRawHandlerCallCount() int {
+	fake.registerRawHandlerMutex.RLock()
+	defer fake.registerRawHandlerMutex.RUnlock()
+	return len(fake.registerRawHandlerArgsForCall)
+}
+
+func (fake *OperationsServer) RegisterRawHandlerCalls(stub func(string, http.Handler)) {
+	fake.registerRawHandlerMutex.Lock()
+	defer fake.registerRawHandlerMutex.Unlock()
+	fake.RegisterRawHandlerStub = stub
+}
+
+func (fake *OperationsServer) RegisterRawHandlerArgsForCall(i int) (string, http.Handler) {
+	fake.registerRawHandlerMutex.RLock()
+	defer fake.registerRawHandlerMutex.RUnlock()
+	argsForCall := fake.registerRawHandlerArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
 func (fake *OperationsServer) Start() error {
 	fake.startMutex.Lock()
 	ret, specificReturn := fake.startReturnsOnCall[len(fake.startArgsForCall)]
@@ -498,6 +575,10 @@ func (fake *OperationsServer) Invocations() map[string][][]interface{} {
 	defer fake.newHistogramMutex.RUnlock()
 	fake.registerCheckerMutex.RLock()
 	defer fake.registerCheckerMutex.RUnlock()
+	fake.registerHandlerMutex.RLock()
+	defer fake.registerHandlerMutex.RUnlock()
+	fake.registerRawHandlerMutex.RLock()
+	defer fake.registerRawHandlerMutex.RUnlock()
 	fake.startMutex.RLock()
 	defer fake.startMutex.RUnlock()
 	fake.stopMutex.RLock()
@@ -36,6 +36,7 @@ import (
 	idemix "github.com/hyperledger/fabric-ca/lib/server/idemix"
 	servermetrics "github.com/hyperledger/fabric-ca/lib/server/metrics"
 	"github.com/hyperledger/fabric-ca/lib/server/operations"
+	"github.com/hyperledger/fabric-ca/lib/server/ratelimit"
 	stls "github.com/hyperledger/fabric-ca/lib/tls"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/revoke"
@@ -62,6 +63,8 @@ type operationsServer interface {
 	Stop() error
 	Addr() string
 	RegisterChecker(component string, checker healthz.HealthChecker) error
+	RegisterHandler(prefix string, handler http.Handler)
+	RegisterRawHandler(prefix string, handler http.Handler)
 }
 
 // Server is the fabric-ca server
@@ -73,6 +76,10 @@ type Server struct {
 	BlockingStart bool
 	// The server's configuration
 	Config *ServerConfig
+	// ConfigLoader loads the configuration of the server when it is
+	// reloaded. If it is nil, the configuration is read from the
+	// configuration file of the default CA.
+	ConfigLoader func() (*ServerConfig, error)
 	// Metrics are the metrics that the server tracks for API calls.
 	Metrics servermetrics.Metrics
 	// Operations is responsible for the server's operation information.
@@ -83,12 +90,37 @@ type Server struct {
 	dbMetrics *db.Metrics
 	// mux is used to server API requests
 	mux *gmux.Router
+	// ocspHandlers are the handlers of the OCSP requests, keyed by the path
+	// prefix they are served under, which are called ahead of mux
+	ocspHandlers map[string]http.Handler
 	// listener for this server
 	listener net.Listener
 	// An error which occurs when serving
 	serveError error
 	// caMap is a list of CAs by name
 	caMap map[string]*CA
+	// caMapMutex guards caMap, to which CAs are added when the configuration
+	// is reloaded
+	caMapMutex sync.RWMutex
+	// reloadMutex serializes reloads of the configuration and the changes
+	// of the CAs at runtime
+	reloadMutex sync.Mutex
+	// stateMutex guards the settings of the server which a reload swaps in:
+	// the configuration, the rate limiter and the log level. A request holds
+	// it for reading while it runs, so that it sees the settings of a single
+	// configuration.
+	stateMutex sync.RWMutex
+	// caDefaults is the configuration of the default CA as loaded, from
+	// which the missing values of the CAs added at runtime are taken
+	caDefaults *CAConfig
+	// managedCAs are the CAs added and disabled at runtime
+	managedCAs []ManagedCA
+	// retiredCAs are the CAs disabled at runtime, whose databases are closed
+	// when the server stops
+	retiredCAs []*CA
+	// limiter limits the rate of requests to the API endpoints; nil if rate
+	// limiting is disabled
+	limiter *ratelimit.Limiter
 	// levels currently supported by the server
 	levels *dbutil.Levels
 	wait   chan bool
@@ -129,6 +161,7 @@ func (s *Server) init(renew bool) (err error) {
 	if err != nil {
 		return err
 	}
+	s.initRateLimiter()
 	// Initialize the default CA last
 	err = s.initDefaultCA(renew)
 	if err != nil {
@@ -138,10 +171,23 @@ func (s *Server) init(renew bool) (err error) {
 	return nil
 }
 
+// initRateLimiter creates the rate limiter of the API endpoints if rate
+// limiting is enabled
+func (s *Server) initRateLimiter() {
+	s.limiter = nil
+	if s.Config.RateLimit.Enabled {
+		s.limiter = ratelimit.New(&s.Config.RateLimit)
+	}
+}
+
 func (s *Server) initMetrics() {
 	s.Metrics = servermetrics.Metrics{
-		APICounter:  s.Operations.NewCounter(servermetrics.APICounterOpts),
-		APIDuration: s.Operations.NewHistogram(servermetrics.APIDurationOpts),
+		APICounter:          s.Operations.NewCounter(servermetrics.APICounterOpts),
+		APIDuration:         s.Operations.NewHistogram(servermetrics.APIDurationOpts),
+		APIThrottledCounter: s.Operations.NewCounter(servermetrics.APIThrottledCounterOpts),
+		CPABEKeyCounter:     s.Operations.NewCounter(servermetrics.CPABEKeyCounterOpts),
+		CPABEKeyDuration:    s.Operations.NewHistogram(servermetrics.CPABEKeyDurationOpts),
+		CPABEKeyAttributes:  s.Operations.NewHistogram(servermetrics.CPABEKeyAttributesOpts),
 	}
 	s.dbMetrics = &db.Metrics{
 		APICounter:  s.Operations.NewCounter(db.APICounterOpts),
@@ -194,8 +240,8 @@ func (s *Server) Start() (err error) {
 		return nil
 	}
 
-	for _, ca := range s.caMap {
-		startNonceSweeper(ca)
+	for _, ca := range s.getCAs() {
+		ca.startWorkers()
 	}
 
 	// Start listening and serving
@@ -211,6 +257,30 @@ func (s *Server) Start() (err error) {
 	return nil
 }
 
+// startWorkers starts the background work of a CA which is served: the
+// sweeper of Idemix nonces, the CRL publisher and the webhook dispatcher
+func (ca *CA) startWorkers() {
+	startNonceSweeper(ca)
+	if ca.crlPublisher != nil {
+		ca.crlPublisher.Start()
+	}
+	if ca.webhooks != nil {
+		ca.webhooks.Start()
+	}
+}
+
+// stopWorkers stops the CRL publisher and the webhook dispatcher of a CA
+func (ca *CA) stopWorkers() {
+	ca.stateMutex.RLock()
+	defer ca.stateMutex.RUnlock()
+	if ca.crlPublisher != nil {
+		ca.crlPublisher.Stop()
+	}
+	if ca.webhooks != nil {
+		ca.webhooks.Stop()
+	}
+}
+
 func startNonceSweeper(ca *CA) {
 	if nm, ok := ca.issuer.(interface{ NonceManager() idemix.NonceManager }); ok && nm != nil {
 		if ss, ok := nm.NonceManager().(interface{ StartNonceSweeper() }); ok {
@@ -230,6 +300,10 @@ func (s *Server) Stop() error {
 		return err
 	}
 
+	for _, ca := range s.getCAs() {
+		ca.stopWorkers()
+	}
+
 	if s.listener == nil {
 		return nil
 	}
@@ -292,6 +366,7 @@ func (s *Server) RegisterBootstrapUser(user, pass, affiliation string) error {
 			attr.GenCRL:         "true",
 			attr.RegistrarAttr:  "*",
 			attr.AffiliationMgr: "true",
+			attr.RoleMgr:        "true",
 		},
 	}
 
@@ -302,21 +377,29 @@ func (s *Server) RegisterBootstrapUser(user, pass, affiliation string) error {
 	return nil
 }
 
-// initConfig initializes the configuration for the server
-func (s *Server) initConfig() (err error) {
-	// Home directory is current working directory by default
+// initHomeDir makes the home directory of the server absolute; it is the
+// current working directory by default
+func (s *Server) initHomeDir() (err error) {
 	if s.HomeDir == "" {
 		s.HomeDir, err = os.Getwd()
 		if err != nil {
 			return errors.Wrap(err, "Failed to get server's home directory")
 		}
 	}
-	// Make home directory absolute, if not already
 	absoluteHomeDir, err := filepath.Abs(s.HomeDir)
 	if err != nil {
 		return fmt.Errorf("Failed to make server's home directory path absolute: %s", err)
 	}
 	s.HomeDir = absoluteHomeDir
+	return nil
+}
+
+// initConfig initializes the configuration for the server
+func (s *Server) initConfig() (err error) {
+	err = s.initHomeDir()
+	if err != nil {
+		return err
+	}
 	// Create config if not set
 	if s.Config == nil {
 		s.Config = new(ServerConfig)
@@ -341,6 +424,16 @@ func (s *Server) initConfig() (err error) {
 		return errors.WithMessage(err, "Invalid value for boolean environment variable 'FABRIC_CA_SERVER_COMPATIBILITY_MODE_V1_3'")
 	}
 
+	compModeStr = os.Getenv("FABRIC_CA_SERVER_COMPATIBILITY_MODE_V1_4")
+	if compModeStr == "" {
+		compModeStr = "true" // TODO: Change default to false once all clients send authorization tokens with a time and nonce
+	}
+
+	s.Config.CompMode1_4, err = strconv.ParseBool(compModeStr)
+	if err != nil {
+		return errors.WithMessage(err, "Invalid value for boolean environment variable 'FABRIC_CA_SERVER_COMPATIBILITY_MODE_V1_4'")
+	}
+
 	return nil
 }
 
@@ -359,18 +452,36 @@ func (s *Server) initMultiCAConfig() (err error) {
 	}
 	// Multi-CA related configuration initialization
 	s.caMap = make(map[string]*CA)
+	defaults := *s.CA.Config
+	s.caDefaults = &defaults
+	s.managedCAs, err = s.readManagedCAs()
+	if err != nil {
+		return err
+	}
 	if cfg.CAcount >= 1 {
 		s.createDefaultCAConfigs(cfg.CAcount)
 	}
-	if len(cfg.CAfiles) != 0 {
+	caFiles := util.NormalizeStringSlice(cfg.CAfiles)
+	loaded := map[string]bool{}
+	if len(caFiles) != 0 {
 		log.Debugf("Default CA configuration, if necessary, will be used to replace missing values for additional CAs: %+v", s.Config.CAcfg)
 		log.Debugf("Additional CAs to be started: %s", cfg.CAfiles)
-		caFiles := util.NormalizeStringSlice(cfg.CAfiles)
 		for _, caFile := range caFiles {
 			err = s.loadCA(caFile, false)
 			if err != nil {
 				return err
 			}
+			loaded[caFile] = true
+		}
+	}
+	// Load the CAs added at runtime
+	for _, m := range s.managedCAs {
+		if m.Disabled || loaded[m.ConfigFile] {
+			continue
+		}
+		err = s.loadCA(m.ConfigFile, false)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -391,14 +502,39 @@ func (s *Server) initDefaultCA(renew bool) error {
 	return nil
 }
 
-// loadCAConfig loads up a CA's configuration from the specified
-// CA configuration file
+// loadCA loads up a CA from the specified CA configuration file
 func (s *Server) loadCA(caFile string, renew bool) error {
 	log.Infof("Loading CA from %s", caFile)
+	cfg, err := s.loadCAConfig(caFile, s.CA.Config)
+	if err != nil {
+		return err
+	}
+	if isCADisabled(s.managedCAs, cfg.CA.Name) {
+		log.Infof("CA '%s' is disabled", cfg.CA.Name)
+		return nil
+	}
+
+	ca, err := newCA(caFile, cfg, s, renew)
+	if err != nil {
+		return err
+	}
+	err = s.addCA(ca)
+	if err != nil {
+		err2 := ca.closeDB()
+		if err2 != nil {
+			log.Errorf("Close DB failed: %s", err2)
+		}
+	}
+	return err
+}
+
+// loadCAConfig loads the configuration of a CA from its configuration file,
+// with missing values taken from the configuration of the default CA
+func (s *Server) loadCAConfig(caFile string, defaultCfg *CAConfig) (*CAConfig, error) {
 	var err error
 
 	if !util.FileExists(caFile) {
-		return errors.Errorf("%s file does not exist", caFile)
+		return nil, errors.Errorf("%s file does not exist", caFile)
 	}
 
 	// Creating new Viper instance, to prevent any server level environment variables or
@@ -408,46 +544,54 @@ func (s *Server) loadCA(caFile string, renew bool) error {
 	caViper := viper.New()
 	err = UnmarshalConfig(cfg, caViper, caFile, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Need to error if no CA name provided in config file, we cannot revert to using
 	// the name of default CA cause CA names must be unique
 	caName := cfg.CA.Name
 	if caName == "" {
-		return errors.Errorf("No CA name provided in CA configuration file. CA name is required in %s", caFile)
+		return nil, errors.Errorf("No CA name provided in CA configuration file. CA name is required in %s", caFile)
 	}
 
 	// Replace missing values in CA configuration values with values from the
 	// default CA configuration
-	util.CopyMissingValues(s.CA.Config, cfg)
+	util.CopyMissingValues(defaultCfg, cfg)
 
 	// Integers and boolean values are handled outside the util.CopyMissingValues
 	// because there is no way through reflect to detect if a value was explicitly
 	// set to 0 or false, or it is using the default value for its type. Viper is
 	// employed here to help detect.
 	if !caViper.IsSet("registry.maxenrollments") {
-		cfg.Registry.MaxEnrollments = s.CA.Config.Registry.MaxEnrollments
+		cfg.Registry.MaxEnrollments = defaultCfg.Registry.MaxEnrollments
 	}
 
-	if !caViper.IsSet("db.tls.enabled") {
-		cfg.DB.TLS.Enabled = s.CA.Config.DB.TLS.Enabled
+	if !caViper.IsSet("registry.secretexpiry") {
+		cfg.Registry.SecretExpiry = defaultCfg.Registry.SecretExpiry
 	}
 
-	log.Debugf("CA configuration after checking for missing values: %+v", cfg)
+	if !caViper.IsSet("registry.passwordpolicy.minlength") {
+		cfg.Registry.PasswordPolicy.MinLength = defaultCfg.Registry.PasswordPolicy.MinLength
+	}
 
-	ca, err := newCA(caFile, cfg, s, renew)
-	if err != nil {
-		return err
+	if !caViper.IsSet("registry.passwordpolicy.charclasses") {
+		cfg.Registry.PasswordPolicy.CharClasses = defaultCfg.Registry.PasswordPolicy.CharClasses
 	}
-	err = s.addCA(ca)
-	if err != nil {
-		err2 := ca.closeDB()
-		if err2 != nil {
-			log.Errorf("Close DB failed: %s", err2)
-		}
+
+	if !caViper.IsSet("registry.passwordhash.cost") {
+		cfg.Registry.PasswordHash.Cost = defaultCfg.Registry.PasswordHash.Cost
 	}
-	return err
+
+	if !caViper.IsSet("registry.totp.skew") {
+		cfg.Registry.TOTP.Skew = defaultCfg.Registry.TOTP.Skew
+	}
+
+	if !caViper.IsSet("db.tls.enabled") {
+		cfg.DB.TLS.Enabled = defaultCfg.DB.TLS.Enabled
+	}
+
+	log.Debugf("CA configuration after checking for missing values: %+v", cfg)
+	return cfg, nil
 }
 
 // DN is the distinguished name inside a certificate
@@ -458,7 +602,20 @@ type DN struct {
 
 // addCA adds a CA to the server if there are no conflicts
 func (s *Server) addCA(ca *CA) error {
-	// check for conflicts
+	s.caMapMutex.Lock()
+	defer s.caMapMutex.Unlock()
+	err := s.checkCAConflicts(ca)
+	if err != nil {
+		return err
+	}
+	// no conflicts, so add it
+	s.caMap[ca.Config.CA.Name] = ca
+	return nil
+}
+
+// checkCAConflicts checks that the name and the subject of a CA are not
+// used by a CA of the server; the caller must hold caMapMutex
+func (s *Server) checkCAConflicts(ca *CA) error {
 	caName := ca.Config.CA.Name
 	for _, c := range s.caMap {
 		if c.Config.CA.Name == caName {
@@ -470,9 +627,6 @@ func (s *Server) addCA(ca *CA) error {
 			return err
 		}
 	}
-	// no conflicts, so add it
-	s.caMap[caName] = ca
-
 	return nil
 }
 
@@ -485,7 +639,18 @@ func (s *Server) closeDB() error {
 		return err
 	}
 	// close other CAs DB
-	for _, c := range s.caMap {
+	for _, c := range s.getCAs() {
+		err = c.closeDB()
+		if err != nil {
+			return err
+		}
+	}
+	// close the DB of the CAs disabled at runtime
+	s.mutex.Lock()
+	retired := s.retiredCAs
+	s.retiredCAs = nil
+	s.mutex.Unlock()
+	for _, c := range retired {
 		err = c.closeDB()
 		if err != nil {
 			return err
@@ -538,13 +703,31 @@ func (s *Server) createDefaultCAConfigs(cacount int) error {
 // GetCA returns the CA given its name
 func (s *Server) GetCA(name string) (*CA, error) {
 	// Lookup the CA from the server
-	ca := s.caMap[name]
+	ca := s.lookupCA(name)
 	if ca == nil {
 		return nil, caerrors.NewHTTPErr(404, caerrors.ErrCANotFound, "CA '%s' does not exist", name)
 	}
 	return ca, nil
 }
 
+// lookupCA returns the CA with the name, or nil if the server has no such CA
+func (s *Server) lookupCA(name string) *CA {
+	s.caMapMutex.RLock()
+	defer s.caMapMutex.RUnlock()
+	return s.caMap[name]
+}
+
+// getCAs returns the CAs of the server
+func (s *Server) getCAs() []*CA {
+	s.caMapMutex.RLock()
+	defer s.caMapMutex.RUnlock()
+	cas := make([]*CA, 0, len(s.caMap))
+	for _, ca := range s.caMap {
+		cas = append(cas, ca)
+	}
+	return cas
+}
+
 // Register all endpoint handlers
 func (s *Server) registerHandlers() {
 	s.mux.Use(s.cors, s.middleware)
@@ -557,10 +740,27 @@ func (s *Server) registerHandlers() {
 	s.registerHandler(newRevokeEndpoint(s))
 	s.registerHandler(newGenCRLEndpoint(s))
 	s.registerHandler(newIdentitiesStreamingEndpoint(s))
+	s.registerHandler(newIdentitiesBatchEndpoint(s))
 	s.registerHandler(newIdentitiesEndpoint(s))
+	s.registerHandler(newIdentitySecretEndpoint(s))
+	s.registerHandler(newIdentityTOTPEndpoint(s))
+	s.registerHandler(newApprovalsEndpoint(s))
+	s.registerHandler(newApprovalEndpoint(s))
+	s.registerHandler(newApproveEndpoint(s))
+	s.registerHandler(newRejectEndpoint(s))
 	s.registerHandler(newAffiliationsStreamingEndpoint(s))
 	s.registerHandler(newAffiliationsEndpoint(s))
+	s.registerHandler(newRolesEndpoint(s))
+	s.registerHandler(newRoleEndpoint(s))
 	s.registerHandler(newCertificateEndpoint(s))
+	s.registerHandler(newACMEAccountsEndpoint(s))
+	s.registerHandler(newAuditEndpoint(s))
+	s.registerOCSPHandler()
+	s.registerCRLHandler()
+	s.registerESTHandlers()
+	s.registerACMEHandler()
+	s.registerReloadHandler()
+	s.registerCAsHandler()
 }
 
 // Register a handler
@@ -594,7 +794,10 @@ func (s *Server) getAPIName(r *http.Request) string {
 	return apiName
 }
 
+// getCAName returns the name of the default CA
 func (s *Server) getCAName() string {
+	s.CA.stateMutex.RLock()
+	defer s.CA.stateMutex.RUnlock()
 	return s.CA.Config.CA.Name
 }
 
@@ -722,7 +925,7 @@ func (s *Server) serve() error {
 		return nil
 	}
 
-	s.serveError = http.Serve(listener, s.mux)
+	s.serveError = http.Serve(listener, s.serveOCSP(s.mux))
 
 	log.Errorf("Server has stopped serving: %s", s.serveError)
 	s.closeListener()
@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package acme
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// InsertAccount is the SQL for inserting the account of an external account binding key
+	InsertAccount = "INSERT INTO acme_accounts (id, enrollment_id, hmac_key, jwk, thumbprint, status, created_at) VALUES (:id, :enrollment_id, :hmac_key, :jwk, :thumbprint, :status, :created_at)"
+	// SelectAccount is the SQL for getting an account by its ID
+	SelectAccount = "SELECT * FROM acme_accounts WHERE (id = ?)"
+	// SelectAccountByThumbprint is the SQL for getting an account by the thumbprint of its key
+	SelectAccountByThumbprint = "SELECT * FROM acme_accounts WHERE (thumbprint = ?)"
+	// BindAccount is the SQL for binding a key to a pending account
+	BindAccount = "UPDATE acme_accounts SET jwk = ?, thumbprint = ?, hmac_key = '', status = ? WHERE (id = ? AND status = ?)"
+
+	// hmacKeyLength is the length in bytes of external account binding keys
+	hmacKeyLength = 32
+)
+
+// AccountRecord is an ACME account. The account is created, pending, along
+// with its external account binding key for an identity and becomes valid
+// when a key is bound to it by a newAccount request.
+type AccountRecord struct {
+	ID           string    `db:"id"`
+	EnrollmentID string    `db:"enrollment_id"`
+	HMACKey      string    `db:"hmac_key"`
+	JWK          string    `db:"jwk"`
+	Thumbprint   string    `db:"thumbprint"`
+	Status       string    `db:"status"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+// AccountAccessor stores ACME accounts in the database
+type AccountAccessor struct {
+	db db.FabricCADB
+}
+
+// NewAccountAccessor returns an AccountAccessor for the database
+func NewAccountAccessor(db db.FabricCADB) *AccountAccessor {
+	return &AccountAccessor{db: db}
+}
+
+// CreateAccount creates a pending account for the identity and returns it
+// along with its external account binding key
+func (a *AccountAccessor) CreateAccount(enrollmentID string) (*AccountRecord, error) {
+	id := make([]byte, 16)
+	key := make([]byte, hmacKeyLength)
+	_, err := rand.Read(id)
+	if err == nil {
+		_, err = rand.Read(key)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate external account binding key")
+	}
+	rec := &AccountRecord{
+		ID:           b64(id),
+		EnrollmentID: enrollmentID,
+		HMACKey:      b64(key),
+		Status:       StatusPending,
+		CreatedAt:    time.Now().UTC(),
+	}
+	_, err = a.db.NamedExec("InsertACMEAccount", InsertAccount, rec)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to insert ACME account into database")
+	}
+	log.Debugf("Created ACME account %s for identity '%s'", rec.ID, enrollmentID)
+	return rec, nil
+}
+
+// GetAccount returns the account with the ID, or nil if there is none
+func (a *AccountAccessor) GetAccount(id string) (*AccountRecord, error) {
+	return a.getAccount("GetACMEAccount", SelectAccount, id)
+}
+
+// GetAccountByThumbprint returns the account bound to the key with the
+// thumbprint, or nil if there is none
+func (a *AccountAccessor) GetAccountByThumbprint(thumbprint string) (*AccountRecord, error) {
+	return a.getAccount("GetACMEAccountByThumbprint", SelectAccountByThumbprint, thumbprint)
+}
+
+// BindAccount binds the key to the pending account and makes it valid
+func (a *AccountAccessor) BindAccount(id, jwk, thumbprint string) error {
+	res, err := a.db.Exec("BindACMEAccount", a.db.Rebind(BindAccount), jwk, thumbprint, StatusValid, id, StatusPending)
+	if err != nil {
+		return errors.Wrap(err, "Failed to bind ACME account")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to bind ACME account")
+	}
+	if n != 1 {
+		return errors.Errorf("ACME account %s is not pending", id)
+	}
+	return nil
+}
+
+func (a *AccountAccessor) getAccount(funcName, query, arg string) (*AccountRecord, error) {
+	rec := &AccountRecord{}
+	err := a.db.Get(funcName, rec, a.db.Rebind(query), arg)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get ACME account")
+	}
+	return rec, nil
+}
@@ -0,0 +1,21 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package acme
+
+import "time"
+
+// Config is the configuration of the ACME server of a CA
+type Config struct {
+	Enabled bool `def:"false" help:"Enable the ACME server for the CA"`
+	// Profile is the signing profile used to issue the certificates of ACME orders
+	Profile string `help:"Signing profile used to issue certificates to ACME clients"`
+	// HTTPPort is the port the http-01 challenge is validated on; it is only
+	// changed from the standard port 80 for testing
+	HTTPPort int `def:"80" help:"Port on which http-01 challenges are validated"`
+	// Expiry is how long orders and their authorizations are valid
+	Expiry time.Duration `def:"24h" help:"Expiration of ACME orders and authorizations"`
+}
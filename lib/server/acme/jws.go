@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package acme
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-ca/lib/server/jose"
+	"github.com/pkg/errors"
+)
+
+// JWS is a JWS (RFC 7515) in the flattened JSON serialization used by ACME
+type JWS struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// Header is the protected header of an ACME JWS (RFC 8555, section 6.2)
+type Header struct {
+	Alg   string    `json:"alg"`
+	Nonce string    `json:"nonce,omitempty"`
+	URL   string    `json:"url"`
+	KID   string    `json:"kid,omitempty"`
+	JWK   *jose.JWK `json:"jwk,omitempty"`
+}
+
+// Message is a parsed JWS
+type Message struct {
+	JWS     *JWS
+	Header  *Header
+	Payload []byte
+}
+
+// ParseJWS parses a JWS in the flattened JSON serialization
+func ParseJWS(body []byte) (*Message, error) {
+	jws := &JWS{}
+	err := json.Unmarshal(body, jws)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid JWS")
+	}
+	protected, err := unb64(jws.Protected)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid JWS protected header")
+	}
+	header := &Header{}
+	err = json.Unmarshal(protected, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid JWS protected header")
+	}
+	payload, err := unb64(jws.Payload)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid JWS payload")
+	}
+	return &Message{JWS: jws, Header: header, Payload: payload}, nil
+}
+
+// Verify verifies the signature of the JWS with the public key
+func (m *Message) Verify(pub crypto.PublicKey) error {
+	sig, err := unb64(m.JWS.Signature)
+	if err != nil {
+		return errors.WithMessage(err, "Invalid JWS signature")
+	}
+	return jose.Verify(m.Header.Alg, pub, []byte(m.JWS.Protected+"."+m.JWS.Payload), sig)
+}
+
+// VerifyHMAC verifies the HS256 MAC of the JWS, as used by external account
+// bindings (RFC 8555, section 7.3.4)
+func (m *Message) VerifyHMAC(key []byte) error {
+	if m.Header.Alg != "HS256" {
+		return errors.Errorf("Unsupported external account binding algorithm '%s'", m.Header.Alg)
+	}
+	sig, err := unb64(m.JWS.Signature)
+	if err != nil {
+		return errors.WithMessage(err, "Invalid JWS signature")
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(m.JWS.Protected + "." + m.JWS.Payload))
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return errors.New("Invalid external account binding MAC")
+	}
+	return nil
+}
+
+func b64(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func unb64(s string) ([]byte, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid base64url encoding")
+	}
+	return buf, nil
+}
@@ -0,0 +1,40 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package acme
+
+import "fmt"
+
+// ACME error types (RFC 8555, section 6.7)
+const (
+	ErrAccountDoesNotExist     = "urn:ietf:params:acme:error:accountDoesNotExist"
+	ErrBadCSR                  = "urn:ietf:params:acme:error:badCSR"
+	ErrBadNonce                = "urn:ietf:params:acme:error:badNonce"
+	ErrBadPublicKey            = "urn:ietf:params:acme:error:badPublicKey"
+	ErrExternalAccountRequired = "urn:ietf:params:acme:error:externalAccountRequired"
+	ErrMalformed               = "urn:ietf:params:acme:error:malformed"
+	ErrOrderNotReady           = "urn:ietf:params:acme:error:orderNotReady"
+	ErrRejectedIdentifier      = "urn:ietf:params:acme:error:rejectedIdentifier"
+	ErrServerInternal          = "urn:ietf:params:acme:error:serverInternal"
+	ErrUnauthorized            = "urn:ietf:params:acme:error:unauthorized"
+	ErrUnsupportedIdentifier   = "urn:ietf:params:acme:error:unsupportedIdentifier"
+)
+
+// Problem is an ACME error returned as a problem document (RFC 7807)
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func newProblem(status int, typ, format string, args ...interface{}) *Problem {
+	return &Problem{Type: typ, Detail: fmt.Sprintf(format, args...), Status: status}
+}
+
+// Error returns the detail of the problem
+func (p *Problem) Error() string {
+	return p.Detail
+}
@@ -0,0 +1,913 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gmux "github.com/gorilla/mux"
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/lib/server/jose"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+// Status values of ACME objects (RFC 8555, section 7.1.6)
+const (
+	StatusPending     = "pending"
+	StatusReady       = "ready"
+	StatusProcessing  = "processing"
+	StatusValid       = "valid"
+	StatusInvalid     = "invalid"
+	StatusDeactivated = "deactivated"
+)
+
+// Challenge types supported by the server
+const (
+	ChallengeHTTP01 = "http-01"
+	ChallengeDNS01  = "dns-01"
+)
+
+const (
+	// nonceExpiry is how long a nonce can be used
+	nonceExpiry = time.Hour
+	// maxBodySize is the maximum size of a request body
+	maxBodySize = 1 << 20
+	// validationTimeout bounds the validation of a challenge
+	validationTimeout = 10 * time.Second
+	// defaultExpiry is the expiry of orders if none is configured
+	defaultExpiry = 24 * time.Hour
+)
+
+// CA is the CA an ACME server issues certificates for
+type CA interface {
+	// DB returns the database holding the ACME accounts
+	DB() (db.FabricCADB, error)
+	// Issue signs the DER encoded CSR for the identity to which the
+	// account is bound and returns the PEM encoded certificate chain
+	Issue(enrollmentID string, csr []byte, identifiers []string) ([]byte, error)
+}
+
+// Server is the ACME (RFC 8555) server of a CA. Accounts are stored in the
+// database; nonces, orders, authorizations and issued certificates are
+// kept in memory, so ACME clients have to create new orders if the server
+// restarts.
+type Server struct {
+	config *Config
+	ca     CA
+	router *gmux.Router
+	// client is used to validate http-01 challenges
+	client *http.Client
+	// lookupTXT is used to validate dns-01 challenges
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+
+	mutex      sync.Mutex
+	nonces     map[string]time.Time
+	lastPrune  time.Time
+	orders     map[string]*order
+	authzs     map[string]*authorization
+	challenges map[string]*challenge
+	certs      map[string][]byte
+}
+
+type order struct {
+	ID          string
+	AccountID   string
+	Status      string
+	Expires     time.Time
+	Identifiers []Identifier
+	AuthzIDs    []string
+	CertID      string
+	Error       *Problem
+}
+
+type authorization struct {
+	ID         string
+	AccountID  string
+	OrderID    string
+	Identifier Identifier
+	Status     string
+	Expires    time.Time
+	Challenges []*challenge
+}
+
+type challenge struct {
+	ID        string
+	AuthzID   string
+	Type      string
+	Token     string
+	Status    string
+	Validated time.Time
+	Error     *Problem
+}
+
+// Identifier is an identifier of an order (RFC 8555, section 9.7.7)
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// prefixKey is the request context key of the path prefix the server is
+// mounted at
+type prefixKey struct{}
+
+// NewServer returns the ACME server of the CA
+func NewServer(config *Config, ca CA) *Server {
+	s := &Server{
+		config:     config,
+		ca:         ca,
+		client:     &http.Client{Timeout: validationTimeout},
+		lookupTXT:  net.DefaultResolver.LookupTXT,
+		nonces:     map[string]time.Time{},
+		orders:     map[string]*order{},
+		authzs:     map[string]*authorization{},
+		challenges: map[string]*challenge{},
+		certs:      map[string][]byte{},
+	}
+	r := gmux.NewRouter()
+	r.HandleFunc("/directory", s.directory).Methods("GET")
+	r.HandleFunc("/new-nonce", s.newNonce).Methods("GET", "HEAD")
+	r.HandleFunc("/new-account", s.handle(s.newAccount)).Methods("POST")
+	r.HandleFunc("/account/{id}", s.handle(s.account)).Methods("POST")
+	r.HandleFunc("/account/{id}/orders", s.handle(s.accountOrders)).Methods("POST")
+	r.HandleFunc("/new-order", s.handle(s.newOrder)).Methods("POST")
+	r.HandleFunc("/order/{id}", s.handle(s.getOrder)).Methods("POST")
+	r.HandleFunc("/order/{id}/finalize", s.handle(s.finalize)).Methods("POST")
+	r.HandleFunc("/authz/{id}", s.handle(s.getAuthorization)).Methods("POST")
+	r.HandleFunc("/chall/{id}", s.handle(s.respondChallenge)).Methods("POST")
+	r.HandleFunc("/cert/{id}", s.handle(s.getCertificate)).Methods("POST")
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.writeProblem(w, r, newProblem(http.StatusNotFound, ErrMalformed, "Resource '%s' not found", r.URL.Path))
+	})
+	s.router = r
+	return s
+}
+
+// Handler returns the handler of the ACME requests of the server mounted at
+// the path prefix. The URLs of the ACME resources are relative to the prefix,
+// so a server can be mounted at more than one prefix.
+func (s *Server) Handler(prefix string) http.Handler {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	strip := http.StripPrefix(strings.TrimSuffix(prefix, "/"), s.router)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		strip.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), prefixKey{}, prefix)))
+	})
+}
+
+// CreateAccount creates a pending account for the identity and returns
+// its external account binding key ID and base64url encoded HMAC key
+func (s *Server) CreateAccount(enrollmentID string) (string, string, error) {
+	accounts, err := s.accounts()
+	if err != nil {
+		return "", "", err
+	}
+	rec, err := accounts.CreateAccount(enrollmentID)
+	if err != nil {
+		return "", "", err
+	}
+	return rec.ID, rec.HMACKey, nil
+}
+
+// request is an authenticated ACME request
+type request struct {
+	r       *http.Request
+	msg     *Message
+	account *AccountRecord
+	// url is the URL the request was sent to
+	url string
+}
+
+// handle returns the HTTP handler of a POST request. The JWS of the request
+// is verified before the handler is called.
+func (s *Server) handle(handler func(w http.ResponseWriter, req *request) *Problem) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, prob := s.verifyRequest(r)
+		if prob == nil {
+			prob = handler(w, req)
+		}
+		if prob != nil {
+			s.writeProblem(w, r, prob)
+		}
+	}
+}
+
+func (s *Server) verifyRequest(r *http.Request) (*request, *Problem) {
+	if ct := r.Header.Get("Content-Type"); ct != "application/jose+json" {
+		return nil, newProblem(http.StatusUnsupportedMediaType, ErrMalformed, "Invalid content type '%s'", ct)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, ErrMalformed, "Failed to read request body: %s", err)
+	}
+	msg, err := ParseJWS(body)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, ErrMalformed, "%s", err)
+	}
+	if !s.consumeNonce(msg.Header.Nonce) {
+		return nil, newProblem(http.StatusBadRequest, ErrBadNonce, "Invalid or expired nonce")
+	}
+	req := &request{r: r, msg: msg, url: s.baseURL(r) + strings.TrimPrefix(r.URL.Path, "/")}
+	if msg.Header.URL != req.url {
+		return nil, newProblem(http.StatusUnauthorized, ErrUnauthorized, "The JWS URL '%s' does not match the request URL '%s'", msg.Header.URL, req.url)
+	}
+
+	var jwk *jose.JWK
+	switch {
+	case msg.Header.JWK != nil && msg.Header.KID != "":
+		return nil, newProblem(http.StatusBadRequest, ErrMalformed, "The JWS must not have both a 'jwk' and a 'kid'")
+	case msg.Header.JWK != nil:
+		// Only a new account request is signed by a key which is not bound to an account yet
+		if !strings.HasSuffix(r.URL.Path, "/new-account") {
+			return nil, newProblem(http.StatusBadRequest, ErrMalformed, "The JWS must have a 'kid'")
+		}
+		jwk = msg.Header.JWK
+	case msg.Header.KID != "":
+		id := strings.TrimPrefix(msg.Header.KID, s.baseURL(r)+"account/")
+		accounts, err := s.accounts()
+		if err != nil {
+			return nil, newProblem(http.StatusInternalServerError, ErrServerInternal, "%s", err)
+		}
+		req.account, err = accounts.GetAccount(id)
+		if err != nil {
+			return nil, newProblem(http.StatusInternalServerError, ErrServerInternal, "%s", err)
+		}
+		if req.account == nil || req.account.Status == StatusPending {
+			return nil, newProblem(http.StatusBadRequest, ErrAccountDoesNotExist, "Account '%s' does not exist", msg.Header.KID)
+		}
+		if req.account.Status != StatusValid {
+			return nil, newProblem(http.StatusUnauthorized, ErrUnauthorized, "Account '%s' is %s", msg.Header.KID, req.account.Status)
+		}
+		jwk = &jose.JWK{}
+		err = json.Unmarshal([]byte(req.account.JWK), jwk)
+		if err != nil {
+			return nil, newProblem(http.StatusInternalServerError, ErrServerInternal, "Invalid key of account '%s'", id)
+		}
+	default:
+		return nil, newProblem(http.StatusBadRequest, ErrMalformed, "The JWS must have a 'jwk' or a 'kid'")
+	}
+	pub, err := jwk.PublicKey()
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, ErrBadPublicKey, "%s", err)
+	}
+	err = msg.Verify(pub)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, ErrMalformed, "%s", err)
+	}
+	return req, nil
+}
+
+// Serve the directory (RFC 8555, section 7.1.1)
+func (s *Server) directory(w http.ResponseWriter, r *http.Request) {
+	base := s.baseURL(r)
+	s.writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"newNonce":   base + "new-nonce",
+		"newAccount": base + "new-account",
+		"newOrder":   base + "new-order",
+		"meta": map[string]interface{}{
+			"externalAccountRequired": true,
+		},
+	})
+}
+
+// Serve a new nonce (RFC 8555, section 7.2)
+func (s *Server) newNonce(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	s.setNonce(w, r)
+	if r.Method == "GET" {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// Create or look up an account (RFC 8555, section 7.3). New accounts must
+// be bound to a pending account created for an identity.
+func (s *Server) newAccount(w http.ResponseWriter, req *request) *Problem {
+	var payload struct {
+		OnlyReturnExisting     bool             `json:"onlyReturnExisting"`
+		ExternalAccountBinding *json.RawMessage `json:"externalAccountBinding"`
+	}
+	err := json.Unmarshal(req.msg.Payload, &payload)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, ErrMalformed, "Invalid new account request: %s", err)
+	}
+	accounts, err := s.accounts()
+	if err != nil {
+		return newProblem(http.StatusInternalServerError, ErrServerInternal, "%s", err)
+	}
+	jwk := req.msg.Header.JWK
+	thumbprint := jwk.Thumbprint()
+	existing, err := accounts.GetAccountByThumbprint(thumbprint)
+	if err != nil {
+		return newProblem(http.StatusInternalServerError, ErrServerInternal, "%s", err)
+	}
+	if existing != nil {
+		w.Header().Set("Location", s.baseURL(req.r)+"account/"+existing.ID)
+		s.writeJSON(w, req.r, http.StatusOK, s.accountJSON(req.r, existing))
+		return nil
+	}
+	if payload.OnlyReturnExisting {
+		return newProblem(http.StatusBadRequest, ErrAccountDoesNotExist, "No account exists for the key")
+	}
+	if payload.ExternalAccountBinding == nil {
+		return newProblem(http.StatusUnauthorized, ErrExternalAccountRequired, "An external account binding is required")
+	}
+
+	eab, err := ParseJWS(*payload.ExternalAccountBinding)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, ErrMalformed, "Invalid external account binding: %s", err)
+	}
+	if eab.Header.URL != req.url {
+		return newProblem(http.StatusUnauthorized, ErrUnauthorized, "The external account binding URL does not match the request URL")
+	}
+	eabKey := &jose.JWK{}
+	err = json.Unmarshal(eab.Payload, eabKey)
+	if err != nil || eabKey.Thumbprint() != thumbprint {
+		return newProblem(http.StatusBadRequest, ErrMalformed, "The external account binding is not for the account key")
+	}
+	rec, err := accounts.GetAccount(eab.Header.KID)
+	if err != nil {
+		return newProblem(http.StatusInternalServerError, ErrServerInternal, "%s", err)
+	}
+	if rec == nil || rec.Status != StatusPending {
+		return newProblem(http.StatusUnauthorized, ErrUnauthorized, "Unknown or already used external account binding key '%s'", eab.Header.KID)
+	}
+	hmacKey, err := unb64(rec.HMACKey)
+	if err != nil {
+		return newProblem(http.StatusInternalServerError, ErrServerInternal, "Invalid external account binding key '%s'", rec.ID)
+	}
+	err = eab.VerifyHMAC(hmacKey)
+	if err != nil {
+		return newProblem(http.StatusUnauthorized, ErrUnauthorized, "%s", err)
+	}
+	jwkJSON, err := json.Marshal(jwk)
+	if err != nil {
+		return newProblem(http.StatusInternalServerError, ErrServerInternal, "%s", err)
+	}
+	err = accounts.BindAccount(rec.ID, string(jwkJSON), thumbprint)
+	if err != nil {
+		return newProblem(http.StatusUnauthorized, ErrUnauthorized, "%s", err)
+	}
+	rec.Status = StatusValid
+	log.Infof("Bound ACME account %s to identity '%s'", rec.ID, rec.EnrollmentID)
+	w.Header().Set("Location", s.baseURL(req.r)+"account/"+rec.ID)
+	s.writeJSON(w, req.r, http.StatusCreated, s.accountJSON(req.r, rec))
+	return nil
+}
+
+// Return the account of the request (RFC 8555, section 7.3.2)
+func (s *Server) account(w http.ResponseWriter, req *request) *Problem {
+	if gmux.Vars(req.r)["id"] != req.account.ID {
+		return newProblem(http.StatusUnauthorized, ErrUnauthorized, "The request is not signed by the account's key")
+	}
+	s.writeJSON(w, req.r, http.StatusOK, s.accountJSON(req.r, req.account))
+	return nil
+}
+
+// Return the orders of the account of the request (RFC 8555, section 7.1.2.1)
+func (s *Server) accountOrders(w http.ResponseWriter, req *request) *Problem {
+	if gmux.Vars(req.r)["id"] != req.account.ID {
+		return newProblem(http.StatusUnauthorized, ErrUnauthorized, "The request is not signed by the account's key")
+	}
+	s.mutex.Lock()
+	urls := []string{}
+	for _, o := range s.orders {
+		if o.AccountID == req.account.ID {
+			urls = append(urls, s.baseURL(req.r)+"order/"+o.ID)
+		}
+	}
+	s.mutex.Unlock()
+	sort.Strings(urls)
+	s.writeJSON(w, req.r, http.StatusOK, map[string]interface{}{"orders": urls})
+	return nil
+}
+
+// Create an order and its authorizations (RFC 8555, section 7.4)
+func (s *Server) newOrder(w http.ResponseWriter, req *request) *Problem {
+	if req.account == nil {
+		return newProblem(http.StatusBadRequest, ErrMalformed, "The request must be signed by an account")
+	}
+	var payload struct {
+		Identifiers []Identifier `json:"identifiers"`
+	}
+	err := json.Unmarshal(req.msg.Payload, &payload)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, ErrMalformed, "Invalid new order request: %s", err)
+	}
+	if len(payload.Identifiers) == 0 {
+		return newProblem(http.StatusBadRequest, ErrMalformed, "The order has no identifiers")
+	}
+	for _, id := range payload.Identifiers {
+		if id.Type != "dns" {
+			return newProblem(http.StatusBadRequest, ErrUnsupportedIdentifier, "Unsupported identifier type '%s'", id.Type)
+		}
+		if !isValidDNSName(id.Value) {
+			return newProblem(http.StatusBadRequest, ErrRejectedIdentifier, "Invalid DNS name '%s'", id.Value)
+		}
+	}
+
+	expiry := s.config.Expiry
+	if expiry <= 0 {
+		expiry = defaultExpiry
+	}
+	o := &order{
+		ID:          newID(),
+		AccountID:   req.account.ID,
+		Status:      StatusPending,
+		Expires:     time.Now().UTC().Add(expiry),
+		Identifiers: payload.Identifiers,
+	}
+	s.mutex.Lock()
+	s.pruneExpired()
+	for _, id := range payload.Identifiers {
+		a := &authorization{
+			ID:         newID(),
+			AccountID:  req.account.ID,
+			OrderID:    o.ID,
+			Identifier: id,
+			Status:     StatusPending,
+			Expires:    o.Expires,
+		}
+		token := newID()
+		for _, typ := range []string{ChallengeHTTP01, ChallengeDNS01} {
+			c := &challenge{ID: newID(), AuthzID: a.ID, Type: typ, Token: token, Status: StatusPending}
+			a.Challenges = append(a.Challenges, c)
+			s.challenges[c.ID] = c
+		}
+		s.authzs[a.ID] = a
+		o.AuthzIDs = append(o.AuthzIDs, a.ID)
+	}
+	s.orders[o.ID] = o
+	resp := s.orderJSON(req.r, o)
+	s.mutex.Unlock()
+
+	w.Header().Set("Location", s.baseURL(req.r)+"order/"+o.ID)
+	s.writeJSON(w, req.r, http.StatusCreated, resp)
+	return nil
+}
+
+// Return an order (RFC 8555, section 7.1.3)
+func (s *Server) getOrder(w http.ResponseWriter, req *request) *Problem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	o, prob := s.lookupOrder(req)
+	if prob != nil {
+		return prob
+	}
+	s.writeJSON(w, req.r, http.StatusOK, s.orderJSON(req.r, o))
+	return nil
+}
+
+// Finalize an order by issuing the certificate for its CSR (RFC 8555, section 7.4)
+func (s *Server) finalize(w http.ResponseWriter, req *request) *Problem {
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	err := json.Unmarshal(req.msg.Payload, &payload)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, ErrMalformed, "Invalid finalize request: %s", err)
+	}
+	csrDER, err := unb64(payload.CSR)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, ErrBadCSR, "%s", err)
+	}
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, ErrBadCSR, "Invalid CSR: %s", err)
+	}
+	err = csr.CheckSignature()
+	if err != nil {
+		return newProblem(http.StatusBadRequest, ErrBadCSR, "Invalid CSR signature: %s", err)
+	}
+
+	s.mutex.Lock()
+	o, prob := s.lookupOrder(req)
+	if prob == nil && o.Status != StatusReady {
+		prob = newProblem(http.StatusForbidden, ErrOrderNotReady, "Order '%s' is %s", o.ID, o.Status)
+	}
+	var identifiers []string
+	if prob == nil {
+		identifiers = orderNames(o)
+		if !equalNames(identifiers, csrNames(csr)) {
+			prob = newProblem(http.StatusBadRequest, ErrBadCSR, "The CSR names do not match the order's identifiers %v", identifiers)
+		} else {
+			o.Status = StatusProcessing
+		}
+	}
+	s.mutex.Unlock()
+	if prob != nil {
+		return prob
+	}
+
+	chain, err := s.ca.Issue(req.account.EnrollmentID, csrDER, identifiers)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil {
+		log.Errorf("Failed to issue certificate for ACME order %s: %s", o.ID, err)
+		o.Status = StatusInvalid
+		o.Error = newProblem(http.StatusInternalServerError, ErrServerInternal, "Failed to issue certificate: %s", err)
+		return o.Error
+	}
+	o.CertID = newID()
+	o.Status = StatusValid
+	s.certs[o.CertID] = chain
+	w.Header().Set("Location", s.baseURL(req.r)+"order/"+o.ID)
+	s.writeJSON(w, req.r, http.StatusOK, s.orderJSON(req.r, o))
+	return nil
+}
+
+// Return an authorization (RFC 8555, section 7.5)
+func (s *Server) getAuthorization(w http.ResponseWriter, req *request) *Problem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	a := s.authzs[gmux.Vars(req.r)["id"]]
+	if a == nil || req.account == nil || a.AccountID != req.account.ID {
+		return newProblem(http.StatusNotFound, ErrMalformed, "Authorization not found")
+	}
+	s.writeJSON(w, req.r, http.StatusOK, s.authzJSON(req.r, a))
+	return nil
+}
+
+// Start the validation of a challenge (RFC 8555, section 7.5.1). The
+// challenge is validated in the background; the client polls the
+// authorization for the result.
+func (s *Server) respondChallenge(w http.ResponseWriter, req *request) *Problem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c := s.challenges[gmux.Vars(req.r)["id"]]
+	var a *authorization
+	if c != nil {
+		a = s.authzs[c.AuthzID]
+	}
+	if a == nil || req.account == nil || a.AccountID != req.account.ID {
+		return newProblem(http.StatusNotFound, ErrMalformed, "Challenge not found")
+	}
+	// A POST-as-GET request only returns the challenge
+	if len(req.msg.Payload) > 0 && c.Status == StatusPending && a.Status == StatusPending {
+		c.Status = StatusProcessing
+		keyAuth := c.Token + "." + req.account.Thumbprint
+		go s.validate(a, c, keyAuth)
+	}
+	w.Header().Add("Link", fmt.Sprintf(`<%sauthz/%s>;rel="up"`, s.baseURL(req.r), a.ID))
+	s.writeJSON(w, req.r, http.StatusOK, s.challengeJSON(req.r, c))
+	return nil
+}
+
+// Return the certificate chain of an order (RFC 8555, section 7.4.2)
+func (s *Server) getCertificate(w http.ResponseWriter, req *request) *Problem {
+	id := gmux.Vars(req.r)["id"]
+	s.mutex.Lock()
+	chain := s.certs[id]
+	owned := false
+	for _, o := range s.orders {
+		if o.CertID == id && req.account != nil && o.AccountID == req.account.ID {
+			owned = true
+		}
+	}
+	s.mutex.Unlock()
+	if chain == nil || !owned {
+		return newProblem(http.StatusNotFound, ErrMalformed, "Certificate not found")
+	}
+	s.setNonce(w, req.r)
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.WriteHeader(http.StatusOK)
+	w.Write(chain)
+	return nil
+}
+
+// validate validates the challenge and updates the status of its
+// authorization and order
+func (s *Server) validate(a *authorization, c *challenge, keyAuth string) {
+	ctx, cancel := context.WithTimeout(context.Background(), validationTimeout)
+	defer cancel()
+	var err error
+	switch c.Type {
+	case ChallengeHTTP01:
+		err = s.validateHTTP01(ctx, a.Identifier.Value, c.Token, keyAuth)
+	case ChallengeDNS01:
+		err = s.validateDNS01(ctx, a.Identifier.Value, keyAuth)
+	default:
+		err = errors.Errorf("Unsupported challenge type '%s'", c.Type)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	o := s.orders[a.OrderID]
+	if err != nil {
+		log.Infof("ACME %s challenge for '%s' failed: %s", c.Type, a.Identifier.Value, err)
+		c.Status = StatusInvalid
+		c.Error = newProblem(http.StatusForbidden, ErrUnauthorized, "%s", err)
+		a.Status = StatusInvalid
+		if o != nil {
+			o.Status = StatusInvalid
+		}
+		return
+	}
+	log.Debugf("ACME %s challenge for '%s' succeeded", c.Type, a.Identifier.Value)
+	c.Status = StatusValid
+	c.Validated = time.Now().UTC()
+	a.Status = StatusValid
+	if o == nil || o.Status != StatusPending {
+		return
+	}
+	for _, id := range o.AuthzIDs {
+		if s.authzs[id] == nil || s.authzs[id].Status != StatusValid {
+			return
+		}
+	}
+	o.Status = StatusReady
+}
+
+func (s *Server) validateHTTP01(ctx context.Context, domain, token, keyAuth string) error {
+	port := s.config.HTTPPort
+	if port == 0 {
+		port = 80
+	}
+	url := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", net.JoinHostPort(domain, fmt.Sprint(port)), token)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return errors.Wrap(err, "Invalid challenge URL")
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to fetch %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Fetching %s returned status %d", url, resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read %s", url)
+	}
+	if strings.TrimSpace(string(body)) != keyAuth {
+		return errors.Errorf("The key authorization at %s does not match", url)
+	}
+	return nil
+}
+
+func (s *Server) validateDNS01(ctx context.Context, domain, keyAuth string) error {
+	name := "_acme-challenge." + domain
+	records, err := s.lookupTXT(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to look up TXT records of %s", name)
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	expected := b64(sum[:])
+	for _, rec := range records {
+		if rec == expected {
+			return nil
+		}
+	}
+	return errors.Errorf("No TXT record of %s matches the key authorization", name)
+}
+
+// lookupOrder returns the order of the request's URL if it belongs to the
+// request's account. The caller must hold the mutex.
+func (s *Server) lookupOrder(req *request) (*order, *Problem) {
+	o := s.orders[gmux.Vars(req.r)["id"]]
+	if o == nil || req.account == nil || o.AccountID != req.account.ID {
+		return nil, newProblem(http.StatusNotFound, ErrMalformed, "Order not found")
+	}
+	return o, nil
+}
+
+// pruneExpired removes expired orders, authorizations, challenges and
+// certificates. The caller must hold the mutex.
+func (s *Server) pruneExpired() {
+	now := time.Now()
+	for id, o := range s.orders {
+		if o.Expires.After(now) {
+			continue
+		}
+		for _, aid := range o.AuthzIDs {
+			if a := s.authzs[aid]; a != nil {
+				for _, c := range a.Challenges {
+					delete(s.challenges, c.ID)
+				}
+			}
+			delete(s.authzs, aid)
+		}
+		delete(s.certs, o.CertID)
+		delete(s.orders, id)
+	}
+}
+
+func (s *Server) setNonce(w http.ResponseWriter, r *http.Request) {
+	nonce := newID()
+	now := time.Now()
+	s.mutex.Lock()
+	if now.Sub(s.lastPrune) > time.Minute {
+		for n, expiry := range s.nonces {
+			if expiry.Before(now) {
+				delete(s.nonces, n)
+			}
+		}
+		s.lastPrune = now
+	}
+	s.nonces[nonce] = now.Add(nonceExpiry)
+	s.mutex.Unlock()
+	w.Header().Set("Replay-Nonce", nonce)
+	w.Header().Add("Link", fmt.Sprintf(`<%sdirectory>;rel="index"`, s.baseURL(r)))
+}
+
+func (s *Server) consumeNonce(nonce string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	expiry, ok := s.nonces[nonce]
+	if !ok {
+		return false
+	}
+	delete(s.nonces, nonce)
+	return expiry.After(time.Now())
+}
+
+func (s *Server) accounts() (*AccountAccessor, error) {
+	db, err := s.ca.DB()
+	if err != nil {
+		return nil, err
+	}
+	return NewAccountAccessor(db), nil
+}
+
+// baseURL returns the URL the server is mounted at
+func (s *Server) baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	prefix, _ := r.Context().Value(prefixKey{}).(string)
+	return scheme + "://" + r.Host + prefix
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, status int, obj interface{}) {
+	s.setNonce(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(obj)
+	if err != nil {
+		log.Errorf("Failed encoding ACME response to JSON: %s", err)
+	}
+}
+
+func (s *Server) writeProblem(w http.ResponseWriter, r *http.Request, prob *Problem) {
+	log.Debugf("ACME request %s %s failed: %s", r.Method, r.URL, prob.Detail)
+	s.setNonce(w, r)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(prob.Status)
+	json.NewEncoder(w).Encode(prob)
+}
+
+func (s *Server) accountJSON(r *http.Request, rec *AccountRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"status": rec.Status,
+		"orders": s.baseURL(r) + "account/" + rec.ID + "/orders",
+	}
+}
+
+func (s *Server) orderJSON(r *http.Request, o *order) map[string]interface{} {
+	base := s.baseURL(r)
+	status := o.Status
+	if status != StatusValid && status != StatusInvalid && o.Expires.Before(time.Now()) {
+		status = StatusInvalid
+	}
+	authzs := []string{}
+	for _, id := range o.AuthzIDs {
+		authzs = append(authzs, base+"authz/"+id)
+	}
+	obj := map[string]interface{}{
+		"status":         status,
+		"expires":        o.Expires.Format(time.RFC3339),
+		"identifiers":    o.Identifiers,
+		"authorizations": authzs,
+		"finalize":       base + "order/" + o.ID + "/finalize",
+	}
+	if o.CertID != "" {
+		obj["certificate"] = base + "cert/" + o.CertID
+	}
+	if o.Error != nil {
+		obj["error"] = o.Error
+	}
+	return obj
+}
+
+func (s *Server) authzJSON(r *http.Request, a *authorization) map[string]interface{} {
+	challenges := []interface{}{}
+	for _, c := range a.Challenges {
+		challenges = append(challenges, s.challengeJSON(r, c))
+	}
+	return map[string]interface{}{
+		"identifier": a.Identifier,
+		"status":     a.Status,
+		"expires":    a.Expires.Format(time.RFC3339),
+		"challenges": challenges,
+	}
+}
+
+func (s *Server) challengeJSON(r *http.Request, c *challenge) map[string]interface{} {
+	obj := map[string]interface{}{
+		"type":   c.Type,
+		"url":    s.baseURL(r) + "chall/" + c.ID,
+		"token":  c.Token,
+		"status": c.Status,
+	}
+	if !c.Validated.IsZero() {
+		obj["validated"] = c.Validated.Format(time.RFC3339)
+	}
+	if c.Error != nil {
+		obj["error"] = c.Error
+	}
+	return obj
+}
+
+func newID() string {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(errors.Wrap(err, "Failed to generate random ID"))
+	}
+	return b64(buf)
+}
+
+// orderNames returns the sorted DNS names of the order's identifiers
+func orderNames(o *order) []string {
+	names := []string{}
+	for _, id := range o.Identifiers {
+		names = append(names, strings.ToLower(id.Value))
+	}
+	return dedup(names)
+}
+
+// csrNames returns the sorted DNS names and common name of the CSR
+func csrNames(csr *x509.CertificateRequest) []string {
+	names := []string{}
+	for _, name := range csr.DNSNames {
+		names = append(names, strings.ToLower(name))
+	}
+	if csr.Subject.CommonName != "" {
+		names = append(names, strings.ToLower(csr.Subject.CommonName))
+	}
+	return dedup(names)
+}
+
+func dedup(names []string) []string {
+	sort.Strings(names)
+	result := []string{}
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidDNSName returns true if the name is a valid DNS name; wildcard
+// names are not supported
+func isValidDNSName(name string) bool {
+	if name == "" || len(name) > 253 || net.ParseIP(name) != nil {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
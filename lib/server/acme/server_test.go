@@ -0,0 +1,332 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package acme_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	. "github.com/hyperledger/fabric-ca/lib/server/acme"
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/lib/server/db/sqlite"
+	"github.com/hyperledger/fabric-ca/lib/server/jose"
+	"github.com/stretchr/testify/assert"
+)
+
+const testChain = "-----BEGIN CERTIFICATE-----\nchain\n-----END CERTIFICATE-----\n"
+
+type fakeCA struct {
+	db           db.FabricCADB
+	enrollmentID string
+	identifiers  []string
+}
+
+func (ca *fakeCA) DB() (db.FabricCADB, error) {
+	return ca.db, nil
+}
+
+func (ca *fakeCA) Issue(enrollmentID string, csr []byte, identifiers []string) ([]byte, error) {
+	ca.enrollmentID = enrollmentID
+	ca.identifiers = identifiers
+	return []byte(testChain), nil
+}
+
+// acmeClient is a minimal ACME client signing its requests with an ECDSA key
+type acmeClient struct {
+	t     *testing.T
+	base  string
+	key   *ecdsa.PrivateKey
+	jwk   *jose.JWK
+	kid   string
+	nonce string
+}
+
+func TestACMEServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acme")
+	util.FatalError(t, err, "Failed to create temp directory")
+	defer os.RemoveAll(dir)
+	sqliteDB := sqlite.NewDB(filepath.Join(dir, "acme.db"), "", nil)
+	err = sqliteDB.Connect()
+	util.FatalError(t, err, "Failed to connect to database")
+	testDB, err := sqliteDB.Create()
+	util.FatalError(t, err, "Failed to create database")
+	defer testDB.Close()
+
+	// The http-01 challenge responder
+	var mutex sync.Mutex
+	keyAuths := map[string]string{}
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		keyAuth, ok := keyAuths[strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(keyAuth))
+	}))
+	defer responder.Close()
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(responder.URL, "http://"))
+	util.FatalError(t, err, "Failed to get responder port")
+	httpPort, err := strconv.Atoi(port)
+	util.FatalError(t, err, "Invalid responder port")
+
+	ca := &fakeCA{db: testDB}
+	cfg := &Config{Enabled: true, HTTPPort: httpPort, Expiry: time.Hour}
+	acmeServer := NewServer(cfg, ca)
+	mux := http.NewServeMux()
+	mux.Handle("/acme/", acmeServer.Handler("/acme/"))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := newACMEClient(t, ts.URL+"/acme/")
+
+	// The directory requires an external account binding
+	resp, err := http.Get(client.base + "directory")
+	util.FatalError(t, err, "Failed to get directory")
+	var directory struct {
+		NewAccount string
+		Meta       struct{ ExternalAccountRequired bool }
+	}
+	decodeJSON(t, resp, http.StatusOK, &directory)
+	assert.Equal(t, client.base+"new-account", directory.NewAccount)
+	assert.True(t, directory.Meta.ExternalAccountRequired)
+
+	// An account cannot be created without an external account binding
+	resp = client.post("new-account", map[string]interface{}{"termsOfServiceAgreed": true})
+	assertProblem(t, resp, http.StatusUnauthorized, ErrExternalAccountRequired)
+
+	// A nonce can only be used once
+	client.nonce = "reused"
+	resp = client.post("new-account", map[string]interface{}{})
+	assertProblem(t, resp, http.StatusBadRequest, ErrBadNonce)
+
+	// Bind the account key to the identity
+	keyID, hmacKey, err := acmeServer.CreateAccount("admin")
+	util.FatalError(t, err, "Failed to create ACME account")
+	eab := client.eab(keyID, hmacKey)
+	resp = client.post("new-account", map[string]interface{}{"externalAccountBinding": eab})
+	assert.Equal(t, client.base+"account/"+keyID, resp.Header.Get("Location"))
+	var account struct{ Status string }
+	decodeJSON(t, resp, http.StatusCreated, &account)
+	assert.Equal(t, StatusValid, account.Status)
+
+	// The binding key can only be used once
+	other := newACMEClient(t, client.base)
+	resp = other.post("new-account", map[string]interface{}{"externalAccountBinding": other.eab(keyID, hmacKey)})
+	assertProblem(t, resp, http.StatusUnauthorized, ErrUnauthorized)
+
+	// The account of the key is returned
+	resp = client.post("new-account", map[string]interface{}{"onlyReturnExisting": true})
+	decodeJSON(t, resp, http.StatusOK, &account)
+	client.kid = client.base + "account/" + keyID
+
+	// Wildcard identifiers are rejected
+	resp = client.post("new-order", map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": "*.example.com"}},
+	})
+	assertProblem(t, resp, http.StatusBadRequest, ErrRejectedIdentifier)
+
+	// Order a certificate for localhost
+	resp = client.post("new-order", map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": "localhost"}},
+	})
+	orderURL := resp.Header.Get("Location")
+	var order struct {
+		Status         string
+		Authorizations []string
+		Finalize       string
+		Certificate    string
+	}
+	decodeJSON(t, resp, http.StatusCreated, &order)
+	assert.Equal(t, StatusPending, order.Status)
+	if !assert.Len(t, order.Authorizations, 1) {
+		return
+	}
+
+	// The order cannot be finalized before it is authorized
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	util.FatalError(t, err, "Failed to generate key")
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "localhost"},
+		DNSNames: []string{"localhost"},
+	}, key)
+	util.FatalError(t, err, "Failed to create CSR")
+	finalize := map[string]string{"csr": base64.RawURLEncoding.EncodeToString(csr)}
+	resp = client.post(strings.TrimPrefix(order.Finalize, client.base), finalize)
+	assertProblem(t, resp, http.StatusForbidden, ErrOrderNotReady)
+
+	// Respond to the http-01 challenge
+	var authz struct {
+		Status     string
+		Challenges []struct{ Type, URL, Token string }
+	}
+	resp = client.post(strings.TrimPrefix(order.Authorizations[0], client.base), nil)
+	decodeJSON(t, resp, http.StatusOK, &authz)
+	for _, c := range authz.Challenges {
+		if c.Type != ChallengeHTTP01 {
+			continue
+		}
+		mutex.Lock()
+		keyAuths[c.Token] = c.Token + "." + client.jwk.Thumbprint()
+		mutex.Unlock()
+		resp = client.post(strings.TrimPrefix(c.URL, client.base), map[string]interface{}{})
+		decodeJSON(t, resp, http.StatusOK, &struct{}{})
+	}
+	for i := 0; i < 50 && order.Status == StatusPending; i++ {
+		time.Sleep(100 * time.Millisecond)
+		resp = client.post(strings.TrimPrefix(orderURL, client.base), nil)
+		decodeJSON(t, resp, http.StatusOK, &order)
+	}
+	if !assert.Equal(t, StatusReady, order.Status) {
+		return
+	}
+
+	// The CSR must be for the identifiers of the order
+	otherCSR, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: []string{"localhost", "example.com"},
+	}, key)
+	util.FatalError(t, err, "Failed to create CSR")
+	resp = client.post(strings.TrimPrefix(order.Finalize, client.base), map[string]string{
+		"csr": base64.RawURLEncoding.EncodeToString(otherCSR),
+	})
+	assertProblem(t, resp, http.StatusBadRequest, ErrBadCSR)
+
+	// Finalize the order and download the certificate
+	resp = client.post(strings.TrimPrefix(order.Finalize, client.base), finalize)
+	decodeJSON(t, resp, http.StatusOK, &order)
+	assert.Equal(t, StatusValid, order.Status)
+	assert.Equal(t, "admin", ca.enrollmentID)
+	assert.Equal(t, []string{"localhost"}, ca.identifiers)
+
+	resp = client.post(strings.TrimPrefix(order.Certificate, client.base), nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/pem-certificate-chain", resp.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(resp.Body)
+	util.FatalError(t, err, "Failed to read certificate")
+	assert.Equal(t, testChain, string(body))
+
+	// Another account cannot see the order
+	keyID, hmacKey, err = acmeServer.CreateAccount("user2")
+	util.FatalError(t, err, "Failed to create ACME account")
+	resp = other.post("new-account", map[string]interface{}{"externalAccountBinding": other.eab(keyID, hmacKey)})
+	decodeJSON(t, resp, http.StatusCreated, &account)
+	other.kid = resp.Header.Get("Location")
+	resp = other.post(strings.TrimPrefix(orderURL, other.base), nil)
+	assertProblem(t, resp, http.StatusNotFound, ErrMalformed)
+}
+
+func newACMEClient(t *testing.T, base string) *acmeClient {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	util.FatalError(t, err, "Failed to generate account key")
+	jwk, err := jose.NewJWK(key.Public())
+	util.FatalError(t, err, "Failed to get JWK")
+	return &acmeClient{t: t, base: base, key: key, jwk: jwk}
+}
+
+// post sends a request signed by the account key; a nil payload is a
+// POST-as-GET request
+func (c *acmeClient) post(path string, payload interface{}) *http.Response {
+	if c.nonce == "" {
+		resp, err := http.Head(c.base + "new-nonce")
+		util.FatalError(c.t, err, "Failed to get nonce")
+		resp.Body.Close()
+		c.nonce = resp.Header.Get("Replay-Nonce")
+	}
+	header := map[string]interface{}{"alg": "ES256", "nonce": c.nonce, "url": c.base + path}
+	if c.kid != "" {
+		header["kid"] = c.kid
+	} else {
+		header["jwk"] = c.jwk
+	}
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		util.FatalError(c.t, err, "Failed to marshal payload")
+	}
+	jws := c.sign(header, body, func(input []byte) []byte {
+		h := sha256.Sum256(input)
+		r, s, err := ecdsa.Sign(rand.Reader, c.key, h[:])
+		util.FatalError(c.t, err, "Failed to sign request")
+		return append(padBytes(r.Bytes(), 32), padBytes(s.Bytes(), 32)...)
+	})
+	buf, err := json.Marshal(jws)
+	util.FatalError(c.t, err, "Failed to marshal JWS")
+	resp, err := http.Post(c.base+path, "application/jose+json", bytes.NewReader(buf))
+	util.FatalError(c.t, err, "Failed to send ACME request")
+	c.nonce = resp.Header.Get("Replay-Nonce")
+	return resp
+}
+
+// eab returns the external account binding of the account key
+func (c *acmeClient) eab(keyID, hmacKey string) *JWS {
+	key, err := base64.RawURLEncoding.DecodeString(hmacKey)
+	util.FatalError(c.t, err, "Invalid HMAC key")
+	payload, err := json.Marshal(c.jwk)
+	util.FatalError(c.t, err, "Failed to marshal JWK")
+	header := map[string]interface{}{"alg": "HS256", "kid": keyID, "url": c.base + "new-account"}
+	return c.sign(header, payload, func(input []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(input)
+		return mac.Sum(nil)
+	})
+}
+
+func (c *acmeClient) sign(header map[string]interface{}, payload []byte, sign func([]byte) []byte) *JWS {
+	protected, err := json.Marshal(header)
+	util.FatalError(c.t, err, "Failed to marshal JWS header")
+	jws := &JWS{
+		Protected: base64.RawURLEncoding.EncodeToString(protected),
+		Payload:   base64.RawURLEncoding.EncodeToString(payload),
+	}
+	jws.Signature = base64.RawURLEncoding.EncodeToString(sign([]byte(jws.Protected + "." + jws.Payload)))
+	return jws
+}
+
+func decodeJSON(t *testing.T, resp *http.Response, status int, obj interface{}) {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	util.FatalError(t, err, "Failed to read response")
+	if resp.StatusCode != status {
+		t.Fatalf("Expected status %d but got %d: %s", status, resp.StatusCode, body)
+	}
+	err = json.Unmarshal(body, obj)
+	util.FatalError(t, err, "Failed to decode response")
+}
+
+func assertProblem(t *testing.T, resp *http.Response, status int, typ string) {
+	var prob Problem
+	decodeJSON(t, resp, status, &prob)
+	assert.Equal(t, typ, prob.Type, prob.Detail)
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+}
+
+func padBytes(buf []byte, size int) []byte {
+	return append(make([]byte, size-len(buf)), buf...)
+}
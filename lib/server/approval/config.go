@@ -0,0 +1,112 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package approval
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The operations whose requests may need approval
+const (
+	// Register is the registration of an identity, by a register request or
+	// a request to add an identity
+	Register = "register"
+	// Modify is the modification of an identity
+	Modify = "modify"
+	// Revoke is the revocation of an identity or of a certificate
+	Revoke = "revoke"
+)
+
+// Config is the configuration of the approval policies of a CA
+type Config struct {
+	// Expiry is how long a request waits for approval before it can no
+	// longer be approved
+	Expiry time.Duration `def:"168h" help:"Time after which a request pending approval can no longer be approved"`
+	// Policies are the policies requests are checked against
+	Policies []Policy
+}
+
+// Policy requires the requests of its operations to be approved by other
+// registrars before they run
+type Policy struct {
+	// Name identifies the policy in the requests it applies to
+	Name string
+	// Operations are the operations the policy applies to: 'register',
+	// 'modify' and 'revoke'
+	Operations []string
+	// Attributes limit the policy to the requests which register or modify
+	// an identity with any of the attributes, or which revoke an identity, or
+	// a certificate of an identity, which has any of them. The policy applies
+	// to all the requests of its operations if no attribute is set.
+	Attributes []string
+	// Approvals is the number of registrars, other than the one which made a
+	// request, who must approve it
+	Approvals int
+}
+
+// Validate returns an error if a policy is not valid
+func (c *Config) Validate() error {
+	for i, p := range c.Policies {
+		if p.Name == "" {
+			return errors.Errorf("Approval policy %d has no name", i)
+		}
+		if len(p.Operations) == 0 {
+			return errors.Errorf("Approval policy '%s' has no operations", p.Name)
+		}
+		for _, op := range p.Operations {
+			if op != Register && op != Modify && op != Revoke {
+				return errors.Errorf("Invalid operation '%s' of approval policy '%s'; it must be 'register', 'modify' or 'revoke'", op, p.Name)
+			}
+		}
+		if p.Approvals < 1 {
+			return errors.Errorf("Approval policy '%s' must require at least one approval", p.Name)
+		}
+	}
+	return nil
+}
+
+// Required returns the number of approvals which a request of the operation
+// needs, given the names of the attributes it sets or that its target has,
+// and the name of the policy which requires them. If several policies apply,
+// the one which requires the most approvals is returned. No approval is
+// needed if no policy applies.
+func (c *Config) Required(op string, attrs []string) (int, string) {
+	required, name := 0, ""
+	for _, p := range c.Policies {
+		if p.Approvals > required && p.applies(op, attrs) {
+			required, name = p.Approvals, p.Name
+		}
+	}
+	return required, name
+}
+
+// applies returns true if the policy applies to a request of the operation
+func (p *Policy) applies(op string, attrs []string) bool {
+	if !contains(p.Operations, op) {
+		return false
+	}
+	if len(p.Attributes) == 0 {
+		return true
+	}
+	for _, attr := range attrs {
+		if contains(p.Attributes, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
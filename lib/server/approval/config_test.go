@@ -0,0 +1,74 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package approval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := &Config{Policies: []Policy{{Name: "p1", Operations: []string{Register, Revoke}, Approvals: 1}}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Policies[0].Approvals = 0
+	assert.Error(t, cfg.Validate(), "A policy must require an approval")
+	cfg.Policies[0].Approvals = 1
+
+	cfg.Policies[0].Operations = []string{"enroll"}
+	assert.Error(t, cfg.Validate(), "The operation of a policy must be known")
+	cfg.Policies[0].Operations = nil
+	assert.Error(t, cfg.Validate(), "A policy must have operations")
+	cfg.Policies[0].Operations = []string{Modify}
+
+	cfg.Policies[0].Name = ""
+	assert.Error(t, cfg.Validate(), "A policy must have a name")
+}
+
+func TestRequired(t *testing.T) {
+	cfg := &Config{Policies: []Policy{
+		{Name: "registrars", Operations: []string{Register, Modify}, Attributes: []string{"hf.Registrar.Roles"}, Approvals: 2},
+		{Name: "revocations", Operations: []string{Revoke}, Approvals: 1},
+		{Name: "admins", Operations: []string{Revoke}, Attributes: []string{"admin"}, Approvals: 3},
+	}}
+
+	n, name := cfg.Required(Register, []string{"hf.Registrar.Roles", "ou"})
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "registrars", name)
+	n, _ = cfg.Required(Register, []string{"ou"})
+	assert.Equal(t, 0, n, "No policy applies to a registration without the attributes")
+	n, _ = cfg.Required(Register, nil)
+	assert.Equal(t, 0, n)
+
+	n, name = cfg.Required(Revoke, nil)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "revocations", name)
+	n, name = cfg.Required(Revoke, []string{"admin"})
+	assert.Equal(t, 3, n, "The policy which requires the most approvals applies")
+	assert.Equal(t, "admins", name)
+
+	n, _ = (&Config{}).Required(Modify, []string{"hf.Registrar.Roles"})
+	assert.Equal(t, 0, n)
+}
+
+func TestRecord(t *testing.T) {
+	rec := &Record{Status: StatusPending, CreatedAt: time.Now().Add(-2 * time.Hour)}
+	assert.Empty(t, rec.Approvers())
+	assert.False(t, rec.HasApproved("admin2"))
+	rec.ApprovedBy = "admin2,admin3"
+	assert.Equal(t, []string{"admin2", "admin3"}, rec.Approvers())
+	assert.True(t, rec.HasApproved("admin3"))
+	assert.False(t, rec.HasApproved("admin"))
+
+	assert.True(t, rec.Expired(time.Hour))
+	assert.False(t, rec.Expired(3*time.Hour))
+	assert.False(t, rec.Expired(0), "Requests do not expire without an expiry")
+	rec.Status = StatusRejected
+	assert.False(t, rec.Expired(time.Hour), "Only pending requests expire")
+}
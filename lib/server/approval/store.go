@@ -0,0 +1,169 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package approval
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/pkg/errors"
+)
+
+// The status of a request
+const (
+	// StatusPending is the status of a request waiting for approval
+	StatusPending = "pending"
+	// StatusApproved is the status of a request which was approved and is
+	// being run
+	StatusApproved = "approved"
+	// StatusExecuted is the status of an approved request which ran
+	StatusExecuted = "executed"
+	// StatusFailed is the status of an approved request which failed when
+	// it ran
+	StatusFailed = "failed"
+	// StatusRejected is the status of a request which was rejected
+	StatusRejected = "rejected"
+)
+
+const (
+	// InsertRequest is the SQL for adding a request
+	InsertRequest = `
+INSERT INTO approvals (id, caller, operation, policy, target, affiliation, type, method, endpoint, vars, request, required_approvals, approved_by, status, reason, created_at, updated_at)
+	VALUES (:id, :caller, :operation, :policy, :target, :affiliation, :type, :method, :endpoint, :vars, :request, :required_approvals, :approved_by, :status, :reason, :created_at, :updated_at);`
+	// SelectRequest is the SQL for getting a request
+	SelectRequest = "SELECT * FROM approvals WHERE (id = ?)"
+	// SelectRequests is the SQL for getting the requests with a status
+	SelectRequests = "SELECT * FROM approvals WHERE (status = ?) ORDER BY created_at"
+	// UpdateRequest is the SQL for updating a request which was not changed
+	// since it was read
+	UpdateRequest = `
+UPDATE approvals SET approved_by = ?, status = ?, reason = ?, updated_at = ?
+	WHERE (id = ? AND status = ? AND approved_by = ?);`
+)
+
+// Record is a request which needs approval
+type Record struct {
+	ID string `db:"id"`
+	// Caller is the enrollment ID of the identity which made the request
+	Caller string `db:"caller"`
+	// Operation is the operation of the request, such as 'register'
+	Operation string `db:"operation"`
+	// Policy is the name of the policy which requires the approvals
+	Policy string `db:"policy"`
+	// Target is the identity, or the serial number of the certificate, which
+	// the request acts on
+	Target string `db:"target"`
+	// Affiliation and Type are the affiliation and type of the identity
+	// which the request acts on
+	Affiliation string `db:"affiliation"`
+	Type        string `db:"type"`
+	// Method, Endpoint and Vars are the HTTP method, the path of the
+	// endpoint and the JSON-encoded variables of the path of the request
+	Method   string `db:"method"`
+	Endpoint string `db:"endpoint"`
+	Vars     string `db:"vars"`
+	// Request is the body of the request, without the secret it chooses
+	Request string `db:"request"`
+	// Required is the number of approvals the request needs
+	Required int `db:"required_approvals"`
+	// ApprovedBy is the comma-separated list of the registrars which
+	// approved the request
+	ApprovedBy string `db:"approved_by"`
+	Status     string `db:"status"`
+	// Reason is why the request was rejected, or the error of a request
+	// which failed
+	Reason    string    `db:"reason"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// Approvers returns the registrars which approved the request
+func (r *Record) Approvers() []string {
+	if r.ApprovedBy == "" {
+		return nil
+	}
+	return strings.Split(r.ApprovedBy, ",")
+}
+
+// HasApproved returns true if the registrar approved the request
+func (r *Record) HasApproved(id string) bool {
+	return contains(r.Approvers(), id)
+}
+
+// Expired returns true if a pending request can no longer be approved
+func (r *Record) Expired(expiry time.Duration) bool {
+	return r.Status == StatusPending && expiry > 0 && time.Now().After(r.CreatedAt.Add(expiry))
+}
+
+// DBStore keeps the requests which need approval in the approvals table of a
+// CA's database
+type DBStore struct {
+	db db.FabricCADB
+}
+
+// NewDBStore returns a DBStore for the database
+func NewDBStore(db db.FabricCADB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// Insert adds a pending request, whose ID is set
+func (s *DBStore) Insert(rec *Record) error {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return errors.Wrap(err, "Failed to generate approval request ID")
+	}
+	rec.ID = hex.EncodeToString(id)
+	rec.Status = StatusPending
+	rec.CreatedAt = time.Now().UTC()
+	rec.UpdatedAt = rec.CreatedAt
+	_, err = s.db.NamedExec("InsertApprovalRequest", InsertRequest, rec)
+	if err != nil {
+		return errors.Wrap(err, "Failed to insert approval request into database")
+	}
+	return nil
+}
+
+// Get returns a request
+func (s *DBStore) Get(id string) (*Record, error) {
+	rec := &Record{}
+	err := s.db.Get("GetApprovalRequest", rec, s.db.Rebind(SelectRequest), id)
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// List returns the requests with the status, oldest first
+func (s *DBStore) List(status string) ([]*Record, error) {
+	var recs []*Record
+	err := s.db.Select("GetApprovalRequests", &recs, s.db.Rebind(SelectRequests), status)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get approval requests")
+	}
+	return recs, nil
+}
+
+// Update stores the changes of a request, unless the request was changed
+// since it had the status and approvers prev has; it returns false then
+func (s *DBStore) Update(rec *Record, prev *Record) (bool, error) {
+	rec.UpdatedAt = time.Now().UTC()
+	res, err := s.db.Exec("UpdateApprovalRequest", s.db.Rebind(UpdateRequest),
+		rec.ApprovedBy, rec.Status, rec.Reason, rec.UpdatedAt,
+		rec.ID, prev.Status, prev.ApprovedBy)
+	if err != nil {
+		return false, errors.Wrapf(err, "Failed to update approval request '%s'", rec.ID)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "Failed to update approval request '%s'", rec.ID)
+	}
+	return n == 1, nil
+}
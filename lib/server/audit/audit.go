@@ -0,0 +1,154 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxAppendAttempts is the number of times an entry is appended when the
+// entry with the same sequence number is appended concurrently by another
+// server of a cluster
+const maxAppendAttempts = 3
+
+// verifyPageSize is the number of entries read at a time by Verify
+const verifyPageSize = 1000
+
+// Record is an entry of the audit log. Each entry holds the hash of the
+// previous entry, so that a change to any entry, or its removal, breaks the
+// chain of hashes from the first entry to the last one.
+type Record struct {
+	// Seq is the sequence number of the entry, starting at 1
+	Seq  int64     `db:"seq" json:"seq"`
+	Time time.Time `db:"time" json:"time"`
+	// CA is the name of the CA which served the request
+	CA string `db:"ca_name" json:"ca"`
+	// Caller is the enrollment ID of the caller, if known
+	Caller string `db:"caller" json:"caller,omitempty"`
+	// Action is the HTTP method and the endpoint of the request
+	Action string `db:"action" json:"action"`
+	// Target is what the request acts on, such as an identity or a certificate
+	Target string `db:"target" json:"target,omitempty"`
+	// RequestHash is the hex-encoded SHA-256 hash of the request
+	RequestHash string `db:"request_hash" json:"request_hash"`
+	// Status is the HTTP status code of the response
+	Status int `db:"status" json:"status"`
+	// ErrorCode is the fabric-ca error code of the response, or 0
+	ErrorCode int    `db:"error_code" json:"error_code,omitempty"`
+	PrevHash  string `db:"prev_hash" json:"prev_hash"`
+	Hash      string `db:"hash" json:"hash"`
+}
+
+// computeHash returns the hex-encoded SHA-256 hash of the entry, which
+// covers all of its fields but the hash itself
+func (r *Record) computeHash() string {
+	buf, _ := json.Marshal([]interface{}{
+		r.Seq, r.Time.Unix(), r.CA, r.Caller, r.Action, r.Target,
+		r.RequestHash, r.Status, r.ErrorCode, r.PrevHash,
+	})
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// Store is where the entries of the audit log are kept
+type Store interface {
+	// Last returns the last entry, or nil if there is none
+	Last() (*Record, error)
+	// Append appends the entry; it fails if an entry with the same sequence
+	// number exists
+	Append(*Record) error
+	// Records returns at most limit entries, starting at sequence number from
+	Records(from int64, limit int) ([]*Record, error)
+}
+
+// Log is an append-only, hash-chained audit log
+type Log struct {
+	store Store
+	mutex sync.Mutex
+}
+
+// New returns an audit log which keeps its entries in the store
+func New(store Store) *Log {
+	return &Log{store: store}
+}
+
+// Append chains the entry to the last entry of the log and appends it
+func (l *Log) Append(rec *Record) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	// Sub-second precision and the time zone are not kept by all databases
+	rec.Time = rec.Time.UTC().Truncate(time.Second)
+	var err error
+	for i := 0; i < maxAppendAttempts; i++ {
+		var last *Record
+		last, err = l.store.Last()
+		if err != nil {
+			return err
+		}
+		rec.Seq, rec.PrevHash = 1, ""
+		if last != nil {
+			rec.Seq, rec.PrevHash = last.Seq+1, last.Hash
+		}
+		rec.Hash = rec.computeHash()
+		err = l.store.Append(rec)
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.WithMessage(err, "Failed to append to the audit log")
+}
+
+// Records returns at most limit entries, starting at sequence number from
+func (l *Log) Records(from int64, limit int) ([]*Record, error) {
+	return l.store.Records(from, limit)
+}
+
+// Verify checks the chain of hashes of the entries of the store and returns
+// the number of entries. It fails at the first entry which was changed,
+// inserted or removed.
+func Verify(store Store) (int64, error) {
+	var prev *Record
+	for {
+		from := int64(1)
+		if prev != nil {
+			from = prev.Seq + 1
+		}
+		recs, err := store.Records(from, verifyPageSize)
+		if err != nil {
+			return 0, err
+		}
+		for _, rec := range recs {
+			switch {
+			case rec.Seq != from:
+				return 0, errors.Errorf("Audit log entry %d is missing", from)
+			case prev != nil && rec.PrevHash != prev.Hash,
+				prev == nil && rec.PrevHash != "":
+				return 0, errors.Errorf("Audit log entry %d is not chained to the previous entry", rec.Seq)
+			case rec.Hash != rec.computeHash():
+				return 0, errors.Errorf("Audit log entry %d was modified", rec.Seq)
+			}
+			prev = rec
+			from++
+		}
+		if len(recs) < verifyPageSize {
+			break
+		}
+	}
+	if prev == nil {
+		return 0, nil
+	}
+	return prev.Seq, nil
+}
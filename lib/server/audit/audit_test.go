@@ -0,0 +1,101 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	. "github.com/hyperledger/fabric-ca/lib/server/audit"
+	"github.com/hyperledger/fabric-ca/lib/server/db/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	util.FatalError(t, err, "Failed to create temp directory")
+	defer os.RemoveAll(dir)
+	sqliteDB := sqlite.NewDB(filepath.Join(dir, "audit.db"), "", nil)
+	err = sqliteDB.Connect()
+	util.FatalError(t, err, "Failed to connect to database")
+	testDB, err := sqliteDB.Create()
+	util.FatalError(t, err, "Failed to create database")
+	defer testDB.Close()
+
+	store := NewDBStore(testDB)
+	n, err := Verify(store)
+	assert.NoError(t, err, "An empty audit log should be valid")
+	assert.Equal(t, int64(0), n)
+
+	l := New(store)
+	for _, action := range []string{"POST register", "POST enroll", "POST revoke"} {
+		err = l.Append(&Record{CA: "ca", Caller: "admin", Action: action, Target: "user1", Status: 201})
+		util.FatalError(t, err, "Failed to append to audit log")
+	}
+	recs, err := l.Records(2, 1)
+	util.FatalError(t, err, "Failed to read audit log")
+	if assert.Len(t, recs, 1) {
+		assert.Equal(t, int64(2), recs[0].Seq)
+		assert.Equal(t, "POST enroll", recs[0].Action)
+	}
+	n, err = Verify(store)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	// A modified entry is detected
+	_, err = testDB.Exec("TamperAuditLog", "UPDATE audit_log SET caller = 'user2' WHERE seq = 2")
+	util.FatalError(t, err, "Failed to update audit log")
+	_, err = Verify(store)
+	assert.EqualError(t, err, "Audit log entry 2 was modified")
+}
+
+func TestFileLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	util.FatalError(t, err, "Failed to create temp directory")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "audit.log")
+
+	l := New(NewFileStore(file))
+	for _, action := range []string{"POST register", "POST enroll", "POST revoke"} {
+		err = l.Append(&Record{CA: "ca", Caller: "admin", Action: action, Status: 200})
+		util.FatalError(t, err, "Failed to append to audit log")
+	}
+	recs, err := l.Records(2, 10)
+	util.FatalError(t, err, "Failed to read audit log")
+	if assert.Len(t, recs, 2) {
+		assert.Equal(t, int64(2), recs[0].Seq)
+		assert.Equal(t, recs[0].Hash, recs[1].PrevHash)
+	}
+
+	// Entries are chained to the entries of a previous run
+	err = New(NewFileStore(file)).Append(&Record{CA: "ca", Action: "GET cainfo", Status: 200})
+	util.FatalError(t, err, "Failed to append to audit log")
+	n, err := Verify(NewFileStore(file))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+
+	buf, err := ioutil.ReadFile(file)
+	util.FatalError(t, err, "Failed to read audit log file")
+	lines := strings.SplitAfter(string(buf), "\n")
+
+	// A modified entry is detected
+	modified := strings.Replace(string(buf), `"caller":"admin","action":"POST enroll"`, `"caller":"user1","action":"POST enroll"`, 1)
+	err = ioutil.WriteFile(file, []byte(modified), 0600)
+	util.FatalError(t, err, "Failed to write audit log file")
+	_, err = Verify(NewFileStore(file))
+	assert.EqualError(t, err, "Audit log entry 2 was modified")
+
+	// A removed entry is detected
+	err = ioutil.WriteFile(file, []byte(lines[0]+strings.Join(lines[2:], "")), 0600)
+	util.FatalError(t, err, "Failed to write audit log file")
+	_, err = Verify(NewFileStore(file))
+	assert.EqualError(t, err, "Audit log entry 2 is missing")
+}
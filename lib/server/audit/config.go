@@ -0,0 +1,15 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+// Config is the configuration of the audit log of a CA
+type Config struct {
+	Enabled bool `def:"false" help:"Record registry and certificate operations in a hash-chained audit log"`
+	// File is the file the audit log is written to; the audit log is stored
+	// in the audit_log table of the CA's database if it is not set
+	File string `help:"File the audit log is written to (default is the audit_log table of the CA's database)"`
+}
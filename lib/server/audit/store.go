@@ -0,0 +1,168 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/pkg/errors"
+)
+
+const (
+	// InsertRecord is the SQL for appending an entry to the audit log
+	InsertRecord = "INSERT INTO audit_log (seq, time, ca_name, caller, action, target, request_hash, status, error_code, prev_hash, hash) VALUES (:seq, :time, :ca_name, :caller, :action, :target, :request_hash, :status, :error_code, :prev_hash, :hash)"
+	// SelectLastRecord is the SQL for getting the last entry of the audit log
+	SelectLastRecord = "SELECT * FROM audit_log ORDER BY seq DESC LIMIT 1"
+	// SelectRecords is the SQL for getting entries of the audit log
+	SelectRecords = "SELECT * FROM audit_log WHERE (seq >= ?) ORDER BY seq LIMIT ?"
+)
+
+// DBStore keeps the audit log in the audit_log table of a CA's database
+type DBStore struct {
+	db db.FabricCADB
+}
+
+// NewDBStore returns a DBStore for the database
+func NewDBStore(db db.FabricCADB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// Last returns the last entry, or nil if there is none
+func (s *DBStore) Last() (*Record, error) {
+	rec := &Record{}
+	err := s.db.Get("GetLastAuditRecord", rec, SelectLastRecord)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get the last audit log entry")
+	}
+	return rec, nil
+}
+
+// Append inserts the entry into the table
+func (s *DBStore) Append(rec *Record) error {
+	_, err := s.db.NamedExec("InsertAuditRecord", InsertRecord, rec)
+	if err != nil {
+		return errors.Wrap(err, "Failed to insert audit log entry into database")
+	}
+	return nil
+}
+
+// Records returns at most limit entries, starting at sequence number from
+func (s *DBStore) Records(from int64, limit int) ([]*Record, error) {
+	var recs []*Record
+	err := s.db.Select("GetAuditRecords", &recs, s.db.Rebind(SelectRecords), from, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get audit log entries")
+	}
+	return recs, nil
+}
+
+// FileStore keeps the audit log in a file, one JSON-encoded entry per line
+type FileStore struct {
+	file  string
+	last  *Record
+	read  bool
+	mutex sync.Mutex
+}
+
+// NewFileStore returns a FileStore for the file
+func NewFileStore(file string) *FileStore {
+	return &FileStore{file: file}
+}
+
+// Last returns the last entry, or nil if there is none
+func (s *FileStore) Last() (*Record, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.read {
+		err := s.scan(func(rec *Record) bool {
+			s.last = rec
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.read = true
+	}
+	return s.last, nil
+}
+
+// Append writes the entry at the end of the file
+func (s *FileStore) Append(rec *Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.read && s.last != nil && rec.Seq <= s.last.Seq {
+		return errors.Errorf("Audit log entry %d exists", rec.Seq)
+	}
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal audit log entry")
+	}
+	f, err := os.OpenFile(s.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open audit log file '%s'", s.file)
+	}
+	_, err = f.Write(append(buf, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	err2 := f.Close()
+	if err == nil {
+		err = err2
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write to audit log file '%s'", s.file)
+	}
+	s.last = rec
+	return nil
+}
+
+// Records returns at most limit entries, starting at sequence number from
+func (s *FileStore) Records(from int64, limit int) ([]*Record, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var recs []*Record
+	err := s.scan(func(rec *Record) bool {
+		if rec.Seq >= from {
+			recs = append(recs, rec)
+		}
+		return len(recs) < limit
+	})
+	return recs, err
+}
+
+// scan calls fn with each entry of the file until it returns false
+func (s *FileStore) scan(fn func(*Record) bool) error {
+	f, err := os.Open(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open audit log file '%s'", s.file)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		rec := &Record{}
+		err = json.Unmarshal(scanner.Bytes(), rec)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid entry at line %d of audit log file '%s'", line, s.file)
+		}
+		if !fn(rec) {
+			return nil
+		}
+	}
+	return errors.Wrapf(scanner.Err(), "Failed to read audit log file '%s'", s.file)
+}
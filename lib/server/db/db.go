@@ -9,11 +9,21 @@ package db
 import (
 	"context"
 	"database/sql"
+	"strconv"
 	"time"
 
 	"github.com/hyperledger/fabric-ca/lib/server/db/util"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/certdb"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	// crlNumberProperty is the property holding the number of the last CRL
+	crlNumberProperty = "crl.number"
+	// maxCRLNumberAttempts is the number of attempts to increment the CRL
+	// number when it is concurrently updated
+	maxCRLNumberAttempts = 10
 )
 
 //go:generate counterfeiter -o mocks/fabricCaDb.go -fake-name FabricCADB . FabricCADB
@@ -233,3 +243,39 @@ func getProperty(db FabricCADB, propName string, val *int) error {
 	}
 	return err
 }
+
+// NextCRLNumber increments the CRL number stored in the properties table and
+// returns the new number. The first CRL number is 1. The number is updated only
+// if no one else updated it in the meantime, so that CRL numbers stay
+// monotonically increasing when several servers share the database.
+func NextCRLNumber(db FabricCADB) (int64, error) {
+	for i := 0; i < maxCRLNumberAttempts; i++ {
+		var current int64
+		err := db.Get("GetCRLNumber", &current, db.Rebind("SELECT value FROM properties WHERE (property = ?)"), crlNumberProperty)
+		if err == sql.ErrNoRows {
+			_, err = db.Exec("NextCRLNumber", db.Rebind("INSERT INTO properties (property, value) VALUES (?, ?)"), crlNumberProperty, "1")
+			if err == nil {
+				return 1, nil
+			}
+			// Someone else inserted the first CRL number
+			continue
+		}
+		if err != nil {
+			return 0, errors.Wrap(err, "Failed to get the CRL number")
+		}
+		next := current + 1
+		res, err := db.Exec("NextCRLNumber", db.Rebind("UPDATE properties SET value = ? WHERE (property = ? AND value = ?)"),
+			strconv.FormatInt(next, 10), crlNumberProperty, strconv.FormatInt(current, 10))
+		if err != nil {
+			return 0, errors.Wrap(err, "Failed to update the CRL number")
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return 0, errors.Wrap(err, "Failed to update the CRL number")
+		}
+		if rows == 1 {
+			return next, nil
+		}
+	}
+	return 0, errors.New("Failed to update the CRL number: too many concurrent updates")
+}
@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package db_test
 
 import (
+	"database/sql"
 	"errors"
 	"testing"
 
@@ -121,3 +122,45 @@ func TestCurrentDBLevels(t *testing.T) {
 	gt.Expect(err).NotTo(HaveOccurred())
 	gt.Expect(levels).To(Equal(&util.Levels{}))
 }
+
+func TestNextCRLNumber(t *testing.T) {
+	gt := NewGomegaWithT(t)
+
+	// The first CRL number is inserted
+	mockFabricCADB := &mocks.FabricCADB{}
+	mockFabricCADB.GetReturns(sql.ErrNoRows)
+	number, err := db.NextCRLNumber(mockFabricCADB)
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(number).To(Equal(int64(1)))
+	gt.Expect(mockFabricCADB.ExecCallCount()).To(Equal(1))
+
+	// The CRL number is incremented, retrying if it was concurrently updated
+	mockFabricCADB = &mocks.FabricCADB{}
+	current := int64(4)
+	mockFabricCADB.GetStub = func(funcName string, dest interface{}, query string, args ...interface{}) error {
+		*dest.(*int64) = current
+		current++
+		return nil
+	}
+	notUpdated := &mocks.Result{}
+	notUpdated.On("RowsAffected").Return(int64(0), nil)
+	updated := &mocks.Result{}
+	updated.On("RowsAffected").Return(int64(1), nil)
+	mockFabricCADB.ExecReturnsOnCall(0, notUpdated, nil)
+	mockFabricCADB.ExecReturnsOnCall(1, updated, nil)
+	number, err = db.NextCRLNumber(mockFabricCADB)
+	gt.Expect(err).NotTo(HaveOccurred())
+	gt.Expect(number).To(Equal(int64(6)))
+
+	mockFabricCADB = &mocks.FabricCADB{}
+	mockFabricCADB.GetReturns(errors.New("failed to get CRL number"))
+	_, err = db.NextCRLNumber(mockFabricCADB)
+	gt.Expect(err).To(HaveOccurred())
+	gt.Expect(err.Error()).To(Equal("Failed to get the CRL number: failed to get CRL number"))
+
+	mockFabricCADB = &mocks.FabricCADB{}
+	mockFabricCADB.ExecReturns(notUpdated, nil)
+	_, err = db.NextCRLNumber(mockFabricCADB)
+	gt.Expect(err).To(HaveOccurred())
+	gt.Expect(err.Error()).To(ContainSubstring("too many concurrent updates"))
+}
@@ -63,6 +63,38 @@ func (m *Migrator) MigrateUsersTable() error {
 		}
 		fallthrough
 
+	case 2:
+		log.Debug("Upgrade identity table to level 3")
+		_, err := tx.Exec(funcName, "ALTER TABLE users ADD COLUMN secret_expiry timestamp NULL DEFAULT NULL AFTER incorrect_password_attempts")
+		if err != nil && !strings.Contains(err.Error(), "1060") { // Already using the latest schema
+			return err
+		}
+		fallthrough
+
+	case 3:
+		log.Debug("Upgrade identity table to level 4")
+		_, err := tx.Exec(funcName, "ALTER TABLE users ADD COLUMN totp_seed VARCHAR(256) DEFAULT '' AFTER secret_expiry, ADD COLUMN totp_step BIGINT DEFAULT 0 AFTER totp_seed")
+		if err != nil && !strings.Contains(err.Error(), "1060") { // Already using the latest schema
+			return err
+		}
+		fallthrough
+
+	case 4:
+		log.Debug("Upgrade identity table to level 5")
+		_, err := tx.Exec(funcName, "ALTER TABLE users ADD COLUMN suspended INTEGER DEFAULT 0 AFTER totp_step")
+		if err != nil && !strings.Contains(err.Error(), "1060") { // Already using the latest schema
+			return err
+		}
+		fallthrough
+
+	case 5:
+		log.Debug("Upgrade identity table to level 6")
+		_, err := tx.Exec(funcName, "ALTER TABLE users ADD COLUMN reissue INTEGER DEFAULT 0 AFTER suspended")
+		if err != nil && !strings.Contains(err.Error(), "1060") { // Already using the latest schema
+			return err
+		}
+		fallthrough
+
 	default:
 		users, err := user.GetUserLessThanLevel(tx, m.SrvLevels.Identity)
 		if err != nil {
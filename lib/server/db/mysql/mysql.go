@@ -164,7 +164,7 @@ func (m *Mysql) createDatabase() error {
 func (m *Mysql) createTables() error {
 	db := m.SqlxDB
 	log.Debug("Creating users table if it doesn't exist")
-	if _, err := db.Exec("CreateUsersTable", "CREATE TABLE IF NOT EXISTS users (id VARCHAR(255) NOT NULL, token blob, type VARCHAR(256), affiliation VARCHAR(1024), attributes TEXT, state INTEGER, max_enrollments INTEGER, level INTEGER DEFAULT 0, incorrect_password_attempts INTEGER DEFAULT 0, PRIMARY KEY (id)) DEFAULT CHARSET=utf8 COLLATE utf8_bin"); err != nil {
+	if _, err := db.Exec("CreateUsersTable", "CREATE TABLE IF NOT EXISTS users (id VARCHAR(255) NOT NULL, token blob, type VARCHAR(256), affiliation VARCHAR(1024), attributes TEXT, state INTEGER, max_enrollments INTEGER, level INTEGER DEFAULT 0, incorrect_password_attempts INTEGER DEFAULT 0, secret_expiry timestamp NULL DEFAULT NULL, totp_seed VARCHAR(256) DEFAULT '', totp_step BIGINT DEFAULT 0, suspended INTEGER DEFAULT 0, reissue INTEGER DEFAULT 0, PRIMARY KEY (id)) DEFAULT CHARSET=utf8 COLLATE utf8_bin"); err != nil {
 		return errors.Wrap(err, "Error creating users table")
 	}
 	log.Debug("Creating affiliations table if it doesn't exist")
@@ -203,5 +203,33 @@ func (m *Mysql) createTables() error {
 			return err
 		}
 	}
+	log.Debug("Creating ocsp_responses table if it does not exist")
+	if _, err := db.Exec("CreateOCSPResponsesTable", "CREATE TABLE IF NOT EXISTS ocsp_responses (serial_number varbinary(128) NOT NULL, authority_key_identifier varbinary(128) NOT NULL, body blob NOT NULL, expiry timestamp DEFAULT 0, PRIMARY KEY(serial_number, authority_key_identifier)) DEFAULT CHARSET=utf8 COLLATE utf8_bin"); err != nil {
+		return errors.Wrap(err, "Error creating ocsp_responses table")
+	}
+	log.Debug("Creating acme_accounts table if it does not exist")
+	if _, err := db.Exec("CreateACMEAccountsTable", "CREATE TABLE IF NOT EXISTS acme_accounts (id VARCHAR(64) NOT NULL, enrollment_id VARCHAR(255) NOT NULL, hmac_key VARCHAR(64), jwk text, thumbprint VARCHAR(64), status VARCHAR(32) NOT NULL, created_at timestamp DEFAULT 0, PRIMARY KEY(id)) DEFAULT CHARSET=utf8 COLLATE utf8_bin"); err != nil {
+		return errors.Wrap(err, "Error creating acme_accounts table")
+	}
+	log.Debug("Creating audit_log table if it does not exist")
+	if _, err := db.Exec("CreateAuditLogTable", "CREATE TABLE IF NOT EXISTS audit_log (seq BIGINT NOT NULL, time timestamp DEFAULT 0, ca_name VARCHAR(255), caller VARCHAR(255), action VARCHAR(64), target VARCHAR(1024), request_hash VARCHAR(64), status INTEGER, error_code INTEGER, prev_hash VARCHAR(64), hash VARCHAR(64), PRIMARY KEY(seq)) DEFAULT CHARSET=utf8 COLLATE utf8_bin"); err != nil {
+		return errors.Wrap(err, "Error creating audit_log table")
+	}
+	log.Debug("Creating webhook_events table if it does not exist")
+	if _, err := db.Exec("CreateWebhookEventsTable", "CREATE TABLE IF NOT EXISTS webhook_events (id VARCHAR(64) NOT NULL, event_id VARCHAR(64) NOT NULL, type VARCHAR(64), endpoint VARCHAR(1024), payload text, created_at timestamp DEFAULT 0, attempts INTEGER, next_attempt timestamp DEFAULT 0, PRIMARY KEY(id)) DEFAULT CHARSET=utf8 COLLATE utf8_bin"); err != nil {
+		return errors.Wrap(err, "Error creating webhook_events table")
+	}
+	log.Debug("Creating token_nonces table if it does not exist")
+	if _, err := db.Exec("CreateTokenNoncesTable", "CREATE TABLE IF NOT EXISTS token_nonces (nonce VARCHAR(128) NOT NULL, expiry timestamp DEFAULT 0, PRIMARY KEY(nonce)) DEFAULT CHARSET=utf8 COLLATE utf8_bin"); err != nil {
+		return errors.Wrap(err, "Error creating token_nonces table")
+	}
+	log.Debug("Creating approvals table if it does not exist")
+	if _, err := db.Exec("CreateApprovalsTable", "CREATE TABLE IF NOT EXISTS approvals (id VARCHAR(64) NOT NULL, caller VARCHAR(255), operation VARCHAR(32), policy VARCHAR(255), target VARCHAR(255), affiliation VARCHAR(1024), type VARCHAR(256), method VARCHAR(16), endpoint VARCHAR(255), vars text, request text, required_approvals INTEGER, approved_by text, status VARCHAR(32) NOT NULL, reason text, created_at timestamp DEFAULT 0, updated_at timestamp DEFAULT 0, PRIMARY KEY(id)) DEFAULT CHARSET=utf8 COLLATE utf8_bin"); err != nil {
+		return errors.Wrap(err, "Error creating approvals table")
+	}
+	log.Debug("Creating roles table if it does not exist")
+	if _, err := db.Exec("CreateRolesTable", "CREATE TABLE IF NOT EXISTS roles (name VARCHAR(255) NOT NULL, attributes text, updated_at timestamp DEFAULT 0, PRIMARY KEY(name)) DEFAULT CHARSET=utf8 COLLATE utf8_bin"); err != nil {
+		return errors.Wrap(err, "Error creating roles table")
+	}
 	return nil
 }
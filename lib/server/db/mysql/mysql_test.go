@@ -199,6 +199,69 @@ var _ = Describe("Mysql", func() {
 			Expect(err.Error()).Should(ContainSubstring("Failed to create MySQL tables: unable to insert default values"))
 		})
 
+		It("returns an error if unable to create ocsp_responses table", func() {
+			mockDB.ExecReturnsOnCall(9, nil, errors.New("unable to create table"))
+
+			db.SqlxDB = mockDB
+			err := db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("Failed to create MySQL tables: Error creating ocsp_responses table: unable to create table"))
+		})
+
+		It("returns an error if unable to create acme_accounts table", func() {
+			mockDB.ExecReturnsOnCall(10, nil, errors.New("unable to create table"))
+
+			db.SqlxDB = mockDB
+			err := db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("Failed to create MySQL tables: Error creating acme_accounts table: unable to create table"))
+		})
+
+		It("returns an error if unable to create audit_log table", func() {
+			mockDB.ExecReturnsOnCall(11, nil, errors.New("unable to create table"))
+
+			db.SqlxDB = mockDB
+			err := db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("Failed to create MySQL tables: Error creating audit_log table: unable to create table"))
+		})
+
+		It("returns an error if unable to create webhook_events table", func() {
+			mockDB.ExecReturnsOnCall(12, nil, errors.New("unable to create table"))
+
+			db.SqlxDB = mockDB
+			err := db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("Failed to create MySQL tables: Error creating webhook_events table: unable to create table"))
+		})
+
+		It("returns an error if unable to create token_nonces table", func() {
+			mockDB.ExecReturnsOnCall(13, nil, errors.New("unable to create table"))
+
+			db.SqlxDB = mockDB
+			err := db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("Failed to create MySQL tables: Error creating token_nonces table: unable to create table"))
+		})
+
+		It("returns an error if unable to create approvals table", func() {
+			mockDB.ExecReturnsOnCall(14, nil, errors.New("unable to create table"))
+
+			db.SqlxDB = mockDB
+			err := db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("Failed to create MySQL tables: Error creating approvals table: unable to create table"))
+		})
+
+		It("returns an error if unable to create roles table", func() {
+			mockDB.ExecReturnsOnCall(15, nil, errors.New("unable to create table"))
+
+			db.SqlxDB = mockDB
+			err := db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("Failed to create MySQL tables: Error creating roles table: unable to create table"))
+		})
+
 		It("creates the fabric ca tables", func() {
 			db.SqlxDB = mockDB
 
@@ -81,6 +81,70 @@ func (m *Migrator) MigrateUsersTable() error {
 		}
 		fallthrough
 
+	case 2:
+		log.Debug("Upgrade identity table to level 3")
+		var res []string
+		query := "SELECT column_name  FROM information_schema.columns WHERE table_name='users' and column_name='secret_expiry'"
+		err := tx.Select(funcName, &res, tx.Rebind(query))
+		if err != nil {
+			return err
+		}
+		if len(res) == 0 {
+			_, err = tx.Exec(funcName, "ALTER TABLE users ADD COLUMN secret_expiry timestamp")
+			if err != nil && !strings.Contains(err.Error(), "already exists") {
+				return err
+			}
+		}
+		fallthrough
+
+	case 3:
+		log.Debug("Upgrade identity table to level 4")
+		var res []string
+		query := "SELECT column_name  FROM information_schema.columns WHERE table_name='users' and column_name='totp_seed'"
+		err := tx.Select(funcName, &res, tx.Rebind(query))
+		if err != nil {
+			return err
+		}
+		if len(res) == 0 {
+			_, err = tx.Exec(funcName, "ALTER TABLE users ADD COLUMN totp_seed VARCHAR(256) DEFAULT '', ADD COLUMN totp_step BIGINT DEFAULT 0")
+			if err != nil && !strings.Contains(err.Error(), "already exists") {
+				return err
+			}
+		}
+		fallthrough
+
+	case 4:
+		log.Debug("Upgrade identity table to level 5")
+		var res []string
+		query := "SELECT column_name  FROM information_schema.columns WHERE table_name='users' and column_name='suspended'"
+		err := tx.Select(funcName, &res, tx.Rebind(query))
+		if err != nil {
+			return err
+		}
+		if len(res) == 0 {
+			_, err = tx.Exec(funcName, "ALTER TABLE users ADD COLUMN suspended INTEGER DEFAULT 0")
+			if err != nil && !strings.Contains(err.Error(), "already exists") {
+				return err
+			}
+		}
+		fallthrough
+
+	case 5:
+		log.Debug("Upgrade identity table to level 6")
+		var res []string
+		query := "SELECT column_name  FROM information_schema.columns WHERE table_name='users' and column_name='reissue'"
+		err := tx.Select(funcName, &res, tx.Rebind(query))
+		if err != nil {
+			return err
+		}
+		if len(res) == 0 {
+			_, err = tx.Exec(funcName, "ALTER TABLE users ADD COLUMN reissue INTEGER DEFAULT 0")
+			if err != nil && !strings.Contains(err.Error(), "already exists") {
+				return err
+			}
+		}
+		fallthrough
+
 	default:
 		users, err := user.GetUserLessThanLevel(tx, m.SrvLevels.Identity)
 		if err != nil {
@@ -79,6 +79,86 @@ func (m *Migrator) MigrateUsersTable() error {
 		}
 		fallthrough
 
+	case 2:
+		log.Debug("Upgrade identity table to level 3")
+		_, err := tx.Exec(funcName, "ALTER TABLE users RENAME TO users_old")
+		if err != nil {
+			return err
+		}
+		err = createIdentityTable(tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(funcName, "INSERT INTO users (id, token, type, affiliation, attributes, state, max_enrollments, level, incorrect_password_attempts) SELECT id, token, type, affiliation, attributes, state, max_enrollments, level, incorrect_password_attempts FROM users_old")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(funcName, "DROP TABLE users_old")
+		if err != nil {
+			return err
+		}
+		fallthrough
+
+	case 3:
+		log.Debug("Upgrade identity table to level 4")
+		_, err := tx.Exec(funcName, "ALTER TABLE users RENAME TO users_old")
+		if err != nil {
+			return err
+		}
+		err = createIdentityTable(tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(funcName, "INSERT INTO users (id, token, type, affiliation, attributes, state, max_enrollments, level, incorrect_password_attempts, secret_expiry) SELECT id, token, type, affiliation, attributes, state, max_enrollments, level, incorrect_password_attempts, secret_expiry FROM users_old")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(funcName, "DROP TABLE users_old")
+		if err != nil {
+			return err
+		}
+		fallthrough
+
+	case 4:
+		log.Debug("Upgrade identity table to level 5")
+		_, err := tx.Exec(funcName, "ALTER TABLE users RENAME TO users_old")
+		if err != nil {
+			return err
+		}
+		err = createIdentityTable(tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(funcName, "INSERT INTO users (id, token, type, affiliation, attributes, state, max_enrollments, level, incorrect_password_attempts, secret_expiry, totp_seed, totp_step) SELECT id, token, type, affiliation, attributes, state, max_enrollments, level, incorrect_password_attempts, secret_expiry, totp_seed, totp_step FROM users_old")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(funcName, "DROP TABLE users_old")
+		if err != nil {
+			return err
+		}
+		fallthrough
+
+	case 5:
+		log.Debug("Upgrade identity table to level 6")
+		_, err := tx.Exec(funcName, "ALTER TABLE users RENAME TO users_old")
+		if err != nil {
+			return err
+		}
+		err = createIdentityTable(tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(funcName, "INSERT INTO users (id, token, type, affiliation, attributes, state, max_enrollments, level, incorrect_password_attempts, secret_expiry, totp_seed, totp_step, suspended) SELECT id, token, type, affiliation, attributes, state, max_enrollments, level, incorrect_password_attempts, secret_expiry, totp_seed, totp_step, suspended FROM users_old")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(funcName, "DROP TABLE users_old")
+		if err != nil {
+			return err
+		}
+		fallthrough
+
 	default:
 		users, err := user.GetUserLessThanLevel(tx, m.SrvLevels.Identity)
 		if err != nil {
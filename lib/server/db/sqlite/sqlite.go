@@ -130,12 +130,40 @@ func createAllSQLiteTables(tx Create, args ...interface{}) error {
 	if err != nil {
 		return err
 	}
+	err = createOCSPResponsesTable(tx)
+	if err != nil {
+		return err
+	}
+	err = createACMEAccountsTable(tx)
+	if err != nil {
+		return err
+	}
+	err = createAuditLogTable(tx)
+	if err != nil {
+		return err
+	}
+	err = createWebhookEventsTable(tx)
+	if err != nil {
+		return err
+	}
+	err = createTokenNoncesTable(tx)
+	if err != nil {
+		return err
+	}
+	err = createApprovalsTable(tx)
+	if err != nil {
+		return err
+	}
+	err = createRolesTable(tx)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
 func createIdentityTable(tx Create) error {
 	log.Debug("Creating users table if it does not exist")
-	if _, err := tx.Exec("CreateUsersTable", "CREATE TABLE IF NOT EXISTS users (id VARCHAR(255), token bytea, type VARCHAR(256), affiliation VARCHAR(1024), attributes TEXT, state INTEGER, max_enrollments INTEGER, level INTEGER DEFAULT 0, incorrect_password_attempts INTEGER DEFAULT 0, PRIMARY KEY (id))"); err != nil {
+	if _, err := tx.Exec("CreateUsersTable", "CREATE TABLE IF NOT EXISTS users (id VARCHAR(255), token bytea, type VARCHAR(256), affiliation VARCHAR(1024), attributes TEXT, state INTEGER, max_enrollments INTEGER, level INTEGER DEFAULT 0, incorrect_password_attempts INTEGER DEFAULT 0, secret_expiry timestamp, totp_seed VARCHAR(256) DEFAULT '', totp_step BIGINT DEFAULT 0, suspended INTEGER DEFAULT 0, reissue INTEGER DEFAULT 0, PRIMARY KEY (id))"); err != nil {
 		return errors.Wrap(err, "Error creating users table")
 	}
 	return nil
@@ -196,6 +224,62 @@ func createPropertiesTable(tx Create) error {
 	return nil
 }
 
+func createOCSPResponsesTable(tx Create) error {
+	log.Debug("Creating ocsp_responses table if it does not exist")
+	if _, err := tx.Exec("CreateOCSPResponsesTable", "CREATE TABLE IF NOT EXISTS ocsp_responses (serial_number blob NOT NULL, authority_key_identifier blob NOT NULL, body blob NOT NULL, expiry timestamp, PRIMARY KEY(serial_number, authority_key_identifier))"); err != nil {
+		return errors.Wrap(err, "Error creating ocsp_responses table")
+	}
+	return nil
+}
+
+func createACMEAccountsTable(tx Create) error {
+	log.Debug("Creating acme_accounts table if it does not exist")
+	if _, err := tx.Exec("CreateACMEAccountsTable", "CREATE TABLE IF NOT EXISTS acme_accounts (id VARCHAR(64) NOT NULL, enrollment_id VARCHAR(255) NOT NULL, hmac_key VARCHAR(64), jwk text, thumbprint VARCHAR(64), status VARCHAR(32) NOT NULL, created_at timestamp, PRIMARY KEY(id))"); err != nil {
+		return errors.Wrap(err, "Error creating acme_accounts table")
+	}
+	return nil
+}
+
+func createAuditLogTable(tx Create) error {
+	log.Debug("Creating audit_log table if it does not exist")
+	if _, err := tx.Exec("CreateAuditLogTable", "CREATE TABLE IF NOT EXISTS audit_log (seq INTEGER NOT NULL, time timestamp, ca_name VARCHAR(255), caller VARCHAR(255), action VARCHAR(64), target VARCHAR(1024), request_hash VARCHAR(64), status INTEGER, error_code INTEGER, prev_hash VARCHAR(64), hash VARCHAR(64), PRIMARY KEY(seq))"); err != nil {
+		return errors.Wrap(err, "Error creating audit_log table")
+	}
+	return nil
+}
+
+func createWebhookEventsTable(tx Create) error {
+	log.Debug("Creating webhook_events table if it does not exist")
+	if _, err := tx.Exec("CreateWebhookEventsTable", "CREATE TABLE IF NOT EXISTS webhook_events (id VARCHAR(64) NOT NULL, event_id VARCHAR(64) NOT NULL, type VARCHAR(64), endpoint VARCHAR(1024), payload text, created_at timestamp, attempts INTEGER, next_attempt timestamp, PRIMARY KEY(id))"); err != nil {
+		return errors.Wrap(err, "Error creating webhook_events table")
+	}
+	return nil
+}
+
+func createTokenNoncesTable(tx Create) error {
+	log.Debug("Creating token_nonces table if it does not exist")
+	if _, err := tx.Exec("CreateTokenNoncesTable", "CREATE TABLE IF NOT EXISTS token_nonces (nonce VARCHAR(128) NOT NULL, expiry timestamp, PRIMARY KEY(nonce))"); err != nil {
+		return errors.Wrap(err, "Error creating token_nonces table")
+	}
+	return nil
+}
+
+func createApprovalsTable(tx Create) error {
+	log.Debug("Creating approvals table if it does not exist")
+	if _, err := tx.Exec("CreateApprovalsTable", "CREATE TABLE IF NOT EXISTS approvals (id VARCHAR(64) NOT NULL, caller VARCHAR(255), operation VARCHAR(32), policy VARCHAR(255), target VARCHAR(255), affiliation VARCHAR(1024), type VARCHAR(256), method VARCHAR(16), endpoint VARCHAR(255), vars text, request text, required_approvals INTEGER, approved_by text, status VARCHAR(32) NOT NULL, reason text, created_at timestamp, updated_at timestamp, PRIMARY KEY(id))"); err != nil {
+		return errors.Wrap(err, "Error creating approvals table")
+	}
+	return nil
+}
+
+func createRolesTable(tx Create) error {
+	log.Debug("Creating roles table if it does not exist")
+	if _, err := tx.Exec("CreateRolesTable", "CREATE TABLE IF NOT EXISTS roles (name VARCHAR(255) NOT NULL, attributes text, updated_at timestamp, PRIMARY KEY(name))"); err != nil {
+		return errors.Wrap(err, "Error creating roles table")
+	}
+	return nil
+}
+
 func (s *Sqlite) doTransaction(funcName string, doit func(tx Create, args ...interface{}) error, args ...interface{}) error {
 	tx := s.CreateTx
 	err := doit(tx, args...)
@@ -142,6 +142,69 @@ var _ = Describe("Sqlite", func() {
 			Expect(err.Error()).To(ContainSubstring("Failed to initialize properties table: failed to load data"))
 		})
 
+		It("return an error if unable to create ocsp_responses table", func() {
+			mockCreateTx.ExecReturnsOnCall(8, nil, errors.New("creating error"))
+			db.CreateTx = mockCreateTx
+			db.SqlxDB = mockDB
+			err = db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error creating ocsp_responses table: creating error"))
+		})
+
+		It("return an error if unable to create acme_accounts table", func() {
+			mockCreateTx.ExecReturnsOnCall(9, nil, errors.New("creating error"))
+			db.CreateTx = mockCreateTx
+			db.SqlxDB = mockDB
+			err = db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error creating acme_accounts table: creating error"))
+		})
+
+		It("return an error if unable to create audit_log table", func() {
+			mockCreateTx.ExecReturnsOnCall(10, nil, errors.New("creating error"))
+			db.CreateTx = mockCreateTx
+			db.SqlxDB = mockDB
+			err = db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error creating audit_log table: creating error"))
+		})
+
+		It("return an error if unable to create webhook_events table", func() {
+			mockCreateTx.ExecReturnsOnCall(11, nil, errors.New("creating error"))
+			db.CreateTx = mockCreateTx
+			db.SqlxDB = mockDB
+			err = db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error creating webhook_events table: creating error"))
+		})
+
+		It("return an error if unable to create token_nonces table", func() {
+			mockCreateTx.ExecReturnsOnCall(12, nil, errors.New("creating error"))
+			db.CreateTx = mockCreateTx
+			db.SqlxDB = mockDB
+			err = db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error creating token_nonces table: creating error"))
+		})
+
+		It("return an error if unable to create approvals table", func() {
+			mockCreateTx.ExecReturnsOnCall(13, nil, errors.New("creating error"))
+			db.CreateTx = mockCreateTx
+			db.SqlxDB = mockDB
+			err = db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error creating approvals table: creating error"))
+		})
+
+		It("return an error if unable to create roles table", func() {
+			mockCreateTx.ExecReturnsOnCall(14, nil, errors.New("creating error"))
+			db.CreateTx = mockCreateTx
+			db.SqlxDB = mockDB
+			err = db.CreateTables()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error creating roles table: creating error"))
+		})
+
 		It("creates the fabric ca tables", func() {
 			db.CreateTx = mockCreateTx
 
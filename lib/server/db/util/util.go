@@ -74,13 +74,19 @@ func MaskDBCred(str string) string {
 
 // GetCADataSource returns a datasource with a unqiue database name
 func GetCADataSource(dbtype, datasource string, cacount int) string {
+	return GetNamedCADataSource(dbtype, datasource, fmt.Sprintf("ca%d", cacount))
+}
+
+// GetNamedCADataSource returns a datasource with a unique database name
+// for the CA with the given name
+func GetNamedCADataSource(dbtype, datasource, caName string) string {
 	if dbtype == "sqlite3" {
 		ext := filepath.Ext(datasource)
 		dbName := strings.TrimSuffix(filepath.Base(datasource), ext)
-		datasource = fmt.Sprintf("%s_ca%d%s", dbName, cacount, ext)
+		datasource = fmt.Sprintf("%s_%s%s", dbName, caName, ext)
 	} else {
 		dbName := getDBName(datasource)
-		datasource = strings.Replace(datasource, dbName, fmt.Sprintf("%s_ca%d", dbName, cacount), 1)
+		datasource = strings.Replace(datasource, dbName, fmt.Sprintf("%s_%s", dbName, caName), 1)
 	}
 	return datasource
 }
@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package externalca
+
+import (
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+)
+
+// Fields of the certificates which can be mapped to enrollment IDs
+const (
+	// CommonName maps the common name of the subject
+	CommonName = "cn"
+	// Email maps the email addresses of the subject alternative names
+	Email = "email"
+	// DNS maps the DNS names of the subject alternative names
+	DNS = "dns"
+	// URI maps the URIs of the subject alternative names
+	URI = "uri"
+)
+
+// Config is the configuration of the enrollment with certificates issued by
+// external CAs, such as a corporate CA or the CA of a partner organization
+type Config struct {
+	Enabled bool `def:"false" help:"Enable enrollment with certificates issued by trusted external CAs"`
+	// CertFiles are the PEM-encoded certificates of the external CAs. The
+	// self-signed certificates are trust anchors and the others are
+	// intermediate CAs which chain to them.
+	CertFiles    []string `help:"A list of comma-separated PEM-encoded certificates of the trusted external CAs"`
+	Mapping      MappingConfig
+	AutoRegister AutoRegisterConfig
+}
+
+// MappingConfig is the rule which maps a certificate to the enrollment ID
+// of an identity of the registry
+type MappingConfig struct {
+	Source string `def:"cn" help:"Field of the certificates which is mapped to the enrollment ID: 'cn', 'email', 'dns' or 'uri'"`
+	// Pattern is a regular expression which the whole value of the field
+	// must match; the enrollment ID is its first group, if it has one, or
+	// else the value. The first value of a field which matches is used.
+	Pattern string `help:"Regular expression which the field must match; the enrollment ID is its first group, if it has one"`
+}
+
+// AutoRegisterConfig is the configuration of the registration of the
+// identities of the certificates which are not in the registry
+type AutoRegisterConfig struct {
+	Enabled     bool   `def:"false" help:"Register the identity of a certificate when it first enrolls"`
+	Affiliation string `help:"Affiliation of the identities which are registered when they first enroll; the root affiliation if not set"`
+	Type        string `def:"client" help:"Type of the identities which are registered when they first enroll"`
+}
+
+// Implements Stringer interface for externalca.Config
+// Calls util.StructToString to convert the Config struct to
+// string.
+func (c Config) String() string {
+	return util.StructToString(&c)
+}
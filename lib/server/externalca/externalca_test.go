@@ -0,0 +1,160 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package externalca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	issuer, signer := tmpl, crypto.Signer(key)
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, key.Public(), signer)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %s", err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func newTestCA(t *testing.T, cn string, parent *testCert) *testCert {
+	return newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, parent)
+}
+
+func writeCerts(t *testing.T, file string, certs ...*testCert) {
+	var buf []byte
+	for _, c := range certs {
+		buf = append(buf, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})...)
+	}
+	err := ioutil.WriteFile(file, buf, 0644)
+	if err != nil {
+		t.Fatalf("Failed to write certificate file: %s", err)
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "externalca")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := newTestCA(t, "corp-root", nil)
+	intermediate := newTestCA(t, "corp-issuing", root)
+	other := newTestCA(t, "other-root", nil)
+	uri, _ := url.Parse("spiffe://corp.example.com/user1")
+	leaf := newTestCert(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "User One"},
+		EmailAddresses: []string{"user1@partner.example.com", "user1@corp.example.com"},
+		DNSNames:       []string{"host1.corp.example.com"},
+		URIs:           []*url.URL{uri},
+	}, intermediate)
+	untrusted := newTestCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "user2"}}, other)
+
+	rootFile := filepath.Join(dir, "root.pem")
+	writeCerts(t, rootFile, root)
+	chainFile := filepath.Join(dir, "chain.pem")
+	writeCerts(t, chainFile, root, intermediate)
+	leafFile := filepath.Join(dir, "leaf.pem")
+	writeCerts(t, leafFile, leaf)
+
+	_, err = NewVerifier(&Config{CertFiles: []string{rootFile}, Mapping: MappingConfig{Source: "serial"}})
+	assert.Error(t, err, "Invalid mapping source should fail")
+	_, err = NewVerifier(&Config{CertFiles: []string{rootFile}, Mapping: MappingConfig{Source: CommonName, Pattern: "("}})
+	assert.Error(t, err, "Invalid mapping pattern should fail")
+	_, err = NewVerifier(&Config{Mapping: MappingConfig{Source: CommonName}})
+	assert.Error(t, err, "Configuration without trusted CAs should fail")
+	_, err = NewVerifier(&Config{CertFiles: []string{leafFile}, Mapping: MappingConfig{Source: CommonName}})
+	assert.Error(t, err, "Certificate file with a certificate which is not a CA should fail")
+	_, err = NewVerifier(&Config{CertFiles: []string{filepath.Join(dir, "missing.pem")}, Mapping: MappingConfig{Source: CommonName}})
+	assert.Error(t, err, "Missing certificate file should fail")
+
+	// The intermediate CA is presented with the certificate
+	v, err := NewVerifier(&Config{CertFiles: []string{rootFile}, Mapping: MappingConfig{Source: CommonName}})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+	id, err := v.Verify(leaf.cert, []*x509.Certificate{intermediate.cert})
+	assert.NoError(t, err)
+	assert.Equal(t, "User One", id)
+	_, err = v.Verify(leaf.cert, nil)
+	assert.Error(t, err, "Certificate without its intermediate CA should fail")
+	_, err = v.Verify(untrusted.cert, nil)
+	assert.Error(t, err, "Certificate of an untrusted CA should fail")
+
+	// The intermediate CA is in the configuration
+	v, err = NewVerifier(&Config{CertFiles: []string{chainFile}, Mapping: MappingConfig{Source: Email, Pattern: `(.+)@corp\.example\.com`}})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+	id, err = v.Verify(leaf.cert, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "user1", id, "The first email which matches should be mapped")
+	v.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = v.Verify(leaf.cert, nil)
+	assert.Error(t, err, "Expired certificate should fail")
+
+	v, err = NewVerifier(&Config{CertFiles: []string{chainFile}, Mapping: MappingConfig{Source: DNS, Pattern: `[^.]+\.corp\.example\.com`}})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+	id, err = v.EnrollmentID(leaf.cert)
+	assert.NoError(t, err)
+	assert.Equal(t, "host1.corp.example.com", id)
+
+	v, err = NewVerifier(&Config{CertFiles: []string{chainFile}, Mapping: MappingConfig{Source: URI, Pattern: `spiffe://corp\.example\.com/(.+)`}})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+	id, err = v.EnrollmentID(leaf.cert)
+	assert.NoError(t, err)
+	assert.Equal(t, "user1", id)
+
+	v, err = NewVerifier(&Config{CertFiles: []string{chainFile}, Mapping: MappingConfig{Source: Email, Pattern: `(.+)@example\.com`}})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+	_, err = v.EnrollmentID(leaf.cert)
+	assert.Error(t, err, "Certificate without a value which matches the pattern should fail")
+}
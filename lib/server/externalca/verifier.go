@@ -0,0 +1,142 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package externalca
+
+import (
+	"bytes"
+	"crypto/x509"
+	"regexp"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+// Verifier verifies that certificates were issued by the trusted external
+// CAs and maps them to enrollment IDs
+type Verifier struct {
+	roots         *x509.CertPool
+	intermediates []*x509.Certificate
+	source        string
+	pattern       *regexp.Regexp
+	now           func() time.Time
+}
+
+// NewVerifier returns the verifier of a configuration
+func NewVerifier(cfg *Config) (*Verifier, error) {
+	switch cfg.Mapping.Source {
+	case CommonName, Email, DNS, URI:
+	default:
+		return nil, errors.Errorf("Invalid external CA mapping source '%s'; expecting '%s', '%s', '%s' or '%s'",
+			cfg.Mapping.Source, CommonName, Email, DNS, URI)
+	}
+	v := &Verifier{
+		roots:  x509.NewCertPool(),
+		source: cfg.Mapping.Source,
+		now:    time.Now,
+	}
+	if cfg.Mapping.Pattern != "" {
+		var err error
+		v.pattern, err = regexp.Compile("^(?:" + cfg.Mapping.Pattern + ")$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid external CA mapping pattern '%s'", cfg.Mapping.Pattern)
+		}
+	}
+	numRoots := 0
+	for _, file := range cfg.CertFiles {
+		pemBytes, err := util.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := util.GetX509CertificatesFromPEM(pemBytes)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "Invalid external CA certificate file '%s'", file)
+		}
+		if len(certs) == 0 {
+			return nil, errors.Errorf("No certificates found in external CA certificate file '%s'", file)
+		}
+		for _, cert := range certs {
+			if !cert.IsCA {
+				return nil, errors.Errorf("Certificate '%s' of file '%s' is not a CA certificate", cert.Subject, file)
+			}
+			if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+				v.roots.AddCert(cert)
+				numRoots++
+			} else {
+				v.intermediates = append(v.intermediates, cert)
+			}
+		}
+	}
+	if numRoots == 0 {
+		return nil, errors.New("The external CA configuration requires the self-signed certificate of at least one trusted CA in 'certfiles'")
+	}
+	return v, nil
+}
+
+// Verify verifies that a certificate chains to a trusted external CA, through
+// the intermediate CAs of the configuration or of the chain presented with
+// it, and returns the enrollment ID it maps to
+func (v *Verifier) Verify(cert *x509.Certificate, chain []*x509.Certificate) (string, error) {
+	intermediates := x509.NewCertPool()
+	for _, c := range v.intermediates {
+		intermediates.AddCert(c)
+	}
+	for _, c := range chain {
+		intermediates.AddCert(c)
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		CurrentTime:   v.now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "The certificate was not issued by a trusted external CA")
+	}
+	return v.EnrollmentID(cert)
+}
+
+// EnrollmentID returns the enrollment ID a certificate maps to, which is the
+// first value of the field of the mapping which matches its pattern
+func (v *Verifier) EnrollmentID(cert *x509.Certificate) (string, error) {
+	var values []string
+	switch v.source {
+	case CommonName:
+		values = []string{cert.Subject.CommonName}
+	case Email:
+		values = cert.EmailAddresses
+	case DNS:
+		values = cert.DNSNames
+	case URI:
+		for _, u := range cert.URIs {
+			values = append(values, u.String())
+		}
+	}
+	for _, value := range values {
+		id := v.match(value)
+		if id != "" {
+			log.Debugf("Mapped %s '%s' of certificate '%s' to enrollment ID '%s'", v.source, value, cert.Subject, id)
+			return id, nil
+		}
+	}
+	return "", errors.Errorf("No %s of the certificate '%s' maps to an enrollment ID", v.source, cert.Subject)
+}
+
+func (v *Verifier) match(value string) string {
+	if v.pattern == nil {
+		return value
+	}
+	m := v.pattern.FindStringSubmatch(value)
+	if m == nil {
+		return ""
+	}
+	if len(m) > 1 {
+		return m[1]
+	}
+	return m[0]
+}
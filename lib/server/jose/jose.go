@@ -0,0 +1,165 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// JWK is a JSON web key (RFC 7517) holding a public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// NewJWK returns the JWK of an ECDSA or RSA public key
+func NewJWK(pub crypto.PublicKey) (*JWK, error) {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return &JWK{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   b64(padBytes(key.X.Bytes(), size)),
+			Y:   b64(padBytes(key.Y.Bytes(), size)),
+		}, nil
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			N:   b64(key.N.Bytes()),
+			E:   b64(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	}
+	return nil, errors.Errorf("Unsupported public key type %T", pub)
+}
+
+// PublicKey returns the public key of the JWK
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, errors.Errorf("Unsupported curve '%s'", k.Crv)
+		}
+		x, err := unb64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := unb64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("The public key is not on the curve")
+		}
+		return key, nil
+	case "RSA":
+		n, err := unb64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := unb64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("Invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	}
+	return nil, errors.Errorf("Unsupported key type '%s'", k.Kty)
+}
+
+// Thumbprint returns the base64url encoded SHA-256 thumbprint of the JWK (RFC 7638)
+func (k *JWK) Thumbprint() string {
+	var canonical string
+	if k.Kty == "EC" {
+		canonical = `{"crv":"` + k.Crv + `","kty":"EC","x":"` + k.X + `","y":"` + k.Y + `"}`
+	} else {
+		canonical = `{"e":"` + k.E + `","kty":"RSA","n":"` + k.N + `"}`
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return b64(sum[:])
+}
+
+// Verify verifies the signature of a JWS signing input with the public key
+// by the algorithm of the JWS (RFC 7518, section 3)
+func Verify(alg string, pub crypto.PublicKey, signingInput, sig []byte) error {
+	switch alg {
+	case "ES256", "ES384":
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.Errorf("Algorithm '%s' requires an EC key", alg)
+		}
+		hash := crypto.SHA256
+		if alg == "ES384" {
+			hash = crypto.SHA384
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("Invalid JWS signature length")
+		}
+		h := hash.New()
+		h.Write(signingInput)
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, h.Sum(nil), r, s) {
+			return errors.New("Invalid JWS signature")
+		}
+		return nil
+	case "RS256":
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("Algorithm 'RS256' requires an RSA key")
+		}
+		h := sha256.Sum256(signingInput)
+		err := rsa.VerifyPKCS1v15(key, crypto.SHA256, h[:], sig)
+		if err != nil {
+			return errors.Wrap(err, "Invalid JWS signature")
+		}
+		return nil
+	}
+	return errors.Errorf("Unsupported JWS algorithm '%s'", alg)
+}
+
+func b64(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func unb64(s string) ([]byte, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid base64url encoding")
+	}
+	return buf, nil
+}
+
+func padBytes(buf []byte, size int) []byte {
+	if len(buf) >= size {
+		return buf
+	}
+	return append(make([]byte, size-len(buf)), buf...)
+}
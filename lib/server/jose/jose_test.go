@@ -0,0 +1,67 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWK(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	util.FatalError(t, err, "Failed to generate EC key")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	util.FatalError(t, err, "Failed to generate RSA key")
+
+	for _, pub := range []crypto.PublicKey{ecKey.Public(), rsaKey.Public()} {
+		jwk, err := NewJWK(pub)
+		util.FatalError(t, err, "Failed to create JWK")
+		key, err := jwk.PublicKey()
+		if assert.NoError(t, err) {
+			assert.Equal(t, pub, key)
+		}
+		assert.Len(t, jwk.Thumbprint(), 43)
+	}
+
+	_, err = (&JWK{Kty: "EC", Crv: "P-256", X: jwkX(ecKey), Y: jwkX(ecKey)}).PublicKey()
+	assert.Error(t, err, "A point which is not on the curve should fail")
+	_, err = (&JWK{Kty: "oct"}).PublicKey()
+	assert.Error(t, err, "An unsupported key type should fail")
+}
+
+func TestVerify(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	util.FatalError(t, err, "Failed to generate EC key")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	util.FatalError(t, err, "Failed to generate RSA key")
+
+	input := []byte("header.payload")
+	digest := sha256.Sum256(input)
+	r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+	util.FatalError(t, err, "Failed to sign with EC key")
+	ecSig := append(padBytes(r.Bytes(), 32), padBytes(s.Bytes(), 32)...)
+	rsaSig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	util.FatalError(t, err, "Failed to sign with RSA key")
+
+	assert.NoError(t, Verify("ES256", ecKey.Public(), input, ecSig))
+	assert.NoError(t, Verify("RS256", rsaKey.Public(), input, rsaSig))
+	assert.Error(t, Verify("ES256", ecKey.Public(), []byte("other"), ecSig), "A signature of another input should fail")
+	assert.Error(t, Verify("ES256", rsaKey.Public(), input, rsaSig), "A key of the wrong type should fail")
+	assert.Error(t, Verify("HS256", ecKey.Public(), input, ecSig), "An unsupported algorithm should fail")
+}
+
+func jwkX(key *ecdsa.PrivateKey) string {
+	return b64(padBytes(key.X.Bytes(), 32))
+}
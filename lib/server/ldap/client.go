@@ -16,6 +16,7 @@ import (
 	"github.com/Knetic/govaluate"
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/attr"
 	causer "github.com/hyperledger/fabric-ca/lib/server/user"
 	"github.com/hyperledger/fabric-ca/lib/spi"
 	ctls "github.com/hyperledger/fabric-ca/lib/tls"
@@ -154,11 +155,18 @@ type Client struct {
 	attrNames     []string             // Names of attributes to request on an LDAP search
 	attrExprs     map[string]*userExpr // Expressions to evaluate to get attribute value
 	attrMaps      map[string]map[string]string
+	attrSchemas   *attr.Schemas // Checker of the values of mapped attributes
 	AdminConn     *ldap.Conn
 	TLS           *ctls.ClientTLSConfig
 	CSP           bccsp.BCCSP
 }
 
+// SetAttributeSchemas sets the schemas which the values of the attributes
+// mapped from LDAP entries must match
+func (lc *Client) SetAttributeSchemas(schemas *attr.Schemas) {
+	lc.attrSchemas = schemas
+}
+
 // GetUser returns a user object for username and attribute values
 // for the requested attribute names
 func (lc *Client) GetUser(username string, attrNames []string) (causer.User, error) {
@@ -409,14 +417,24 @@ func (u *user) GetAttribute(name string) (*api.Attribute, error) {
 		if len(vals) == 0 {
 			vals = make([]string, 0)
 		}
-		return &api.Attribute{Name: name, Value: strings.Join(vals, ",")}, nil
+		return u.checkAttribute(&api.Attribute{Name: name, Value: strings.Join(vals, ",")})
 	}
 	log.Debugf("Evaluating expression for attribute '%s' from LDAP user '%s'", name, u.name)
 	value, err := expr.evaluate(u)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to evaluate LDAP expression")
 	}
-	return &api.Attribute{Name: name, Value: fmt.Sprintf("%v", value)}, nil
+	return u.checkAttribute(&api.Attribute{Name: name, Value: fmt.Sprintf("%v", value)})
+}
+
+// checkAttribute returns an attribute mapped from the LDAP entry, or an error
+// if its value does not match its schema
+func (u *user) checkAttribute(a *api.Attribute) (*api.Attribute, error) {
+	err := u.client.attrSchemas.CheckValue(a)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Attribute of LDAP user '%s' is not valid", u.name)
+	}
+	return a, nil
 }
 
 // GetAttributes returns the requested attributes
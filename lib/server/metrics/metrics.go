@@ -28,6 +28,47 @@ var (
 		LabelNames:   []string{"ca_name", "api_name", "status_code"},
 		StatsdFormat: "%{#fqname}.%{ca_name}.%{api_name}.%{status_code}",
 	}
+
+	// APIThrottledCounterOpts define the counter opts for requests rejected
+	// by rate limits
+	APIThrottledCounterOpts = metrics.CounterOpts{
+		Namespace:    "api_request",
+		Subsystem:    "",
+		Name:         "throttled",
+		Help:         "Number of requests to an API rejected because a rate limit was exceeded",
+		LabelNames:   []string{"api_name", "limit"},
+		StatsdFormat: "%{#fqname}.%{api_name}.%{limit}",
+	}
+
+	// CPABEKeyCounterOpts define the counter opts for CP-ABE key derivations
+	CPABEKeyCounterOpts = metrics.CounterOpts{
+		Namespace:    "cpabe_key",
+		Subsystem:    "",
+		Name:         "count",
+		Help:         "Number of CP-ABE private keys derived for enrollments",
+		LabelNames:   []string{"ca_name", "cache"},
+		StatsdFormat: "%{#fqname}.%{ca_name}.%{cache}",
+	}
+
+	// CPABEKeyDurationOpts define the duration opts for CP-ABE key derivations
+	CPABEKeyDurationOpts = metrics.HistogramOpts{
+		Namespace:    "cpabe_key",
+		Subsystem:    "",
+		Name:         "duration",
+		Help:         "Time taken in seconds to derive a CP-ABE private key, including the wait for a worker",
+		LabelNames:   []string{"ca_name", "cache"},
+		StatsdFormat: "%{#fqname}.%{ca_name}.%{cache}",
+	}
+
+	// CPABEKeyAttributesOpts define the attribute count opts for CP-ABE key derivations
+	CPABEKeyAttributesOpts = metrics.HistogramOpts{
+		Namespace:    "cpabe_key",
+		Subsystem:    "",
+		Name:         "attributes",
+		Help:         "Number of attributes in a derived CP-ABE private key",
+		LabelNames:   []string{"ca_name"},
+		StatsdFormat: "%{#fqname}.%{ca_name}",
+	}
 )
 
 // Metrics are the metrics tracked by server
@@ -36,4 +77,12 @@ type Metrics struct {
 	APICounter metrics.Counter
 	// APIDuration keeps track of time taken for request to complete for an API
 	APIDuration metrics.Histogram
+	// APIThrottledCounter keeps track of number of requests rejected by rate limits
+	APIThrottledCounter metrics.Counter
+	// CPABEKeyCounter keeps track of number of CP-ABE private keys derived
+	CPABEKeyCounter metrics.Counter
+	// CPABEKeyDuration keeps track of time taken to derive a CP-ABE private key
+	CPABEKeyDuration metrics.Histogram
+	// CPABEKeyAttributes keeps track of number of attributes in derived CP-ABE private keys
+	CPABEKeyAttributes metrics.Histogram
 }
@@ -0,0 +1,75 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oidc
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	ctls "github.com/hyperledger/fabric-ca/lib/tls"
+)
+
+// Modes of the OpenID Connect identity provider
+const (
+	// AlongsideMode accepts ID tokens in addition to the enrollment secrets
+	// of the identities of the registry of the CA. The identity of a token
+	// is added to the registry when it first enrolls.
+	AlongsideMode = "alongside"
+	// RegistryMode uses the identity provider as the registry of the CA,
+	// as an LDAP server is when LDAP is enabled
+	RegistryMode = "registry"
+)
+
+// Config is the configuration of the enrollment with OpenID Connect ID tokens
+type Config struct {
+	Enabled bool   `def:"false" help:"Enable enrollment with OpenID Connect ID tokens"`
+	Mode    string `def:"alongside" help:"'alongside' to accept ID tokens in addition to the enrollment secrets of the registry, or 'registry' to use the identity provider as the registry"`
+	// Issuer and Audience must equal the 'iss' claim of the ID tokens and
+	// one of the values of their 'aud' claim
+	Issuer   string `help:"Issuer of the ID tokens; the value of their 'iss' claim"`
+	Audience string `help:"Audience of the ID tokens, usually the client ID of the CA at the identity provider"`
+	// JWKSFile and JWKSURL are where the public keys which sign the ID tokens
+	// are found; the keys of the URL are fetched again after JWKSRefresh, or
+	// when a token is signed with an unknown key
+	JWKSFile    string        `help:"File containing the JSON web key set of the identity provider"`
+	JWKSURL     string        `help:"URL of the JSON web key set of the identity provider"`
+	JWKSRefresh time.Duration `def:"1h" help:"Interval at which the JSON web key set of the URL is fetched again"`
+	ClockSkew   time.Duration `def:"1m" help:"Maximum difference between the times of the ID tokens and the time of the server"`
+	// UserType is the type of the identities of the ID tokens
+	UserType  string `def:"client" help:"Type of the identities of the ID tokens"`
+	Claims    ClaimConfig
+	Attribute AttrConfig
+	TLS       ctls.ClientTLSConfig
+}
+
+// ClaimConfig names the claims of the ID tokens which are the enrollment ID
+// and the affiliation of their identities
+type ClaimConfig struct {
+	EnrollmentID string `def:"sub" help:"Claim of the ID tokens whose value is the enrollment ID"`
+	Affiliation  string `help:"Claim of the ID tokens whose value is the affiliation; the root affiliation if not set"`
+}
+
+// AttrConfig is the configuration of the mapping of the claims of the ID
+// tokens to attributes, as ldap.AttrConfig is for LDAP entries
+type AttrConfig struct {
+	Names      []string             `help:"The names of the claims of the ID tokens which are attributes of the identities"`
+	Converters []NameVal            // Used to convert the claims of an ID token into a fabric-ca-server attribute
+	Maps       map[string][]NameVal // Used to map the values of claims to fabric-ca-server names
+}
+
+// NameVal is a name and value pair
+type NameVal struct {
+	Name  string
+	Value string
+}
+
+// Implements Stringer interface for oidc.Config
+// Calls util.StructToString to convert the Config struct to
+// string.
+func (c Config) String() string {
+	return util.StructToString(&c)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oidc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+	"github.com/pkg/errors"
+)
+
+// claimExpr is the expression of a converter, which computes the value of
+// an attribute from the claims of an ID token. It supports the functions
+// of the expressions of LDAP converters, with 'claim' in place of 'attr'.
+type claimExpr struct {
+	provider   *Provider
+	attr, expr string
+	claims     map[string]interface{}
+}
+
+func newClaimExpr(p *Provider, attr, expr string) (*claimExpr, error) {
+	ce := &claimExpr{provider: p, attr: attr, expr: expr}
+	_, err := govaluate.NewEvaluableExpressionWithFunctions(expr, ce.functions())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid expression for attribute '%s'", attr)
+	}
+	return ce, nil
+}
+
+// evaluate returns the value of the expression for the claims of a user
+func (ce *claimExpr) evaluate(u *user, claims map[string]interface{}) (string, error) {
+	ce2 := &claimExpr{provider: ce.provider, attr: ce.attr, expr: ce.expr, claims: claims}
+	eval, err := govaluate.NewEvaluableExpressionWithFunctions(ce2.expr, ce2.functions())
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid expression for attribute '%s'", ce.attr)
+	}
+	parms := map[string]interface{}{
+		"id":          u.name,
+		"affiliation": u.affiliation,
+	}
+	result, err := eval.Evaluate(parms)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v", result), nil
+}
+
+func (ce *claimExpr) functions() map[string]govaluate.ExpressionFunction {
+	return map[string]govaluate.ExpressionFunction{
+		"claim": ce.claimFunction,
+		"map":   ce.mapFunction,
+		"if":    ce.ifFunction,
+	}
+}
+
+// Get the value of a claim; the usage is 'claim(<claimName> [, <separator>])'.
+// If the value of the claim is an array, return its values in a single
+// string separated by the <separator> string, which is a comma by default.
+// The value of a claim which is not set is the empty string.
+func (ce *claimExpr) claimFunction(args ...interface{}) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, errors.Errorf("Expecting 1 or 2 arguments for 'claim' but found %d", len(args))
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, errors.Errorf("First argument to 'claim' must be a string; '%v' is not a string", args[0])
+	}
+	sep := ","
+	if len(args) == 2 {
+		sep, ok = args[1].(string)
+		if !ok {
+			return nil, errors.Errorf("Second argument to 'claim' must be a string; '%v' is not a string", args[1])
+		}
+	}
+	return claimString(ce.claims[name], sep), nil
+}
+
+// Map function performs string substitutions on the 1st argument for each
+// entry in the map referenced by the 2nd argument, as it does for LDAP.
+func (ce *claimExpr) mapFunction(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errors.Errorf("Expecting two arguments but found %d", len(args))
+	}
+	str, ok := args[0].(string)
+	if !ok {
+		return nil, errors.Errorf("First argument to 'map' must be a string; '%v' is not a string", args[0])
+	}
+	mapName, ok := args[1].(string)
+	if !ok {
+		return nil, errors.Errorf("Second argument to 'map' must be a string; '%v' is not a string", args[1])
+	}
+	mapName = strings.ToLower(mapName)
+	myMap := ce.provider.attrMaps[mapName]
+	if myMap == nil {
+		return nil, errors.Errorf("Unknown map name: '%s'", mapName)
+	}
+	for name, val := range myMap {
+		str = strings.Replace(str, name, val, -1)
+	}
+	return str, nil
+}
+
+// The "ifFunction" returns the 2nd arg if the 1st boolean arg is true; otherwise it
+// returns the 3rd arg.
+func (ce *claimExpr) ifFunction(args ...interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errors.Errorf("Expecting 3 arguments for 'if' but found %d", len(args))
+	}
+	cond, ok := args[0].(bool)
+	if !ok {
+		return nil, errors.New("Expecting first argument to 'if' to be a boolean")
+	}
+	if cond {
+		return args[1], nil
+	}
+	return args[2], nil
+}
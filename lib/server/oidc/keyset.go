@@ -0,0 +1,151 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oidc
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/lib/server/jose"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+// minFetchInterval is the minimum time between two fetches of the key set
+// of a URL, so that tokens signed with unknown keys cannot flood the
+// identity provider
+const minFetchInterval = time.Minute
+
+// jwk is a JSON web key of a key set
+type jwk struct {
+	jose.JWK
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+// keySet holds the public keys of the identity provider by key ID, read
+// from a file or fetched from a URL
+type keySet struct {
+	file    string
+	url     string
+	refresh time.Duration
+	client  *http.Client
+	now     func() time.Time
+	mutex   sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// lookup returns the keys which may have signed a token with a key ID; all
+// keys if the token has none
+func (ks *keySet) lookup(kid string) ([]crypto.PublicKey, error) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	if ks.url != "" {
+		now := ks.now()
+		_, known := ks.keys[kid]
+		if ks.keys == nil || now.Sub(ks.fetched) >= ks.refresh ||
+			(kid != "" && !known && now.Sub(ks.fetched) >= minFetchInterval) {
+			err := ks.fetch(now)
+			if err != nil {
+				if ks.keys == nil {
+					return nil, err
+				}
+				log.Warningf("Failed to refresh the JSON web key set of the identity provider: %s", err)
+			}
+		}
+	}
+	if kid != "" {
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, errors.Errorf("Unknown key ID '%s'", kid)
+		}
+		return []crypto.PublicKey{key}, nil
+	}
+	keys := make([]crypto.PublicKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// load reads the key set of the file
+func (ks *keySet) load() error {
+	buf, err := ioutil.ReadFile(ks.file)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read JSON web key set file '%s'", ks.file)
+	}
+	keys, err := parseKeySet(buf)
+	if err != nil {
+		return errors.WithMessagef(err, "Invalid JSON web key set file '%s'", ks.file)
+	}
+	ks.keys = keys
+	return nil
+}
+
+// fetch gets the key set of the URL
+func (ks *keySet) fetch(now time.Time) error {
+	// A failed fetch is not retried before the minimum interval either
+	ks.fetched = now
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get JSON web key set from '%s'", ks.url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Failed to get JSON web key set from '%s': %s", ks.url, resp.Status)
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read JSON web key set from '%s'", ks.url)
+	}
+	keys, err := parseKeySet(buf)
+	if err != nil {
+		return errors.WithMessagef(err, "Invalid JSON web key set from '%s'", ks.url)
+	}
+	ks.keys = keys
+	log.Debugf("Fetched %d keys of the identity provider from '%s'", len(keys), ks.url)
+	return nil
+}
+
+// parseKeySet returns the signature keys of a JSON web key set (RFC 7517,
+// section 5) by key ID; the keys of other types or uses are skipped
+func parseKeySet(buf []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := json.Unmarshal(buf, &set)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse JSON web key set")
+	}
+	keys := map[string]crypto.PublicKey{}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.PublicKey()
+		if err != nil {
+			log.Debugf("Skipping key '%s' of JSON web key set: %s", k.Kid, err)
+			continue
+		}
+		kid := k.Kid
+		if kid == "" {
+			// A key without an ID is only used for tokens without one
+			kid = fmt.Sprintf("#%d", i)
+		}
+		keys[kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("The JSON web key set has no supported signature keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,316 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/server/jose"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "fabric-ca"
+)
+
+// testSigner signs ID tokens with an ECDSA or RSA key
+type testSigner struct {
+	kid string
+	key crypto.Signer
+}
+
+func newECSigner(t *testing.T, kid string) *testSigner {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	util.FatalError(t, err, "Failed to generate EC key")
+	return &testSigner{kid: kid, key: key}
+}
+
+func newRSASigner(t *testing.T, kid string) *testSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	util.FatalError(t, err, "Failed to generate RSA key")
+	return &testSigner{kid: kid, key: key}
+}
+
+func (s *testSigner) jwk(t *testing.T) map[string]interface{} {
+	k, err := jose.NewJWK(s.key.Public())
+	util.FatalError(t, err, "Failed to create JWK")
+	buf, err := json.Marshal(k)
+	util.FatalError(t, err, "Failed to marshal JWK")
+	m := map[string]interface{}{}
+	err = json.Unmarshal(buf, &m)
+	util.FatalError(t, err, "Failed to unmarshal JWK")
+	m["kid"] = s.kid
+	m["use"] = "sig"
+	return m
+}
+
+func (s *testSigner) sign(t *testing.T, claims map[string]interface{}) string {
+	alg := "ES256"
+	if _, ok := s.key.(*rsa.PrivateKey); ok {
+		alg = "RS256"
+	}
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": s.kid, "typ": "JWT"})
+	util.FatalError(t, err, "Failed to marshal header")
+	payload, err := json.Marshal(claims)
+	util.FatalError(t, err, "Failed to marshal claims")
+	input := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch key := s.key.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		util.FatalError(t, err, "Failed to sign token")
+		sig = append(pad(r.Bytes(), 32), pad(s.Bytes(), 32)...)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		util.FatalError(t, err, "Failed to sign token")
+	}
+	return input + "." + b64(sig)
+}
+
+func b64(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func pad(buf []byte, size int) []byte {
+	return append(make([]byte, size-len(buf)), buf...)
+}
+
+func writeKeySet(t *testing.T, dir string, signers ...*testSigner) string {
+	keys := []interface{}{}
+	for _, s := range signers {
+		keys = append(keys, s.jwk(t))
+	}
+	buf, err := json.Marshal(map[string]interface{}{"keys": keys})
+	util.FatalError(t, err, "Failed to marshal key set")
+	file := filepath.Join(dir, "jwks.json")
+	err = ioutil.WriteFile(file, buf, 0644)
+	util.FatalError(t, err, "Failed to write key set")
+	return file
+}
+
+func testClaims(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":    testIssuer,
+		"aud":    []string{"other", testAudience},
+		"sub":    "alice",
+		"exp":    now.Add(time.Hour).Unix(),
+		"iat":    now.Unix(),
+		"email":  "alice@example.com",
+		"dept":   "org1.department1",
+		"groups": []string{"users", "ca-admins"},
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oidc")
+	util.FatalError(t, err, "Failed to create temp directory")
+	defer os.RemoveAll(dir)
+	file := writeKeySet(t, dir, newECSigner(t, "k1"))
+
+	_, err = NewProvider(&Config{Issuer: testIssuer, Audience: testAudience}, nil)
+	assert.Error(t, err, "A provider without a key set should fail")
+	_, err = NewProvider(&Config{Audience: testAudience, JWKSFile: file}, nil)
+	assert.Error(t, err, "A provider without an issuer should fail")
+	_, err = NewProvider(&Config{Issuer: testIssuer, JWKSFile: file}, nil)
+	assert.Error(t, err, "A provider without an audience should fail")
+	_, err = NewProvider(&Config{Issuer: testIssuer, Audience: testAudience, JWKSFile: file, Mode: "ldap"}, nil)
+	assert.Error(t, err, "An unknown mode should fail")
+	_, err = NewProvider(&Config{Issuer: testIssuer, Audience: testAudience, JWKSFile: file, JWKSURL: "http://localhost"}, nil)
+	assert.Error(t, err, "A key set file and URL should fail")
+	_, err = NewProvider(&Config{Issuer: testIssuer, Audience: testAudience, JWKSFile: filepath.Join(dir, "missing.json")}, nil)
+	assert.Error(t, err, "A missing key set file should fail")
+	cfg := &Config{Issuer: testIssuer, Audience: testAudience, JWKSFile: file}
+	cfg.Attribute.Converters = []NameVal{{Name: "a", Value: "claim("}}
+	_, err = NewProvider(cfg, nil)
+	assert.Error(t, err, "An invalid converter should fail")
+
+	p, err := NewProvider(&Config{Issuer: testIssuer, Audience: testAudience, JWKSFile: file}, nil)
+	if assert.NoError(t, err) {
+		assert.False(t, p.IsRegistry())
+		assert.Equal(t, "client", p.userType)
+		assert.Equal(t, "sub", p.idClaim)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oidc")
+	util.FatalError(t, err, "Failed to create temp directory")
+	defer os.RemoveAll(dir)
+	ec := newECSigner(t, "k1")
+	rs := newRSASigner(t, "k2")
+	cfg := &Config{
+		Issuer:    testIssuer,
+		Audience:  testAudience,
+		JWKSFile:  writeKeySet(t, dir, ec, rs),
+		ClockSkew: time.Minute,
+		UserType:  "user",
+		Claims:    ClaimConfig{Affiliation: "dept"},
+		Attribute: AttrConfig{
+			Names: []string{"email", "missing"},
+			Converters: []NameVal{
+				{Name: "hf.Revoker", Value: `claim("groups") =~ "ca-admins"`},
+				{Name: "role", Value: `map(claim("groups", ":"), "Roles")`},
+			},
+			Maps: map[string][]NameVal{
+				"Roles": {{Name: "users", Value: "client"}},
+			},
+		},
+	}
+	p, err := NewProvider(cfg, nil)
+	util.FatalError(t, err, "Failed to create provider")
+	now := time.Now()
+
+	u, err := p.Authenticate(ec.sign(t, testClaims(now)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", u.GetName())
+		assert.Equal(t, "user", u.GetType())
+		assert.Equal(t, []string{"org1", "department1"}, u.GetAffiliationPath())
+		attrs, err := u.GetAttributes(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []api.Attribute{
+			{Name: "email", Value: "alice@example.com"},
+			{Name: "hf.Revoker", Value: "true"},
+			{Name: "role", Value: "client:ca-admins"},
+		}, attrs)
+		_, err = u.GetAttribute("missing")
+		assert.Error(t, err, "An attribute of a missing claim should not be set")
+		assert.Error(t, u.Login("secret", -1), "A user of an ID token should not log in with a secret")
+	}
+	_, err = p.Authenticate(rs.sign(t, testClaims(now)))
+	assert.NoError(t, err, "A token signed with an RSA key should be accepted")
+
+	// Tokens which fail verification
+	other := newECSigner(t, "k1")
+	_, err = p.Authenticate(other.sign(t, testClaims(now)))
+	assert.Error(t, err, "A token signed with another key should be rejected")
+	_, err = p.Authenticate(newECSigner(t, "k3").sign(t, testClaims(now)))
+	assert.Error(t, err, "A token signed with an unknown key should be rejected")
+	claims := testClaims(now)
+	claims["iss"] = "https://other.example.com"
+	_, err = p.Authenticate(ec.sign(t, claims))
+	assert.Error(t, err, "A token of another issuer should be rejected")
+	claims = testClaims(now)
+	claims["aud"] = "other"
+	_, err = p.Authenticate(ec.sign(t, claims))
+	assert.Error(t, err, "A token for another audience should be rejected")
+	claims = testClaims(now)
+	claims["exp"] = now.Add(-2 * time.Minute).Unix()
+	_, err = p.Authenticate(ec.sign(t, claims))
+	assert.Error(t, err, "An expired token should be rejected")
+	claims["exp"] = now.Add(-30 * time.Second).Unix()
+	_, err = p.Authenticate(ec.sign(t, claims))
+	assert.NoError(t, err, "A token which expired within the clock skew should be accepted")
+	claims = testClaims(now)
+	delete(claims, "exp")
+	_, err = p.Authenticate(ec.sign(t, claims))
+	assert.Error(t, err, "A token without expiration should be rejected")
+	claims = testClaims(now)
+	claims["nbf"] = now.Add(2 * time.Minute).Unix()
+	_, err = p.Authenticate(ec.sign(t, claims))
+	assert.Error(t, err, "A token which is not yet valid should be rejected")
+	claims = testClaims(now)
+	delete(claims, "sub")
+	_, err = p.Authenticate(ec.sign(t, claims))
+	assert.Error(t, err, "A token without an enrollment ID should be rejected")
+	claims = testClaims(now)
+	claims["dept"] = []string{"org1"}
+	_, err = p.Authenticate(ec.sign(t, claims))
+	assert.Error(t, err, "A token whose affiliation is not a string should be rejected")
+
+	parts := strings.Split(ec.sign(t, testClaims(now)), ".")
+	_, err = p.Authenticate(parts[0] + "." + parts[1] + "." + b64(make([]byte, 64)))
+	assert.Error(t, err, "A token with an invalid signature should be rejected")
+	hs, err := json.Marshal(map[string]string{"alg": "HS256", "kid": "k1"})
+	util.FatalError(t, err, "Failed to marshal header")
+	_, err = p.Authenticate(b64(hs) + "." + parts[1] + "." + parts[2])
+	assert.Error(t, err, "A token with a symmetric algorithm should be rejected")
+	_, err = p.Authenticate("a.b")
+	assert.Error(t, err, "A token without 3 parts should be rejected")
+}
+
+func TestKeySetURL(t *testing.T) {
+	ec := newECSigner(t, "k1")
+	keys := []interface{}{ec.jwk(t)}
+	fetches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer ts.Close()
+
+	p, err := NewProvider(&Config{Issuer: testIssuer, Audience: testAudience, JWKSURL: ts.URL, JWKSRefresh: time.Hour}, nil)
+	util.FatalError(t, err, "Failed to create provider")
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	p.keys.now = p.now
+	assert.Equal(t, 0, fetches, "The key set should not be fetched before a token is verified")
+
+	_, err = p.Authenticate(ec.sign(t, testClaims(now)))
+	assert.NoError(t, err)
+	_, err = p.Authenticate(ec.sign(t, testClaims(now)))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fetches, "The key set should be cached")
+
+	// A rotated key is fetched when a token is signed with it, at most
+	// once per minimum interval
+	rotated := newECSigner(t, "k2")
+	keys = append(keys, rotated.jwk(t))
+	_, err = p.Authenticate(rotated.sign(t, testClaims(now)))
+	assert.Error(t, err, "An unknown key should not be fetched again right away")
+	now = now.Add(2 * minFetchInterval)
+	_, err = p.Authenticate(rotated.sign(t, testClaims(now)))
+	assert.NoError(t, err, "A rotated key should be fetched")
+	assert.Equal(t, 2, fetches)
+
+	// The key set is kept if it cannot be fetched again
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	now = now.Add(2 * time.Hour)
+	_, err = p.Authenticate(ec.sign(t, testClaims(now)))
+	assert.NoError(t, err, "The cached key set should be used if it cannot be refreshed")
+	assert.Equal(t, 3, fetches)
+}
+
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oidc")
+	util.FatalError(t, err, "Failed to create temp directory")
+	defer os.RemoveAll(dir)
+	p, err := NewProvider(&Config{Mode: RegistryMode, Issuer: testIssuer, Audience: testAudience, JWKSFile: writeKeySet(t, dir, newECSigner(t, "k1"))}, nil)
+	util.FatalError(t, err, "Failed to create provider")
+	assert.True(t, p.IsRegistry())
+	u, err := p.GetUser("bob", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "bob", u.GetName())
+		assert.Equal(t, "client", u.GetType())
+		assert.Empty(t, u.GetAffiliationPath())
+		attrs, err := u.GetAttributes(nil)
+		assert.NoError(t, err)
+		assert.Empty(t, attrs)
+	}
+	assert.Error(t, p.InsertUser(nil), "Identities cannot be added to the identity provider")
+}
@@ -0,0 +1,363 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oidc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib/server/jose"
+	causer "github.com/hyperledger/fabric-ca/lib/server/user"
+	ctls "github.com/hyperledger/fabric-ca/lib/tls"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultJWKSRefresh is the refresh interval of a configuration which
+	// has none
+	DefaultJWKSRefresh = time.Hour
+	// fetchTimeout is the timeout of a request for the key set of a URL
+	fetchTimeout = 10 * time.Second
+)
+
+// Provider verifies the ID tokens of an OpenID Connect identity provider
+// and maps their claims to identities. In registry mode, it is the identity
+// registry of the CA.
+type Provider struct {
+	mode      string
+	issuer    string
+	audience  string
+	clockSkew time.Duration
+	userType  string
+	idClaim   string
+	affClaim  string
+	attrNames []string
+	attrExprs []*claimExpr
+	attrMaps  map[string]map[string]string
+	keys      *keySet
+	now       func() time.Time
+}
+
+// NewProvider returns the provider of the configuration. The key set of a
+// file is read now; the one of a URL when the first token is verified.
+func NewProvider(cfg *Config, csp bccsp.BCCSP) (*Provider, error) {
+	log.Debugf("Creating new OpenID Connect provider for %+v", cfg)
+	if cfg == nil {
+		return nil, errors.New("OpenID Connect configuration is nil")
+	}
+	p := &Provider{
+		mode:      cfg.Mode,
+		issuer:    cfg.Issuer,
+		audience:  cfg.Audience,
+		clockSkew: cfg.ClockSkew,
+		userType:  cfgVal(cfg.UserType, "client"),
+		idClaim:   cfgVal(cfg.Claims.EnrollmentID, "sub"),
+		affClaim:  cfg.Claims.Affiliation,
+		attrNames: cfg.Attribute.Names,
+		now:       time.Now,
+	}
+	switch p.mode {
+	case "":
+		p.mode = AlongsideMode
+	case AlongsideMode, RegistryMode:
+	default:
+		return nil, errors.Errorf("Invalid OpenID Connect mode '%s'; it must be '%s' or '%s'", cfg.Mode, AlongsideMode, RegistryMode)
+	}
+	if p.issuer == "" {
+		return nil, errors.New("OpenID Connect configuration requires an 'issuer'")
+	}
+	if p.audience == "" {
+		return nil, errors.New("OpenID Connect configuration requires an 'audience'")
+	}
+	if p.clockSkew < 0 {
+		return nil, errors.Errorf("Invalid clock skew %s of ID tokens; it must not be negative", cfg.ClockSkew)
+	}
+	for _, ele := range cfg.Attribute.Converters {
+		ce, err := newClaimExpr(p, ele.Name, ele.Value)
+		if err != nil {
+			return nil, err
+		}
+		p.attrExprs = append(p.attrExprs, ce)
+		log.Debugf("Added OpenID Connect mapping expression for attribute '%s'", ele.Name)
+	}
+	p.attrMaps = map[string]map[string]string{}
+	for mapName, value := range cfg.Attribute.Maps {
+		mapName = strings.ToLower(mapName)
+		p.attrMaps[mapName] = map[string]string{}
+		for _, ele := range value {
+			p.attrMaps[mapName][ele.Name] = ele.Value
+		}
+	}
+	p.keys = &keySet{
+		file:    cfg.JWKSFile,
+		url:     cfg.JWKSURL,
+		refresh: cfg.JWKSRefresh,
+		now:     time.Now,
+	}
+	if p.keys.refresh <= 0 {
+		p.keys.refresh = DefaultJWKSRefresh
+	}
+	switch {
+	case cfg.JWKSFile != "" && cfg.JWKSURL != "":
+		return nil, errors.New("OpenID Connect configuration requires either a 'jwksfile' or a 'jwksurl', not both")
+	case cfg.JWKSFile != "":
+		err := p.keys.load()
+		if err != nil {
+			return nil, err
+		}
+	case cfg.JWKSURL != "":
+		transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+		if len(cfg.TLS.CertFiles) > 0 {
+			tlsConfig, err := ctls.GetClientTLSConfig(&cfg.TLS, csp)
+			if err != nil {
+				return nil, errors.WithMessage(err, "Failed to get TLS configuration of the JSON web key set URL")
+			}
+			transport.TLSClientConfig = tlsConfig
+		}
+		p.keys.client = &http.Client{Timeout: fetchTimeout, Transport: transport}
+	default:
+		return nil, errors.New("OpenID Connect configuration requires a 'jwksfile' or a 'jwksurl'")
+	}
+	log.Debug("OpenID Connect provider was successfully created")
+	return p, nil
+}
+
+func cfgVal(val1, val2 string) string {
+	if val1 != "" {
+		return val1
+	}
+	return val2
+}
+
+// IsRegistry returns true if the provider is the identity registry of the CA
+func (p *Provider) IsRegistry() bool {
+	return p.mode == RegistryMode
+}
+
+// BearerToken returns the token of an authorization header of the bearer
+// scheme (RFC 6750)
+func BearerToken(authHdr string) (string, bool) {
+	const prefix = "bearer "
+	if len(authHdr) <= len(prefix) || !strings.EqualFold(authHdr[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(authHdr[len(prefix):]), true
+}
+
+// Authenticate verifies an ID token and returns the identity of its claims
+func (p *Provider) Authenticate(token string) (causer.User, error) {
+	claims, err := p.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return p.newUser(claims)
+}
+
+// verify verifies the signature, issuer, audience and validity period of a
+// compact serialized ID token and returns its claims
+func (p *Provider) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.Errorf("Invalid ID token; expecting 3 parts but found %d", len(parts))
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid ID token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err = json.Unmarshal(buf, &header)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid ID token header")
+	}
+	// Only asymmetric algorithms are accepted, so that the key set cannot
+	// be used as an HMAC secret
+	switch header.Alg {
+	case "RS256", "ES256", "ES384":
+	default:
+		return nil, errors.Errorf("Unsupported ID token algorithm '%s'", header.Alg)
+	}
+	keys, err := p.keys.lookup(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid ID token signature")
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if jose.Verify(header.Alg, key, signingInput, sig) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("The signature of the ID token is not valid")
+	}
+	buf, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid ID token payload")
+	}
+	claims := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	err = dec.Decode(&claims)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid ID token payload")
+	}
+	err = p.checkClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkClaims checks the registered claims of an ID token (RFC 7519,
+// section 4.1)
+func (p *Provider) checkClaims(claims map[string]interface{}) error {
+	if iss, _ := claims["iss"].(string); iss != p.issuer {
+		return errors.Errorf("The issuer '%s' of the ID token is not '%s'", iss, p.issuer)
+	}
+	if !hasAudience(claims["aud"], p.audience) {
+		return errors.Errorf("The audience of the ID token does not include '%s'", p.audience)
+	}
+	now := p.now()
+	exp, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("The ID token has no expiration time")
+	}
+	if !now.Before(exp.Add(p.clockSkew)) {
+		return errors.Errorf("The ID token expired at %s", exp.UTC().Format(time.RFC3339))
+	}
+	nbf, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(p.clockSkew).Before(nbf) {
+		return errors.Errorf("The ID token is not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+	iat, ok, err := numericDate(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(p.clockSkew).Before(iat) {
+		return errors.Errorf("The ID token was issued in the future at %s", iat.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// hasAudience returns true if the 'aud' claim, which is a string or an
+// array of strings, includes an audience
+func hasAudience(aud interface{}, audience string) bool {
+	switch val := aud.(type) {
+	case string:
+		return val == audience
+	case []interface{}:
+		for _, ele := range val {
+			if s, ok := ele.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// numericDate returns the time of a claim whose value is a number of
+// seconds since the epoch, and false if the claim is not set
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	val, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	num, ok := val.(json.Number)
+	if !ok {
+		return time.Time{}, false, errors.Errorf("The '%s' claim of the ID token is not a number", name)
+	}
+	secs, err := num.Float64()
+	if err != nil {
+		return time.Time{}, false, errors.Wrapf(err, "Invalid '%s' claim of the ID token", name)
+	}
+	return time.Unix(int64(secs), 0), true, nil
+}
+
+// newUser maps the claims of a verified ID token to an identity
+func (p *Provider) newUser(claims map[string]interface{}) (*user, error) {
+	name, _ := claims[p.idClaim].(string)
+	if name == "" {
+		return nil, errors.Errorf("The ID token has no '%s' claim with the enrollment ID", p.idClaim)
+	}
+	u := &user{
+		name:     name,
+		userType: p.userType,
+		attrs:    []api.Attribute{},
+	}
+	if p.affClaim != "" {
+		aff, ok := claims[p.affClaim]
+		if ok {
+			u.affiliation, ok = aff.(string)
+			if !ok {
+				return nil, errors.Errorf("The '%s' claim of the ID token with the affiliation is not a string", p.affClaim)
+			}
+		}
+	}
+	for _, attrName := range p.attrNames {
+		val, ok := claims[attrName]
+		if !ok {
+			continue
+		}
+		u.attrs = append(u.attrs, api.Attribute{Name: attrName, Value: claimString(val, ",")})
+	}
+	for _, expr := range p.attrExprs {
+		val, err := expr.evaluate(u, claims)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "Failed to evaluate OpenID Connect expression for attribute '%s'", expr.attr)
+		}
+		u.attrs = append(u.attrs, api.Attribute{Name: expr.attr, Value: val})
+	}
+	log.Debugf("ID token of '%s' has affiliation '%s' and attributes %+v", u.name, u.affiliation, u.attrs)
+	return u, nil
+}
+
+// claimString returns the value of a claim as a string; the values of an
+// array are separated by a separator
+func claimString(val interface{}, sep string) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case []interface{}:
+		vals := make([]string, 0, len(v))
+		for _, ele := range v {
+			vals = append(vals, claimString(ele, sep))
+		}
+		return strings.Join(vals, sep)
+	case nil:
+		return ""
+	}
+	buf, _ := json.Marshal(val)
+	return string(buf)
+}
@@ -0,0 +1,189 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oidc
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	causer "github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/lib/spi"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var (
+	errNotSupported = errors.New("Not supported")
+)
+
+// GetUser returns the user of an enrollment ID. The identity provider cannot
+// be queried for the claims of a user, so the user has the type of the
+// identities of the ID tokens but no affiliation or attributes; only an ID
+// token authenticated by Authenticate has them.
+func (p *Provider) GetUser(username string, attrNames []string) (causer.User, error) {
+	log.Debugf("Getting OpenID Connect user '%s' without claims", username)
+	return &user{name: username, userType: p.userType, attrs: []api.Attribute{}}, nil
+}
+
+// InsertUser inserts a user
+func (p *Provider) InsertUser(user *causer.Info) error {
+	return errNotSupported
+}
+
+// UpdateUser updates a user
+func (p *Provider) UpdateUser(user *causer.Info, updatePass bool) error {
+	return errNotSupported
+}
+
+// DeleteUser deletes a user
+func (p *Provider) DeleteUser(id string) (causer.User, error) {
+	return nil, errNotSupported
+}
+
+// GetAffiliation returns an affiliation group
+func (p *Provider) GetAffiliation(name string) (spi.Affiliation, error) {
+	return nil, errNotSupported
+}
+
+// GetAllAffiliations gets affiliation and any sub affiliation
+func (p *Provider) GetAllAffiliations(name string) (*sqlx.Rows, error) {
+	return nil, errNotSupported
+}
+
+// InsertAffiliation adds an affiliation group
+func (p *Provider) InsertAffiliation(name string, prekey string, version int) error {
+	return errNotSupported
+}
+
+// DeleteAffiliation deletes an affiliation group
+func (p *Provider) DeleteAffiliation(name string, force, identityRemoval, isRegistrar bool) (*causer.DbTxResult, error) {
+	return nil, errNotSupported
+}
+
+// ModifyAffiliation renames the affiliation and updates all identities to use the new affiliation
+func (p *Provider) ModifyAffiliation(oldAffiliation, newAffiliation string, force, isRegistrar bool) (*causer.DbTxResult, error) {
+	return nil, errNotSupported
+}
+
+// GetUserLessThanLevel returns all identities that are less than the level specified
+func (p *Provider) GetUserLessThanLevel(version int) ([]causer.User, error) {
+	return nil, errNotSupported
+}
+
+// GetFilteredUsers returns all identities that fall under the affiliation and types
+func (p *Provider) GetFilteredUsers(affiliation, types string) (*sqlx.Rows, error) {
+	return nil, errNotSupported
+}
+
+// GetAffiliationTree returns the requested affiliations and all affiliations below it
+func (p *Provider) GetAffiliationTree(name string) (*causer.DbTxResult, error) {
+	return nil, errNotSupported
+}
+
+// A user is the identity of the claims of an ID token
+type user struct {
+	name        string
+	userType    string
+	affiliation string
+	attrs       []api.Attribute
+}
+
+// GetName returns the enrollment ID of the user
+func (u *user) GetName() string {
+	return u.name
+}
+
+// GetType returns the type of the user
+func (u *user) GetType() string {
+	return u.userType
+}
+
+// GetMaxEnrollments returns the max enrollments of the user
+func (u *user) GetMaxEnrollments() int {
+	return 0
+}
+
+// GetLevel returns the level of the user
+func (u *user) GetLevel() int {
+	return 0
+}
+
+// SetLevel sets the level of the user
+func (u *user) SetLevel(level int) error {
+	return errNotSupported
+}
+
+// Login is not supported; a user authenticates with an ID token
+func (u *user) Login(password string, caMaxEnrollment int) error {
+	return errors.Errorf("User '%s' must authenticate with an OpenID Connect ID token", u.name)
+}
+
+// LoginComplete requires no action on OpenID Connect
+func (u *user) LoginComplete() error {
+	return nil
+}
+
+// GetAffiliationPath returns the affiliation path for this user
+func (u *user) GetAffiliationPath() []string {
+	if u.affiliation == "" {
+		return []string{}
+	}
+	return strings.Split(u.affiliation, ".")
+}
+
+// GetAttribute returns the value of an attribute
+func (u *user) GetAttribute(name string) (*api.Attribute, error) {
+	for _, attr := range u.attrs {
+		if attr.Name == name {
+			return &attr, nil
+		}
+	}
+	return nil, errors.Errorf("User does not have attribute '%s'", name)
+}
+
+// GetAttributes returns the requested attributes, or all of them if none
+// are requested
+func (u *user) GetAttributes(attrNames []string) ([]api.Attribute, error) {
+	if attrNames == nil {
+		return u.attrs, nil
+	}
+	attrs := []api.Attribute{}
+	for _, name := range attrNames {
+		attr, err := u.GetAttribute(name)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, *attr)
+	}
+	return attrs, nil
+}
+
+// Revoke is not supported for OpenID Connect
+func (u *user) Revoke() error {
+	return errNotSupported
+}
+
+// IsRevoked is not supported for OpenID Connect
+func (u *user) IsRevoked() bool {
+	return false
+}
+
+// ModifyAttributes adds a new attribute or modifies existing attribute
+func (u *user) ModifyAttributes(attrs []api.Attribute) error {
+	return errNotSupported
+}
+
+// IncrementIncorrectPasswordAttempts is not supported for OpenID Connect
+func (u *user) IncrementIncorrectPasswordAttempts() error {
+	return errNotSupported
+}
+
+// GetFailedLoginAttempts returns the number of failed logins of the user
+func (u *user) GetFailedLoginAttempts() int {
+	return 0
+}
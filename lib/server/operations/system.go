@@ -39,6 +39,9 @@ type System struct {
 	httpServer *http.Server
 	mux        *mux.Router
 	addr       string
+	// rawHandlers are the handlers called ahead of the router, keyed by the
+	// path prefix they are registered for
+	rawHandlers map[string]http.Handler
 }
 
 // Options contains configuration for the operations system
@@ -111,7 +114,7 @@ func (s *System) initializeServer() {
 	s.mux = mux.NewRouter()
 	s.httpServer = &http.Server{
 		Addr:         s.options.ListenAddress,
-		Handler:      s.mux,
+		Handler:      http.HandlerFunc(s.serveHTTP),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 2 * time.Minute,
 	}
@@ -187,6 +190,32 @@ func (s *System) RegisterChecker(component string, checker healthz.HealthChecker
 	return s.healthHandler.RegisterChecker(component, checker)
 }
 
+// RegisterHandler registers the handler for all paths starting with prefix
+func (s *System) RegisterHandler(prefix string, handler http.Handler) {
+	s.mux.PathPrefix(prefix).Handler(handler)
+}
+
+// RegisterRawHandler registers the handler for all paths starting with
+// prefix. Unlike a handler registered with RegisterHandler, it is called
+// ahead of the router and sees the path as sent rather than cleaned.
+func (s *System) RegisterRawHandler(prefix string, handler http.Handler) {
+	if s.rawHandlers == nil {
+		s.rawHandlers = map[string]http.Handler{}
+	}
+	s.rawHandlers[prefix] = handler
+}
+
+func (s *System) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	for prefix, handler := range s.rawHandlers {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
 func (s *System) listen() (net.Listener, error) {
 	listener, err := net.Listen("tcp", s.options.ListenAddress)
 	if err != nil {
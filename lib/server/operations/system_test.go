@@ -79,6 +79,22 @@ var _ = Describe("System", func() {
 		resp.Body.Close()
 	})
 
+	It("passes the path as sent to a raw handler", func() {
+		var path string
+		system.RegisterRawHandler("/raw", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.EscapedPath()
+		}))
+		err := system.Start()
+		Expect(err).NotTo(HaveOccurred())
+
+		rawURL := fmt.Sprintf("https://%s/raw/a//b%%2Bc", system.Addr())
+		resp, err := unauthClient.Get(rawURL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		resp.Body.Close()
+		Expect(path).To(Equal("/raw/a//b%2Bc"))
+	})
+
 	Context("when ClientCertRequired is true", func() {
 		BeforeEach(func() {
 			options.TLS.ClientCertRequired = true
@@ -0,0 +1,30 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package password
+
+// PolicyConfig is the configuration of the policy which the secrets chosen
+// by registrars must follow
+type PolicyConfig struct {
+	MinLength int `def:"0" help:"Minimum number of characters of a secret chosen by a registrar"`
+	// CharClasses is the minimum number of the classes of characters, which
+	// are lowercase letters, uppercase letters, digits and other characters,
+	// that a secret must contain
+	CharClasses int `def:"0" help:"Minimum number of character classes (lowercase, uppercase, digits, others) of a secret chosen by a registrar"`
+	// DenyList are secrets which are not allowed, regardless of their case
+	DenyList []string `help:"A list of comma-separated secrets which are not allowed"`
+	// DenyFile is a file with a secret which is not allowed on each line
+	DenyFile string `help:"File which lists secrets which are not allowed, one per line"`
+}
+
+// HashConfig is the configuration of the hashing of the secrets stored in
+// the users table
+type HashConfig struct {
+	Algorithm string `def:"bcrypt" help:"Algorithm used to hash secrets: 'bcrypt' or 'argon2id'"`
+	// Cost is the cost of bcrypt, or the number of passes of argon2id. The
+	// default is 10 for bcrypt and 3 for argon2id.
+	Cost int `def:"0" help:"Cost of the hash algorithm: the cost of bcrypt or the number of passes of argon2id; 0 uses the default of the algorithm"`
+}
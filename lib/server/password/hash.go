@@ -0,0 +1,168 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hash algorithms
+const (
+	// Bcrypt is the bcrypt algorithm, which is the default
+	Bcrypt = "bcrypt"
+	// Argon2id is the argon2id algorithm
+	Argon2id = "argon2id"
+)
+
+// Parameters of argon2id other than its number of passes
+const (
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+	// argon2DefaultTime is the default number of passes
+	argon2DefaultTime = 3
+)
+
+// argon2Prefix is the prefix of the argon2id hashes, which are encoded as
+// $argon2id$v=19$m=<memory>,t=<passes>,p=<threads>$<salt>$<key> with the
+// salt and key in unpadded base64
+var argon2Prefix = []byte("$argon2id$")
+
+// ErrMismatch is returned when a secret does not match a hash
+var ErrMismatch = errors.New("The hash is not the hash of the given secret")
+
+// Hasher hashes secrets with an algorithm and cost
+type Hasher struct {
+	algorithm string
+	cost      int
+}
+
+// NewHasher returns the hasher of the configuration
+func NewHasher(cfg *HashConfig) (*Hasher, error) {
+	h := &Hasher{algorithm: cfg.Algorithm, cost: cfg.Cost}
+	switch h.algorithm {
+	case "", Bcrypt:
+		h.algorithm = Bcrypt
+		if h.cost == 0 {
+			h.cost = bcrypt.DefaultCost
+		}
+		if h.cost < bcrypt.MinCost || h.cost > bcrypt.MaxCost {
+			return nil, errors.Errorf("Invalid bcrypt cost %d; it must be between %d and %d", h.cost, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case Argon2id:
+		if h.cost == 0 {
+			h.cost = argon2DefaultTime
+		}
+		if h.cost < 1 {
+			return nil, errors.Errorf("Invalid argon2id cost %d; it must be at least 1", h.cost)
+		}
+	default:
+		return nil, errors.Errorf("Unsupported hash algorithm '%s'; it must be '%s' or '%s'", cfg.Algorithm, Bcrypt, Argon2id)
+	}
+	return h, nil
+}
+
+// Hash returns the hash of a secret
+func (h *Hasher) Hash(secret []byte) ([]byte, error) {
+	if h.algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword(secret, h.cost)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to hash password")
+		}
+		return hash, nil
+	}
+	salt := make([]byte, argon2SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to generate salt")
+	}
+	key := argon2.IDKey(secret, salt, uint32(h.cost), argon2Memory, argon2Threads, argon2KeyLen)
+	return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, h.cost, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+// NeedsRehash returns true if a hash was not made with the algorithm and
+// cost of the hasher, so that the secret should be hashed again
+func (h *Hasher) NeedsRehash(hash []byte) bool {
+	if bytes.HasPrefix(hash, argon2Prefix) {
+		p, err := parseArgon2(hash)
+		return err != nil || h.algorithm != Argon2id || p.time != uint32(h.cost) ||
+			p.memory != argon2Memory || p.threads != argon2Threads || len(p.key) != argon2KeyLen
+	}
+	if h.algorithm != Bcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != h.cost
+}
+
+// Compare returns nil if a secret matches a hash made with any of the
+// supported algorithms, or ErrMismatch if it does not
+func Compare(hash, secret []byte) error {
+	if !bytes.HasPrefix(hash, argon2Prefix) {
+		err := bcrypt.CompareHashAndPassword(hash, secret)
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return ErrMismatch
+		}
+		return err
+	}
+	p, err := parseArgon2(hash)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey(secret, p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// argon2Params are the parameters, salt and key of an argon2id hash
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseArgon2(hash []byte) (*argon2Params, error) {
+	var version int
+	var salt, key string
+	p := &argon2Params{}
+	fields := bytes.Split(hash, []byte("$"))
+	if len(fields) != 6 {
+		return nil, errors.New("Invalid argon2id hash")
+	}
+	_, err := fmt.Sscanf(string(fields[2]), "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, errors.New("Unsupported version of argon2id hash")
+	}
+	_, err = fmt.Sscanf(string(fields[3]), "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid parameters of argon2id hash")
+	}
+	salt, key = string(fields[4]), string(fields[5])
+	p.salt, err = base64.RawStdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid salt of argon2id hash")
+	}
+	p.key, err = base64.RawStdEncoding.DecodeString(key)
+	if err != nil || len(p.key) == 0 {
+		return nil, errors.New("Invalid key of argon2id hash")
+	}
+	return p, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package password
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "password")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "denylist")
+	err = ioutil.WriteFile(file, []byte("# common secrets\nPassword1!\n\n  Letmein123$  \n  # Indented-comment-1\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write deny list file: %s", err)
+	}
+
+	p, err := NewPolicy(&PolicyConfig{MinLength: 8, CharClasses: 3, DenyList: []string{"Qwerty123"}, DenyFile: file})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, p.MinLength())
+	assert.NoError(t, p.Check("Secure-pw-42"))
+	assert.Error(t, p.Check("Short1!"), "Secret shorter than the minimum length should fail")
+	assert.Error(t, p.Check("lowercaseonly"), "Secret with too few character classes should fail")
+	assert.Error(t, p.Check("qwerty123"), "Secret on the deny list should fail regardless of case")
+	assert.Error(t, p.Check("password1!"), "Secret in the deny list file should fail")
+	assert.Error(t, p.Check("LETMEIN123$"), "Secret in the deny list file should fail")
+	// The comments of the deny list file, indented or not, are not denied
+	assert.Len(t, p.denied, 3)
+	assert.False(t, p.denied["# common secrets"])
+	assert.False(t, p.denied["# indented-comment-1"])
+	assert.NoError(t, p.Check("# Indented-comment-1"), "Comments of the deny list file are not secrets")
+
+	var nilPolicy *Policy
+	assert.NoError(t, nilPolicy.Check(""))
+	assert.Equal(t, 0, nilPolicy.MinLength())
+
+	_, err = NewPolicy(&PolicyConfig{MinLength: -1})
+	assert.Error(t, err)
+	_, err = NewPolicy(&PolicyConfig{CharClasses: 5})
+	assert.Error(t, err)
+	_, err = NewPolicy(&PolicyConfig{DenyFile: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+func TestHasher(t *testing.T) {
+	secret := []byte("secret")
+
+	_, err := NewHasher(&HashConfig{Algorithm: "md5"})
+	assert.Error(t, err)
+	_, err = NewHasher(&HashConfig{Algorithm: Bcrypt, Cost: 3})
+	assert.Error(t, err)
+	_, err = NewHasher(&HashConfig{Algorithm: Argon2id, Cost: -1})
+	assert.Error(t, err)
+
+	bh, err := NewHasher(&HashConfig{})
+	assert.NoError(t, err)
+	bhash, err := bh.Hash(secret)
+	assert.NoError(t, err)
+	cost, err := bcrypt.Cost(bhash)
+	assert.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+	assert.NoError(t, Compare(bhash, secret))
+	assert.Equal(t, ErrMismatch, Compare(bhash, []byte("wrong")))
+	assert.False(t, bh.NeedsRehash(bhash))
+
+	ah, err := NewHasher(&HashConfig{Algorithm: Argon2id, Cost: 1})
+	assert.NoError(t, err)
+	ahash, err := ah.Hash(secret)
+	assert.NoError(t, err)
+	assert.Contains(t, string(ahash), "$argon2id$v=19$m=65536,t=1,p=4$")
+	assert.NoError(t, Compare(ahash, secret))
+	assert.Equal(t, ErrMismatch, Compare(ahash, []byte("wrong")))
+	assert.False(t, ah.NeedsRehash(ahash))
+
+	// A change of algorithm or cost requires the hashes to be upgraded
+	assert.True(t, ah.NeedsRehash(bhash))
+	assert.True(t, bh.NeedsRehash(ahash))
+	ah2, err := NewHasher(&HashConfig{Algorithm: Argon2id, Cost: 2})
+	assert.NoError(t, err)
+	assert.True(t, ah2.NeedsRehash(ahash))
+	bh2, err := NewHasher(&HashConfig{Algorithm: Bcrypt, Cost: 4})
+	assert.NoError(t, err)
+	assert.True(t, bh2.NeedsRehash(bhash))
+
+	_, err = parseArgon2([]byte("$argon2id$v=19$m=65536"))
+	assert.Error(t, err)
+	assert.Error(t, Compare([]byte("$argon2id$v=18$m=65536,t=1,p=4$c2FsdA$a2V5"), secret))
+}
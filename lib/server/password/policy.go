@@ -0,0 +1,114 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package password
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Policy checks the secrets chosen by registrars against a password policy
+type Policy struct {
+	minLength   int
+	charClasses int
+	denied      map[string]bool
+}
+
+// NewPolicy returns the policy of the configuration, loading its deny list
+// file if it has one
+func NewPolicy(cfg *PolicyConfig) (*Policy, error) {
+	if cfg.MinLength < 0 {
+		return nil, errors.Errorf("Invalid minimum length %d of the password policy", cfg.MinLength)
+	}
+	if cfg.CharClasses < 0 || cfg.CharClasses > 4 {
+		return nil, errors.Errorf("Invalid number of character classes %d of the password policy; it must be between 0 and 4", cfg.CharClasses)
+	}
+	p := &Policy{
+		minLength:   cfg.MinLength,
+		charClasses: cfg.CharClasses,
+		denied:      map[string]bool{},
+	}
+	for _, secret := range cfg.DenyList {
+		p.deny(secret)
+	}
+	if cfg.DenyFile != "" {
+		f, err := os.Open(cfg.DenyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to open the deny list file of the password policy")
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			p.deny(line)
+		}
+		err = scanner.Err()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read the deny list file '%s' of the password policy", cfg.DenyFile)
+		}
+	}
+	return p, nil
+}
+
+func (p *Policy) deny(secret string) {
+	secret = strings.TrimSpace(secret)
+	if secret != "" {
+		p.denied[strings.ToLower(secret)] = true
+	}
+}
+
+// Check returns an error which tells why the secret does not follow the
+// policy, if it does not
+func (p *Policy) Check(secret string) error {
+	if p == nil {
+		return nil
+	}
+	length := len([]rune(secret))
+	if length < p.minLength {
+		return errors.Errorf("The secret must have at least %d characters, but has %d", p.minLength, length)
+	}
+	if classes := charClasses(secret); classes < p.charClasses {
+		return errors.Errorf("The secret must contain at least %d of lowercase letters, uppercase letters, digits and other characters, but contains %d", p.charClasses, classes)
+	}
+	if p.denied[strings.ToLower(strings.TrimSpace(secret))] {
+		return errors.New("The secret is not allowed because it is on the deny list")
+	}
+	return nil
+}
+
+// MinLength returns the minimum length of a secret
+func (p *Policy) MinLength() int {
+	if p == nil {
+		return 0
+	}
+	return p.minLength
+}
+
+// charClasses returns the number of classes of the characters of a secret
+func charClasses(secret string) int {
+	var lower, upper, digit, other int
+	for _, r := range secret {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
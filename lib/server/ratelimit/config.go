@@ -0,0 +1,40 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ratelimit
+
+// Config is the configuration of the rate limits of the API endpoints
+type Config struct {
+	Enabled bool `def:"false" help:"Limit the rate of requests to the API endpoints"`
+	// Identity limits the requests of each enrollment ID of each CA
+	Identity IdentityLimit
+	// IP limits the requests from each client IP address
+	IP IPLimit
+	// Endpoints limit the requests to an endpoint from all clients
+	Endpoints []EndpointLimit
+}
+
+// IdentityLimit is the limit of the requests of an enrollment ID
+type IdentityLimit struct {
+	Rate  int `def:"600" help:"Number of requests per minute allowed for an enrollment ID; 0 disables the limit"`
+	Burst int `def:"100" help:"Number of requests an enrollment ID can make at once"`
+}
+
+// IPLimit is the limit of the requests from a client IP address
+type IPLimit struct {
+	Rate  int `def:"1200" help:"Number of requests per minute allowed from a client IP address; 0 disables the limit"`
+	Burst int `def:"200" help:"Number of requests a client IP address can make at once"`
+}
+
+// EndpointLimit is the limit of the requests to an endpoint
+type EndpointLimit struct {
+	// Name is the name of the endpoint, such as 'enroll' or 'identities'
+	Name string
+	// Rate is the number of requests per minute allowed
+	Rate int
+	// Burst is the number of requests allowed at once
+	Burst int
+}
@@ -0,0 +1,184 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Kinds of limits, which are reported when a request is limited
+const (
+	// Identity is the limit of an enrollment ID
+	Identity = "identity"
+	// IP is the limit of a client IP address
+	IP = "ip"
+	// Endpoint is the limit of an endpoint
+	Endpoint = "endpoint"
+)
+
+// sweepInterval is how often the buckets of the clients which have been
+// idle long enough to be full again are removed
+const sweepInterval = time.Minute
+
+// bucket is a token bucket which holds up to burst tokens and is refilled
+// at rate tokens per second; each request takes a token
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(perMinute, burst int, now time.Time) *bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{
+		rate:   float64(perMinute) / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// check returns true if there is a token, without taking it. Otherwise, it
+// returns how long the request should wait until there is one.
+func (b *bucket) check(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take takes a token if there is one. Otherwise, it returns how long the
+// request should wait until there is one.
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	ok, wait := b.check(now)
+	if ok {
+		b.tokens--
+	}
+	return ok, wait
+}
+
+// buckets are the buckets of the clients which share a limit
+type buckets struct {
+	rate    int
+	burst   int
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func newBuckets(rate, burst int) *buckets {
+	return &buckets{rate: rate, burst: burst, buckets: map[string]*bucket{}}
+}
+
+// get returns the bucket of the client, or nil if there is no limit
+func (bs *buckets) get(key string, now time.Time) *bucket {
+	if bs == nil {
+		return nil
+	}
+	if now.Sub(bs.swept) > sweepInterval {
+		// A full bucket is the same as a new one, so it can be removed
+		for k, b := range bs.buckets {
+			b.refill(now)
+			if b.tokens >= b.burst {
+				delete(bs.buckets, k)
+			}
+		}
+		bs.swept = now
+	}
+	b := bs.buckets[key]
+	if b == nil {
+		b = newBucket(bs.rate, bs.burst, now)
+		bs.buckets[key] = b
+	}
+	return b
+}
+
+func (bs *buckets) take(key string, now time.Time) (bool, time.Duration) {
+	b := bs.get(key, now)
+	if b == nil {
+		return true, 0
+	}
+	return b.take(now)
+}
+
+// Limiter limits the rate of requests per enrollment ID, per client IP
+// address and per endpoint with token buckets
+type Limiter struct {
+	identities *buckets
+	ips        *buckets
+	endpoints  map[string]*bucket
+	mutex      sync.Mutex
+	// now returns the current time; it is only changed by tests
+	now func() time.Time
+}
+
+// New returns a limiter for the configuration
+func New(cfg *Config) *Limiter {
+	l := &Limiter{endpoints: map[string]*bucket{}, now: time.Now}
+	if cfg.Identity.Rate > 0 {
+		l.identities = newBuckets(cfg.Identity.Rate, cfg.Identity.Burst)
+	}
+	if cfg.IP.Rate > 0 {
+		l.ips = newBuckets(cfg.IP.Rate, cfg.IP.Burst)
+	}
+	for _, e := range cfg.Endpoints {
+		if e.Rate > 0 {
+			l.endpoints[e.Name] = newBucket(e.Rate, e.Burst, l.now())
+		}
+	}
+	return l
+}
+
+// AllowRequest returns true if a request from the client IP address to the
+// endpoint is allowed. Otherwise, it returns the kind of limit which was
+// exceeded and how long the client should wait before it retries.
+// A token is taken from either bucket only if both allow the request.
+func (l *Limiter) AllowRequest(ip, endpoint string) (bool, string, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	ipBucket := l.ips.get(ip, now)
+	if ipBucket != nil {
+		if ok, wait := ipBucket.check(now); !ok {
+			return false, IP, wait
+		}
+	}
+	endpointBucket := l.endpoints[endpoint]
+	if endpointBucket != nil {
+		if ok, wait := endpointBucket.check(now); !ok {
+			return false, Endpoint, wait
+		}
+	}
+	if ipBucket != nil {
+		ipBucket.tokens--
+	}
+	if endpointBucket != nil {
+		endpointBucket.tokens--
+	}
+	return true, "", 0
+}
+
+// AllowIdentity returns true if a request of the authenticated enrollment ID
+// of a CA is allowed. Otherwise, it returns how long the client should wait
+// before it retries.
+func (l *Limiter) AllowIdentity(caName, id string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.identities.take(caName+"/"+id, l.now())
+}
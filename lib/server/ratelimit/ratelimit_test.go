@@ -0,0 +1,100 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := New(&Config{
+		Enabled:   true,
+		Identity:  IdentityLimit{Rate: 60, Burst: 2},
+		IP:        IPLimit{Rate: 120, Burst: 3},
+		Endpoints: []EndpointLimit{{Name: "register", Rate: 6, Burst: 1}},
+	})
+	l.now = func() time.Time { return now }
+
+	// An identity can make a burst of requests and then one per second
+	for i := 0; i < 2; i++ {
+		ok, _ := l.AllowIdentity("ca1", "user1")
+		assert.True(t, ok, "Request %d of the burst should be allowed", i+1)
+	}
+	ok, wait := l.AllowIdentity("ca1", "user1")
+	assert.False(t, ok, "Request after the burst should be limited")
+	assert.Equal(t, time.Second, wait)
+	ok, _ = l.AllowIdentity("ca2", "user1")
+	assert.True(t, ok, "The same enrollment ID of another CA has its own limit")
+	now = now.Add(time.Second)
+	ok, _ = l.AllowIdentity("ca1", "user1")
+	assert.True(t, ok, "Request should be allowed after the wait")
+
+	// The endpoint limit applies to all clients
+	ok, _, _ = l.AllowRequest("10.0.0.1", "register")
+	assert.True(t, ok)
+	ok, kind, wait := l.AllowRequest("10.0.0.2", "register")
+	assert.False(t, ok, "Second request to the endpoint should be limited")
+	assert.Equal(t, Endpoint, kind)
+	assert.Equal(t, 10*time.Second, wait)
+
+	// The IP limit applies to all endpoints
+	ok, _, _ = l.AllowRequest("10.0.0.1", "enroll")
+	assert.True(t, ok)
+	ok, _, _ = l.AllowRequest("10.0.0.1", "enroll")
+	assert.True(t, ok)
+	ok, kind, _ = l.AllowRequest("10.0.0.1", "enroll")
+	assert.False(t, ok, "Request after the burst of the IP address should be limited")
+	assert.Equal(t, IP, kind)
+	ok, _, _ = l.AllowRequest("10.0.0.3", "enroll")
+	assert.True(t, ok, "Another IP address has its own limit")
+
+	// Idle clients are removed once their buckets are full again
+	now = now.Add(2 * sweepInterval)
+	ok, _, _ = l.AllowRequest("10.0.0.4", "enroll")
+	assert.True(t, ok)
+	assert.Len(t, l.ips.buckets, 1)
+}
+
+func TestLimitedRequestTakesNoToken(t *testing.T) {
+	now := time.Now()
+	l := New(&Config{
+		Enabled:   true,
+		IP:        IPLimit{Rate: 1, Burst: 1},
+		Endpoints: []EndpointLimit{{Name: "register", Rate: 1, Burst: 1}},
+	})
+	l.now = func() time.Time { return now }
+
+	// A request limited by its IP address takes no token from the endpoint
+	ok, _, _ := l.AllowRequest("10.0.0.1", "enroll")
+	assert.True(t, ok)
+	ok, kind, _ := l.AllowRequest("10.0.0.1", "register")
+	assert.False(t, ok)
+	assert.Equal(t, IP, kind)
+	ok, _, _ = l.AllowRequest("10.0.0.2", "register")
+	assert.True(t, ok, "The endpoint should still have a token")
+
+	// A request limited by the endpoint takes no token from its IP address
+	ok, kind, _ = l.AllowRequest("10.0.0.3", "register")
+	assert.False(t, ok)
+	assert.Equal(t, Endpoint, kind)
+	ok, _, _ = l.AllowRequest("10.0.0.3", "enroll")
+	assert.True(t, ok, "The IP address should still have a token")
+}
+
+func TestDisabledLimits(t *testing.T) {
+	l := New(&Config{Enabled: true})
+	for i := 0; i < 1000; i++ {
+		ok, _, _ := l.AllowRequest("10.0.0.1", "enroll")
+		assert.True(t, ok)
+		ok, _ = l.AllowIdentity("ca1", "user1")
+		assert.True(t, ok)
+	}
+}
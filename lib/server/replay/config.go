@@ -0,0 +1,29 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package replay
+
+import "time"
+
+// Stores of the nonces of authorization tokens
+const (
+	// DBStore keeps the nonces in the token_nonces table of the CA's
+	// database, so that the servers of a cluster share them
+	DBStore = "db"
+	// MemoryStore keeps the nonces in the memory of the server
+	MemoryStore = "memory"
+)
+
+// Config is the configuration of the replay protection of the x509
+// authorization tokens
+type Config struct {
+	// ClockSkew is the maximum difference between the time at which a
+	// token was created and the time of the server
+	ClockSkew time.Duration `def:"5m" help:"Maximum difference between the time of an authorization token and the time of the server"`
+	// NonceStore is where the nonces of the tokens are remembered until the
+	// tokens expire
+	NonceStore string `def:"db" help:"Where the nonces of authorization tokens are remembered: 'db' to share them through the CA's database, or 'memory'"`
+}
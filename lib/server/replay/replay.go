@@ -0,0 +1,174 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package replay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// InsertNonce is the SQL for remembering the nonce of a token
+	InsertNonce = "INSERT INTO token_nonces (nonce, expiry) VALUES (?, ?)"
+	// CountNonce is the SQL for checking if the nonce of a token is remembered
+	CountNonce = "SELECT COUNT(*) FROM token_nonces WHERE (nonce = ?)"
+	// RemoveExpiredNonces is the SQL for forgetting the nonces of expired tokens
+	RemoveExpiredNonces = "DELETE FROM token_nonces WHERE (expiry < ?)"
+)
+
+// DefaultClockSkew is the clock skew of a configuration which has none
+const DefaultClockSkew = 5 * time.Minute
+
+// ErrReplayed is returned when the nonce of a token was already used
+var ErrReplayed = errors.New("The authorization token was already used")
+
+// Store remembers the nonces of tokens until the tokens expire
+type Store interface {
+	// Add remembers a nonce until its expiry; it returns false if the
+	// nonce is already remembered
+	Add(nonce string, expiry time.Time) (bool, error)
+	// Sweep forgets the nonces which expired before a time
+	Sweep(now time.Time) error
+}
+
+// Guard rejects the tokens which were not created within the clock skew
+// of the time of the server, and the tokens whose nonce was already used
+type Guard struct {
+	clockSkew time.Duration
+	store     Store
+	now       func() time.Time
+	mutex     sync.Mutex
+	lastSweep time.Time
+}
+
+// NewGuard returns the guard of the configuration; the nonces are stored
+// in the database of the CA unless the configuration keeps them in memory
+func NewGuard(cfg *Config, caDB db.FabricCADB) (*Guard, error) {
+	if cfg.ClockSkew < 0 {
+		return nil, errors.Errorf("Invalid clock skew %s of authorization tokens; it must not be negative", cfg.ClockSkew)
+	}
+	g := &Guard{
+		clockSkew: cfg.ClockSkew,
+		now:       time.Now,
+	}
+	if g.clockSkew == 0 {
+		g.clockSkew = DefaultClockSkew
+	}
+	switch cfg.NonceStore {
+	case "", DBStore:
+		if caDB == nil {
+			return nil, errors.New("The database store of the nonces of authorization tokens requires a database")
+		}
+		g.store = &dbStore{db: caDB}
+	case MemoryStore:
+		g.store = newMemoryStore()
+	default:
+		return nil, errors.Errorf("Invalid store '%s' of the nonces of authorization tokens; it must be '%s' or '%s'", cfg.NonceStore, DBStore, MemoryStore)
+	}
+	return g, nil
+}
+
+// Check returns an error if a token created at a time is outside the clock
+// skew window, or if its nonce was already used. Otherwise, the nonce is
+// remembered until the token expires.
+func (g *Guard) Check(created time.Time, nonce string) error {
+	now := g.now()
+	if created.Before(now.Add(-g.clockSkew)) || created.After(now.Add(g.clockSkew)) {
+		return errors.Errorf("The time %s of the authorization token is not within %s of the time of the server",
+			created.UTC().Format(time.RFC3339), g.clockSkew)
+	}
+	if nonce == "" {
+		return errors.New("The authorization token has no nonce")
+	}
+	g.sweep(now)
+	added, err := g.store.Add(nonce, created.Add(g.clockSkew).UTC())
+	if err != nil {
+		return err
+	}
+	if !added {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// sweep forgets the expired nonces at most once per clock skew
+func (g *Guard) sweep(now time.Time) {
+	g.mutex.Lock()
+	if now.Sub(g.lastSweep) < g.clockSkew {
+		g.mutex.Unlock()
+		return
+	}
+	g.lastSweep = now
+	g.mutex.Unlock()
+	err := g.store.Sweep(now.UTC())
+	if err != nil {
+		log.Warningf("Failed to remove the expired nonces of authorization tokens: %s", err)
+	}
+}
+
+// dbStore keeps the nonces in the token_nonces table of the CA's database
+type dbStore struct {
+	db db.FabricCADB
+}
+
+func (s *dbStore) Add(nonce string, expiry time.Time) (bool, error) {
+	_, err := s.db.Exec("InsertTokenNonce", s.db.Rebind(InsertNonce), nonce, expiry)
+	if err == nil {
+		return true, nil
+	}
+	// The insert fails if another request, possibly to another server of
+	// the cluster, already used the nonce
+	var count int
+	err2 := s.db.Get("GetTokenNonce", &count, s.db.Rebind(CountNonce), nonce)
+	if err2 == nil && count > 0 {
+		return false, nil
+	}
+	return false, errors.Wrap(err, "Failed to store the nonce of the authorization token")
+}
+
+func (s *dbStore) Sweep(now time.Time) error {
+	_, err := s.db.Exec("RemoveExpiredTokenNonces", s.db.Rebind(RemoveExpiredNonces), now)
+	if err != nil {
+		return errors.Wrap(err, "Failed to remove expired token nonces from the database")
+	}
+	return nil
+}
+
+// memoryStore keeps the nonces in memory
+type memoryStore struct {
+	mutex  sync.Mutex
+	nonces map[string]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{nonces: map[string]time.Time{}}
+}
+
+func (s *memoryStore) Add(nonce string, expiry time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.nonces[nonce]; ok {
+		return false, nil
+	}
+	s.nonces[nonce] = expiry
+	return true, nil
+}
+
+func (s *memoryStore) Sweep(now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for nonce, expiry := range s.nonces {
+		if expiry.Before(now) {
+			delete(s.nonces, nonce)
+		}
+	}
+	return nil
+}
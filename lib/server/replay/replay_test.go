@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package replay
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/lib/server/db/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDB(t *testing.T, dir string) *db.DB {
+	sqliteDB := sqlite.NewDB(filepath.Join(dir, "replay.db"), "", nil)
+	err := sqliteDB.Connect()
+	util.FatalError(t, err, "Failed to connect to database")
+	testDB, err := sqliteDB.Create()
+	util.FatalError(t, err, "Failed to create database")
+	return testDB
+}
+
+func countNonces(t *testing.T, testDB *db.DB) int {
+	var n int
+	err := testDB.Get("CountTokenNonces", &n, "SELECT COUNT(*) FROM token_nonces")
+	util.FatalError(t, err, "Failed to count token nonces")
+	return n
+}
+
+func TestNewGuard(t *testing.T) {
+	_, err := NewGuard(&Config{ClockSkew: -time.Minute, NonceStore: MemoryStore}, nil)
+	assert.Error(t, err, "Negative clock skew should fail")
+	_, err = NewGuard(&Config{ClockSkew: time.Minute, NonceStore: "redis"}, nil)
+	assert.Error(t, err, "Unknown nonce store should fail")
+	_, err = NewGuard(&Config{ClockSkew: time.Minute, NonceStore: DBStore}, nil)
+	assert.Error(t, err, "Database store without a database should fail")
+	g, err := NewGuard(&Config{NonceStore: MemoryStore}, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, DefaultClockSkew, g.clockSkew)
+	}
+}
+
+func TestMemoryGuard(t *testing.T) {
+	g, err := NewGuard(&Config{ClockSkew: time.Minute, NonceStore: MemoryStore}, nil)
+	util.FatalError(t, err, "Failed to create guard")
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	assert.NoError(t, g.Check(now, "nonce1"))
+	assert.Equal(t, ErrReplayed, g.Check(now, "nonce1"), "A used nonce should be rejected")
+	assert.NoError(t, g.Check(now.Add(-50*time.Second), "nonce2"))
+	assert.NoError(t, g.Check(now.Add(50*time.Second), "nonce3"))
+	assert.Error(t, g.Check(now.Add(-2*time.Minute), "nonce4"), "An old token should be rejected")
+	assert.Error(t, g.Check(now.Add(2*time.Minute), "nonce5"), "A token from the future should be rejected")
+	assert.Error(t, g.Check(now, ""), "A token without a nonce should be rejected")
+
+	// The nonces are forgotten once their tokens expired
+	now = now.Add(3 * time.Minute)
+	assert.NoError(t, g.Check(now, "nonce6"))
+	assert.Len(t, g.store.(*memoryStore).nonces, 1)
+}
+
+func TestDBGuard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	util.FatalError(t, err, "Failed to create temp directory")
+	defer os.RemoveAll(dir)
+	testDB := newTestDB(t, dir)
+	defer testDB.Close()
+
+	// Two guards on the same database act as two servers of a cluster
+	cfg := &Config{ClockSkew: time.Minute, NonceStore: DBStore}
+	g1, err := NewGuard(cfg, testDB)
+	util.FatalError(t, err, "Failed to create guard")
+	g2, err := NewGuard(cfg, testDB)
+	util.FatalError(t, err, "Failed to create guard")
+	now := time.Now()
+	g1.now = func() time.Time { return now }
+	g2.now = g1.now
+
+	assert.NoError(t, g1.Check(now, "nonce1"))
+	assert.Equal(t, ErrReplayed, g1.Check(now, "nonce1"), "A used nonce should be rejected")
+	assert.Equal(t, ErrReplayed, g2.Check(now, "nonce1"), "A nonce used with another server should be rejected")
+	assert.NoError(t, g2.Check(now, "nonce2"))
+	assert.Equal(t, 2, countNonces(t, testDB))
+
+	now = now.Add(3 * time.Minute)
+	assert.NoError(t, g1.Check(now, "nonce3"))
+	assert.Equal(t, 1, countNonces(t, testDB), "Expired nonces should be removed")
+}
@@ -0,0 +1,140 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package role
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/pkg/errors"
+)
+
+// membershipAttr is the attribute which lists the roles of an identity
+const membershipAttr = "hf.Roles"
+
+// ValidateName returns an error if a role name is not valid; a name cannot
+// be empty or hold commas or spaces, since the roles of an identity are a
+// comma-separated list
+func ValidateName(name string) error {
+	if name == "" {
+		return errors.New("Role name is empty")
+	}
+	if strings.IndexFunc(name, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) >= 0 {
+		return errors.Errorf("Role name '%s' cannot contain commas or spaces", name)
+	}
+	return nil
+}
+
+// ValidateAttributes returns an error if the attributes of a role are not
+// valid. Each attribute must have a name and a value, appear once, and not
+// be the attribute which lists the roles of an identity.
+func ValidateAttributes(attrs []api.Attribute) error {
+	seen := map[string]bool{}
+	for _, a := range attrs {
+		if a.Name == "" {
+			return errors.New("Role attribute has no name")
+		}
+		if a.Name == membershipAttr {
+			return errors.Errorf("A role cannot give the attribute '%s'", membershipAttr)
+		}
+		if a.Value == "" {
+			return errors.Errorf("Role attribute '%s' has no value", a.Name)
+		}
+		if seen[a.Name] {
+			return errors.Errorf("Role attribute '%s' appears more than once", a.Name)
+		}
+		seen[a.Name] = true
+	}
+	return nil
+}
+
+// Names returns the roles of a comma-separated list, such as the value of
+// the attribute which lists the roles of an identity
+func Names(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Bundle returns the attributes which a set of roles give an identity. An
+// error is returned if a role is not defined, or if two roles give the same
+// attribute different values.
+func Bundle(names []string, defs map[string][]api.Attribute) ([]api.Attribute, error) {
+	var bundle []api.Attribute
+	index := map[string]int{}
+	from := map[string]string{}
+	for _, name := range names {
+		attrs, ok := defs[name]
+		if !ok {
+			return nil, errors.Errorf("Role '%s' does not exist", name)
+		}
+		for _, a := range attrs {
+			i, found := index[a.Name]
+			if !found {
+				index[a.Name] = len(bundle)
+				from[a.Name] = name
+				bundle = append(bundle, a)
+				continue
+			}
+			if bundle[i].Value != a.Value || bundle[i].ECert != a.ECert {
+				return nil, errors.Errorf("Roles '%s' and '%s' give attribute '%s' different values", from[a.Name], name, a.Name)
+			}
+		}
+	}
+	return bundle, nil
+}
+
+// Changes returns the changes to the attributes of an identity, attrs,
+// whose roles gave it the attributes prev and now give it the attributes
+// next. The attributes which only prev has are removed, with an empty value,
+// and those of next which the identity does not have are set. The attributes
+// named in skip are left as they are.
+func Changes(attrs, prev, next []api.Attribute, skip []string) []api.Attribute {
+	var changes []api.Attribute
+	for _, a := range prev {
+		if contains(skip, a.Name) || find(next, a.Name) != nil || find(attrs, a.Name) == nil {
+			continue
+		}
+		changes = append(changes, api.Attribute{Name: a.Name, Value: ""})
+	}
+	for _, a := range next {
+		if contains(skip, a.Name) {
+			continue
+		}
+		cur := find(attrs, a.Name)
+		if cur != nil && cur.Value == a.Value && cur.ECert == a.ECert {
+			continue
+		}
+		changes = append(changes, a)
+	}
+	return changes
+}
+
+// find returns the attribute with a name, or nil
+func find(attrs []api.Attribute, name string) *api.Attribute {
+	for i := range attrs {
+		if attrs[i].Name == name {
+			return &attrs[i]
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
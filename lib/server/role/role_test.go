@@ -0,0 +1,65 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package role
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, ValidateName("auditor"))
+	for _, name := range []string{"", "a,b", "a b"} {
+		assert.Error(t, ValidateName(name), "Role name '%s' should not be valid", name)
+	}
+
+	assert.NoError(t, ValidateAttributes([]api.Attribute{{Name: "a", Value: "1"}, {Name: "b", Value: "2", ECert: true}}))
+	invalid := [][]api.Attribute{
+		{{Value: "1"}},
+		{{Name: "a"}},
+		{{Name: "a", Value: "1"}, {Name: "a", Value: "2"}},
+		{{Name: "hf.Roles", Value: "other"}},
+	}
+	for _, attrs := range invalid {
+		assert.Error(t, ValidateAttributes(attrs), "Attributes %+v should not be valid", attrs)
+	}
+}
+
+func TestNames(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, Names(" a, b,a,,"))
+	assert.Nil(t, Names(""))
+}
+
+func TestBundle(t *testing.T) {
+	defs := map[string][]api.Attribute{
+		"r1": {{Name: "a", Value: "1"}, {Name: "b", Value: "2"}},
+		"r2": {{Name: "b", Value: "2"}, {Name: "c", Value: "3"}},
+		"r3": {{Name: "a", Value: "4"}},
+	}
+	bundle, err := Bundle([]string{"r1", "r2"}, defs)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []api.Attribute{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "c", Value: "3"}}, bundle)
+	}
+	_, err = Bundle([]string{"r1", "r3"}, defs)
+	assert.Error(t, err, "Roles which give an attribute different values should fail")
+	_, err = Bundle([]string{"r4"}, defs)
+	assert.Error(t, err, "A role which does not exist should fail")
+}
+
+func TestChanges(t *testing.T) {
+	attrs := []api.Attribute{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "d", Value: "5"}}
+	prev := []api.Attribute{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "e", Value: "6"}}
+	next := []api.Attribute{{Name: "a", Value: "1"}, {Name: "c", Value: "3"}, {Name: "d", Value: "4"}}
+
+	changes := Changes(attrs, prev, next, nil)
+	assert.Equal(t, []api.Attribute{{Name: "b"}, {Name: "c", Value: "3"}, {Name: "d", Value: "4"}}, changes)
+
+	changes = Changes(attrs, prev, next, []string{"b", "d"})
+	assert.Equal(t, []api.Attribute{{Name: "c", Value: "3"}}, changes)
+}
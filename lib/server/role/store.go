@@ -0,0 +1,119 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package role
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/pkg/errors"
+)
+
+const (
+	// InsertRole is the SQL for adding a role
+	InsertRole = "INSERT INTO roles (name, attributes, updated_at) VALUES (:name, :attributes, :updated_at)"
+	// SelectRole is the SQL for getting a role
+	SelectRole = "SELECT * FROM roles WHERE (name = ?)"
+	// SelectRoles is the SQL for getting all the roles
+	SelectRoles = "SELECT * FROM roles ORDER BY name"
+	// UpdateRole is the SQL for changing the attributes of a role
+	UpdateRole = "UPDATE roles SET attributes = :attributes, updated_at = :updated_at WHERE (name = :name)"
+	// DeleteRole is the SQL for removing a role
+	DeleteRole = "DELETE FROM roles WHERE (name = ?)"
+)
+
+// Record is a named role, which gives its members a set of attributes
+type Record struct {
+	Name string `db:"name"`
+	// Attributes are the JSON-encoded attributes of the role
+	Attributes string    `db:"attributes"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+// NewRecord returns the record of a role with attributes
+func NewRecord(name string, attrs []api.Attribute) (*Record, error) {
+	if attrs == nil {
+		attrs = []api.Attribute{}
+	}
+	buf, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to marshal the attributes of role '%s'", name)
+	}
+	return &Record{
+		Name:       name,
+		Attributes: string(buf),
+		UpdatedAt:  time.Now().UTC(),
+	}, nil
+}
+
+// GetAttributes returns the attributes of the role
+func (r *Record) GetAttributes() ([]api.Attribute, error) {
+	var attrs []api.Attribute
+	err := json.Unmarshal([]byte(r.Attributes), &attrs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal the attributes of role '%s'", r.Name)
+	}
+	return attrs, nil
+}
+
+// DBStore keeps the roles in the roles table of a CA's database
+type DBStore struct {
+	db db.FabricCADB
+}
+
+// NewDBStore returns a DBStore for the database
+func NewDBStore(db db.FabricCADB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// Insert adds a role
+func (s *DBStore) Insert(rec *Record) error {
+	_, err := s.db.NamedExec("InsertRole", InsertRole, rec)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to insert role '%s' into database", rec.Name)
+	}
+	return nil
+}
+
+// Get returns a role
+func (s *DBStore) Get(name string) (*Record, error) {
+	rec := &Record{}
+	err := s.db.Get("GetRole", rec, s.db.Rebind(SelectRole), name)
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// List returns all the roles, ordered by name
+func (s *DBStore) List() ([]*Record, error) {
+	var recs []*Record
+	err := s.db.Select("GetRoles", &recs, s.db.Rebind(SelectRoles))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get roles")
+	}
+	return recs, nil
+}
+
+// Definitions returns the attributes of all the roles by role name
+func (s *DBStore) Definitions() (map[string][]api.Attribute, error) {
+	recs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	defs := map[string][]api.Attribute{}
+	for _, rec := range recs {
+		attrs, err := rec.GetAttributes()
+		if err != nil {
+			return nil, err
+		}
+		defs[rec.Name] = attrs
+	}
+	return defs, nil
+}
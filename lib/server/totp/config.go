@@ -0,0 +1,25 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package totp
+
+// Config is the configuration of the time-based one-time passwords (TOTP)
+// which identities enroll with in addition to their enrollment secret
+type Config struct {
+	// KeyFile is the file of the AES-256 key which encrypts the TOTP seeds
+	// stored in the users table. It is created if it does not exist, and
+	// must be the same for all the servers of a cluster.
+	KeyFile string `def:"totp.key" help:"File of the key which encrypts the TOTP seeds of identities; it is created if it does not exist"`
+	// Attributes are the attributes which require an identity to enroll with
+	// a TOTP if it has any of them with a value other than 'false'
+	Attributes []string `help:"A list of comma-separated attributes which require an identity which has any of them to enroll with a TOTP"`
+	// Skew is the number of time steps before and after the current one in
+	// which a TOTP is accepted, to allow for clock drift
+	Skew int `def:"1" help:"Number of 30 second time steps before and after the current one in which a TOTP is accepted"`
+	// Issuer is the issuer of the key URIs of the seeds, which authenticator
+	// applications display; it is the name of the CA by default
+	Issuer string `help:"Issuer of the TOTP key URIs returned to registrars (default CA's name)"`
+}
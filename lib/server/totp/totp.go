@@ -0,0 +1,242 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Period is the time step of the TOTPs
+	Period = 30 * time.Second
+	// Digits is the number of digits of a TOTP
+	Digits = 6
+	// seedSize is the size of a seed, which is the size of an HMAC-SHA1
+	// key recommended by RFC 4226
+	seedSize = 20
+	// keySize is the size of the AES-256 key which encrypts the seeds
+	keySize = 32
+)
+
+var (
+	// ErrInvalidCode is returned when a TOTP does not match the seed
+	ErrInvalidCode = errors.New("The TOTP is not valid")
+	// ErrReplayedCode is returned when the time step of a TOTP was already
+	// used to enroll
+	ErrReplayedCode = errors.New("The TOTP was already used")
+)
+
+// Code returns the TOTP of a seed at a time (RFC 6238), which is the HOTP
+// (RFC 4226) of the time step of the time
+func Code(seed []byte, t time.Time) string {
+	return hotp(seed, timeStep(t))
+}
+
+func timeStep(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+func hotp(seed []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, seed)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, bin%1000000)
+}
+
+// EncodeSeed returns the base32 encoding of a seed, which is how
+// authenticator applications expect it to be entered
+func EncodeSeed(seed []byte) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(seed)
+}
+
+// Authenticator creates and verifies the TOTPs of identities. The seeds are
+// stored encrypted with the key of its key file, and are bound to the
+// enrollment ID of their identity.
+type Authenticator struct {
+	aead   cipher.AEAD
+	attrs  []string
+	skew   int
+	issuer string
+	now    func() time.Time
+}
+
+// NewAuthenticator returns the authenticator of a configuration; the issuer
+// of the key URIs is the name of the CA unless the configuration has one
+func NewAuthenticator(cfg *Config, caName string) (*Authenticator, error) {
+	if cfg.Skew < 0 {
+		return nil, errors.Errorf("Invalid TOTP skew %d; it must not be negative", cfg.Skew)
+	}
+	if cfg.KeyFile == "" {
+		return nil, errors.New("The TOTP configuration requires a 'keyfile'")
+	}
+	key, err := loadKey(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create the cipher of the TOTP seeds")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create the cipher of the TOTP seeds")
+	}
+	return &Authenticator{
+		aead:   aead,
+		attrs:  cfg.Attributes,
+		skew:   cfg.Skew,
+		issuer: cfgVal(cfg.Issuer, caName),
+		now:    time.Now,
+	}, nil
+}
+
+func cfgVal(val1, val2 string) string {
+	if val1 != "" {
+		return val1
+	}
+	return val2
+}
+
+// loadKey reads the base64 encoded key of a key file, creating the file
+// with a new random key if it does not exist
+func loadKey(file string) ([]byte, error) {
+	if !util.FileExists(file) {
+		key := make([]byte, keySize)
+		_, err := rand.Read(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to generate the TOTP seed key")
+		}
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to create the directory of the TOTP seed key file '%s'", file)
+		}
+		err = ioutil.WriteFile(file, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to write the TOTP seed key file '%s'", file)
+		}
+		log.Infof("Created the TOTP seed key file %s", file)
+		return key, nil
+	}
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read the TOTP seed key file '%s'", file)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid TOTP seed key file '%s'", file)
+	}
+	if len(key) != keySize {
+		return nil, errors.Errorf("Invalid TOTP seed key file '%s'; expecting a key of %d bytes but found %d", file, keySize, len(key))
+	}
+	return key, nil
+}
+
+// Required returns true if an identity with some attributes must enroll
+// with a TOTP because of the attributes of the configuration
+func (a *Authenticator) Required(attrs []api.Attribute) bool {
+	for _, name := range a.attrs {
+		for _, attr := range attrs {
+			if attr.Name == name && attr.Value != "" && !strings.EqualFold(attr.Value, "false") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewSeed returns a new random seed for an identity and its encryption,
+// which is stored in the users table
+func (a *Authenticator) NewSeed(id string) ([]byte, string, error) {
+	seed := make([]byte, seedSize)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Failed to generate a TOTP seed")
+	}
+	nonce := make([]byte, a.aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Failed to generate a TOTP seed")
+	}
+	sealed := a.aead.Seal(nonce, nonce, seed, []byte(id))
+	return seed, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (a *Authenticator) decrypt(id, encSeed string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encSeed)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid TOTP seed of identity '%s'", id)
+	}
+	size := a.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, errors.Errorf("Invalid TOTP seed of identity '%s'", id)
+	}
+	seed, err := a.aead.Open(nil, sealed[:size], sealed[size:], []byte(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to decrypt the TOTP seed of identity '%s'", id)
+	}
+	return seed, nil
+}
+
+// KeyURI returns the key URI of the seed of an identity, which authenticator
+// applications can import, often from a QR code
+func (a *Authenticator) KeyURI(id string, seed []byte) string {
+	params := url.Values{}
+	params.Set("secret", EncodeSeed(seed))
+	params.Set("issuer", a.issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", Digits))
+	params.Set("period", fmt.Sprintf("%d", int(Period/time.Second)))
+	return "otpauth://totp/" + url.PathEscape(a.issuer+":"+id) + "?" + params.Encode()
+}
+
+// Verify checks a TOTP of an identity against its encrypted seed and returns
+// the time step of the TOTP. The TOTP must be of a time step later than the
+// last one the identity used, so that it cannot be used twice.
+func (a *Authenticator) Verify(id, encSeed, code string, lastStep int64) (int64, error) {
+	seed, err := a.decrypt(id, encSeed)
+	if err != nil {
+		return 0, err
+	}
+	if len(code) != Digits {
+		return 0, ErrInvalidCode
+	}
+	now := timeStep(a.now())
+	for i := -a.skew; i <= a.skew; i++ {
+		step := now + int64(i)
+		if !hmac.Equal([]byte(hotp(seed, step)), []byte(code)) {
+			continue
+		}
+		if step <= lastStep {
+			return 0, ErrReplayedCode
+		}
+		return step, nil
+	}
+	return 0, ErrInvalidCode
+}
@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package totp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+	// The SHA1 test vectors of RFC 6238, truncated to 6 digits
+	seed := []byte("12345678901234567890")
+	assert.Equal(t, "287082", Code(seed, time.Unix(59, 0)))
+	assert.Equal(t, "081804", Code(seed, time.Unix(1111111109, 0)))
+	assert.Equal(t, "050471", Code(seed, time.Unix(1111111111, 0)))
+	assert.Equal(t, "005924", Code(seed, time.Unix(1234567890, 0)))
+	assert.Equal(t, "279037", Code(seed, time.Unix(2000000000, 0)))
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", EncodeSeed(seed))
+}
+
+func TestAuthenticator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "totp")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "msp", "totp.key")
+
+	_, err = NewAuthenticator(&Config{KeyFile: keyFile, Skew: -1}, "ca1")
+	assert.Error(t, err, "Negative skew should fail")
+	_, err = NewAuthenticator(&Config{}, "ca1")
+	assert.Error(t, err, "Configuration without a key file should fail")
+
+	a, err := NewAuthenticator(&Config{KeyFile: keyFile, Skew: 1, Attributes: []string{"hf.Registrar.Roles", "hf.IntermediateCA"}}, "ca1")
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %s", err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("Key file was not created: %s", err)
+	}
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	seed, encSeed, err := a.NewSeed("admin2")
+	if err != nil {
+		t.Fatalf("Failed to create seed: %s", err)
+	}
+	assert.Len(t, seed, seedSize)
+	assert.NotContains(t, encSeed, EncodeSeed(seed))
+
+	now := time.Unix(1600000000, 0)
+	a.now = func() time.Time { return now }
+	step, err := a.Verify("admin2", encSeed, Code(seed, now), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Unix()/30, step)
+	_, err = a.Verify("admin2", encSeed, Code(seed, now.Add(-Period)), 0)
+	assert.NoError(t, err, "TOTP of the previous time step should be accepted")
+	_, err = a.Verify("admin2", encSeed, Code(seed, now.Add(2*Period)), 0)
+	assert.Equal(t, ErrInvalidCode, err, "TOTP outside of the skew should fail")
+	_, err = a.Verify("admin2", encSeed, Code(seed, now), step)
+	assert.Equal(t, ErrReplayedCode, err, "TOTP of a used time step should fail")
+	_, err = a.Verify("admin2", encSeed, "12345", 0)
+	assert.Equal(t, ErrInvalidCode, err)
+	_, err = a.Verify("admin3", encSeed, Code(seed, now), 0)
+	assert.Error(t, err, "Seed of another identity should fail")
+
+	// The key is read back from the key file
+	a2, err := NewAuthenticator(&Config{KeyFile: keyFile}, "ca1")
+	if err != nil {
+		t.Fatalf("Failed to create authenticator from existing key file: %s", err)
+	}
+	a2.now = a.now
+	_, err = a2.Verify("admin2", encSeed, Code(seed, now), 0)
+	assert.NoError(t, err)
+
+	uri := a.KeyURI("admin2", seed)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/ca1:admin2?"), "Unexpected key URI %s", uri)
+	assert.Contains(t, uri, "secret="+EncodeSeed(seed))
+	assert.Contains(t, uri, "issuer=ca1")
+
+	assert.True(t, a.Required([]api.Attribute{{Name: "hf.Registrar.Roles", Value: "client"}}))
+	assert.True(t, a.Required([]api.Attribute{{Name: "hf.IntermediateCA", Value: "true"}}))
+	assert.False(t, a.Required([]api.Attribute{{Name: "hf.IntermediateCA", Value: "false"}}))
+	assert.False(t, a.Required([]api.Attribute{{Name: "hf.Revoker", Value: "true"}}))
+
+	err = ioutil.WriteFile(keyFile, []byte("c2hvcnQ=\n"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write key file: %s", err)
+	}
+	_, err = NewAuthenticator(&Config{KeyFile: keyFile}, "ca1")
+	assert.Error(t, err, "Key file with a short key should fail")
+}
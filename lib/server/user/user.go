@@ -10,13 +10,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"strings"
+	"time"
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib/server/password"
 	"github.com/hyperledger/fabric-ca/lib/spi"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // DbTxResult returns information on any affiliations and/or identities affected
@@ -87,6 +88,19 @@ type Record struct {
 	MaxEnrollments            int    `db:"max_enrollments"`
 	Level                     int    `db:"level"`
 	IncorrectPasswordAttempts int    `db:"incorrect_password_attempts"`
+	// SecretExpiry is when the enrollment secret expires; nil if it does not
+	SecretExpiry *time.Time `db:"secret_expiry"`
+	// TOTPSeed is the encrypted TOTP seed of the user; empty if the user
+	// enrolls without a TOTP
+	TOTPSeed string `db:"totp_seed"`
+	// TOTPStep is the time step of the last TOTP the user enrolled with
+	TOTPStep int64 `db:"totp_step"`
+	// Suspended is true if the user is suspended, which blocks its
+	// requests until it is resumed
+	Suspended bool `db:"suspended"`
+	// Reissue is true if a change of the roles of the user requires it to
+	// reissue its certificates, until it enrolls again
+	Reissue bool `db:"reissue"`
 }
 
 // Info contains information about a user
@@ -100,7 +114,25 @@ type Info struct {
 	MaxEnrollments            int
 	Level                     int
 	IncorrectPasswordAttempts int
-}
+	SecretExpiry              *time.Time
+	TOTPSeed                  string `mask:"password"`
+	TOTPStep                  int64
+	Suspended                 bool
+	Reissue                   bool
+}
+
+// States of the enrollment secret of a user
+const (
+	// SecretActive is the state of a secret which can be used to enroll
+	SecretActive = "active"
+	// SecretExpired is the state of a secret which is past its expiry
+	SecretExpired = "expired"
+	// SecretUsed is the state of a secret which was used up by the maximum
+	// number of enrollments of the user
+	SecretUsed = "used"
+	// SecretRevoked is the state of the secret of a revoked user
+	SecretRevoked = "revoked"
+)
 
 //go:generate counterfeiter -o mocks/userDB.go -fake-name UserDB . userDB
 
@@ -114,9 +146,10 @@ type userDB interface {
 // Impl is the databases representation of a user
 type Impl struct {
 	Info
-	pass  []byte
-	attrs map[string]api.Attribute
-	db    userDB
+	pass   []byte
+	attrs  map[string]api.Attribute
+	db     userDB
+	hasher *password.Hasher
 }
 
 // New creates a DBUser object from the DB user record
@@ -130,6 +163,11 @@ func New(userRec *Record, db userDB) *Impl {
 	user.Type = userRec.Type
 	user.Level = userRec.Level
 	user.IncorrectPasswordAttempts = userRec.IncorrectPasswordAttempts
+	user.SecretExpiry = userRec.SecretExpiry
+	user.TOTPSeed = userRec.TOTPSeed
+	user.TOTPStep = userRec.TOTPStep
+	user.Suspended = userRec.Suspended
+	user.Reissue = userRec.Reissue
 
 	var attrs []api.Attribute
 	json.Unmarshal([]byte(userRec.Attributes), &attrs)
@@ -158,6 +196,13 @@ func (u *Impl) GetPass() []byte {
 	return u.pass
 }
 
+// SetPasswordHasher sets the hasher with which the password of the user is
+// hashed again on login if its stored hash was made with another algorithm
+// or cost
+func (u *Impl) SetPasswordHasher(hasher *password.Hasher) {
+	u.hasher = hasher
+}
+
 // GetType returns the type of the user
 func (u *Impl) GetType() string {
 	return u.Type
@@ -219,7 +264,7 @@ func (u *Impl) Login(pass string, caMaxEnrollments int) error {
 	log.Debugf("DB: Login user %s with max enrollments of %d and state of %d", u.Name, u.MaxEnrollments, u.State)
 
 	// Check the password by comparing to stored hash
-	err := bcrypt.CompareHashAndPassword(u.pass, []byte(pass))
+	err := password.Compare(u.pass, []byte(pass))
 	if err != nil {
 		err2 := u.IncrementIncorrectPasswordAttempts()
 		if err2 != nil {
@@ -236,6 +281,10 @@ func (u *Impl) Login(pass string, caMaxEnrollments int) error {
 		return errors.Errorf("User %s is revoked; access denied", u.Name)
 	}
 
+	if u.SecretExpiry != nil && !time.Now().Before(*u.SecretExpiry) {
+		return errors.Errorf("The enrollment secret of identity %s expired at %s", u.Name, u.SecretExpiry.UTC().Format(time.RFC3339))
+	}
+
 	// If max enrollment value of user is greater than allowed by CA, using CA max enrollment value for user
 	if caMaxEnrollments != -1 && (u.MaxEnrollments > caMaxEnrollments || u.MaxEnrollments == -1) {
 		log.Debugf("Max enrollment value (%d) of identity is greater than allowed by CA, using CA max enrollment value of %d", u.MaxEnrollments, caMaxEnrollments)
@@ -251,7 +300,34 @@ func (u *Impl) Login(pass string, caMaxEnrollments int) error {
 
 	log.Debugf("DB: identity %s successfully logged in", u.Name)
 
-	return u.resetIncorrectLoginAttempts()
+	err = u.resetIncorrectLoginAttempts()
+	if err != nil {
+		return err
+	}
+
+	// Upgrade the stored hash if the hash configuration has changed since
+	// it was made; a failure does not fail the login, which already succeeded
+	if u.hasher != nil && u.hasher.NeedsRehash(u.pass) {
+		err = u.rehashPassword(pass)
+		if err != nil {
+			log.Warningf("Failed to upgrade the password hash of identity %s: %s", u.Name, err)
+		}
+	}
+	return nil
+}
+
+func (u *Impl) rehashPassword(pass string) error {
+	hash, err := u.hasher.Hash([]byte(pass))
+	if err != nil {
+		return err
+	}
+	_, err = u.db.Exec("RehashPassword", u.db.Rebind("UPDATE users SET token = ? WHERE (id = ? AND token = ?)"), hash, u.Name, u.pass)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to update the password hash of identity %s", u.Name)
+	}
+	u.pass = hash
+	log.Debugf("Upgraded the password hash of identity %s", u.Name)
+	return nil
 }
 
 func (u *Impl) resetIncorrectLoginAttempts() error {
@@ -502,6 +578,133 @@ func (u *Impl) IncrementIncorrectPasswordAttempts() error {
 	return nil
 }
 
+// SetIncorrectPasswordAttempts sets the number of incorrect password
+// attempts of the user
+func (u *Impl) SetIncorrectPasswordAttempts(attempts int) error {
+	query := "UPDATE users SET incorrect_password_attempts = ? WHERE (id = ?)"
+	res, err := u.db.Exec("SetIncorrectPasswordAttempts", u.db.Rebind(query), attempts, u.GetName())
+	if err != nil {
+		return errors.Wrapf(err, "Failed to update the incorrect password attempts of identity %s", u.Name)
+	}
+
+	numRowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get number of rows affected")
+	}
+
+	if numRowsAffected == 0 {
+		return errors.Errorf("No rows were affected when updating the state of identity %s", u.Name)
+	}
+	return nil
+}
+
+// SetTOTPSeed sets the encrypted TOTP seed of the user, or removes it if the
+// seed is empty. The time steps of the TOTPs of the previous seed are
+// forgotten.
+func (u *Impl) SetTOTPSeed(seed string) error {
+	query := "UPDATE users SET totp_seed = ?, totp_step = 0 WHERE (id = ?)"
+	res, err := u.db.Exec("SetTOTPSeed", u.db.Rebind(query), seed, u.GetName())
+	if err != nil {
+		return errors.Wrapf(err, "Failed to update the TOTP seed of identity %s", u.Name)
+	}
+
+	numRowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get number of rows affected")
+	}
+
+	if numRowsAffected != 1 {
+		return errors.Errorf("%d rows were affected when updating the TOTP seed of identity %s", numRowsAffected, u.Name)
+	}
+
+	u.TOTPSeed = seed
+	u.TOTPStep = 0
+	return nil
+}
+
+// UseTOTPStep records the time step of a TOTP the user enrolls with. It
+// returns an error if the user already used that time step or a later one,
+// possibly through another server of the cluster.
+func (u *Impl) UseTOTPStep(step int64) error {
+	query := "UPDATE users SET totp_step = ? WHERE (id = ? AND totp_step < ?)"
+	res, err := u.db.Exec("UseTOTPStep", u.db.Rebind(query), step, u.GetName(), step)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to update the TOTP time step of identity %s", u.Name)
+	}
+
+	numRowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get number of rows affected")
+	}
+
+	if numRowsAffected == 0 {
+		return errors.Errorf("The TOTP of identity %s was already used", u.Name)
+	}
+
+	u.TOTPStep = step
+	return nil
+}
+
+// SetSuspended suspends the user, or resumes it if suspended is false. Unlike
+// a revocation, a suspension is reversible, and the record and enrollments of
+// the user are left as they are.
+func (u *Impl) SetSuspended(suspended bool) error {
+	if u.Suspended == suspended {
+		return nil
+	}
+	value := 0
+	if suspended {
+		value = 1
+	}
+	query := "UPDATE users SET suspended = ? WHERE (id = ?)"
+	res, err := u.db.Exec("SetSuspended", u.db.Rebind(query), value, u.GetName())
+	if err != nil {
+		return errors.Wrapf(err, "Failed to update the suspension of identity %s", u.Name)
+	}
+
+	numRowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get number of rows affected")
+	}
+
+	if numRowsAffected != 1 {
+		return errors.Errorf("%d rows were affected when updating the suspension of identity %s", numRowsAffected, u.Name)
+	}
+
+	u.Suspended = suspended
+	log.Debugf("Successfully set suspension of identity %s to %t", u.Name, suspended)
+	return nil
+}
+
+// IsSuspended returns true if the user is suspended
+func (u *Impl) IsSuspended() bool {
+	return u.Suspended
+}
+
+// SetReissue sets whether the user must reissue its certificates, which
+// is the case when a change of its roles changed its attributes
+func (u *Impl) SetReissue(reissue bool) error {
+	if u.Reissue == reissue {
+		return nil
+	}
+	value := 0
+	if reissue {
+		value = 1
+	}
+	query := "UPDATE users SET reissue = ? WHERE (id = ?)"
+	_, err := u.db.Exec("SetReissue", u.db.Rebind(query), value, u.GetName())
+	if err != nil {
+		return errors.Wrapf(err, "Failed to update the reissue flag of identity %s", u.Name)
+	}
+	u.Reissue = reissue
+	return nil
+}
+
+// NeedsReissue returns true if the user must reissue its certificates
+func (u *Impl) NeedsReissue() bool {
+	return u.Reissue
+}
+
 // GetFailedLoginAttempts returns the number of times the user has entered an incorrect password
 func (u *Impl) GetFailedLoginAttempts() int {
 	return u.IncorrectPasswordAttempts
@@ -524,6 +727,34 @@ func (u *Impl) Migrate(tx userDB) error {
 		}
 		fallthrough
 
+	case 2:
+		err := u.migrateUserToLevel3(tx)
+		if err != nil {
+			return err
+		}
+		fallthrough
+
+	case 3:
+		err := u.migrateUserToLevel4(tx)
+		if err != nil {
+			return err
+		}
+		fallthrough
+
+	case 4:
+		err := u.migrateUserToLevel5(tx)
+		if err != nil {
+			return err
+		}
+		fallthrough
+
+	case 5:
+		err := u.migrateUserToLevel6(tx)
+		if err != nil {
+			return err
+		}
+		fallthrough
+
 	default:
 		return nil
 	}
@@ -590,6 +821,75 @@ func (u *Impl) migrateUserToLevel2(tx userDB) error {
 	return nil
 }
 
+func (u *Impl) migrateUserToLevel3(tx userDB) error {
+	log.Debugf("Migrating user '%s' to level 3", u.GetName())
+
+	// Level 3 added the secret_expiry column, which is NULL for the
+	// existing users, so their secrets do not expire
+	err := u.setLevel(tx, 3)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to update level of user")
+	}
+
+	return nil
+}
+
+func (u *Impl) migrateUserToLevel4(tx userDB) error {
+	log.Debugf("Migrating user '%s' to level 4", u.GetName())
+
+	// Level 4 added the totp_seed and totp_step columns, which are empty
+	// for the existing users, so they enroll without a TOTP
+	err := u.setLevel(tx, 4)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to update level of user")
+	}
+
+	return nil
+}
+
+func (u *Impl) migrateUserToLevel5(tx userDB) error {
+	log.Debugf("Migrating user '%s' to level 5", u.GetName())
+
+	// Level 5 added the suspended column, which is 0 for the existing users
+	err := u.setLevel(tx, 5)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to update level of user")
+	}
+
+	return nil
+}
+
+func (u *Impl) migrateUserToLevel6(tx userDB) error {
+	log.Debugf("Migrating user '%s' to level 6", u.GetName())
+
+	// Level 6 added the reissue column, which is 0 for the existing users
+	err := u.setLevel(tx, 6)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to update level of user")
+	}
+
+	return nil
+}
+
+// GetSecretState returns the state of the enrollment secret of a user with
+// the state, maximum enrollments and secret expiry of its record. The maximum
+// enrollments of the user are capped by those of its CA, as they are on login.
+func GetSecretState(state, maxEnrollments int, secretExpiry *time.Time, caMaxEnrollments int) string {
+	if state == -1 {
+		return SecretRevoked
+	}
+	if secretExpiry != nil && !time.Now().Before(*secretExpiry) {
+		return SecretExpired
+	}
+	if caMaxEnrollments != -1 && (maxEnrollments > caMaxEnrollments || maxEnrollments == -1) {
+		maxEnrollments = caMaxEnrollments
+	}
+	if maxEnrollments != -1 && state >= maxEnrollments {
+		return SecretUsed
+	}
+	return SecretActive
+}
+
 // Affiliation is interface that defines functions needed to get a user's affiliation
 type Affiliation interface {
 	GetAffiliationPath() []string
@@ -8,6 +8,7 @@ package user_test
 
 import (
 	"errors"
+	"time"
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
 	"github.com/hyperledger/fabric-ca/lib/server/user"
@@ -145,8 +146,22 @@ var _ = Describe("user", func() {
 			Expect(err.Error()).To(Equal("The identity testuser has already enrolled 4 times, it has reached its maximum enrollment allowance"))
 		})
 
+		It("returns an error if the user's secret expired", func() {
+			u.MaxEnrollments = 4
+			expiry := time.Now().Add(-time.Minute)
+			u.SecretExpiry = &expiry
+			mockResult.RowsAffectedReturns(int64(1), nil)
+			mockUserDB.ExecReturns(mockResult, nil)
+
+			err := u.Login("password", -1)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("The enrollment secret of identity testuser expired at"))
+		})
+
 		It("logins in user", func() {
 			u.MaxEnrollments = 4
+			expiry := time.Now().Add(time.Hour)
+			u.SecretExpiry = &expiry
 			mockResult.RowsAffectedReturns(int64(1), nil)
 			mockUserDB.ExecReturns(mockResult, nil)
 			err := u.Login("password", -1)
@@ -154,6 +169,19 @@ var _ = Describe("user", func() {
 		})
 	})
 
+	Context("GetSecretState", func() {
+		It("returns the state of the secret", func() {
+			past := time.Now().Add(-time.Minute)
+			future := time.Now().Add(time.Hour)
+			Expect(user.GetSecretState(-1, 1, nil, -1)).To(Equal(user.SecretRevoked))
+			Expect(user.GetSecretState(0, 1, &past, -1)).To(Equal(user.SecretExpired))
+			Expect(user.GetSecretState(1, 1, &future, -1)).To(Equal(user.SecretUsed))
+			Expect(user.GetSecretState(2, -1, nil, 2)).To(Equal(user.SecretUsed))
+			Expect(user.GetSecretState(0, 1, &future, -1)).To(Equal(user.SecretActive))
+			Expect(user.GetSecretState(5, -1, nil, -1)).To(Equal(user.SecretActive))
+		})
+	})
+
 	Context("IncrementIncorrectPasswordAttempts", func() {
 		It("returns an error if db fails to execute query", func() {
 			mockUserDB.ExecReturns(nil, errors.New("failed to execute"))
@@ -235,6 +263,109 @@ var _ = Describe("user", func() {
 		})
 	})
 
+	Context("TOTP", func() {
+		It("returns an error if setting the seed fails to execute query", func() {
+			mockUserDB.ExecReturns(nil, errors.New("failed to execute"))
+
+			err := u.SetTOTPSeed("seed")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Failed to update the TOTP seed of identity testuser: failed to execute"))
+		})
+
+		It("sets the seed and resets the time step", func() {
+			mockResult.RowsAffectedReturns(int64(1), nil)
+			mockUserDB.ExecReturns(mockResult, nil)
+			u.TOTPStep = 10
+
+			err := u.SetTOTPSeed("seed")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(u.TOTPSeed).To(Equal("seed"))
+			Expect(u.TOTPStep).To(Equal(int64(0)))
+		})
+
+		It("returns an error if the time step was already used", func() {
+			mockResult.RowsAffectedReturns(int64(0), nil)
+			mockUserDB.ExecReturns(mockResult, nil)
+
+			err := u.UseTOTPStep(10)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("The TOTP of identity testuser was already used"))
+		})
+
+		It("records the time step", func() {
+			mockResult.RowsAffectedReturns(int64(1), nil)
+			mockUserDB.ExecReturns(mockResult, nil)
+
+			err := u.UseTOTPStep(10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(u.TOTPStep).To(Equal(int64(10)))
+		})
+
+		It("returns an error if setting the incorrect password attempts fails to execute query", func() {
+			mockUserDB.ExecReturns(nil, errors.New("failed to execute"))
+
+			err := u.SetIncorrectPasswordAttempts(3)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Failed to update the incorrect password attempts of identity testuser: failed to execute"))
+		})
+
+		It("sets the incorrect password attempts", func() {
+			mockResult.RowsAffectedReturns(int64(1), nil)
+			mockUserDB.ExecReturns(mockResult, nil)
+
+			err := u.SetIncorrectPasswordAttempts(3)
+			Expect(err).NotTo(HaveOccurred())
+			_, _, args := mockUserDB.ExecArgsForCall(0)
+			Expect(args).To(Equal([]interface{}{3, "testuser"}))
+		})
+	})
+
+	Context("suspend", func() {
+		It("returns an error if it fails to execute query", func() {
+			mockUserDB.ExecReturns(nil, errors.New("failed to execute"))
+
+			err := u.SetSuspended(true)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Failed to update the suspension of identity testuser: failed to execute"))
+		})
+
+		It("suspends and resumes the user without revoking it", func() {
+			mockResult.RowsAffectedReturns(int64(1), nil)
+			mockUserDB.ExecReturns(mockResult, nil)
+
+			err := u.SetSuspended(true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(u.IsSuspended()).To(BeTrue())
+			Expect(u.IsRevoked()).To(BeFalse())
+
+			err = u.SetSuspended(false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(u.IsSuspended()).To(BeFalse())
+		})
+	})
+
+	Context("reissue", func() {
+		It("returns an error if it fails to execute query", func() {
+			mockUserDB.ExecReturns(nil, errors.New("failed to execute"))
+
+			err := u.SetReissue(true)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Failed to update the reissue flag of identity testuser: failed to execute"))
+		})
+
+		It("sets and clears the reissue flag", func() {
+			mockUserDB.ExecReturns(mockResult, nil)
+
+			err := u.SetReissue(true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(u.NeedsReissue()).To(BeTrue())
+
+			err = u.SetReissue(false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(u.NeedsReissue()).To(BeFalse())
+		})
+	})
+
 	It("splits affiliation on dots and returns a string slice", func() {
 		u.Affiliation = "foo.bar.xyz"
 		aff := u.GetAffiliationPath()
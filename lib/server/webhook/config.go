@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package webhook
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/lib/tls"
+)
+
+// Config is the configuration of the webhooks of a CA
+type Config struct {
+	Enabled bool `def:"false" help:"Send signed events of the CA to webhook endpoints"`
+	// Timeout is how long a delivery waits for the response of an endpoint
+	Timeout time.Duration `def:"10s" help:"Timeout of the delivery of an event to a webhook endpoint"`
+	// RetryInterval is how long a failed delivery waits before it is retried;
+	// the wait doubles with each failed attempt, up to an hour
+	RetryInterval time.Duration `def:"30s" help:"Interval after which the delivery of an event to a webhook endpoint is first retried"`
+	// Expiry is how long an event is kept for an endpoint which does not
+	// accept it before it is discarded
+	Expiry time.Duration `def:"168h" help:"Time after which an event that could not be delivered is discarded"`
+	// Endpoints are the endpoints the events are sent to
+	Endpoints []EndpointConfig
+}
+
+// EndpointConfig is the configuration of an endpoint events are sent to
+type EndpointConfig struct {
+	// URL is the URL the events are posted to
+	URL string
+	// Secret is the key of the HMAC-SHA256 signature of the events
+	Secret string
+	// Events are the types of the events sent to the endpoint; a type ending
+	// with '.*', such as 'certificate.*', matches all the types with that
+	// prefix. All events are sent if no type is set.
+	Events []string
+	// TLS is the TLS configuration used for an https URL; the system's root
+	// certificates are trusted if no certificate files are set
+	TLS tls.ClientTLSConfig
+}
+
+// accepts returns true if events of the type are sent to the endpoint
+func (e *EndpointConfig) accepts(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, t := range e.Events {
+		if t == eventType || t == "*" {
+			return true
+		}
+		if strings.HasSuffix(t, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package webhook
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/pkg/errors"
+)
+
+const (
+	// InsertDelivery is the SQL for adding a delivery to the outbox
+	InsertDelivery = "INSERT INTO webhook_events (id, event_id, type, endpoint, payload, created_at, attempts, next_attempt) VALUES (:id, :event_id, :type, :endpoint, :payload, :created_at, :attempts, :next_attempt)"
+	// SelectDueDeliveries is the SQL for getting the deliveries to attempt
+	SelectDueDeliveries = "SELECT * FROM webhook_events WHERE (next_attempt <= ?) ORDER BY created_at LIMIT ?"
+	// UpdateDelivery is the SQL for recording a failed attempt of a delivery
+	UpdateDelivery = "UPDATE webhook_events SET attempts = :attempts, next_attempt = :next_attempt WHERE (id = :id)"
+	// DeleteDelivery is the SQL for removing a delivery from the outbox
+	DeleteDelivery = "DELETE FROM webhook_events WHERE (id = ?)"
+)
+
+// delivery is the delivery of an event to an endpoint, which is kept in
+// the webhook_events table of the CA's database until the endpoint accepts
+// the event or the event expires
+type delivery struct {
+	ID      string `db:"id"`
+	EventID string `db:"event_id"`
+	Type    string `db:"type"`
+	// Endpoint is the URL of the endpoint
+	Endpoint    string    `db:"endpoint"`
+	Payload     string    `db:"payload"`
+	CreatedAt   time.Time `db:"created_at"`
+	Attempts    int       `db:"attempts"`
+	NextAttempt time.Time `db:"next_attempt"`
+}
+
+func insertDelivery(caDB db.FabricCADB, d *delivery) error {
+	_, err := caDB.NamedExec("InsertWebhookEvent", InsertDelivery, d)
+	if err != nil {
+		return errors.Wrap(err, "Failed to insert webhook event into database")
+	}
+	return nil
+}
+
+func dueDeliveries(caDB db.FabricCADB, now time.Time, limit int) ([]*delivery, error) {
+	var ds []*delivery
+	err := caDB.Select("GetWebhookEvents", &ds, caDB.Rebind(SelectDueDeliveries), now, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get webhook events")
+	}
+	return ds, nil
+}
+
+func updateDelivery(caDB db.FabricCADB, d *delivery) error {
+	_, err := caDB.NamedExec("UpdateWebhookEvent", UpdateDelivery, d)
+	if err != nil {
+		return errors.Wrap(err, "Failed to update webhook event")
+	}
+	return nil
+}
+
+func deleteDelivery(caDB db.FabricCADB, id string) error {
+	_, err := caDB.Exec("DeleteWebhookEvent", caDB.Rebind(DeleteDelivery), id)
+	if err != nil {
+		return errors.Wrap(err, "Failed to delete webhook event")
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/lib/tls"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp"
+	"github.com/pkg/errors"
+)
+
+// Types of the events
+const (
+	CertificateIssued   = "certificate.issued"
+	CertificateRevoked  = "certificate.revoked"
+	CertificateReleased = "certificate.released"
+	IdentityRegistered  = "identity.registered"
+	IdentityModified    = "identity.modified"
+	IdentityRemoved     = "identity.removed"
+	AffiliationAdded    = "affiliation.added"
+	AffiliationModified = "affiliation.modified"
+	AffiliationRemoved  = "affiliation.removed"
+	RoleAdded           = "role.added"
+	RoleModified        = "role.modified"
+	RoleRemoved         = "role.removed"
+)
+
+const (
+	// SignatureHeader is the header of the HMAC-SHA256 signature of the body
+	// of an event, in the form 'sha256=<hex-encoded signature>'
+	SignatureHeader = "X-Fabric-CA-Signature"
+	// EventIDHeader is the header of the ID of an event; an event is
+	// delivered at least once, so receivers should ignore IDs they have seen
+	EventIDHeader = "X-Fabric-CA-Event-Id"
+	// EventTypeHeader is the header of the type of an event
+	EventTypeHeader = "X-Fabric-CA-Event"
+)
+
+const (
+	// batchSize is the number of deliveries attempted at a time
+	batchSize = 100
+	// defaultTimeout is the timeout of a delivery if none is configured
+	defaultTimeout = 10 * time.Second
+	// defaultRetryInterval is the interval after which a failed delivery is
+	// first retried if none is configured
+	defaultRetryInterval = 30 * time.Second
+	// maxRetryInterval is the longest time a failed delivery waits before
+	// it is retried
+	maxRetryInterval = time.Hour
+)
+
+// Event is the JSON body posted to the endpoints
+type Event struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// CA is the name of the CA the event occurred in
+	CA   string      `json:"ca"`
+	Data interface{} `json:"data"`
+}
+
+// Sign returns the value of the signature header of the body of an event
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if signature is the value of the signature header of
+// the body of an event
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// endpoint is an endpoint the events are sent to
+type endpoint struct {
+	*EndpointConfig
+	client *http.Client
+}
+
+// Dispatcher sends the events of a CA to its webhook endpoints. Events are
+// first stored in the outbox table of the CA's database and then delivered
+// in the background, so that they are retried until an endpoint accepts
+// them even across restarts.
+type Dispatcher struct {
+	cfg       *Config
+	caName    string
+	endpoints map[string]*endpoint
+	// interval is the interval after which a failed delivery is first retried
+	interval time.Duration
+	// trigger is signaled to deliver new events without waiting for the
+	// next retry
+	trigger chan struct{}
+	stop    chan struct{}
+	once    sync.Once
+	mutex   sync.RWMutex
+	db      db.FabricCADB
+}
+
+// NewDispatcher returns a dispatcher for the events of a CA, which are kept
+// in the database until they are delivered
+func NewDispatcher(cfg *Config, caName string, caDB db.FabricCADB, csp bccsp.BCCSP) (*Dispatcher, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	interval := cfg.RetryInterval
+	if interval <= 0 {
+		interval = defaultRetryInterval
+	}
+	d := &Dispatcher{
+		cfg:       cfg,
+		caName:    caName,
+		interval:  interval,
+		endpoints: map[string]*endpoint{},
+		trigger:   make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		db:        caDB,
+	}
+	for i := range cfg.Endpoints {
+		ep := &cfg.Endpoints[i]
+		if ep.URL == "" {
+			return nil, errors.Errorf("No URL is set for webhook endpoint %d", i+1)
+		}
+		if ep.Secret == "" {
+			return nil, errors.Errorf("No secret is set for webhook endpoint '%s'", ep.URL)
+		}
+		if _, ok := d.endpoints[ep.URL]; ok {
+			return nil, errors.Errorf("Webhook endpoint '%s' is configured more than once", ep.URL)
+		}
+		transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+		if len(ep.TLS.CertFiles) > 0 {
+			tlsConfig, err := tls.GetClientTLSConfig(&ep.TLS, csp)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "Failed to get TLS configuration of webhook endpoint '%s'", ep.URL)
+			}
+			transport.TLSClientConfig = tlsConfig
+		}
+		d.endpoints[ep.URL] = &endpoint{
+			EndpointConfig: ep,
+			client:         &http.Client{Timeout: timeout, Transport: transport},
+		}
+	}
+	return d, nil
+}
+
+// SetDB changes the database the events are kept in
+func (d *Dispatcher) SetDB(caDB db.FabricCADB) {
+	d.mutex.Lock()
+	d.db = caDB
+	d.mutex.Unlock()
+}
+
+func (d *Dispatcher) getDB() db.FabricCADB {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.db
+}
+
+// Emit stores an event for each endpoint that accepts its type and makes
+// the dispatcher deliver them
+func (d *Dispatcher) Emit(eventType string, data interface{}) error {
+	caDB := d.getDB()
+	if caDB == nil {
+		return errors.New("Database is not set")
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	event := &Event{
+		ID:   newID(),
+		Type: eventType,
+		Time: now,
+		CA:   d.caName,
+		Data: data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal %s event", eventType)
+	}
+	stored := false
+	for i := range d.cfg.Endpoints {
+		ep := &d.cfg.Endpoints[i]
+		if !ep.accepts(eventType) {
+			continue
+		}
+		err = insertDelivery(caDB, &delivery{
+			ID:          newID(),
+			EventID:     event.ID,
+			Type:        eventType,
+			Endpoint:    ep.URL,
+			Payload:     string(payload),
+			CreatedAt:   now,
+			NextAttempt: now,
+		})
+		if err != nil {
+			return errors.WithMessagef(err, "Failed to store %s event for webhook endpoint '%s'", eventType, ep.URL)
+		}
+		stored = true
+	}
+	if stored {
+		d.Trigger()
+	}
+	return nil
+}
+
+// Start delivers the stored events and keeps delivering them in the
+// background until the dispatcher is stopped
+func (d *Dispatcher) Start() {
+	log.Debugf("Starting webhook dispatcher for CA '%s' with %d endpoint(s)", d.caName, len(d.endpoints))
+	go d.run()
+}
+
+// Stop stops the dispatcher; the events which are not delivered yet are
+// delivered when a dispatcher is started again
+func (d *Dispatcher) Stop() {
+	d.once.Do(func() {
+		close(d.stop)
+	})
+}
+
+// Trigger makes the dispatcher deliver the events which are due without
+// waiting for the next retry
+func (d *Dispatcher) Trigger() {
+	select {
+	case d.trigger <- struct{}{}:
+	default:
+		// A delivery is already pending
+	}
+}
+
+func (d *Dispatcher) run() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		err := d.deliver()
+		if err != nil {
+			log.Errorf("Failed to deliver webhook events of CA '%s': %s", d.caName, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-d.trigger:
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// deliver attempts the deliveries which are due. Once a delivery to an
+// endpoint fails, the other deliveries to that endpoint wait until the
+// failed one is retried, so that an endpoint which is down is not flooded.
+func (d *Dispatcher) deliver() error {
+	caDB := d.getDB()
+	if caDB == nil {
+		return nil
+	}
+	// The time of the next attempt of the endpoints that failed
+	failed := map[string]time.Time{}
+	for {
+		now := time.Now().UTC().Truncate(time.Second)
+		ds, err := dueDeliveries(caDB, now, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, dl := range ds {
+			select {
+			case <-d.stop:
+				return nil
+			default:
+			}
+			ep := d.endpoints[dl.Endpoint]
+			next, isFailed := failed[dl.Endpoint]
+			switch {
+			case ep == nil:
+				log.Warningf("Discarding %s event %s of CA '%s' for webhook endpoint '%s', which is no longer configured", dl.Type, dl.EventID, d.caName, dl.Endpoint)
+				err = deleteDelivery(caDB, dl.ID)
+			case d.cfg.Expiry > 0 && now.Sub(dl.CreatedAt) > d.cfg.Expiry:
+				log.Warningf("Discarding %s event %s of CA '%s' for webhook endpoint '%s' after %d failed attempts", dl.Type, dl.EventID, d.caName, dl.Endpoint, dl.Attempts)
+				err = deleteDelivery(caDB, dl.ID)
+			case isFailed:
+				dl.NextAttempt = next
+				err = updateDelivery(caDB, dl)
+			default:
+				err = ep.send(dl)
+				if err == nil {
+					log.Debugf("Delivered %s event %s of CA '%s' to webhook endpoint '%s'", dl.Type, dl.EventID, d.caName, dl.Endpoint)
+					err = deleteDelivery(caDB, dl.ID)
+					break
+				}
+				log.Infof("Failed to deliver %s event %s of CA '%s' to webhook endpoint '%s': %s", dl.Type, dl.EventID, d.caName, dl.Endpoint, err)
+				dl.Attempts++
+				dl.NextAttempt = now.Add(d.retryInterval(dl.Attempts))
+				failed[dl.Endpoint] = dl.NextAttempt
+				err = updateDelivery(caDB, dl)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if len(ds) < batchSize {
+			return nil
+		}
+	}
+}
+
+// retryInterval returns how long a delivery waits after its attempt failed
+func (d *Dispatcher) retryInterval(attempts int) time.Duration {
+	interval := d.interval
+	for i := 1; i < attempts && interval < maxRetryInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxRetryInterval {
+		interval = maxRetryInterval
+	}
+	return interval
+}
+
+// send posts the event of a delivery to the endpoint, which accepts it by
+// returning a 2xx status code
+func (ep *endpoint) send(dl *delivery) error {
+	body := []byte(dl.Payload)
+	req, err := http.NewRequest("POST", ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "Failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, dl.EventID)
+	req.Header.Set(EventTypeHeader, dl.Type)
+	req.Header.Set(SignatureHeader, Sign(ep.Secret, body))
+	resp, err := ep.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("Endpoint returned status %s", resp.Status)
+	}
+	return nil
+}
+
+func newID() string {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(errors.Wrap(err, "Failed to generate random ID"))
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,182 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package webhook_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/lib/server/db/sqlite"
+	. "github.com/hyperledger/fabric-ca/lib/server/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver is an in-process webhook endpoint
+type receiver struct {
+	*httptest.Server
+	secret string
+	events chan *Event
+	// failures is the number of requests to fail before events are accepted
+	failures int32
+}
+
+func newReceiver(t *testing.T, secret string, failures int32) *receiver {
+	r := &receiver{secret: secret, events: make(chan *Event, 10), failures: failures}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&r.failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil || !Verify(r.secret, body, req.Header.Get(SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		event := &Event{}
+		err = json.Unmarshal(body, event)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, event.ID, req.Header.Get(EventIDHeader))
+		assert.Equal(t, event.Type, req.Header.Get(EventTypeHeader))
+		r.events <- event
+	}))
+	return r
+}
+
+func (r *receiver) next(t *testing.T) *Event {
+	select {
+	case event := <-r.events:
+		return event
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for webhook event")
+		return nil
+	}
+}
+
+func newTestDB(t *testing.T, dir string) *db.DB {
+	sqliteDB := sqlite.NewDB(filepath.Join(dir, "webhook.db"), "", nil)
+	err := sqliteDB.Connect()
+	util.FatalError(t, err, "Failed to connect to database")
+	testDB, err := sqliteDB.Create()
+	util.FatalError(t, err, "Failed to create database")
+	return testDB
+}
+
+func countEvents(t *testing.T, testDB *db.DB) int {
+	var n int
+	err := testDB.Get("CountWebhookEvents", &n, "SELECT COUNT(*) FROM webhook_events")
+	util.FatalError(t, err, "Failed to count webhook events")
+	return n
+}
+
+func TestDispatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	util.FatalError(t, err, "Failed to create temp directory")
+	defer os.RemoveAll(dir)
+	testDB := newTestDB(t, dir)
+	defer testDB.Close()
+
+	all := newReceiver(t, "secret1", 1)
+	defer all.Close()
+	identities := newReceiver(t, "secret2", 0)
+	defer identities.Close()
+	cfg := &Config{
+		Enabled:       true,
+		RetryInterval: 100 * time.Millisecond,
+		Endpoints: []EndpointConfig{
+			{URL: all.URL, Secret: "secret1"},
+			{URL: identities.URL, Secret: "secret2", Events: []string{"identity.*"}},
+		},
+	}
+	d, err := NewDispatcher(cfg, "ca1", testDB, nil)
+	util.FatalError(t, err, "Failed to create dispatcher")
+
+	// Events emitted before the dispatcher is started are kept
+	err = d.Emit(IdentityRegistered, map[string]string{"id": "user1"})
+	util.FatalError(t, err, "Failed to emit event")
+	err = d.Emit(CertificateIssued, map[string]string{"serial": "1234"})
+	util.FatalError(t, err, "Failed to emit event")
+	assert.Equal(t, 3, countEvents(t, testDB))
+
+	d.Start()
+	defer d.Stop()
+
+	// The first delivery to the endpoint for all events fails and is retried
+	received := map[string]*Event{}
+	for i := 0; i < 2; i++ {
+		event := all.next(t)
+		received[event.Type] = event
+	}
+	if assert.Contains(t, received, IdentityRegistered) {
+		event := received[IdentityRegistered]
+		assert.Equal(t, "ca1", event.CA)
+		assert.Equal(t, map[string]interface{}{"id": "user1"}, event.Data)
+	}
+	assert.Contains(t, received, CertificateIssued)
+
+	// The other endpoint only receives identity events
+	assert.Equal(t, IdentityRegistered, identities.next(t).Type)
+	err = d.Emit(AffiliationAdded, map[string]string{"name": "org3"})
+	util.FatalError(t, err, "Failed to emit event")
+	assert.Equal(t, AffiliationAdded, all.next(t).Type)
+	select {
+	case event := <-identities.events:
+		t.Errorf("Unexpected %s event for endpoint which only accepts identity events", event.Type)
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.Equal(t, 0, countEvents(t, testDB), "Delivered events should be removed from the outbox")
+}
+
+func TestDispatcherDiscardsEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	util.FatalError(t, err, "Failed to create temp directory")
+	defer os.RemoveAll(dir)
+	testDB := newTestDB(t, dir)
+	defer testDB.Close()
+
+	down := newReceiver(t, "secret", 1000)
+	defer down.Close()
+	cfg := &Config{
+		Enabled:       true,
+		RetryInterval: 100 * time.Millisecond,
+		Expiry:        time.Hour,
+		Endpoints:     []EndpointConfig{{URL: down.URL, Secret: "secret"}},
+	}
+	d, err := NewDispatcher(cfg, "ca1", testDB, nil)
+	util.FatalError(t, err, "Failed to create dispatcher")
+	err = d.Emit(IdentityRemoved, map[string]string{"id": "user1"})
+	util.FatalError(t, err, "Failed to emit event")
+
+	// An event is kept while the endpoint is down, and discarded once the
+	// endpoint is no longer configured
+	d2, err := NewDispatcher(&Config{Enabled: true, RetryInterval: 100 * time.Millisecond}, "ca1", testDB, nil)
+	util.FatalError(t, err, "Failed to create dispatcher")
+	d.Start()
+	time.Sleep(300 * time.Millisecond)
+	d.Stop()
+	assert.Equal(t, 1, countEvents(t, testDB), "An undelivered event should be kept")
+	d2.Start()
+	defer d2.Stop()
+	for i := 0; i < 50 && countEvents(t, testDB) > 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(t, 0, countEvents(t, testDB), "The event of a removed endpoint should be discarded")
+
+	_, err = NewDispatcher(&Config{Endpoints: []EndpointConfig{{URL: down.URL}}}, "ca1", testDB, nil)
+	assert.Error(t, err, "An endpoint without a secret should be rejected")
+}
@@ -16,6 +16,9 @@ limitations under the License.
 package lib
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -25,6 +28,9 @@ import (
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/attrmgr"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/config"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/signer"
 )
 
 const (
@@ -327,6 +333,58 @@ func BenchmarkGenCRL(b *testing.B) {
 	}
 }
 
+func BenchmarkGenerateCPABEKey(b *testing.B) {
+	for _, attrCount := range []int{1, 5, 10, 20} {
+		b.Run(fmt.Sprintf("attrs=%d", attrCount), func(b *testing.B) {
+			b.StopTimer()
+			srv := getServerForBenchmark(serverbPort, rootDir, "", -1, b)
+			err := srv.Start()
+			if err != nil {
+				b.Fatalf("Server failed to start: %v", err)
+			}
+			defer cleanup(srv)
+
+			ext, err := createCPABEAttrExtension(attrCount)
+			if err != nil {
+				b.Fatalf("Failed to create attribute extension: %s", err)
+			}
+			b.StartTimer()
+			for i := 0; i < b.N; i++ {
+				_, err = srv.CA.GenerateCPABEKeyBytes([]signer.Extension{*ext})
+				if err != nil {
+					b.Fatalf("Failed to generate cpabe key: %s", err)
+				}
+			}
+			b.StopTimer()
+		})
+	}
+}
+
+func BenchmarkGenerateCPABEKeyParallel(b *testing.B) {
+	b.StopTimer()
+	srv := getServerForBenchmark(serverbPort, rootDir, "", -1, b)
+	err := srv.Start()
+	if err != nil {
+		b.Fatalf("Server failed to start: %v", err)
+	}
+	defer cleanup(srv)
+
+	ext, err := createCPABEAttrExtension(10)
+	if err != nil {
+		b.Fatalf("Failed to create attribute extension: %s", err)
+	}
+	b.StartTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, err := srv.CA.GenerateCPABEKeyBytes([]signer.Extension{*ext})
+			if err != nil {
+				b.Errorf("Failed to generate cpabe key: %s", err)
+			}
+		}
+	})
+	b.StopTimer()
+}
+
 func invokeRevokeBenchmark(b *testing.B) {
 	srv := getServerForBenchmark(serverbPort, rootDir, "", -1, b)
 	err := srv.Start()
@@ -506,6 +564,21 @@ func createGetCACertRequest(client *Client) (*http.Request, error) {
 	return cainforeq, nil
 }
 
+func createCPABEAttrExtension(attrCount int) (*signer.Extension, error) {
+	attrs := &attrmgr.Attributes{Attrs: map[string]string{}}
+	for i := 0; i < attrCount; i++ {
+		attrs.Attrs["attr"+strconv.Itoa(i)] = "value" + strconv.Itoa(i)
+	}
+	buf, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return &signer.Extension{
+		ID:    config.OID(attrmgr.AttrOID),
+		Value: hex.EncodeToString(buf),
+	}, nil
+}
+
 func createGenCRLRequest(user *Identity) (*http.Request, error) {
 	body, err := util.Marshal(&api.GenCRLRequest{CAName: ""}, "GenCRL")
 	if err != nil {
@@ -0,0 +1,199 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/audit"
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/signer"
+	"github.com/pkg/errors"
+)
+
+const (
+	// acmePathPrefix is the path prefix of the ACME server of the default CA
+	acmePathPrefix = "/acme/"
+	// acmeCAPathPrefix is the path prefix of the ACME servers of the other
+	// CAs, which is followed by the name of the CA
+	acmeCAPathPrefix = acmePathPrefix + "ca/"
+)
+
+func newACMEAccountsEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:    "acmeaccounts",
+		Methods: []string{"POST"},
+		Handler: acmeAccountsHandler,
+		Server:  s,
+	}
+}
+
+// Handle a request for an ACME external account binding key. An identity
+// can get a key for itself, or for an identity it can manage.
+func acmeAccountsHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	var req api.ACMEAccountRequest
+	err := ctx.ReadBody(&req)
+	if err != nil {
+		return nil, err
+	}
+	caller, err := ctx.TokenAuthentication()
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ctx.GetCA()
+	if err != nil {
+		return nil, err
+	}
+	if ca.acme == nil {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrAuthorizationFailure, "ACME is not enabled for CA '%s'", ca.Config.CA.Name)
+	}
+	id := req.ID
+	if id == "" {
+		id = caller
+	}
+	if id != caller {
+		_, err = ctx.GetUser(id)
+		if err != nil {
+			return nil, caerrors.NewAuthorizationErr(caerrors.ErrGettingUser, "The identity '%s' cannot create an ACME account for '%s': %s", caller, id, err)
+		}
+	}
+	keyID, hmacKey, err := ca.acme.CreateAccount(id)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrGettingUser, "Failed to create ACME account: %s", err)
+	}
+	log.Debugf("Identity '%s' created ACME account %s for '%s'", caller, keyID, id)
+	return &api.ACMEAccountResponse{KeyID: keyID, HMACKey: hmacKey}, nil
+}
+
+// registerACMEHandler registers the handler of the ACME servers of the CAs.
+// The ACME server of the default CA is at /acme/ and the ACME server of
+// any CA is at /acme/ca/<caname>/.
+func (s *Server) registerACMEHandler() {
+	s.mux.PathPrefix(acmePathPrefix).Handler(http.HandlerFunc(s.serveACME)).Name("acme")
+}
+
+func (s *Server) serveACME(w http.ResponseWriter, r *http.Request) {
+	name := s.getCAName()
+	prefix := acmePathPrefix
+	if strings.HasPrefix(r.URL.Path, acmeCAPathPrefix) {
+		name = strings.SplitN(strings.TrimPrefix(r.URL.Path, acmeCAPathPrefix), "/", 2)[0]
+		prefix = acmeCAPathPrefix + name + "/"
+	}
+	ca := s.lookupCA(name)
+	if ca == nil {
+		http.NotFound(w, r)
+		return
+	}
+	// The ACME server locks the settings of the CA when it calls it
+	ca.stateMutex.RLock()
+	server := ca.acme
+	ca.stateMutex.RUnlock()
+	if server == nil {
+		http.NotFound(w, r)
+		return
+	}
+	server.Handler(prefix).ServeHTTP(w, r)
+}
+
+// acmeCA is the CA of an ACME server
+type acmeCA struct {
+	ca *CA
+}
+
+// DB returns the database of the CA
+func (a *acmeCA) DB() (db.FabricCADB, error) {
+	a.ca.stateMutex.RLock()
+	defer a.ca.stateMutex.RUnlock()
+	if a.ca.db == nil {
+		return nil, errors.Errorf("The database of CA '%s' is not initialized", a.ca.Config.CA.Name)
+	}
+	return a.ca.db, nil
+}
+
+// Issue signs the certificate of an ACME order for the identity to which
+// the ACME account is bound. The certificate has the identity as its
+// common name and the validated DNS names as its subject alternative names.
+// The issuance is recorded in the audit log of the CA.
+func (a *acmeCA) Issue(enrollmentID string, csrDER []byte, identifiers []string) (certs []byte, err error) {
+	ca := a.ca
+	ca.stateMutex.RLock()
+	defer ca.stateMutex.RUnlock()
+	defer func() {
+		// The ACME server answers a failed issuance with an internal error
+		rec := &audit.Record{
+			Caller:      enrollmentID,
+			Action:      "POST acme/finalize",
+			Target:      strings.Join(identifiers, ","),
+			RequestHash: requestHash(csrDER),
+			Status:      http.StatusOK,
+		}
+		if err != nil {
+			rec.Status = http.StatusInternalServerError
+		}
+		ca.appendAudit(rec)
+	}()
+	caller, err := ca.registry.GetUser(enrollmentID, nil)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Failed to get identity '%s'", enrollmentID)
+	}
+	if caller.IsRevoked() {
+		return nil, errors.Errorf("The identity '%s' is revoked", enrollmentID)
+	}
+	err = checkSuspended(caller)
+	if err != nil {
+		return nil, err
+	}
+	csrReq, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid CSR")
+	}
+	profile := ca.Config.ACME.Profile
+	isForCACert, err := isRequestForCASigningCert(csrReq, ca, profile)
+	if err != nil {
+		return nil, err
+	}
+	if isForCACert {
+		return nil, errors.New("ACME cannot be used to issue CA certificates")
+	}
+	err = csrInputLengthCheck(csrReq)
+	if err != nil {
+		return nil, errors.WithMessage(err, "CSR input validation failed")
+	}
+
+	req := signer.SignRequest{
+		Request: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})),
+		Hosts:   identifiers,
+		Profile: profile,
+		Subject: &signer.Subject{CN: enrollmentID},
+	}
+	setRequestOUs(&req, caller)
+	req.NotAfter = time.Now().Round(time.Minute).Add(getSigningProfile(ca, profile).Expiry).UTC()
+	_, notAfter, err := ca.getCACertExpiry()
+	if err != nil {
+		return nil, errors.New("Failed to get CA certificate information")
+	}
+	if !notAfter.IsZero() && req.NotAfter.After(notAfter) {
+		req.NotAfter = notAfter
+	}
+	cert, err := ca.enrollSigner.Sign(req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Certificate signing failure")
+	}
+	chain, err := ca.getCAChain()
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Failed to get the chain of CA '%s'", ca.Config.CA.Name)
+	}
+	log.Infof("Issued ACME certificate for %v to identity '%s'", identifiers, enrollmentID)
+	return append(cert, chain...), nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACME(t *testing.T) {
+	srv := TestGetRootServer(t)
+	srv.CA.Config.ACME.Enabled = true
+	srv.CA.Config.Audit.Enabled = true
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	// The ACME server of the default CA is also served under its name
+	for _, path := range []string{"/acme/directory", "/acme/ca/" + srv.CA.Config.CA.Name + "/directory"} {
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%d%s", rootPort, path))
+		util.FatalError(t, err, "Failed to get ACME directory")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+	}
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/acme/ca/unknown/directory", rootPort))
+	util.FatalError(t, err, "Failed to get ACME directory")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// An identity gets an external account binding key for itself
+	c := TestGetRootClient()
+	enrollResp, err := c.Enroll(&api.EnrollmentRequest{
+		Name:   "admin",
+		Secret: "adminpw",
+	})
+	util.FatalError(t, err, "Failed to enroll 'admin'")
+	admin := enrollResp.Identity
+	account, err := admin.CreateACMEAccount(&api.ACMEAccountRequest{})
+	util.FatalError(t, err, "Failed to create ACME account")
+	assert.NotEmpty(t, account.KeyID)
+	assert.NotEmpty(t, account.HMACKey)
+
+	// The identity must exist
+	_, err = admin.CreateACMEAccount(&api.ACMEAccountRequest{ID: "unknown"})
+	assert.Error(t, err, "Creating an ACME account for an unknown identity should fail")
+
+	// Certificates of ACME orders are issued to the identity of the account
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	util.FatalError(t, err, "Failed to generate key")
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "peer1.example.com"},
+		DNSNames: []string{"peer1.example.com"},
+	}, key)
+	util.FatalError(t, err, "Failed to create CSR")
+	chain, err := (&acmeCA{ca: &srv.CA}).Issue("admin", csr, []string{"peer1.example.com"})
+	util.FatalError(t, err, "Failed to issue ACME certificate")
+	certs, err := util.GetX509CertificatesFromPEM(chain)
+	util.FatalError(t, err, "Failed to parse certificate chain")
+	if assert.Len(t, certs, 2) {
+		assert.Equal(t, "admin", certs[0].Subject.CommonName)
+		assert.Equal(t, []string{"peer1.example.com"}, certs[0].DNSNames)
+		assert.NoError(t, certs[0].CheckSignatureFrom(certs[1]))
+	}
+	_, err = (&acmeCA{ca: &srv.CA}).Issue("unknown", csr, []string{"peer1.example.com"})
+	assert.Error(t, err, "Issuing an ACME certificate to an unknown identity should fail")
+
+	// The issuances are recorded in the audit log
+	recs, err := srv.CA.audit.Records(1, maxAuditLimit)
+	util.FatalError(t, err, "Failed to get audit log")
+	if assert.True(t, len(recs) >= 2) {
+		issued, failed := recs[len(recs)-2], recs[len(recs)-1]
+		assert.Equal(t, "POST acme/finalize", issued.Action)
+		assert.Equal(t, "admin", issued.Caller)
+		assert.Equal(t, "peer1.example.com", issued.Target)
+		assert.Equal(t, http.StatusOK, issued.Status)
+		assert.Equal(t, "unknown", failed.Caller)
+		assert.Equal(t, http.StatusInternalServerError, failed.Status)
+	}
+}
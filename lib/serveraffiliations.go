@@ -18,6 +18,7 @@ import (
 	"github.com/hyperledger/fabric-ca/lib/server/db/util"
 	"github.com/hyperledger/fabric-ca/lib/server/user"
 	cadbuser "github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
 	"github.com/hyperledger/fabric-ca/lib/spi"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
 	"github.com/pkg/errors"
@@ -260,6 +261,12 @@ func processAffiliationDeleteRequest(ctx *serverRequestContextImpl, caname strin
 	if err != nil {
 		return nil, err
 	}
+	for _, aff := range result.Affiliations {
+		ctx.ca.emitEvent(webhook.AffiliationRemoved, &affiliationEvent{Name: aff.GetName(), Caller: ctx.enrollmentID})
+	}
+	for _, id := range result.Identities {
+		ctx.ca.emitEvent(webhook.IdentityRemoved, &identityEvent{ID: id.GetName(), Caller: ctx.enrollmentID})
+	}
 
 	resp, err := getResponse(result, caname)
 	if err != nil {
@@ -343,6 +350,8 @@ func processAffiliationPostRequest(ctx *serverRequestContextImpl, caname string)
 
 	}
 
+	ctx.ca.emitEvent(webhook.AffiliationAdded, &affiliationEvent{Name: addAffiliation, Caller: ctx.enrollmentID})
+
 	resp := &api.AffiliationResponse{CAName: caname}
 	resp.Name = addAffiliation
 
@@ -398,6 +407,7 @@ func processAffiliationPutRequest(ctx *serverRequestContextImpl, caname string)
 	if err != nil {
 		return nil, errors.WithMessage(err, fmt.Sprintf("Failed to modify affiliation from '%s' to '%s'", modifyAffiliation, newAffiliation))
 	}
+	ctx.ca.emitEvent(webhook.AffiliationModified, &affiliationEvent{Name: modifyAffiliation, NewName: newAffiliation, Caller: ctx.enrollmentID})
 
 	resp, err := getResponse(result, caname)
 	if err != nil {
@@ -0,0 +1,575 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	gmux "github.com/gorilla/mux"
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/approval"
+	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+// approvalKey is the key of the approval request in the context of an
+// approved request which runs
+type approvalKey struct{}
+
+func newApprovalsEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:    "approvals",
+		Methods: []string{"GET"},
+		Handler: approvalsHandler,
+		Server:  s,
+	}
+}
+
+func newApprovalEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:    "approvals/{id}",
+		Methods: []string{"GET"},
+		Handler: approvalHandler,
+		Server:  s,
+	}
+}
+
+func newApproveEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:    "approvals/{id}/approve",
+		Methods: []string{"POST"},
+		Handler: approveHandler,
+		Server:  s,
+	}
+}
+
+func newRejectEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:    "approvals/{id}/reject",
+		Methods: []string{"POST"},
+		Handler: rejectHandler,
+		Server:  s,
+	}
+}
+
+// approvedHandler returns the handler of an endpoint whose requests may need
+// approval
+func approvedHandler(endpoint string) func(ctx *serverRequestContextImpl) (interface{}, error) {
+	switch endpoint {
+	case "register":
+		return registerHandler
+	case "identities":
+		return identitiesStreamingHandler
+	case "identities/{id}":
+		return identitiesHandler
+	case "revoke":
+		return revokeHandler
+	}
+	return nil
+}
+
+// approvalPending is returned by the handler of a request which is pending
+// approval, which is answered with the approval request instead
+type approvalPending struct {
+	resp *api.ApprovalResponse
+}
+
+func (e *approvalPending) Error() string {
+	return fmt.Sprintf("Request is pending as approval request '%s'", e.resp.ID)
+}
+
+// requireApproval returns an approvalPending error if an approval policy
+// applies to a request. The request is then stored until other registrars
+// approve or reject it. No error is returned for the requests which need no
+// approval, nor for the approved requests which run.
+func (ca *CA) requireApproval(ctx ServerRequestContext, op, target, affiliation, idType string, attrs []string) error {
+	required, policy := ca.Config.Approvals.Required(op, attrs)
+	if required == 0 {
+		return nil
+	}
+	r := ctx.GetReq()
+	if approvalFromRequest(r) != nil {
+		return nil
+	}
+	caller, err := ctx.GetCaller()
+	if err != nil {
+		return err
+	}
+	body, err := approvalRequestBody(ctx, op)
+	if err != nil {
+		return err
+	}
+	route := gmux.CurrentRoute(r)
+	if route == nil {
+		return caerrors.NewHTTPErr(500, caerrors.ErrHTTPRequest, "Failed to correctly handle HTTP request")
+	}
+	vars, err := json.Marshal(gmux.Vars(r))
+	if err != nil {
+		return caerrors.NewHTTPErr(500, caerrors.ErrHTTPRequest, "Failed to encode the variables of the request: %s", err)
+	}
+	rec := &approval.Record{
+		Caller:      caller.GetName(),
+		Operation:   op,
+		Policy:      policy,
+		Target:      target,
+		Affiliation: affiliation,
+		Type:        idType,
+		Method:      r.Method,
+		Endpoint:    route.GetName(),
+		Vars:        string(vars),
+		Request:     body,
+		Required:    required,
+	}
+	err = ca.approvals().Insert(rec)
+	if err != nil {
+		return caerrors.NewHTTPErr(500, caerrors.ErrApprovalRequest, "Failed to store the request for approval: %s", err)
+	}
+	log.Infof("The %s request of '%s' for '%s' needs %d approvals by policy '%s'; it is pending as approval request '%s'",
+		op, rec.Caller, target, required, policy, rec.ID)
+	return &approvalPending{resp: &api.ApprovalResponse{
+		ApprovalInfo: approvalInfo(rec),
+		CAName:       ca.Config.CA.Name,
+	}}
+}
+
+// approvalRequestBody returns the body of a request which needs approval
+// without the secret it chooses, as the stored request can be read by the
+// registrars which act on it. An approved registration gets a generated
+// secret instead, and a modification which needs approval cannot set one.
+func approvalRequestBody(ctx ServerRequestContext, op string) (string, error) {
+	var body map[string]json.RawMessage
+	err := ctx.ReadBody(&body)
+	if err != nil {
+		return "", err
+	}
+	if secret, ok := body["secret"]; ok {
+		if op == approval.Modify && string(secret) != `""` {
+			return "", caerrors.NewHTTPErr(400, caerrors.ErrApprovalRequest, "A modify request which needs approval cannot set the secret; reset the secret once the request ran")
+		}
+		delete(body, "secret")
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return "", caerrors.NewHTTPErr(500, caerrors.ErrApprovalRequest, "Failed to encode the request for approval: %s", err)
+	}
+	return string(b), nil
+}
+
+// checkBatchApproval returns an error if an approval policy applies to an
+// entry of a batch request, which must then be sent alone
+func (ca *CA) checkBatchApproval(op, id string, attrs []string) error {
+	required, policy := ca.Config.Approvals.Required(op, attrs)
+	if required > 0 {
+		return caerrors.NewHTTPErr(403, caerrors.ErrApprovalRequest, "The %s request for '%s' needs %d approvals by policy '%s', so it cannot be part of a batch request",
+			op, id, required, policy)
+	}
+	return nil
+}
+
+// approvals returns the store of the requests which need approval
+func (ca *CA) approvals() *approval.DBStore {
+	return approval.NewDBStore(ca.db)
+}
+
+// approvalFromRequest returns the approval request of an approved request
+// which runs, or nil
+func approvalFromRequest(r *http.Request) *approval.Record {
+	if r == nil {
+		return nil
+	}
+	rec, _ := r.Context().Value(approvalKey{}).(*approval.Record)
+	return rec
+}
+
+// approvedAuthentication authenticates an approved request which runs as the
+// caller which made it, which must still be neither revoked nor suspended
+func (ctx *serverRequestContextImpl) approvedAuthentication(rec *approval.Record) (string, error) {
+	ctx.enrollmentID = rec.Caller
+	caller, err := ctx.GetCaller()
+	if err != nil {
+		return "", err
+	}
+	if caller.IsRevoked() {
+		return "", caerrors.NewAuthenticationErr(caerrors.ErrRevokedID, "Identity '%s' which made approval request '%s' is revoked", rec.Caller, rec.ID)
+	}
+	err = checkSuspended(caller)
+	if err != nil {
+		return "", err
+	}
+	log.Debugf("Running approval request '%s' as '%s'", rec.ID, rec.Caller)
+	return rec.Caller, nil
+}
+
+// Handle a request to list the requests with a status, by default those
+// pending approval. Registrars see the requests on the identities they can
+// act on, and every caller sees its own requests.
+func approvalsHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	callerID, err := ctx.TokenAuthentication()
+	if err != nil {
+		return nil, err
+	}
+	caname, err := ctx.getCAName()
+	if err != nil {
+		return nil, err
+	}
+	status := ctx.GetQueryParm("status")
+	if status == "" {
+		status = approval.StatusPending
+	}
+	recs, err := ctx.ca.approvals().List(status)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrApprovalRequest, "Failed to get approval requests: %s", err)
+	}
+	resp := &api.GetApprovalsResponse{
+		Approvals: []api.ApprovalInfo{},
+		CAName:    caname,
+	}
+	for _, rec := range recs {
+		if ctx.canSeeApproval(rec, callerID) != nil {
+			continue
+		}
+		resp.Approvals = append(resp.Approvals, approvalInfo(rec))
+	}
+	return resp, nil
+}
+
+// Handle a request to get a request which needs approval
+func approvalHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	callerID, err := ctx.TokenAuthentication()
+	if err != nil {
+		return nil, err
+	}
+	caname, err := ctx.getCAName()
+	if err != nil {
+		return nil, err
+	}
+	rec, err := ctx.getApproval()
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.canSeeApproval(rec, callerID)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ApprovalResponse{
+		ApprovalInfo: approvalInfo(rec),
+		CAName:       caname,
+	}, nil
+}
+
+// Handle a request to approve a pending request. The request runs as soon as
+// it has the approvals it needs, with the checks it would have had if it
+// had needed none. Its response, such as the secret of a registered
+// identity, is only returned to the registrar whose approval ran it.
+func approveHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	callerID, err := ctx.TokenAuthentication()
+	if err != nil {
+		return nil, err
+	}
+	caname, err := ctx.getCAName()
+	if err != nil {
+		return nil, err
+	}
+	rec, err := ctx.getApproval()
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.canDecide(rec, callerID, true)
+	if err != nil {
+		return nil, err
+	}
+	prev := *rec
+	approvers := append(rec.Approvers(), callerID)
+	rec.ApprovedBy = strings.Join(approvers, ",")
+	if len(approvers) >= rec.Required {
+		rec.Status = approval.StatusApproved
+	}
+	err = ctx.updateApproval(rec, &prev)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Approval request '%s' was approved by '%s' (%d of %d approvals)", rec.ID, callerID, len(approvers), rec.Required)
+	var result json.RawMessage
+	if rec.Status == approval.StatusApproved {
+		result = ctx.runApproved(rec)
+	}
+	resp := &api.ApprovalResponse{
+		ApprovalInfo: approvalInfo(rec),
+		CAName:       caname,
+	}
+	resp.Result = result
+	return resp, nil
+}
+
+// Handle a request to reject a pending request, which the caller which made
+// it may also do to withdraw it
+func rejectHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	var req api.RejectApprovalRequest
+	_, err := ctx.TryReadBody(&req)
+	if err != nil {
+		return nil, err
+	}
+	callerID, err := ctx.TokenAuthentication()
+	if err != nil {
+		return nil, err
+	}
+	caname, err := ctx.getCAName()
+	if err != nil {
+		return nil, err
+	}
+	rec, err := ctx.getApproval()
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.canDecide(rec, callerID, false)
+	if err != nil {
+		return nil, err
+	}
+	prev := *rec
+	rec.Status = approval.StatusRejected
+	rec.Reason = fmt.Sprintf("Rejected by '%s'", callerID)
+	if req.Reason != "" {
+		rec.Reason = fmt.Sprintf("%s: %s", rec.Reason, req.Reason)
+	}
+	err = ctx.updateApproval(rec, &prev)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Approval request '%s' was rejected by '%s'", rec.ID, callerID)
+	return &api.ApprovalResponse{
+		ApprovalInfo: approvalInfo(rec),
+		CAName:       caname,
+	}, nil
+}
+
+// getApproval returns the approval request named by the path of the request
+func (ctx *serverRequestContextImpl) getApproval() (*approval.Record, error) {
+	id, err := ctx.GetVar("id")
+	if err != nil {
+		return nil, err
+	}
+	rec, err := ctx.ca.approvals().Get(id)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(404, caerrors.ErrApprovalRequest, "Approval request '%s' was not found: %s", id, err)
+	}
+	return rec, nil
+}
+
+// updateApproval stores the changes of an approval request, unless another
+// request changed it first
+func (ctx *serverRequestContextImpl) updateApproval(rec, prev *approval.Record) error {
+	ok, err := ctx.ca.approvals().Update(rec, prev)
+	if err != nil {
+		return caerrors.NewHTTPErr(500, caerrors.ErrApprovalRequest, "%s", err)
+	}
+	if !ok {
+		return caerrors.NewHTTPErr(409, caerrors.ErrApprovalRequest, "Approval request '%s' was changed by another request; try again", rec.ID)
+	}
+	return nil
+}
+
+// canSeeApproval returns an error unless the caller made the approval
+// request, or is a registrar which can act on the identity of the request
+func (ctx *serverRequestContextImpl) canSeeApproval(rec *approval.Record, callerID string) error {
+	if rec.Caller == callerID {
+		return nil
+	}
+	return ctx.canActOnApproval(rec)
+}
+
+// canActOnApproval returns an error unless the caller is a registrar which
+// can act on the affiliation and type of the identity of an approval request
+func (ctx *serverRequestContextImpl) canActOnApproval(rec *approval.Record) error {
+	err := ctx.IsRegistrar()
+	if err != nil {
+		return err
+	}
+	err = ctx.ContainsAffiliation(rec.Affiliation)
+	if err != nil {
+		return err
+	}
+	return ctx.CanActOnType(rec.Type)
+}
+
+// canDecide returns an error if the caller cannot approve, or reject, an
+// approval request. A request can only be approved by registrars other than
+// the caller which made it, once each and before it expires.
+func (ctx *serverRequestContextImpl) canDecide(rec *approval.Record, callerID string, approve bool) error {
+	action := "rejected"
+	if approve {
+		action = "approved"
+	}
+	if rec.Status != approval.StatusPending {
+		return caerrors.NewHTTPErr(400, caerrors.ErrApprovalRequest, "Approval request '%s' is %s and cannot be %s", rec.ID, rec.Status, action)
+	}
+	if !approve && rec.Caller == callerID {
+		return nil
+	}
+	if approve {
+		if rec.Caller == callerID {
+			return caerrors.NewHTTPErr(403, caerrors.ErrApprovalRequest, "Approval request '%s' cannot be approved by the caller which made it", rec.ID)
+		}
+		if rec.Expired(ctx.ca.Config.Approvals.Expiry) {
+			return caerrors.NewHTTPErr(400, caerrors.ErrApprovalRequest, "Approval request '%s' has expired", rec.ID)
+		}
+		if rec.HasApproved(callerID) {
+			return caerrors.NewHTTPErr(400, caerrors.ErrApprovalRequest, "Approval request '%s' was already approved by '%s'", rec.ID, callerID)
+		}
+	}
+	return ctx.canActOnApproval(rec)
+}
+
+// runApproved runs an approved request as the caller which made it, stores
+// its status or error, and returns its response. The response is not
+// stored, as it may hold the secret of an identity.
+func (ctx *serverRequestContextImpl) runApproved(rec *approval.Record) json.RawMessage {
+	prev := *rec
+	var result json.RawMessage
+	resp, err := ctx.executeApproved(rec)
+	if err != nil {
+		log.Infof("Approved request '%s' failed: %s", rec.ID, err)
+		rec.Status = approval.StatusFailed
+		rec.Reason = approvalError(err)
+	} else {
+		log.Infof("Approved request '%s' ran successfully", rec.ID)
+		rec.Status = approval.StatusExecuted
+		result, err = json.Marshal(resp)
+		if err != nil {
+			log.Warningf("Failed to encode the result of approval request '%s': %s", rec.ID, err)
+		}
+	}
+	_, err = ctx.ca.approvals().Update(rec, &prev)
+	if err != nil {
+		log.Errorf("Failed to store the status of approval request '%s': %s", rec.ID, err)
+	}
+	return result
+}
+
+// executeApproved calls the handler of an approved request with the request
+// as it was received
+func (ctx *serverRequestContextImpl) executeApproved(rec *approval.Record) (interface{}, error) {
+	handler := approvedHandler(rec.Endpoint)
+	if handler == nil {
+		return nil, errors.Errorf("Requests to endpoint '%s' cannot be approved", rec.Endpoint)
+	}
+	var vars map[string]string
+	err := json.Unmarshal([]byte(rec.Vars), &vars)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid variables of the request")
+	}
+	path := rec.Endpoint
+	for name, value := range vars {
+		path = strings.Replace(path, "{"+name+"}", url.PathEscape(value), -1)
+	}
+	r, err := http.NewRequest(rec.Method, fmt.Sprintf("%s%s?ca=%s", apiPathPrefix, path, url.QueryEscape(ctx.ca.Config.CA.Name)),
+		strings.NewReader(rec.Request))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create the request")
+	}
+	r = gmux.SetURLVars(r, vars)
+	r = r.WithContext(context.WithValue(r.Context(), approvalKey{}, rec))
+	se := &serverEndpoint{
+		Path:    rec.Endpoint,
+		Methods: []string{rec.Method},
+		Handler: handler,
+		Server:  ctx.endpoint.Server,
+	}
+	nested := newServerRequestContext(r, &approvalResponseWriter{header: http.Header{}}, se)
+	// The request runs on the CA which the approving request already locked,
+	// so the nested context must neither lock it again nor release it
+	nested.ca = ctx.ca
+	return handler(nested)
+}
+
+// approvalResponseWriter is the response writer of an approved request which
+// runs, whose response is kept by the approval request instead
+type approvalResponseWriter struct {
+	header http.Header
+}
+
+func (w *approvalResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *approvalResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *approvalResponseWriter) WriteHeader(statusCode int) {}
+
+// approvalError returns the error of an approved request which failed as the
+// caller would have received it
+func approvalError(err error) string {
+	if he, ok := errors.Cause(err).(*caerrors.HTTPErr); ok {
+		return he.GetRemoteMsg()
+	}
+	return err.Error()
+}
+
+// approvalInfo returns the information of an approval request
+func approvalInfo(rec *approval.Record) api.ApprovalInfo {
+	return api.ApprovalInfo{
+		ID:          rec.ID,
+		Caller:      rec.Caller,
+		Operation:   rec.Operation,
+		Policy:      rec.Policy,
+		Target:      rec.Target,
+		Affiliation: rec.Affiliation,
+		Type:        rec.Type,
+		Required:    rec.Required,
+		ApprovedBy:  rec.Approvers(),
+		Status:      rec.Status,
+		Reason:      rec.Reason,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   rec.UpdatedAt,
+	}
+}
+
+// attributeNames returns the names of attributes
+func attributeNames(attrs []api.Attribute) []string {
+	names := make([]string, len(attrs))
+	for i, attr := range attrs {
+		names[i] = attr.Name
+	}
+	return names
+}
+
+// userAttributeNames returns the names of the attributes of an identity
+func userAttributeNames(u user.User) ([]string, error) {
+	attrs, err := u.GetAttributes(nil)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrGettingUser, "Failed to get the attributes of identity '%s': %s", u.GetName(), err)
+	}
+	return attributeNames(attrs), nil
+}
+
+// modifyAttributeNames returns the names of the attributes which an identity
+// has or is given by a modify request
+func modifyAttributeNames(req *api.ModifyIdentityRequest, u user.User) ([]string, error) {
+	names, err := userAttributeNames(u)
+	if err != nil {
+		return nil, err
+	}
+	return append(names, attributeNames(req.Attributes)...), nil
+}
+
+// requireRevokeApproval requires approval of the revocation of an identity,
+// or of its certificate with a serial number, if an approval policy applies
+func (ca *CA) requireRevokeApproval(ctx ServerRequestContext, target string, u user.User) error {
+	attrs, err := userAttributeNames(u)
+	if err != nil {
+		return err
+	}
+	return ca.requireApproval(ctx, approval.Revoke, target, user.GetAffiliation(u), u.GetType(), attrs)
+}
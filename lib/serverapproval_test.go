@@ -0,0 +1,164 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/server/approval"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApprovals(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	admin := resp.Identity
+
+	// Register the approvers before the policies apply
+	approvers := []*Identity{}
+	for _, name := range []string{"approver1", "approver2"} {
+		rr, err := admin.Register(&api.RegistrationRequest{
+			Name:        name,
+			Affiliation: ".",
+			Attributes:  []api.Attribute{{Name: "hf.Registrar.Roles", Value: "*"}},
+		})
+		util.FatalError(t, err, "Failed to register approver")
+		resp, err = client.Enroll(&api.EnrollmentRequest{Name: name, Secret: rr.Secret})
+		util.FatalError(t, err, "Failed to enroll approver")
+		approvers = append(approvers, resp.Identity)
+	}
+
+	srv.CA.Config.Approvals.Policies = []approval.Policy{
+		{Name: "registrars", Operations: []string{approval.Register, approval.Modify}, Attributes: []string{"hf.Registrar.Roles"}, Approvals: 2},
+		{Name: "revocations", Operations: []string{approval.Revoke}, Approvals: 1},
+	}
+
+	// A registration to which no policy applies runs at once
+	rr, err := admin.Register(&api.RegistrationRequest{Name: "user1"})
+	util.FatalError(t, err, "Failed to register user 'user1'")
+
+	_, err = admin.Register(&api.RegistrationRequest{
+		Name:       "registrar1",
+		Secret:     "registrar1pw",
+		Attributes: []api.Attribute{{Name: "hf.Registrar.Roles", Value: "client"}},
+	})
+	id := pendingApprovalID(t, err)
+	_, err = srv.CA.registry.GetUser("registrar1", nil)
+	assert.Error(t, err, "A pending registration should not be stored")
+	rec, err := srv.CA.approvals().Get(id)
+	util.FatalError(t, err, "Failed to get the stored approval request")
+	assert.NotContains(t, rec.Request, "registrar1pw", "The chosen secret should not be stored")
+
+	list, err := approvers[0].GetApprovals("", "")
+	util.FatalError(t, err, "Failed to list pending approval requests")
+	if assert.Len(t, list.Approvals, 1) {
+		assert.Equal(t, id, list.Approvals[0].ID)
+		assert.Equal(t, "registrar1", list.Approvals[0].Target)
+		assert.Equal(t, 2, list.Approvals[0].Required)
+	}
+
+	_, err = admin.Approve(id, "")
+	assert.Error(t, err, "The caller which made a request should not approve it")
+	ar, err := approvers[0].Approve(id, "")
+	util.FatalError(t, err, "Failed to approve request")
+	assert.Equal(t, approval.StatusPending, ar.Status)
+	_, err = approvers[0].Approve(id, "")
+	assert.Error(t, err, "A registrar should not approve a request twice")
+	ar, err = approvers[1].Approve(id, "")
+	util.FatalError(t, err, "Failed to approve request")
+	assert.Equal(t, approval.StatusExecuted, ar.Status)
+	_, err = srv.CA.registry.GetUser("registrar1", nil)
+	assert.NoError(t, err, "The approved registration should be stored")
+
+	// The response, with a generated secret, is only returned to the
+	// registrar whose approval ran the request
+	var regResp api.RegistrationResponse
+	err = json.Unmarshal(ar.Result, &regResp)
+	util.FatalError(t, err, "Failed to decode the result of the approved registration")
+	assert.NotEqual(t, "registrar1pw", regResp.Secret)
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "registrar1", Secret: regResp.Secret})
+	assert.NoError(t, err, "Failed to enroll with the secret of the approved registration")
+	ar, err = admin.GetApproval(id, "")
+	util.FatalError(t, err, "Failed to get approval request")
+	assert.Equal(t, approval.StatusExecuted, ar.Status)
+	assert.Empty(t, ar.Result)
+
+	// A modification which needs approval cannot set the secret
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "registrar1", Secret: "newpw"})
+	if assert.Error(t, err, "A modification which needs approval should not set the secret") {
+		assert.Contains(t, err.Error(), "cannot set the secret")
+	}
+
+	// A rejected request does not run
+	_, err = admin.Revoke(&api.RevocationRequest{Name: "user1"})
+	id = pendingApprovalID(t, err)
+	ar, err = approvers[0].Reject(&api.RejectApprovalRequest{ID: id, Reason: "not expected"})
+	util.FatalError(t, err, "Failed to reject request")
+	assert.Equal(t, approval.StatusRejected, ar.Status)
+	assert.Contains(t, ar.Reason, "not expected")
+	_, err = approvers[1].Approve(id, "")
+	assert.Error(t, err, "A rejected request should not be approved")
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "user1", Secret: rr.Secret})
+	assert.NoError(t, err, "The identity of a rejected revocation should not be revoked")
+
+	// A request cannot be part of a batch if a policy applies to it
+	batchResp, err := admin.Batch(&api.BatchRequest{Identities: []api.BatchIdentity{
+		{RegistrationRequest: api.RegistrationRequest{
+			Name:       "registrar2",
+			Attributes: []api.Attribute{{Name: "hf.Registrar.Roles", Value: "client"}},
+		}},
+	}})
+	util.FatalError(t, err, "Failed to send batch request")
+	if assert.Len(t, batchResp.Results, 1) {
+		assert.Equal(t, api.BatchFailed, batchResp.Results[0].Status)
+	}
+
+	// Running an approved request leaves the CA unlocked, so the
+	// configuration can still be reloaded
+	srv.ConfigLoader = func() (*ServerConfig, error) {
+		cfg := *srv.Config
+		cfg.CAcfg = *srv.CA.Config
+		return &cfg, nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := srv.Reload()
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		assert.NoError(t, err, "Failed to reload after an approved request ran")
+	case <-time.After(10 * time.Second):
+		t.Fatal("Reloading after an approved request ran should not block")
+	}
+}
+
+// pendingApprovalID returns the ID of the approval request of the error of a
+// request which is pending
+func pendingApprovalID(t *testing.T, err error) string {
+	pending, ok := errors.Cause(err).(*ApprovalPendingError)
+	if !ok {
+		t.Fatalf("Request should be pending approval: %v", err)
+	}
+	return pending.Approval.ID
+}
@@ -0,0 +1,251 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	gmux "github.com/gorilla/mux"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/audit"
+	cadbfactory "github.com/hyperledger/fabric-ca/lib/server/db/factory"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultAuditLimit is the number of audit log entries returned by the
+	// audit endpoint if the request does not set a limit
+	defaultAuditLimit = 100
+	// maxAuditLimit is the maximum number of audit log entries returned by
+	// the audit endpoint
+	maxAuditLimit = 1000
+)
+
+// AuditLogResponse is the response of the audit endpoint
+type AuditLogResponse struct {
+	Records []*audit.Record `json:"records"`
+}
+
+// initAuditLog creates the audit log of the CA if auditing is enabled. The
+// audit log is kept in the CA's database unless a file is set.
+func (ca *CA) initAuditLog() {
+	ca.audit = nil
+	cfg := &ca.Config.Audit
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.File != "" {
+		ca.audit = audit.New(audit.NewFileStore(cfg.File))
+		return
+	}
+	ca.audit = audit.New(audit.NewDBStore(ca.db))
+}
+
+// audit appends an entry for the request to the audit log of the CA which
+// served it, with the status code of its response
+func (se *serverEndpoint) audit(ctx *serverRequestContextImpl, scode int, he *caerrors.HTTPErr) {
+	ca := ctx.ca
+	if ca == nil {
+		ca, _ = ctx.getCA()
+		if ca == nil {
+			ca = &se.Server.CA
+		}
+	}
+	if ca.audit == nil {
+		return
+	}
+	body, _ := ctx.ReadBodyBytes()
+	ca.auditRequest(ctx, se.Path, auditTarget(ctx, body), scode, he)
+}
+
+// auditRequest appends an entry for a request to the audit log of the CA.
+// action is the endpoint of the request and target what it acts on.
+func (ca *CA) auditRequest(ctx *serverRequestContextImpl, action, target string, scode int, he *caerrors.HTTPErr) {
+	r := ctx.req
+	body, _ := ctx.ReadBodyBytes()
+	rec := &audit.Record{
+		Caller:      ctx.enrollmentID,
+		Action:      r.Method + " " + action,
+		Target:      target,
+		RequestHash: requestHash([]byte(r.Method+" "+r.URL.RequestURI()+"\n"), body),
+		Status:      scode,
+	}
+	if rec.Caller == "" {
+		// The caller did not authenticate; record who it claimed to be
+		rec.Caller, _, _ = r.BasicAuth()
+	}
+	if he != nil {
+		rec.Status = he.GetStatusCode()
+		rec.ErrorCode = he.GetLocalCode()
+	}
+	ca.appendAudit(rec)
+}
+
+// appendAudit appends an entry to the audit log of the CA, if auditing is
+// enabled
+func (ca *CA) appendAudit(rec *audit.Record) {
+	if ca.audit == nil {
+		return
+	}
+	rec.CA = ca.Config.CA.Name
+	err := ca.audit.Append(rec)
+	if err != nil {
+		log.Errorf("Failed to record %s by '%s' in the audit log of CA '%s': %s", rec.Action, rec.Caller, rec.CA, err)
+	}
+}
+
+// requestHash returns the hex-encoded SHA-256 hash of the parts of a request
+func requestHash(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditTarget returns what the request acts on: the variables of its path,
+// such as the identity or affiliation, or else the identity, affiliation or
+// certificate serial number of its body
+func auditTarget(ctx *serverRequestContextImpl, body []byte) string {
+	vars := gmux.Vars(ctx.req)
+	if len(vars) > 0 {
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		values := make([]string, len(names))
+		for i, name := range names {
+			values[i] = vars[name]
+		}
+		return strings.Join(values, "/")
+	}
+	var req struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Serial string `json:"serial"`
+	}
+	if len(body) == 0 || json.Unmarshal(body, &req) != nil {
+		return ""
+	}
+	switch {
+	case req.ID != "":
+		return req.ID
+	case req.Name != "":
+		return req.Name
+	case req.Serial != "":
+		return "serial " + req.Serial
+	}
+	return ""
+}
+
+func newAuditEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:    "audit",
+		Methods: []string{"GET"},
+		Handler: auditHandler,
+		Server:  s,
+	}
+}
+
+// Handle a request for the entries of the audit log of a CA. Only
+// registrars can read the audit log.
+func auditHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	_, err := ctx.TokenAuthentication()
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ctx.GetCA()
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.IsRegistrar()
+	if err != nil {
+		return nil, err
+	}
+	if ca.audit == nil {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrAuditLog, "Auditing is not enabled for CA '%s'", ca.Config.CA.Name)
+	}
+	from, err := intQueryParm(ctx, "from", 1)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := intQueryParm(ctx, "limit", defaultAuditLimit)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+	recs, err := ca.audit.Records(int64(from), limit)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrAuditLog, "Failed to read the audit log: %s", err)
+	}
+	if recs == nil {
+		recs = []*audit.Record{}
+	}
+	return &AuditLogResponse{Records: recs}, nil
+}
+
+// intQueryParm returns the integer value of a query parameter, or def if the
+// parameter is not set
+func intQueryParm(ctx *serverRequestContextImpl, name string, def int) (int, error) {
+	param := ctx.GetQueryParm(name)
+	if param == "" {
+		return def, nil
+	}
+	value, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, caerrors.NewHTTPErr(400, caerrors.ErrBadReqBody, "Invalid value for the '%s' query parameter: %s", name, param)
+	}
+	return value, nil
+}
+
+// VerifyAuditLog checks the chain of hashes of the audit log of a CA and
+// returns its number of entries. caName is the name of the CA, or empty for
+// the default CA.
+func (s *Server) VerifyAuditLog(caName string) (int64, error) {
+	ca, err := s.getOfflineCA(caName)
+	if err != nil {
+		return 0, err
+	}
+	cfg := ca.Config
+	var store audit.Store
+	if cfg.Audit.File != "" {
+		store = audit.NewFileStore(cfg.Audit.File)
+	} else {
+		err = normalizeDBConfig(&cfg.DB, ca.HomeDir)
+		if err != nil {
+			return 0, err
+		}
+		caDB, err := cadbfactory.New(cfg.DB.Type, cfg.DB.Datasource, cfg.CA.Name, &cfg.DB.TLS, ca.csp, nil)
+		if err != nil {
+			return 0, err
+		}
+		err = caDB.Connect()
+		if err != nil {
+			return 0, err
+		}
+		sqlxdb, err := caDB.Create()
+		if err != nil {
+			return 0, err
+		}
+		defer sqlxdb.Close()
+		store = audit.NewDBStore(sqlxdb)
+	}
+	n, err := audit.Verify(store)
+	if err != nil {
+		return 0, errors.WithMessagef(err, "The audit log of CA '%s' is not valid", cfg.CA.Name)
+	}
+	return n, nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	srv := TestGetRootServer(t)
+	srv.CA.Config.Audit.Enabled = true
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	c := TestGetRootClient()
+	_, err = c.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "wrongpw"})
+	assert.Error(t, err, "Enrolling with a wrong secret should fail")
+	enrollResp, err := c.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll 'admin'")
+	admin := enrollResp.Identity
+	regResp, err := admin.Register(&api.RegistrationRequest{Name: "audituser", Affiliation: "org1"})
+	util.FatalError(t, err, "Failed to register 'audituser'")
+
+	resp, err := admin.GetAuditLog(&api.GetAuditLogRequest{From: 2})
+	util.FatalError(t, err, "Failed to get audit log")
+	if assert.Len(t, resp.Records, 2) {
+		enroll, register := resp.Records[0], resp.Records[1]
+		assert.Equal(t, int64(2), enroll.Seq)
+		assert.Equal(t, "POST enroll", enroll.Action)
+		assert.Equal(t, "admin", enroll.Caller)
+		assert.Equal(t, 201, enroll.Status)
+		assert.Equal(t, "POST register", register.Action)
+		assert.Equal(t, "audituser", register.Target)
+		assert.Equal(t, srv.CA.Config.CA.Name, register.CA)
+		assert.Equal(t, enroll.Hash, register.PrevHash)
+	}
+	resp, err = admin.GetAuditLog(&api.GetAuditLogRequest{Limit: 1})
+	util.FatalError(t, err, "Failed to get audit log")
+	if assert.Len(t, resp.Records, 1) {
+		assert.Equal(t, 401, resp.Records[0].Status)
+		assert.NotZero(t, resp.Records[0].ErrorCode)
+	}
+
+	// Only registrars can read the audit log
+	userResp, err := c.Enroll(&api.EnrollmentRequest{Name: "audituser", Secret: regResp.Secret})
+	util.FatalError(t, err, "Failed to enroll 'audituser'")
+	_, err = userResp.Identity.GetAuditLog(&api.GetAuditLogRequest{})
+	assert.Error(t, err, "A non-registrar should not be able to read the audit log")
+
+	err = srv.Stop()
+	util.FatalError(t, err, "Failed to stop server")
+	srv = TestGetServer2(false, rootPort, rootDir, "", -1, t)
+	n, err := srv.VerifyAuditLog("")
+	assert.NoError(t, err, "The audit log should be valid")
+	// The last entry is the request of the non-registrar
+	assert.Equal(t, int64(7), n)
+}
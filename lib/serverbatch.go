@@ -0,0 +1,232 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/approval"
+	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+// The maximum number of identities of a batch request
+const maxBatchSize = 1000
+
+func newIdentitiesBatchEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:    "identities/batch",
+		Methods: []string{"POST"},
+		Handler: identitiesBatchHandler,
+		Server:  s,
+	}
+}
+
+// Handle a request to register or modify many identities. Each entry is
+// checked as a register or modify request of the caller would be, and the
+// identities are stored in one transaction. Unless the request is best
+// effort, no identity is stored if any entry is not valid. The response has
+// the result of each entry, with the secrets of the registered identities
+// and of the modified identities whose secret was set.
+func identitiesBatchHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	var req api.BatchRequest
+	err := ctx.ReadBody(&req)
+	if err != nil {
+		return nil, err
+	}
+	callerID, err := ctx.TokenAuthentication()
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Received batch request from %s with %d identities", callerID, len(req.Identities))
+	if ctx.IsLDAPEnabled() {
+		return nil, caerrors.NewHTTPErr(403, caerrors.ErrInvalidLDAPAction, "Batch requests are not supported when using LDAP")
+	}
+	caname, err := ctx.getCAName()
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Identities) == 0 {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrBatchRequest, "No identities in batch request")
+	}
+	if len(req.Identities) > maxBatchSize {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrBatchRequest, "Batch request has %d identities, but at most %d are allowed", len(req.Identities), maxBatchSize)
+	}
+	ca := ctx.ca
+	accessor, ok := ca.registry.(*Accessor)
+	if !ok {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrBatchRequest, "Batch requests are not supported by the registry of CA '%s'", caname)
+	}
+	caller, err := ctx.GetCaller()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.BatchResponse{
+		Results: make([]api.BatchResult, len(req.Identities)),
+		CAName:  caname,
+	}
+	users := []*batchUser{}
+	indexes := []int{}
+	seen := map[string]bool{}
+	failed := false
+	for i := range req.Identities {
+		entry := &req.Identities[i]
+		result := &resp.Results[i]
+		result.ID = entry.Name
+		u, err := ctx.checkBatchEntry(entry, caller, result, seen)
+		if err != nil {
+			log.Debugf("Entry %d of batch request for identity '%s' is not valid: %s", i, entry.Name, err)
+			failed = true
+			setBatchError(result, err)
+			continue
+		}
+		users = append(users, u)
+		indexes = append(indexes, i)
+	}
+
+	if failed && !req.BestEffort {
+		for _, i := range indexes {
+			resp.Results[i] = api.BatchResult{ID: resp.Results[i].ID, Status: api.BatchSkipped}
+		}
+		return resp, nil
+	}
+
+	err = accessor.updateUsers(users)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrBatchRequest, "Failed to store the identities of the batch request: %s", err)
+	}
+
+	for j, u := range users {
+		result := &resp.Results[indexes[j]]
+		event := webhook.IdentityRegistered
+		result.Status = api.BatchRegistered
+		if !u.insert {
+			event = webhook.IdentityModified
+			result.Status = api.BatchModified
+			if u.updatePass {
+				result.Secret = u.info.Pass
+			}
+			ca.setBatchTOTPSeed(result)
+		}
+		ca.emitEvent(event, &identityEvent{ID: u.info.Name, Type: u.info.Type, Affiliation: u.info.Affiliation, Caller: callerID})
+	}
+	log.Debugf("Batch request of %s stored %d of %d identities", callerID, len(users), len(req.Identities))
+	return resp, nil
+}
+
+// checkBatchEntry checks an entry of a batch request and returns the
+// identity to be stored. The secret and TOTP seed of a registered identity
+// are set in the result.
+func (ctx *serverRequestContextImpl) checkBatchEntry(entry *api.BatchIdentity, caller user.User, result *api.BatchResult, seen map[string]bool) (*batchUser, error) {
+	if entry.Name == "" {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrBatchRequest, "No ID name specified in batch entry")
+	}
+	if seen[entry.Name] {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrBatchRequest, "Identity '%s' appears more than once in the batch request", entry.Name)
+	}
+	seen[entry.Name] = true
+
+	if entry.Modify {
+		return ctx.checkBatchModify(entry)
+	}
+
+	req := &entry.RegistrationRequest
+	normalizeRegistrationRequest(req, caller)
+	err := canRegister(caller, req, ctx.ca, ctx)
+	if err != nil {
+		log.Debugf("Registrar is not allowed to register user '%s': %s", req.Name, err)
+		return nil, caerrors.NewAuthorizationErr(caerrors.ErrRegistrarRegAuth, "Registration of '%s' failed", req.Name)
+	}
+	err = ctx.ca.addRoleAttributes(req, caller)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.ca.checkRegistrationAttrs(req)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.ca.checkBatchApproval(approval.Register, req.Name, attributeNames(req.Attributes))
+	if err != nil {
+		return nil, err
+	}
+	info, regResp, err := newUserInfo(req, ctx.ca)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Registration of '%s' failed", req.Name)
+	}
+	result.Secret = regResp.Secret
+	result.TOTPSeed = regResp.TOTPSeed
+	result.TOTPURI = regResp.TOTPURI
+	return &batchUser{info: info, insert: true}, nil
+}
+
+// checkBatchModify checks an entry of a batch request which modifies an
+// identity, as a request to modify the identity would be checked. A
+// suspension cannot be changed by a batch request.
+func (ctx *serverRequestContextImpl) checkBatchModify(entry *api.BatchIdentity) (*batchUser, error) {
+	if entry.TOTP || entry.SecretExpiry != "" {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrBatchRequest, "The 'totp' and 'secret_expiry' options of identity '%s' may only be set when it is registered", entry.Name)
+	}
+	userToModify, err := ctx.GetUser(entry.Name)
+	if err != nil {
+		return nil, err
+	}
+	req := &api.ModifyIdentityRequest{
+		ID:             entry.Name,
+		Type:           entry.Type,
+		Affiliation:    entry.Affiliation,
+		Attributes:     entry.Attributes,
+		MaxEnrollments: entry.MaxEnrollments,
+		Secret:         entry.Secret,
+	}
+	info, setPass, err := ctx.checkModifyRequest(req, userToModify)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := modifyAttributeNames(req, userToModify)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.ca.checkBatchApproval(approval.Modify, entry.Name, attrs)
+	if err != nil {
+		return nil, err
+	}
+	return &batchUser{info: info, updatePass: setPass}, nil
+}
+
+// setBatchTOTPSeed gives a modified identity a TOTP seed if its attributes
+// now require one, as a request to modify the identity would
+func (ca *CA) setBatchTOTPSeed(result *api.BatchResult) {
+	u, err := ca.registry.GetUser(result.ID, nil)
+	if err != nil {
+		log.Warningf("Failed to get modified identity '%s': %s", result.ID, err)
+		return
+	}
+	dbUser, ok := u.(*user.Impl)
+	if !ok || dbUser.TOTPSeed != "" || !ca.totp.Required(dbUser.Attributes) {
+		return
+	}
+	result.TOTPSeed, result.TOTPURI, err = ca.setTOTPSeed(dbUser)
+	if err != nil {
+		log.Warningf("Failed to set the TOTP seed of identity '%s': %s", result.ID, err)
+	}
+}
+
+// setBatchError sets the error of a result to the error which the caller
+// would receive for the entry alone
+func setBatchError(result *api.BatchResult, err error) {
+	result.Status = api.BatchFailed
+	if he, ok := errors.Cause(err).(*caerrors.HTTPErr); ok {
+		result.Code = he.GetRemoteCode()
+		result.Error = he.GetRemoteMsg()
+		return
+	}
+	result.Code = caerrors.ErrBatchRequest
+	result.Error = err.Error()
+}
@@ -8,6 +8,8 @@ package lib
 
 import (
 	"github.com/hyperledger/fabric-ca/lib/server/operations"
+	"github.com/hyperledger/fabric-ca/lib/server/ratelimit"
+	"github.com/hyperledger/fabric-ca/lib/server/replay"
 	"github.com/hyperledger/fabric-ca/lib/tls"
 )
 
@@ -54,12 +56,34 @@ type ServerConfig struct {
 	CRLSizeLimit int `def:"512000" help:"Size limit of an acceptable CRL in bytes"`
 	// CompMode1_3 determines if to run in comptability for version 1.3
 	CompMode1_3 bool `skip:"true"`
+	// CompMode1_4 determines if to accept the authorization tokens of the
+	// clients of version 1.4 and earlier, which have no time and nonce
+	CompMode1_4 bool `skip:"true"`
+	// OCSP contains the server wide configuration of the OCSP responder
+	OCSP ServerOCSPConfig
+	// EST contains the configuration of the EST (RFC 7030) endpoints
+	EST ESTConfig
+	// RateLimit contains the rate limits of the API endpoints
+	RateLimit ratelimit.Config
+	// Token contains the replay protection of the x509 authorization tokens
+	Token replay.Config
 	// Metrics contains the configuration for provider and statsd
 	Metrics operations.MetricsOptions `hide:"true"`
 	// Operations contains the configuration for the operations servers
 	Operations operations.Options `hide:"true"`
 }
 
+// ServerOCSPConfig contains the server wide OCSP responder options; the
+// responder itself is enabled per CA
+type ServerOCSPConfig struct {
+	Operations bool `def:"false" help:"Serve the OCSP responder on the operations listener in addition to the API listener"`
+}
+
+// ESTConfig contains the options of the EST (RFC 7030) endpoints
+type ESTConfig struct {
+	Enabled bool `def:"false" help:"Serve the EST endpoints under /.well-known/est"`
+}
+
 // CORS defines the Cross-Origin Resource Sharing settings for the server.
 type CORS struct {
 	Enabled bool     `help:"Enable CORS for the fabric-ca-server"`
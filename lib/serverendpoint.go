@@ -13,6 +13,7 @@ import (
 	"github.com/hyperledger/fabric-ca/lib/caerrors"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/api"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
 )
 
 // serverEndpoint represents a particular endpoint (e.g. to "/api/v1/enroll")
@@ -33,25 +34,38 @@ type serverEndpoint struct {
 // and return the response with a proper HTTP status code
 func (se *serverEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var resp interface{}
+	scode := se.getSuccessRC()
 	url := r.URL.String()
 	log.Debugf("Received request for %s", url)
 	w = newHTTPResponseWriter(r, w, se)
+	se.Server.stateMutex.RLock()
+	defer se.Server.stateMutex.RUnlock()
+	ctx := newServerRequestContext(r, w, se)
+	defer ctx.releaseCA()
 	err := se.validateMethod(r)
+	if err == nil {
+		err = se.limitRequest(ctx)
+	}
 	if err == nil {
 		// Call the endpoint handler to handle the request.  The handler may
 		// a) return the response in the 'resp' variable below, or
 		// b) write the response one chunk at a time, which is appropriate if the response may be large
 		//    and we don't want the server to buffer the entire response in memory.
-		resp, err = se.Handler(newServerRequestContext(r, w, se))
+		resp, err = se.Handler(ctx)
+	}
+	if pending, ok := errors.Cause(err).(*approvalPending); ok {
+		// The request is stored until other registrars approve it
+		resp, err = pending.resp, nil
+		scode = http.StatusAccepted
 	}
 	he := getHTTPErr(err)
+	se.audit(ctx, scode, he)
 	if he != nil {
 		// An error occurred
 		w.WriteHeader(he.GetStatusCode())
 		log.Infof(`%s %s %s %d %d "%s"`, r.RemoteAddr, r.Method, r.URL, he.GetStatusCode(), he.GetLocalCode(), he.GetLocalMsg())
 	} else {
 		// No error occurred
-		scode := se.getSuccessRC()
 		w.WriteHeader(scode)
 		log.Infof(`%s %s %s %d 0 "OK"`, r.RemoteAddr, r.Method, r.URL, scode)
 	}
@@ -100,6 +100,15 @@ func handleEnroll(ctx *serverRequestContextImpl, id string) (interface{}, error)
 	if err != nil {
 		return nil, err
 	}
+	resp, err := enroll(ctx, id, &req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Sign the certificate of an enrollment request of the authenticated caller
+func enroll(ctx *serverRequestContextImpl, id string, req *api.EnrollmentRequestNet) (*api.EnrollmentResponseNet, error) {
 	// Get the targeted CA
 	ca, err := ctx.GetCA()
 	if err != nil {
@@ -165,6 +174,8 @@ func handleEnroll(ctx *serverRequestContextImpl, id string) (interface{}, error)
 	if err != nil {
 		return nil, errors.WithMessage(err, "Certificate signing failure")
 	}
+	// The certificate has the current attributes of the caller
+	ctx.clearReissue()
 	// Add server info to the response
 	resp := &api.EnrollmentResponseNet{
 		Cert: util.B64Encode(cert),
@@ -0,0 +1,281 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+
+	gmux "github.com/gorilla/mux"
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/signer"
+	"github.com/pkg/errors"
+)
+
+const (
+	// estPathPrefix is the path prefix of the EST endpoints (RFC 7030, section 3.2.2)
+	estPathPrefix = "/.well-known/est/"
+	// estCALabel is the path variable of the optional CA label, which
+	// selects the CA by its name
+	estCALabel = "ca"
+
+	estCertsContentType = "application/pkcs7-mime; smime-type=certs-only"
+)
+
+var (
+	oidPKCS7Data       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// estEndpoint is an EST endpoint. Unlike serverEndpoint, it writes the raw
+// EST response instead of the JSON envelope of the fabric-ca API.
+type estEndpoint struct {
+	// Path is the path of the EST operation (e.g. "simpleenroll")
+	Path string
+	// The HTTP methods which the handler handles
+	Methods []string
+	// Handler returns the DER encoded response of the operation, or nil if
+	// there is no content
+	Handler func(ctx *serverRequestContextImpl) ([]byte, error)
+	// Server which hosts this endpoint
+	Server *Server
+}
+
+// registerESTHandlers registers the EST endpoints, both for the default CA
+// and for the CA selected by a CA label
+func (s *Server) registerESTHandlers() {
+	if !s.Config.EST.Enabled {
+		return
+	}
+	endpoints := []*estEndpoint{
+		{Path: "cacerts", Methods: []string{"GET"}, Handler: estCACertsHandler, Server: s},
+		{Path: "simpleenroll", Methods: []string{"POST"}, Handler: estEnrollHandler, Server: s},
+		{Path: "simplereenroll", Methods: []string{"POST"}, Handler: estReenrollHandler, Server: s},
+		{Path: "csrattrs", Methods: []string{"GET"}, Handler: estCSRAttrsHandler, Server: s},
+	}
+	for _, ep := range endpoints {
+		s.mux.Handle(estPathPrefix+ep.Path, ep).Name("est/" + ep.Path)
+		s.mux.Handle(estPathPrefix+"{"+estCALabel+"}/"+ep.Path, ep).Name("est/" + ep.Path)
+	}
+}
+
+// ServeHTTP handles an EST request and writes the base64 encoded response
+func (ee *estEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Debugf("Received EST request for %s", r.URL.String())
+	ee.Server.stateMutex.RLock()
+	defer ee.Server.stateMutex.RUnlock()
+	ctx := newServerRequestContext(r, w, &serverEndpoint{Path: ee.Path, Methods: ee.Methods, Server: ee.Server})
+	defer ctx.releaseCA()
+	resp, err := ee.handle(ctx)
+	he := getHTTPErr(err)
+	scode := http.StatusOK
+	if resp == nil {
+		scode = http.StatusNoContent
+	}
+	ee.audit(ctx, scode, he)
+	if he != nil {
+		log.Infof(`%s %s %s %d %d "%s"`, r.RemoteAddr, r.Method, r.URL, he.GetStatusCode(), he.GetLocalCode(), he.GetLocalMsg())
+		if he.GetStatusCode() == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fabric-ca"`)
+		}
+		http.Error(w, he.GetRemoteMsg(), he.GetStatusCode())
+		return
+	}
+	log.Infof(`%s %s %s %d 0 "OK"`, r.RemoteAddr, r.Method, r.URL, scode)
+	if resp == nil {
+		w.WriteHeader(scode)
+		return
+	}
+	w.Header().Set("Content-Type", ee.contentType())
+	w.Header().Set("Content-Transfer-Encoding", "base64")
+	w.WriteHeader(scode)
+	w.Write([]byte(base64.StdEncoding.EncodeToString(resp)))
+}
+
+func (ee *estEndpoint) handle(ctx *serverRequestContextImpl) ([]byte, error) {
+	err := ee.validateMethod(ctx.req)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.endpoint.limitRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The CA is selected by the CA label rather than by the request body,
+	// which is not JSON
+	name := gmux.Vars(ctx.req)[estCALabel]
+	if name == "" {
+		name = ee.Server.getCAName()
+	}
+	ca, err := ee.Server.GetCA(name)
+	if err != nil {
+		return nil, err
+	}
+	ctx.setCA(ca)
+	return ee.Handler(ctx)
+}
+
+// audit appends an entry for the EST request to the audit log of the CA
+// which served it, or of the default CA if there is no such CA. The body
+// is a CSR, so the target is the identity which enrolls.
+func (ee *estEndpoint) audit(ctx *serverRequestContextImpl, scode int, he *caerrors.HTTPErr) {
+	ca := ctx.ca
+	if ca == nil {
+		ca = &ee.Server.CA
+	}
+	if ca.audit == nil {
+		return
+	}
+	target := ctx.enrollmentID
+	if target == "" {
+		target, _, _ = ctx.req.BasicAuth()
+	}
+	ca.auditRequest(ctx, "est/"+ee.Path, target, scode, he)
+}
+
+func (ee *estEndpoint) contentType() string {
+	if ee.Path == "csrattrs" {
+		return "application/csrattrs"
+	}
+	return estCertsContentType
+}
+
+// Validate that the HTTP method is supported for this endpoint
+func (ee *estEndpoint) validateMethod(r *http.Request) error {
+	for _, m := range ee.Methods {
+		if m == r.Method {
+			return nil
+		}
+	}
+	return caerrors.NewHTTPErr(405, caerrors.ErrMethodNotAllowed, "Method %s is not allowed", r.Method)
+}
+
+// Handle an EST cacerts request, which returns the CA chain
+func estCACertsHandler(ctx *serverRequestContextImpl) ([]byte, error) {
+	ca, err := ctx.GetCA()
+	if err != nil {
+		return nil, err
+	}
+	chain, err := ca.getCAChain()
+	if err != nil {
+		log.Errorf("Failed to read the chain file of CA '%s': %s", ca.Config.CA.Name, err)
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrGetCACert, "Failed to get the certificates of CA '%s'", ca.Config.CA.Name)
+	}
+	certs, err := util.GetX509CertificatesFromPEM(chain)
+	if err != nil {
+		log.Errorf("Failed to parse the chain file of CA '%s': %s", ca.Config.CA.Name, err)
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrGetCACert, "Failed to get the certificates of CA '%s'", ca.Config.CA.Name)
+	}
+	return certsOnlyPKCS7(certs)
+}
+
+// Handle an EST simpleenroll request, guarded by basic authentication
+func estEnrollHandler(ctx *serverRequestContextImpl) ([]byte, error) {
+	id, err := ctx.BasicAuthentication()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handleESTEnroll(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.ui.LoginComplete()
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Handle an EST simplereenroll request, guarded by token authentication
+func estReenrollHandler(ctx *serverRequestContextImpl) ([]byte, error) {
+	id, err := ctx.TokenAuthentication()
+	if err != nil {
+		return nil, err
+	}
+	return handleESTEnroll(ctx, id)
+}
+
+// Handle an EST csrattrs request. The CA does not require any particular
+// CSR attributes, so there is no content (RFC 7030, section 4.5.2).
+func estCSRAttrsHandler(ctx *serverRequestContextImpl) ([]byte, error) {
+	return nil, nil
+}
+
+// Handle the common processing for EST enroll and reenroll. The request is
+// signed the same way as a native enrollment request; the CP-ABE key, if
+// any, is not returned as EST has no way to carry it.
+func handleESTEnroll(ctx *serverRequestContextImpl, id string) ([]byte, error) {
+	body, err := ctx.ReadBodyBytes()
+	if err != nil {
+		return nil, err
+	}
+	der, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(body), nil)))
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrBadCSR, "The CSR is not base64 encoded: %s", err)
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	req := &api.EnrollmentRequestNet{
+		SignRequest: signer.SignRequest{Request: string(csrPEM)},
+	}
+	resp, err := enroll(ctx, id, req)
+	if err != nil {
+		return nil, err
+	}
+	certPEM, err := util.B64Decode(resp.Cert)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed to decode the enrollment certificate")
+	}
+	cert, err := BytesToX509Cert(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	return certsOnlyPKCS7([]*x509.Certificate{cert})
+}
+
+// certsOnlyPKCS7 returns a degenerate certs-only PKCS#7 SignedData
+// structure holding the certificates (RFC 7030, section 4.1.3)
+func certsOnlyPKCS7(certs []*x509.Certificate) ([]byte, error) {
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+	signedData, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      struct{ ContentType asn1.ObjectIdentifier }{oidPKCS7Data},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos:      emptySet,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal PKCS#7 signed data")
+	}
+	contentInfo, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{
+		ContentType: oidPKCS7SignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal PKCS#7 content info")
+	}
+	return contentInfo, nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEST(t *testing.T) {
+	srv := TestGetRootServer(t)
+	srv.Config.EST.Enabled = true
+	srv.CA.Config.Audit.Enabled = true
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+	defer os.RemoveAll(rootDir)
+
+	url := fmt.Sprintf("http://localhost:%d/.well-known/est/", rootPort)
+
+	// cacerts returns the CA chain
+	resp, err := http.Get(url + "cacerts")
+	util.FatalError(t, err, "Failed to get CA certificates")
+	certs := readESTCerts(t, resp)
+	issuer, err := getCACert(&srv.CA)
+	util.FatalError(t, err, "Failed to get CA certificate")
+	if assert.Len(t, certs, 1) {
+		assert.Equal(t, issuer.Raw, certs[0].Raw)
+	}
+
+	// The CA can be selected by its label
+	resp, err = http.Get(url + srv.CA.Config.CA.Name + "/cacerts")
+	util.FatalError(t, err, "Failed to get CA certificates")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err = http.Get(url + "unknown/cacerts")
+	util.FatalError(t, err, "Failed to get CA certificates")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// csrattrs has no content
+	resp, err = http.Get(url + "csrattrs")
+	util.FatalError(t, err, "Failed to get CSR attributes")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// simpleenroll requires basic authentication
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	util.FatalError(t, err, "Failed to generate key")
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "admin"},
+	}, key)
+	util.FatalError(t, err, "Failed to create CSR")
+	body := base64.StdEncoding.EncodeToString(csr)
+
+	resp, err = http.Post(url+"simpleenroll", "application/pkcs10", bytes.NewBufferString(body))
+	util.FatalError(t, err, "Failed to enroll")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+
+	req, err := http.NewRequest("POST", url+"simpleenroll", bytes.NewBufferString(body))
+	util.FatalError(t, err, "Failed to create request")
+	req.Header.Set("Content-Type", "application/pkcs10")
+	req.SetBasicAuth("admin", "adminpw")
+	resp, err = http.DefaultClient.Do(req)
+	util.FatalError(t, err, "Failed to enroll")
+	certs = readESTCerts(t, resp)
+	if assert.Len(t, certs, 1) {
+		assert.Equal(t, "admin", certs[0].Subject.CommonName)
+		assert.NoError(t, certs[0].CheckSignatureFrom(issuer))
+		assert.Equal(t, key.Public(), certs[0].PublicKey)
+	}
+
+	// The enrollments are recorded in the audit log
+	recs, err := srv.CA.audit.Records(1, maxAuditLimit)
+	util.FatalError(t, err, "Failed to get audit log")
+	if assert.True(t, len(recs) >= 2) {
+		failed, enrolled := recs[len(recs)-2], recs[len(recs)-1]
+		assert.Equal(t, "POST est/simpleenroll", failed.Action)
+		assert.Equal(t, http.StatusUnauthorized, failed.Status)
+		assert.NotZero(t, failed.ErrorCode)
+		assert.Equal(t, "POST est/simpleenroll", enrolled.Action)
+		assert.Equal(t, http.StatusOK, enrolled.Status)
+		assert.Equal(t, "admin", enrolled.Caller)
+		assert.Equal(t, "admin", enrolled.Target)
+		assert.Equal(t, srv.CA.Config.CA.Name, enrolled.CA)
+	}
+}
+
+// readESTCerts reads the certificates of a certs-only PKCS#7 EST response
+func readESTCerts(t *testing.T, resp *http.Response) []*x509.Certificate {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", resp.StatusCode)
+	}
+	assert.Equal(t, estCertsContentType, resp.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(resp.Body)
+	util.FatalError(t, err, "Failed to read response")
+	der, err := base64.StdEncoding.DecodeString(string(body))
+	util.FatalError(t, err, "Failed to decode response")
+
+	var contentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	_, err = asn1.Unmarshal(der, &contentInfo)
+	util.FatalError(t, err, "Failed to parse PKCS#7 content info")
+	assert.True(t, contentInfo.ContentType.Equal(oidPKCS7SignedData))
+	var signedData struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+		SignerInfos      asn1.RawValue
+	}
+	_, err = asn1.Unmarshal(contentInfo.Content.Bytes, &signedData)
+	util.FatalError(t, err, "Failed to parse PKCS#7 signed data")
+	certs, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+	util.FatalError(t, err, "Failed to parse certificates")
+	return certs
+}
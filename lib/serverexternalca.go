@@ -0,0 +1,162 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"crypto/x509"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/attr"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/revoke"
+	"github.com/pkg/errors"
+)
+
+// provisionedByExternalCA is the value of the 'hf.ProvisionedBy' attribute
+// of the identities which are added to the registry for the certificates of
+// external CAs
+const provisionedByExternalCA = "externalca"
+
+// externalCertUser is an identity of the registry which enrolls with the
+// certificate of an external CA. As with an ID token, the certificate is not
+// an enrollment secret, so its enrollments do not count against the maximum
+// enrollments of the identity.
+type externalCertUser struct {
+	user.User
+}
+
+// LoginComplete requires no action for a certificate of an external CA
+func (u *externalCertUser) LoginComplete() error {
+	return nil
+}
+
+// externalCertAuthentication authenticates the caller by a certificate of a
+// trusted external CA and returns the enrollment ID it maps to. The
+// certificate is in the x509 token of the authorization header or, if the
+// request has no authorization header, is the TLS client certificate.
+func (ctx *serverRequestContextImpl) externalCertAuthentication(ca *CA, authHdr string) (string, error) {
+	if ca.externalCA == nil {
+		if authHdr == "" {
+			return "", caerrors.NewHTTPErr(401, caerrors.ErrNoAuthHdr, "No authorization header")
+		}
+		return "", caerrors.NewAuthenticationErr(caerrors.ErrNoUserPass, "No user/pass in authorization header")
+	}
+	r := ctx.req
+	var cert *x509.Certificate
+	var chain []*x509.Certificate
+	var tokenNonce *util.TokenNonce
+	if authHdr != "" {
+		body, err := ctx.ReadBodyBytes()
+		if err != nil {
+			return "", err
+		}
+		cert, tokenNonce, err = util.VerifyTokenNonce(ca.csp, authHdr, r.Method, r.URL.RequestURI(), body, false)
+		if err != nil {
+			return "", caerrors.NewAuthenticationErr(caerrors.ErrInvalidToken, "Invalid token in authorization header: %s", err)
+		}
+		if tokenNonce == nil {
+			return "", caerrors.NewAuthenticationErr(caerrors.ErrInvalidToken, "Invalid token in authorization header: the token has no time and nonce")
+		}
+	} else {
+		cert = r.TLS.PeerCertificates[0]
+		chain = r.TLS.PeerCertificates[1:]
+	}
+	id, err := ca.externalCA.Verify(cert, chain)
+	if err != nil {
+		return "", caerrors.NewAuthenticationErr(caerrors.ErrUntrustedCertificate, "Untrusted certificate: %s", err)
+	}
+	revoked, checked := revoke.VerifyCertificate(cert)
+	if !checked {
+		return "", caerrors.NewHTTPErr(401, caerrors.ErrCertRevokeCheckFailure, "Failed while checking for revocation")
+	}
+	if revoked {
+		return "", caerrors.NewAuthenticationErr(caerrors.ErrCertRevoked, "The certificate of the external CA is a revoked or expired certificate")
+	}
+	// Remember the nonce of the token only once its certificate is trusted
+	if tokenNonce != nil {
+		if ca.replayGuard == nil {
+			return "", caerrors.NewHTTPErr(500, caerrors.ErrTokenReplayed, "Failed to check the authorization token for replay")
+		}
+		err = ca.replayGuard.Check(tokenNonce.Time, tokenNonce.Nonce)
+		if err != nil {
+			return "", caerrors.NewAuthenticationErr(caerrors.ErrTokenReplayed, "Invalid token in authorization header: %s", err)
+		}
+	}
+	err = ctx.limitIdentity(ca, id)
+	if err != nil {
+		return "", err
+	}
+	caller, err := ca.registry.GetUser(id, nil)
+	if err != nil {
+		if !ca.Config.ExternalCA.AutoRegister.Enabled {
+			return "", caerrors.NewAuthenticationErr(caerrors.ErrInvalidUser, "Failed to get user: %s", err)
+		}
+		caller, err = ca.registerExternalIdentity(id)
+		if err != nil {
+			return "", caerrors.NewHTTPErr(500, caerrors.ErrGettingUser, "Failed to register identity of external CA certificate: %s", err)
+		}
+	}
+	err = ca.checkExternalIdentity(caller)
+	if err != nil {
+		return "", err
+	}
+	if caller.IsRevoked() {
+		return "", caerrors.NewAuthorizationErr(caerrors.ErrRevokedID, "Enrollment ID is revoked, unable to process request")
+	}
+	err = checkSuspended(caller)
+	if err != nil {
+		return "", err
+	}
+	ctx.ui = &externalCertUser{caller}
+	ctx.caller = caller
+	ctx.enrollmentID = id
+	log.Debugf("Authenticated '%s' by certificate '%s' of an external CA", id, cert.Subject)
+	return id, nil
+}
+
+// registerExternalIdentity adds the identity of a certificate of an external
+// CA to the registry, with the affiliation and type of the configuration,
+// when it first enrolls
+func (ca *CA) registerExternalIdentity(id string) (user.User, error) {
+	cfg := &ca.Config.ExternalCA.AutoRegister
+	if cfg.Affiliation != "" {
+		_, err := ca.registry.GetAffiliation(cfg.Affiliation)
+		if err != nil {
+			return nil, errors.Errorf("Affiliation '%s' of identity '%s' is not defined", cfg.Affiliation, id)
+		}
+	}
+	registered, err := ca.insertProvisionedIdentity(&user.Info{
+		Name:        id,
+		Type:        cfg.Type,
+		Affiliation: cfg.Affiliation,
+		Attributes:  []api.Attribute{{Name: attr.ProvisionedBy, Value: provisionedByExternalCA}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Added identity '%s' of an external CA certificate to the registry", id)
+	return registered, nil
+}
+
+// checkExternalIdentity returns an error if a certificate of an external CA
+// may not enroll as an identity. Unless the mapping has a pattern, which
+// selects the values the external CAs may map to, a certificate only maps
+// to an identity which was registered for such a certificate, so that an
+// external CA cannot issue a certificate for a registrar of this CA.
+func (ca *CA) checkExternalIdentity(registered user.User) error {
+	if ca.Config.ExternalCA.Mapping.Pattern != "" {
+		return nil
+	}
+	a, err := registered.GetAttribute(attr.ProvisionedBy)
+	if err != nil || a.Value != provisionedByExternalCA {
+		return caerrors.NewAuthenticationErr(caerrors.ErrUntrustedCertificate, "Identity '%s' was not added for an external CA certificate and the mapping has no pattern", registered.GetName())
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/server/externalca"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeExternalCert creates a certificate signed by an issuer, or a
+// self-signed CA certificate if the issuer is nil, and writes it and its key
+// to files of a directory
+func writeExternalCert(t *testing.T, dir, cn string, issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	util.FatalError(t, err, "Failed to generate key")
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if issuer == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		issuer, issuerKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, key.Public(), issuerKey)
+	util.FatalError(t, err, "Failed to create certificate")
+	cert, err := x509.ParseCertificate(der)
+	util.FatalError(t, err, "Failed to parse certificate")
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	util.FatalError(t, err, "Failed to marshal key")
+
+	certFile := filepath.Join(dir, cn+".pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	util.FatalError(t, err, "Failed to write certificate file")
+	keyFile := filepath.Join(dir, cn+"-key.pem")
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+	util.FatalError(t, err, "Failed to write key file")
+	return cert, key, certFile, keyFile
+}
+
+func TestExternalCAEnroll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "externalca")
+	util.FatalError(t, err, "Failed to create temp directory")
+	defer os.RemoveAll(dir)
+
+	root, rootKey, rootFile, _ := writeExternalCert(t, dir, "corp-root", nil, nil)
+	_, _, user1File, user1KeyFile := writeExternalCert(t, dir, "extuser1", root, rootKey)
+	_, _, user2File, user2KeyFile := writeExternalCert(t, dir, "extuser2", root, rootKey)
+	_, _, adminFile, adminKeyFile := writeExternalCert(t, dir, "admin", root, rootKey)
+	other, otherKey, _, _ := writeExternalCert(t, dir, "other-root", nil, nil)
+	_, _, untrustedFile, untrustedKeyFile := writeExternalCert(t, dir, "extuser3", other, otherKey)
+
+	srv := TestGetRootServer(t)
+	srv.CA.Config.ExternalCA = externalca.Config{
+		Enabled:   true,
+		CertFiles: []string{rootFile},
+		Mapping:   externalca.MappingConfig{Source: externalca.CommonName},
+	}
+	err = srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	c := TestGetRootClient()
+	enrollResp, err := c.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll 'admin'")
+	admin := enrollResp.Identity
+
+	_, err = c.Enroll(&api.EnrollmentRequest{Name: "extuser1", ExternalCertFile: user1File, ExternalKeyFile: user1KeyFile})
+	if assert.Error(t, err, "Enrollment of an identity which is not registered should fail") {
+		assert.Contains(t, err.Error(), "Error Code: 23")
+	}
+
+	// Without a pattern, a certificate does not map to an identity
+	// registered otherwise, such as the bootstrap admin
+	_, err = admin.Register(&api.RegistrationRequest{Name: "extuser1", Affiliation: "org1"})
+	util.FatalError(t, err, "Failed to register 'extuser1'")
+	for _, name := range []string{"admin", "extuser1"} {
+		_, err = c.Enroll(&api.EnrollmentRequest{
+			Name:             name,
+			ExternalCertFile: filepath.Join(dir, name+".pem"),
+			ExternalKeyFile:  filepath.Join(dir, name+"-key.pem"),
+		})
+		if assert.Error(t, err, "A certificate should not map to an identity registered otherwise without a pattern") {
+			assert.Contains(t, err.Error(), "Error Code: 26")
+		}
+	}
+
+	// A pattern selects the identities the certificates map to
+	srv.CA.Config.ExternalCA.Mapping.Pattern = "extuser.*"
+	err = srv.CA.initExternalCA()
+	util.FatalError(t, err, "Failed to initialize external CA verifier")
+	_, err = c.Enroll(&api.EnrollmentRequest{Name: "admin", ExternalCertFile: adminFile, ExternalKeyFile: adminKeyFile})
+	assert.Error(t, err, "A certificate should not map to an identity the pattern does not match")
+	enrollResp, err = c.Enroll(&api.EnrollmentRequest{Name: "extuser1", ExternalCertFile: user1File, ExternalKeyFile: user1KeyFile})
+	if assert.NoError(t, err, "Enrollment with a trusted external CA certificate should succeed") {
+		assert.Equal(t, "extuser1", enrollResp.Identity.GetECert().GetX509Cert().Subject.CommonName)
+	}
+
+	_, err = c.Enroll(&api.EnrollmentRequest{Name: "extuser3", ExternalCertFile: untrustedFile, ExternalKeyFile: untrustedKeyFile})
+	if assert.Error(t, err, "Enrollment with an untrusted certificate should fail") {
+		assert.Contains(t, err.Error(), "Error Code: 26")
+	}
+
+	// The identity is registered when it first enrolls, and its certificate
+	// maps to it without a pattern
+	srv.CA.Config.ExternalCA.Mapping.Pattern = ""
+	err = srv.CA.initExternalCA()
+	util.FatalError(t, err, "Failed to initialize external CA verifier")
+	srv.CA.Config.ExternalCA.AutoRegister = externalca.AutoRegisterConfig{Enabled: true, Affiliation: "org2", Type: "client"}
+	_, err = c.Enroll(&api.EnrollmentRequest{Name: "extuser2", ExternalCertFile: user2File, ExternalKeyFile: user2KeyFile})
+	assert.NoError(t, err, "Enrollment with automatic registration should succeed")
+	_, err = c.Enroll(&api.EnrollmentRequest{Name: "extuser2", ExternalCertFile: user2File, ExternalKeyFile: user2KeyFile})
+	assert.NoError(t, err, "Enrollment of an identity registered for its certificate should succeed")
+	idResp, err := admin.GetIdentity("extuser2", "")
+	if assert.NoError(t, err, "Identity should have been registered") {
+		assert.Equal(t, "org2", idResp.Affiliation)
+		assert.Equal(t, "client", idResp.Type)
+	}
+}
@@ -7,26 +7,34 @@ SPDX-License-Identifier: Apache-2.0
 package lib
 
 import (
+	"crypto"
+	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"math/big"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
 	"github.com/hyperledger/fabric-ca/lib/caerrors"
-	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/crl"
+	"github.com/hyperledger/fabric-ca/lib/server/db"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
 )
 
 const (
 	crlPemType = "X509 CRL"
 )
 
+// oidExtensionReasonCode is the OID of the CRL entry reason code extension
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
 // The response to the POST /gencrl request
 type genCRLResponseNet struct {
 	// Base64 encoding of PEM-encoded CRL
@@ -108,33 +116,75 @@ func genCRL(ca *CA, req api.GenCRLRequest) ([]byte, error) {
 		return nil, caerrors.NewHTTPErr(500, caerrors.ErrGetCACert, "Failed to get certificate for CA '%s'", ca.HomeDir)
 	}
 
+	// The CRL is signed by the current key of the CA, or by a key it rolled
+	// over from for the certificates issued by that key
+	var retired *retiredSigner
+	aki := strings.TrimLeft(strings.ToLower(req.AKI), "0")
+	if aki != "" && aki != skiString(caCert.SubjectKeyId) {
+		retired = ca.retiredSigners[aki]
+		if retired == nil {
+			return nil, caerrors.NewHTTPErr(400, caerrors.ErrGetCASigner, "CA '%s' has no key with subject key identifier '%s'", ca.Config.CA.Name, req.AKI)
+		}
+		caCert = retired.cert
+	}
+
 	if !canSignCRL(caCert) {
 		return nil, caerrors.NewHTTPErr(500, caerrors.ErrNoCrlSignAuth,
 			"The CA does not have authority to generate a CRL. Its certificate does not have 'crl sign' key usage")
 	}
 
 	// Get the signer for the CA
-	_, signer, err := util.GetSignerFromCert(caCert, ca.csp)
+	var signer crypto.Signer
+	if retired != nil {
+		signer = retired.signer
+	} else {
+		_, signer, err = util.GetSignerFromCert(caCert, ca.csp)
+		if err != nil {
+			log.Errorf("Failed to get signer for CA '%s': %s", ca.HomeDir, err)
+			return nil, caerrors.NewHTTPErr(500, caerrors.ErrGetCASigner, "Failed to get signer for CA '%s'", ca.HomeDir)
+		}
+	}
+
+	// Get the number of the new CRL
+	number, err := db.NextCRLNumber(ca.db)
 	if err != nil {
-		log.Errorf("Failed to get signer for CA '%s': %s", ca.HomeDir, err)
-		return nil, caerrors.NewHTTPErr(500, caerrors.ErrGetCASigner, "Failed to get signer for CA '%s'", ca.HomeDir)
+		log.Errorf("Failed to get the CRL number for CA '%s': %s", ca.HomeDir, err)
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrGenCRL, "Failed to generate CRL for CA '%s'", ca.HomeDir)
 	}
 
-	expiry := time.Now().UTC().Add(ca.Config.CRL.Expiry)
+	now := time.Now().UTC()
 	var revokedCerts []pkix.RevokedCertificate
 
 	// For every record, create a new revokedCertificate and add it to slice
 	for _, certRecord := range certs {
+		// Skip the certificates issued by another key of the CA
+		if ca.retiredSigners[strings.ToLower(certRecord.AKI)] != retired {
+			continue
+		}
 		serialInt := new(big.Int)
 		serialInt.SetString(certRecord.Serial, 16)
 		revokedCert := pkix.RevokedCertificate{
 			SerialNumber:   serialInt,
 			RevocationTime: certRecord.RevokedAt,
 		}
+		// The reason code entry extension is omitted for the unspecified reason (RFC 5280 section 5.3.1)
+		if certRecord.Reason != ocsp.Unspecified {
+			reason, err := asn1.Marshal(asn1.Enumerated(certRecord.Reason))
+			if err != nil {
+				return nil, caerrors.NewHTTPErr(500, caerrors.ErrGenCRL, "Failed to marshal the revocation reason of certificate %s", certRecord.Serial)
+			}
+			revokedCert.Extensions = []pkix.Extension{{Id: oidExtensionReasonCode, Value: reason}}
+		}
 		revokedCerts = append(revokedCerts, revokedCert)
 	}
 
-	crl, err := crl.CreateGenericCRL(revokedCerts, signer, caCert, expiry)
+	template := &x509.RevocationList{
+		RevokedCertificates: revokedCerts,
+		Number:              big.NewInt(number),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(ca.Config.CRL.Expiry),
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, template, caCert, signer)
 	if err != nil {
 		log.Errorf("Failed to generate CRL for CA '%s': %s", ca.HomeDir, err)
 		return nil, caerrors.NewHTTPErr(500, caerrors.ErrGenCRL, "Failed to generate CRL for CA '%s'", ca.HomeDir)
@@ -17,7 +17,10 @@ import (
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
 	"github.com/hyperledger/fabric-ca/lib/attr"
 	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/approval"
+	"github.com/hyperledger/fabric-ca/lib/server/role"
 	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
 	"github.com/pkg/errors"
 )
@@ -42,6 +45,26 @@ func newIdentitiesStreamingEndpoint(s *Server) *serverEndpoint {
 	}
 }
 
+func newIdentitySecretEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:      "identities/{id}/secret",
+		Methods:   []string{"POST"},
+		Handler:   identitySecretHandler,
+		Server:    s,
+		successRC: 200,
+	}
+}
+
+func newIdentityTOTPEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:      "identities/{id}/totp",
+		Methods:   []string{"POST"},
+		Handler:   identityTOTPHandler,
+		Server:    s,
+		successRC: 200,
+	}
+}
+
 func identitiesStreamingHandler(ctx *serverRequestContextImpl) (interface{}, error) {
 	// Authenticate
 	callerID, err := ctx.TokenAuthentication()
@@ -185,6 +208,7 @@ func getIDs(ctx *serverRequestContextImpl, caller user.User, caname string) erro
 	}
 
 	log.Debugf("Number of identities to be delivered in each chunk: %d", numIdentities)
+	caMaxEnrollments := ctx.ca.Config.Registry.MaxEnrollments
 
 	w.Write([]byte(`{"identities":[`))
 
@@ -210,6 +234,11 @@ func getIDs(ctx *serverRequestContextImpl, caller user.User, caname string) erro
 			Affiliation:    id.Affiliation,
 			MaxEnrollments: id.MaxEnrollments,
 			Attributes:     attrs,
+			SecretState:    user.GetSecretState(id.State, id.MaxEnrollments, id.SecretExpiry, caMaxEnrollments),
+			SecretExpiry:   id.SecretExpiry,
+			Suspended:      id.Suspended,
+			Roles:          role.Names(attr.GetAttrValue(attrs, attr.AssignedRoles)),
+			Reissue:        id.Reissue,
 		}
 
 		resp, err := util.Marshal(idInfo, "identities info")
@@ -256,8 +285,15 @@ func getID(ctx *serverRequestContextImpl, caller user.User, id, caname string) (
 		Affiliation:    user.GetAffiliation(caUser),
 		Attributes:     allAttributes,
 		MaxEnrollments: caUser.GetMaxEnrollments(),
+		Roles:          role.Names(attr.GetAttrValue(allAttributes, attr.AssignedRoles)),
 		CAName:         caname,
 	}
+	if u, ok := caUser.(*user.Impl); ok {
+		resp.SecretState = user.GetSecretState(u.State, u.MaxEnrollments, u.SecretExpiry, ctx.ca.Config.Registry.MaxEnrollments)
+		resp.SecretExpiry = u.SecretExpiry
+		resp.Suspended = u.IsSuspended()
+		resp.Reissue = u.NeedsReissue()
+	}
 
 	return resp, nil
 }
@@ -299,6 +335,7 @@ func processDeleteRequest(ctx *serverRequestContextImpl, caname string) (*api.Id
 	if err != nil {
 		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRemoveIdentity, "Failed to remove identity: %s", err)
 	}
+	ctx.ca.emitEvent(webhook.IdentityRemoved, &identityEvent{ID: removeID, Caller: ctx.enrollmentID})
 
 	resp, err := getIDResp(userToRemove, "", caname)
 	if err != nil {
@@ -329,6 +366,8 @@ func processPostRequest(ctx *serverRequestContextImpl, caname string) (*api.Iden
 		Affiliation:    req.Affiliation,
 		Attributes:     req.Attributes,
 		MaxEnrollments: req.MaxEnrollments,
+		SecretExpiry:   req.SecretExpiry,
+		TOTP:           req.TOTP,
 	}
 	log.Debugf("Adding identity: %+v", util.StructToString(addReq))
 
@@ -338,7 +377,7 @@ func processPostRequest(ctx *serverRequestContextImpl, caname string) (*api.Iden
 	}
 	callerID := caller.GetName()
 
-	pass, err := registerUser(addReq, callerID, ctx.ca, ctx)
+	regResp, err := registerUser(addReq, callerID, ctx.ca, ctx)
 	if err != nil {
 		return nil, errors.WithMessagef(err, "Failed to add identity '%s'", req.ID)
 	}
@@ -348,10 +387,12 @@ func processPostRequest(ctx *serverRequestContextImpl, caname string) (*api.Iden
 		return nil, err
 	}
 
-	resp, err := getIDResp(user, pass, caname)
+	resp, err := getIDResp(user, regResp.Secret, caname)
 	if err != nil {
 		return nil, err
 	}
+	resp.TOTPSeed = regResp.TOTPSeed
+	resp.TOTPURI = regResp.TOTPURI
 
 	log.Debugf("Identity successfully added")
 	return resp, nil
@@ -383,16 +424,83 @@ func processPutRequest(ctx *serverRequestContextImpl, caname string) (*api.Ident
 		return nil, err
 	}
 
+	modReq, setPass, err := ctx.checkModifyRequest(&req, userToModify)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := modifyAttributeNames(&req, userToModify)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.ca.requireApproval(ctx, approval.Modify, modifyID, user.GetAffiliation(userToModify), userToModify.GetType(), attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = registry.UpdateUser(modReq, setPass)
+	if err != nil {
+		return nil, err
+	}
+
+	userToModify, err = registry.GetUser(modifyID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Suspend || req.Resume {
+		err = ctx.ca.suspendIdentity(userToModify.(*user.Impl), req.Suspend, req.Hold)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx.ca.emitEvent(webhook.IdentityModified, &identityEvent{
+		ID:          modifyID,
+		Type:        userToModify.GetType(),
+		Affiliation: user.GetAffiliation(userToModify),
+		Caller:      ctx.enrollmentID,
+	})
+
+	resp, err := getIDResp(userToModify, req.Secret, caname)
+	if err != nil {
+		return nil, err
+	}
+
+	// An identity given attributes which require a TOTP is given a seed
+	if u, ok := userToModify.(*user.Impl); ok && u.TOTPSeed == "" && ctx.ca.totp.Required(resp.Attributes) {
+		resp.TOTPSeed, resp.TOTPURI, err = ctx.ca.setTOTPSeed(u)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Debugf("Identity successfully modified")
+	return resp, nil
+}
+
+// checkModifyRequest checks that the caller may make a request to modify an
+// identity, and returns the modified identity and whether its secret is set
+func (ctx *serverRequestContextImpl) checkModifyRequest(req *api.ModifyIdentityRequest, userToModify user.User) (*user.Info, bool, error) {
 	var checkAff, checkType, checkAttrs bool
-	modReq, setPass := getModifyReq(userToModify, &req)
+	prevAttrs, err := userToModify.GetAttributes(nil)
+	if err != nil {
+		return nil, false, err
+	}
+	// Give or take the attributes of the roles the request assigns
+	err = ctx.ca.addRoleChanges(req, prevAttrs)
+	if err != nil {
+		return nil, false, err
+	}
+	modReq, setPass := getModifyReq(userToModify, req)
 	log.Debugf("Modify Request: %+v", util.StructToString(modReq))
 
 	if req.Affiliation != "" {
 		newAff := req.Affiliation
 		if newAff != "." { // Only need to check if not requesting root affiliation
-			aff, _ := registry.GetAffiliation(newAff)
+			aff, _ := ctx.ca.registry.GetAffiliation(newAff)
 			if aff == nil {
-				return nil, caerrors.NewHTTPErr(400, caerrors.ErrModifyingIdentity, "Affiliation '%s' is not supported", newAff)
+				return nil, false, caerrors.NewHTTPErr(400, caerrors.ErrModifyingIdentity, "Affiliation '%s' is not supported", newAff)
 			}
 		}
 		checkAff = true
@@ -406,27 +514,156 @@ func processPutRequest(ctx *serverRequestContextImpl, caname string) (*api.Ident
 		checkAttrs = true
 	}
 
-	err = ctx.CanModifyUser(&req, checkAff, checkType, checkAttrs, userToModify)
+	err = ctx.CanModifyUser(req, checkAff, checkType, checkAttrs, userToModify)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	err = registry.UpdateUser(modReq, setPass)
+	err = ctx.ca.checkModifiedAttrs(req.ID, modReq.Type, prevAttrs, modReq.Attributes)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	userToModify, err = registry.GetUser(modifyID, nil)
+	err = ctx.checkSuspendRequest(req, userToModify)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if setPass {
+		err = ctx.ca.checkPasswordPolicy(req.Secret)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return modReq, setPass, nil
+}
+
+// Handle a request to replace the enrollment secret of an identity with a new
+// random secret. The caller must be able to manage the identity. The state of
+// the identity is reset, so that the new secret can be used for as many
+// enrollments as the identity is allowed.
+func identitySecretHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	var req api.ResetSecretRequest
+	err := ctx.ReadBody(&req)
+	if err != nil {
+		return nil, err
+	}
+	callerID, err := ctx.TokenAuthentication()
+	log.Debugf("Received reset secret request from %s", callerID)
+	if err != nil {
+		return nil, err
+	}
+	caname, err := ctx.getCAName()
+	if err != nil {
+		return nil, err
+	}
+	id, err := ctx.GetVar("id")
+	if err != nil {
+		return nil, err
+	}
+	caUser, err := ctx.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	u, ok := caUser.(*user.Impl)
+	if !ok {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrInvalidLDAPAction, "The secret of identity '%s' cannot be reset when LDAP is enabled", id)
+	}
+	if u.IsRevoked() {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrRevokedID, "The secret of identity '%s' cannot be reset because it is revoked", id)
+	}
+	ca := ctx.ca
+	secretExpiry, err := getSecretExpiry(req.SecretExpiry, ca.Config.Registry.SecretExpiry)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := getIDResp(userToModify, req.Secret, caname)
+	info := u.Info
+	info.Pass = ca.newSecret()
+	info.State = 0
+	info.IncorrectPasswordAttempts = 0
+	info.SecretExpiry = secretExpiry
+	err = ca.registry.UpdateUser(&info, true)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrModifyingIdentity, "Failed to reset the secret of identity '%s': %s", id, err)
+	}
+	ca.emitEvent(webhook.IdentityModified, &identityEvent{
+		ID:          id,
+		Type:        info.Type,
+		Affiliation: info.Affiliation,
+		Caller:      ctx.enrollmentID,
+	})
+
+	log.Debugf("Secret of identity '%s' successfully reset", id)
+	return &api.ResetSecretResponse{
+		ID:           id,
+		Secret:       info.Pass,
+		SecretExpiry: secretExpiry,
+		CAName:       caname,
+	}, nil
+}
+
+// Handle a request to give an identity a new TOTP seed, which it must enroll
+// with, or to remove its seed. The caller must be able to manage the
+// identity. The seed of an identity whose attributes require a TOTP cannot
+// be removed.
+func identityTOTPHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	var req api.TOTPRequest
+	err := ctx.ReadBody(&req)
+	if err != nil {
+		return nil, err
+	}
+	callerID, err := ctx.TokenAuthentication()
+	log.Debugf("Received TOTP request from %s", callerID)
+	if err != nil {
+		return nil, err
+	}
+	caname, err := ctx.getCAName()
+	if err != nil {
+		return nil, err
+	}
+	id, err := ctx.GetVar("id")
+	if err != nil {
+		return nil, err
+	}
+	caUser, err := ctx.GetUser(id)
 	if err != nil {
 		return nil, err
 	}
+	u, ok := caUser.(*user.Impl)
+	if !ok {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrInvalidLDAPAction, "The TOTP seed of identity '%s' cannot be set when LDAP is enabled", id)
+	}
+	ca := ctx.ca
+	resp := &api.TOTPResponse{
+		ID:     id,
+		CAName: caname,
+	}
+	if req.Disable {
+		if ca.totp.Required(u.Attributes) {
+			return nil, caerrors.NewHTTPErr(400, caerrors.ErrTOTPSeed, "The TOTP seed of identity '%s' cannot be removed because its attributes require a TOTP", id)
+		}
+		err = u.SetTOTPSeed("")
+		if err != nil {
+			return nil, caerrors.NewHTTPErr(500, caerrors.ErrTOTPSeed, "Failed to remove the TOTP seed of identity '%s': %s", id, err)
+		}
+	} else {
+		if u.IsRevoked() {
+			return nil, caerrors.NewHTTPErr(400, caerrors.ErrRevokedID, "The TOTP seed of identity '%s' cannot be set because it is revoked", id)
+		}
+		resp.TOTPSeed, resp.TOTPURI, err = ca.setTOTPSeed(u)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ca.emitEvent(webhook.IdentityModified, &identityEvent{
+		ID:          id,
+		Type:        u.Type,
+		Affiliation: u.Affiliation,
+		Caller:      ctx.enrollmentID,
+	})
 
-	log.Debugf("Identity successfully modified")
+	log.Debugf("TOTP seed of identity '%s' successfully updated", id)
 	return resp, nil
 }
 
@@ -483,7 +720,7 @@ func getIDResp(caUser user.User, secret, caname string) (*api.IdentityResponse,
 	if err != nil {
 		return nil, err
 	}
-	return &api.IdentityResponse{
+	resp := &api.IdentityResponse{
 		ID:             caUser.GetName(),
 		Type:           caUser.GetType(),
 		Affiliation:    user.GetAffiliation(caUser),
@@ -491,5 +728,9 @@ func getIDResp(caUser user.User, secret, caname string) (*api.IdentityResponse,
 		MaxEnrollments: caUser.GetMaxEnrollments(),
 		Secret:         secret,
 		CAName:         caname,
-	}, nil
+	}
+	if u, ok := caUser.(*user.Impl); ok {
+		resp.Suspended = u.IsSuspended()
+	}
+	return resp, nil
 }
@@ -13,10 +13,12 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
 	"github.com/hyperledger/fabric-ca/lib/attr"
+	"github.com/hyperledger/fabric-ca/lib/server/password"
 	"github.com/hyperledger/fabric-ca/lib/server/user"
 	cadbuser "github.com/hyperledger/fabric-ca/lib/server/user"
 	"github.com/stretchr/testify/assert"
@@ -960,6 +962,208 @@ func cleanMultiCADir(t *testing.T) {
 	}
 }
 
+func TestSecretExpiry(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	srv.CA.Config.Registry.SecretExpiry = time.Hour
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	admin := resp.Identity
+
+	_, err = admin.Register(&api.RegistrationRequest{Name: "user1", SecretExpiry: "2h"})
+	if assert.Error(t, err, "Secret expiry greater than the CA's should fail") {
+		assert.Contains(t, err.Error(), "Error Code: 85")
+	}
+	_, err = admin.Register(&api.RegistrationRequest{Name: "user1", SecretExpiry: "-1h"})
+	assert.Error(t, err, "Negative secret expiry should fail")
+
+	// A one-time secret gets the expiry of the CA by default
+	rr, err := admin.Register(&api.RegistrationRequest{Name: "user1", MaxEnrollments: 1})
+	util.FatalError(t, err, "Failed to register user 'user1'")
+	id, err := admin.GetIdentity("user1", "")
+	util.FatalError(t, err, "Failed to get user 'user1'")
+	assert.Equal(t, cadbuser.SecretActive, id.SecretState)
+	if assert.NotNil(t, id.SecretExpiry) {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *id.SecretExpiry, time.Minute)
+	}
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "user1", Secret: rr.Secret})
+	util.FatalError(t, err, "Failed to enroll 'user1'")
+	id, err = admin.GetIdentity("user1", "")
+	util.FatalError(t, err, "Failed to get user 'user1'")
+	assert.Equal(t, cadbuser.SecretUsed, id.SecretState)
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "user1", Secret: rr.Secret})
+	assert.Error(t, err, "A one-time secret should not be reusable")
+
+	// A reset secret can be used again, and the old secret cannot
+	_, err = admin.ResetSecret(&api.ResetSecretRequest{ID: "user1", SecretExpiry: "2h"})
+	assert.Error(t, err, "Secret expiry greater than the CA's should fail")
+	reset, err := admin.ResetSecret(&api.ResetSecretRequest{ID: "user1", SecretExpiry: "10m"})
+	util.FatalError(t, err, "Failed to reset the secret of 'user1'")
+	assert.NotEqual(t, rr.Secret, reset.Secret)
+	if assert.NotNil(t, reset.SecretExpiry) {
+		assert.WithinDuration(t, time.Now().Add(10*time.Minute), *reset.SecretExpiry, time.Minute)
+	}
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "user1", Secret: rr.Secret})
+	assert.Error(t, err, "The old secret should no longer be valid")
+
+	// An expired secret cannot be used to enroll
+	u, err := srv.CA.registry.GetUser("user1", nil)
+	util.FatalError(t, err, "Failed to get user 'user1'")
+	info := u.(*cadbuser.Impl).Info
+	info.Pass = string(u.(*cadbuser.Impl).GetPass())
+	expired := time.Now().UTC().Add(-time.Minute)
+	info.SecretExpiry = &expired
+	err = srv.CA.registry.UpdateUser(&info, false)
+	util.FatalError(t, err, "Failed to update user 'user1'")
+	id, err = admin.GetIdentity("user1", "")
+	util.FatalError(t, err, "Failed to get user 'user1'")
+	assert.Equal(t, cadbuser.SecretExpired, id.SecretState)
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "user1", Secret: reset.Secret})
+	assert.Error(t, err, "An expired secret should not be valid")
+
+	reset, err = admin.ResetSecret(&api.ResetSecretRequest{ID: "user1"})
+	util.FatalError(t, err, "Failed to reset the secret of 'user1'")
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "user1", Secret: reset.Secret})
+	assert.NoError(t, err, "Failed to enroll with the reset secret of 'user1'")
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	srv.CA.Config.Registry.PasswordPolicy = password.PolicyConfig{MinLength: 16, CharClasses: 3, DenyList: []string{"Password12345678"}}
+	srv.CA.Config.Registry.PasswordHash = password.HashConfig{Algorithm: password.Argon2id, Cost: 1}
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	// The bootstrap identity is not subject to the policy
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	admin := resp.Identity
+
+	_, err = admin.Register(&api.RegistrationRequest{Name: "user1", Secret: "Short-1"})
+	if assert.Error(t, err, "Secret shorter than the minimum length should fail") {
+		assert.Contains(t, err.Error(), "Error Code: 86")
+	}
+	_, err = admin.Register(&api.RegistrationRequest{Name: "user1", Secret: "alllowercaseletters"})
+	assert.Error(t, err, "Secret with too few character classes should fail")
+	_, err = admin.Register(&api.RegistrationRequest{Name: "user1", Secret: "PASSWORD12345678"})
+	assert.Error(t, err, "Secret on the deny list should fail")
+	_, err = admin.Register(&api.RegistrationRequest{Name: "user1", Secret: "Correct-Horse-42"})
+	util.FatalError(t, err, "Failed to register user 'user1'")
+	rr, err := admin.Register(&api.RegistrationRequest{Name: "user2"})
+	util.FatalError(t, err, "Failed to register user 'user2'")
+	assert.Len(t, rr.Secret, 16, "Generated secrets should be as long as the policy requires")
+
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "user1", Secret: "weak"})
+	if assert.Error(t, err, "Modifying a secret to one which does not follow the policy should fail") {
+		assert.Contains(t, err.Error(), "Error Code: 86")
+	}
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "user1", Secret: "Battery-Staple-7"})
+	util.FatalError(t, err, "Failed to modify the secret of 'user1'")
+
+	u, err := srv.CA.registry.GetUser("user1", nil)
+	util.FatalError(t, err, "Failed to get user 'user1'")
+	assert.True(t, strings.HasPrefix(string(u.(*cadbuser.Impl).GetPass()), "$argon2id$"), "Secrets should be hashed with argon2id")
+
+	// A hash made with another algorithm is upgraded on the next login
+	accessor := srv.CA.registry.(*Accessor)
+	accessor.SetPasswordHasher(nil)
+	_, err = admin.Register(&api.RegistrationRequest{Name: "user3", Secret: "Tr0ub4dor&3-Horse"})
+	util.FatalError(t, err, "Failed to register user 'user3'")
+	accessor.SetPasswordHasher(srv.CA.passwordHasher)
+	u, err = srv.CA.registry.GetUser("user3", nil)
+	util.FatalError(t, err, "Failed to get user 'user3'")
+	assert.True(t, strings.HasPrefix(string(u.(*cadbuser.Impl).GetPass()), "$2a$"), "Secret should be hashed with bcrypt")
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "user3", Secret: "Tr0ub4dor&3-Horse"})
+	util.FatalError(t, err, "Failed to enroll 'user3'")
+	u, err = srv.CA.registry.GetUser("user3", nil)
+	util.FatalError(t, err, "Failed to get user 'user3'")
+	assert.True(t, strings.HasPrefix(string(u.(*cadbuser.Impl).GetPass()), "$argon2id$"), "Hash should be upgraded to argon2id on login")
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "user3", Secret: "Tr0ub4dor&3-Horse"})
+	assert.NoError(t, err, "Failed to enroll 'user3' with the upgraded hash")
+}
+
+func TestSuspendIdentity(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	admin := resp.Identity
+
+	rr, err := admin.Register(&api.RegistrationRequest{Name: "user1"})
+	util.FatalError(t, err, "Failed to register user 'user1'")
+	resp, err = client.Enroll(&api.EnrollmentRequest{Name: "user1", Secret: rr.Secret})
+	util.FatalError(t, err, "Failed to enroll 'user1'")
+	user1 := resp.Identity
+
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "user1", Suspend: true, Resume: true})
+	assert.Error(t, err, "Suspending and resuming an identity at once should fail")
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "user1", Hold: true})
+	assert.Error(t, err, "Hold without suspend or resume should fail")
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "admin", Suspend: true})
+	assert.Error(t, err, "An identity should not be able to suspend itself")
+
+	modResp, err := admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "user1", Suspend: true})
+	util.FatalError(t, err, "Failed to suspend 'user1'")
+	assert.True(t, modResp.Suspended)
+	id, err := admin.GetIdentity("user1", "")
+	util.FatalError(t, err, "Failed to get user 'user1'")
+	assert.True(t, id.Suspended)
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "user1", Secret: rr.Secret})
+	if assert.Error(t, err, "Enrollment of a suspended identity should fail") {
+		assert.Contains(t, err.Error(), "Error Code: 91")
+	}
+	_, err = user1.Reenroll(&api.ReenrollmentRequest{})
+	if assert.Error(t, err, "Reenrollment of a suspended identity should fail") {
+		assert.Contains(t, err.Error(), "Error Code: 91")
+	}
+
+	// The certificates of the identity are placed on hold and released
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "user1", Suspend: true, Hold: true})
+	util.FatalError(t, err, "Failed to place the certificates of 'user1' on hold")
+	certs, err := srv.CA.certDBAccessor.GetCertificatesByID("user1")
+	util.FatalError(t, err, "Failed to get certificates of 'user1'")
+	if assert.Len(t, certs, 1) {
+		assert.Equal(t, "revoked", certs[0].Status)
+		assert.Equal(t, ocsp.CertificateHold, certs[0].Reason)
+	}
+	u, err := srv.CA.registry.GetUser("user1", nil)
+	util.FatalError(t, err, "Failed to get user 'user1'")
+	assert.False(t, u.IsRevoked(), "A suspended identity should not be revoked")
+
+	modResp, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "user1", Resume: true, Hold: true})
+	util.FatalError(t, err, "Failed to resume 'user1'")
+	assert.False(t, modResp.Suspended)
+	certs, err = srv.CA.certDBAccessor.GetCertificatesByID("user1")
+	util.FatalError(t, err, "Failed to get certificates of 'user1'")
+	if assert.Len(t, certs, 1) {
+		assert.Equal(t, "good", certs[0].Status)
+	}
+	_, err = user1.Reenroll(&api.ReenrollmentRequest{})
+	assert.NoError(t, err, "Failed to reenroll 'user1' after it was resumed")
+}
+
 func captureOutput(f func(string, func(*json.Decoder) error) error, caname string, cb func(*json.Decoder) error) (string, error) {
 	old := os.Stdout
 	r, w, err := os.Pipe()
@@ -977,3 +1181,144 @@ func captureOutput(f func(string, func(*json.Decoder) error) error, caname strin
 	io.Copy(&buf, r)
 	return buf.String(), nil
 }
+
+func TestBatchIdentities(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	admin := resp.Identity
+
+	_, err = admin.Batch(&api.BatchRequest{})
+	assert.Error(t, err, "A batch request without identities should fail")
+
+	identities := []api.BatchIdentity{
+		{RegistrationRequest: api.RegistrationRequest{Name: "batch1", Affiliation: "org1"}},
+		{RegistrationRequest: api.RegistrationRequest{Name: "batch2", Affiliation: "bogus"}},
+		{RegistrationRequest: api.RegistrationRequest{Name: "batch1", Affiliation: "org2"}},
+	}
+
+	// An all-or-nothing batch stores nothing if an entry is not valid
+	batchResp, err := admin.Batch(&api.BatchRequest{Identities: identities})
+	util.FatalError(t, err, "Failed to send all-or-nothing batch request")
+	if assert.Len(t, batchResp.Results, 3) {
+		assert.Equal(t, api.BatchSkipped, batchResp.Results[0].Status)
+		assert.Empty(t, batchResp.Results[0].Secret)
+		assert.Equal(t, api.BatchFailed, batchResp.Results[1].Status)
+		assert.NotEmpty(t, batchResp.Results[1].Error)
+		assert.Equal(t, api.BatchFailed, batchResp.Results[2].Status)
+	}
+	_, err = srv.CA.registry.GetUser("batch1", nil)
+	assert.Error(t, err, "No identity of a failed all-or-nothing batch should be stored")
+
+	// A best effort batch stores the valid entries
+	batchResp, err = admin.Batch(&api.BatchRequest{Identities: identities, BestEffort: true})
+	util.FatalError(t, err, "Failed to send best effort batch request")
+	if assert.Len(t, batchResp.Results, 3) {
+		assert.Equal(t, api.BatchRegistered, batchResp.Results[0].Status)
+		assert.NotEmpty(t, batchResp.Results[0].Secret)
+		assert.Equal(t, api.BatchFailed, batchResp.Results[1].Status)
+		assert.Equal(t, api.BatchFailed, batchResp.Results[2].Status)
+	}
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "batch1", Secret: batchResp.Results[0].Secret})
+	assert.NoError(t, err, "Failed to enroll with the secret returned by the batch request")
+
+	// Identities are registered and modified in one batch
+	batchResp, err = admin.Batch(&api.BatchRequest{Identities: []api.BatchIdentity{
+		{RegistrationRequest: api.RegistrationRequest{Name: "batch1", Type: "peer"}, Modify: true},
+		{RegistrationRequest: api.RegistrationRequest{Name: "batch3", Secret: "batch3pw", Affiliation: "org2"}},
+	}})
+	util.FatalError(t, err, "Failed to send batch request")
+	if assert.Len(t, batchResp.Results, 2) {
+		assert.Equal(t, api.BatchModified, batchResp.Results[0].Status)
+		assert.Equal(t, api.BatchRegistered, batchResp.Results[1].Status)
+		assert.Equal(t, "batch3pw", batchResp.Results[1].Secret)
+	}
+	u, err := srv.CA.registry.GetUser("batch1", nil)
+	util.FatalError(t, err, "Failed to get user 'batch1'")
+	assert.Equal(t, "peer", u.GetType())
+	_, err = srv.CA.registry.GetUser("batch3", nil)
+	assert.NoError(t, err, "Failed to get user 'batch3'")
+
+	// An identity which is not registered cannot be modified
+	batchResp, err = admin.Batch(&api.BatchRequest{Identities: []api.BatchIdentity{
+		{RegistrationRequest: api.RegistrationRequest{Name: "batch4"}, Modify: true},
+	}})
+	util.FatalError(t, err, "Failed to send batch request")
+	if assert.Len(t, batchResp.Results, 1) {
+		assert.Equal(t, api.BatchFailed, batchResp.Results[0].Status)
+	}
+}
+
+func TestAttributeSchemas(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	schemas := []api.AttributeSchema{
+		{Name: "department", Type: attr.SchemaEnum, Values: []string{"sales", "hr"}, RequiredFor: []string{"user"}},
+		{Name: "employeeid", Type: attr.SchemaInt, Immutable: true},
+	}
+	srv := TestGetRootServer(t)
+	srv.CA.Config.Registry.AttributeSchemas = schemas
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	client := TestGetRootClient()
+	cainfo, err := client.GetCAInfo(&api.GetCAInfoRequest{})
+	util.FatalError(t, err, "Failed to get CA info")
+	assert.Equal(t, schemas, cainfo.AttributeSchemas, "The schemas should be returned by cainfo")
+
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	admin := resp.Identity
+
+	_, err = admin.Register(&api.RegistrationRequest{
+		Name:       "user1",
+		Type:       "user",
+		Attributes: []api.Attribute{{Name: "department", Value: "marketing"}},
+	})
+	if assert.Error(t, err, "Registration with a value which is not allowed should fail") {
+		assert.Contains(t, err.Error(), "Error Code: 96")
+	}
+	_, err = admin.Register(&api.RegistrationRequest{Name: "user1", Type: "user"})
+	assert.Error(t, err, "Registration without a required attribute should fail")
+	_, err = admin.AddIdentity(&api.AddIdentityRequest{
+		ID:         "user1",
+		Type:       "user",
+		Attributes: []api.Attribute{{Name: "department", Value: "sales"}, {Name: "employeeid", Value: "abc"}},
+	})
+	assert.Error(t, err, "Adding an identity with an invalid integer should fail")
+	_, err = admin.AddIdentity(&api.AddIdentityRequest{
+		ID:         "user1",
+		Type:       "user",
+		Attributes: []api.Attribute{{Name: "department", Value: "sales"}, {Name: "employeeid", Value: "42"}},
+	})
+	util.FatalError(t, err, "Failed to add identity 'user1'")
+
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "user1", Attributes: []api.Attribute{{Name: "department", Value: "hr"}}})
+	assert.NoError(t, err, "Failed to modify a mutable attribute")
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "user1", Attributes: []api.Attribute{{Name: "employeeid", Value: "43"}}})
+	if assert.Error(t, err, "Modifying an immutable attribute should fail") {
+		assert.Contains(t, err.Error(), "Error Code: 96")
+	}
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{ID: "user1", Attributes: []api.Attribute{{Name: "department", Value: ""}}})
+	assert.Error(t, err, "Removing a required attribute should fail")
+
+	batchResp, err := admin.Batch(&api.BatchRequest{Identities: []api.BatchIdentity{
+		{RegistrationRequest: api.RegistrationRequest{Name: "user2", Type: "user"}},
+	}})
+	util.FatalError(t, err, "Failed to send batch request")
+	if assert.Len(t, batchResp.Results, 1) {
+		assert.Equal(t, api.BatchFailed, batchResp.Results[0].Status)
+	}
+}
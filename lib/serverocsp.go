@@ -0,0 +1,305 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	dbutil "github.com/hyperledger/fabric-ca/lib/server/db/util"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	cfocsp "github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/ocsp"
+	cspsigner "github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp/signer"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	ocspPath = "ocsp"
+)
+
+// ocspSource is the source of the OCSP responses of a server. The CA which
+// answers a request is the one whose current certificate, or the certificate
+// of a key it rolled over from, matches the issuer hashes of the request.
+type ocspSource struct {
+	server *Server
+}
+
+// Response returns the OCSP response for the request
+func (src *ocspSource) Response(req *ocsp.Request) ([]byte, http.Header, error) {
+	for _, ca := range src.server.getCAs() {
+		resp, ok, err := ca.ocspResponse(req)
+		if ok {
+			return resp, nil, err
+		}
+	}
+	return nil, nil, cfocsp.ErrNotFound
+}
+
+// ocspResponse returns the OCSP response for the request and true if the CA
+// answers OCSP requests for the issuer of the request
+func (ca *CA) ocspResponse(req *ocsp.Request) ([]byte, bool, error) {
+	ca.stateMutex.RLock()
+	defer ca.stateMutex.RUnlock()
+	if ca.ocspSigner == nil {
+		return nil, false, nil
+	}
+	if ocspRequestMatchesIssuer(req, ca.ocspIssuer) {
+		resp, err := ca.getOCSPResponse(req.SerialNumber, ca.ocspIssuer, ca.ocspSigner)
+		return resp, true, err
+	}
+	for ski, signer := range ca.ocspRetiredSigners {
+		issuer := ca.retiredSigners[ski].cert
+		if ocspRequestMatchesIssuer(req, issuer) {
+			resp, err := ca.getOCSPResponse(req.SerialNumber, issuer, signer)
+			return resp, true, err
+		}
+	}
+	return nil, false, nil
+}
+
+// registerOCSPHandler registers the OCSP responder on the API listener and,
+// if configured, on the operations listener. GET requests carry the base64
+// encoded request in the path, which the routers would clean, so the
+// responder is called ahead of them with the path as sent.
+func (s *Server) registerOCSPHandler() {
+	responder := cfocsp.NewResponder(&ocspSource{server: s}, nil)
+	s.ocspHandlers = map[string]http.Handler{}
+	for _, prefix := range []string{"/" + ocspPath, apiPathPrefix + ocspPath} {
+		handler := ocspHandler(prefix, responder)
+		// The route names the OCSP requests in the metrics
+		s.mux.PathPrefix(prefix).Handler(handler).Name(ocspPath)
+		s.ocspHandlers[prefix] = s.cors(s.middleware(handler))
+	}
+	if s.Config.OCSP.Operations {
+		s.Operations.RegisterRawHandler("/"+ocspPath, ocspHandler("/"+ocspPath, responder))
+	}
+}
+
+// serveOCSP passes the requests under the OCSP paths to the OCSP responder
+// and all other requests to the router
+func (s *Server) serveOCSP(router http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.EscapedPath()
+		for prefix, handler := range s.ocspHandlers {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		router.ServeHTTP(w, r)
+	})
+}
+
+// ocspHandler returns the handler of the OCSP requests under the path
+// prefix. The responder gets the rest of the path as sent, as it decodes
+// the request of a GET itself.
+func ocspHandler(prefix string, responder http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := *r.URL
+		u.Path = strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+		u.RawPath = ""
+		req := *r
+		req.URL = &u
+		responder.ServeHTTP(w, &req)
+	})
+}
+
+// Initialize the signer of OCSP responses
+func (ca *CA) initOCSPSigner() error {
+	cfg := &ca.Config.OCSP
+	if !cfg.Enabled {
+		return nil
+	}
+	log.Debug("Initializing OCSP signer")
+
+	issuer, err := getCACert(ca)
+	if err != nil {
+		return err
+	}
+	responder := issuer
+	var signer crypto.Signer
+	if cfg.Certfile == "" {
+		_, signer, err = util.GetSignerFromCert(issuer, ca.csp)
+		if err != nil {
+			return errors.WithMessage(err, "Failed to get the CA signer for OCSP responses")
+		}
+	} else {
+		responder, signer, err = getOCSPDelegateSigner(cfg.Certfile, cfg.Keyfile, ca)
+		if err != nil {
+			return err
+		}
+		err = responder.CheckSignatureFrom(issuer)
+		if err != nil {
+			return errors.Wrapf(err, "OCSP signing certificate '%s' was not issued by the CA", cfg.Certfile)
+		}
+	}
+
+	expiry := cfg.Expiry
+	if expiry == 0 {
+		expiry = 24 * time.Hour
+	}
+	ca.ocspSigner, err = cfocsp.NewSigner(issuer, responder, signer, expiry)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create OCSP signer")
+	}
+	ca.ocspIssuer = issuer
+	// The certificates issued by a key the CA rolled over from are answered
+	// for with that key
+	ca.ocspRetiredSigners = map[string]cfocsp.Signer{}
+	for ski, retired := range ca.retiredSigners {
+		ca.ocspRetiredSigners[ski], err = cfocsp.NewSigner(retired.cert, retired.cert, retired.signer, expiry)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to create OCSP signer of retired CA key %s", ski)
+		}
+	}
+	return nil
+}
+
+// getOCSPDelegateSigner returns the delegated OCSP signing certificate and
+// its signer, looking the key up in the keystore and falling back to the
+// key file
+func getOCSPDelegateSigner(certFile, keyFile string, ca *CA) (*x509.Certificate, crypto.Signer, error) {
+	certBytes, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to read OCSP signing certificate '%s'", certFile)
+	}
+	cert, err := BytesToX509Cert(certBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasExtKeyUsage(cert, x509.ExtKeyUsageOCSPSigning) {
+		return nil, nil, errors.Errorf("Certificate '%s' does not have the OCSP signing extended key usage", certFile)
+	}
+	_, signer, err := util.GetSignerFromCert(cert, ca.csp)
+	if err == nil {
+		return cert, signer, nil
+	}
+	log.Debugf("No OCSP signing key found in BCCSP keystore, attempting fallback")
+	key, err := util.ImportBCCSPKeyFromPEM(keyFile, ca.csp, false)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "Could not find the OCSP signing key in BCCSP keystore nor in keyfile "+keyFile)
+	}
+	signer, err = cspsigner.New(ca.csp, key)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "Failed initializing CryptoSigner")
+	}
+	return cert, signer, nil
+}
+
+// getOCSPResponse returns the OCSP response for the certificate with the
+// serial number issued by the issuer, from the OCSP table if a response is
+// cached there. The response is signed by the signer.
+func (ca *CA) getOCSPResponse(serial *big.Int, issuer *x509.Certificate, signer cfocsp.Signer) ([]byte, error) {
+	sn := util.GetSerialAsHex(serial)
+	aki := strings.TrimLeft(hex.EncodeToString(issuer.SubjectKeyId), "0")
+
+	records, err := ca.certDBAccessor.GetOCSP(sn, aki)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed to get cached OCSP response")
+	}
+	now := time.Now()
+	for _, rec := range records {
+		if rec.Body != "" && rec.Expiry.After(now) {
+			return []byte(rec.Body), nil
+		}
+	}
+
+	certRecord, err := ca.certDBAccessor.GetCertificateWithID(sn, aki)
+	if err != nil {
+		if dbutil.IsGetError(err) {
+			return nil, cfocsp.ErrNotFound
+		}
+		return nil, err
+	}
+	cert, err := BytesToX509Cert([]byte(certRecord.PEM))
+	if err != nil {
+		return nil, err
+	}
+	req := cfocsp.SignRequest{
+		Certificate: cert,
+		Status:      certRecord.Status,
+	}
+	if certRecord.Status == string(Revoked) {
+		req.Reason = certRecord.Reason
+		req.RevokedAt = certRecord.RevokedAt
+	}
+	thisUpdate := now.UTC()
+	req.ThisUpdate = &thisUpdate
+	resp, err := signer.Sign(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to sign OCSP response")
+	}
+
+	parsed, err := ocsp.ParseResponse(resp, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse signed OCSP response")
+	}
+	err = ca.certDBAccessor.UpsertOCSP(sn, aki, string(resp), parsed.NextUpdate)
+	if err != nil {
+		log.Warningf("Failed to cache OCSP response for certificate %s: %s", sn, err)
+	}
+	return resp, nil
+}
+
+// invalidateOCSPResponse marks the cached OCSP response of the certificate
+// as expired so that the next request gets a response with the new status
+func (ca *CA) invalidateOCSPResponse(serial, aki string) {
+	if ca.ocspSigner == nil {
+		return
+	}
+	records, err := ca.certDBAccessor.GetOCSP(serial, aki)
+	if err != nil || len(records) == 0 {
+		return
+	}
+	err = ca.certDBAccessor.UpdateOCSP(serial, aki, "", time.Now())
+	if err != nil {
+		log.Warningf("Failed to invalidate cached OCSP response for certificate %s: %s", serial, err)
+	}
+}
+
+// ocspRequestMatchesIssuer returns true if the OCSP request is for a
+// certificate issued by the issuer
+func ocspRequestMatchesIssuer(req *ocsp.Request, issuer *x509.Certificate) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	_, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki)
+	if err != nil {
+		return false
+	}
+	h := req.HashAlgorithm.New()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h = req.HashAlgorithm.New()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+	return bytes.Equal(nameHash, req.IssuerNameHash) && bytes.Equal(keyHash, req.IssuerKeyHash)
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
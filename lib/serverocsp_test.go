@@ -0,0 +1,146 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestOCSPResponder(t *testing.T) {
+	srv := TestGetRootServer(t)
+	srv.CA.Config.OCSP.Enabled = true
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	c := TestGetRootClient()
+	resp, err := c.Enroll(&api.EnrollmentRequest{
+		Name:   "admin",
+		Secret: "adminpw",
+	})
+	util.FatalError(t, err, "Failed to enroll 'admin'")
+	admin := resp.Identity
+	cert := admin.GetECert().GetX509Cert()
+	issuer := srv.CA.ocspIssuer
+	url := fmt.Sprintf("http://localhost:%d/api/v1/ocsp", rootPort)
+
+	ocspResp, err := postOCSPRequest(url, cert, issuer)
+	util.FatalError(t, err, "Failed to get OCSP response")
+	assert.Equal(t, ocsp.Good, ocspResp.Status)
+
+	// The same response is returned from the cache for a GET request
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	util.FatalError(t, err, "Failed to create OCSP request")
+	ocspResp, err = getOCSPResponse(url+"/"+base64.StdEncoding.EncodeToString(req), issuer)
+	util.FatalError(t, err, "Failed to get OCSP response")
+	assert.Equal(t, ocsp.Good, ocspResp.Status)
+
+	// The path of a GET request is passed to the responder as sent rather
+	// than cleaned by the router
+	encoded := strings.Replace(base64.StdEncoding.EncodeToString(req), "+", "%2B", -1)
+	ocspResp, err = getOCSPResponse(url+"//"+encoded, issuer)
+	util.FatalError(t, err, "Failed to get OCSP response with an unclean path")
+	assert.Equal(t, ocsp.Good, ocspResp.Status)
+
+	_, err = admin.Revoke(&api.RevocationRequest{
+		Serial: util.GetSerialAsHex(cert.SerialNumber),
+		AKI:    hex.EncodeToString(cert.AuthorityKeyId),
+		Reason: "keycompromise",
+	})
+	util.FatalError(t, err, "Failed to revoke the certificate of 'admin'")
+
+	ocspResp, err = postOCSPRequest(url, cert, issuer)
+	util.FatalError(t, err, "Failed to get OCSP response")
+	assert.Equal(t, ocsp.Revoked, ocspResp.Status)
+	assert.Equal(t, ocsp.KeyCompromise, ocspResp.RevocationReason)
+
+	// Requests for certificates of other issuers are not answered
+	_, err = postOCSPRequest(url, cert, cert)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+}
+
+func TestOCSPRetiredIssuer(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	resp, err := TestGetRootClient().Enroll(&api.EnrollmentRequest{
+		Name:   "admin",
+		Secret: "adminpw",
+	})
+	util.FatalError(t, err, "Failed to enroll 'admin'")
+	cert := resp.Identity.GetECert().GetX509Cert()
+	oldIssuer := readCertFile(t, srv.CA.Config.CA.Certfile)
+	err = srv.Stop()
+	util.FatalError(t, err, "Failed to stop server")
+
+	srv = TestGetServer2(false, rootPort, rootDir, "", -1, t)
+	err = srv.RolloverCA("")
+	util.FatalError(t, err, "Failed to roll over CA key")
+
+	// The certificates issued by the retired key are answered for with it
+	srv = TestGetServer2(false, rootPort, rootDir, "", -1, t)
+	srv.CA.Config.OCSP.Enabled = true
+	err = srv.Start()
+	util.FatalError(t, err, "Failed to start server after rollover")
+	defer srv.Stop()
+	url := fmt.Sprintf("http://localhost:%d/api/v1/ocsp", rootPort)
+
+	ocspResp, err := postOCSPRequest(url, cert, oldIssuer)
+	util.FatalError(t, err, "Failed to get OCSP response for the retired issuer")
+	assert.Equal(t, ocsp.Good, ocspResp.Status)
+	assert.NotEqual(t, oldIssuer.SubjectKeyId, srv.CA.ocspIssuer.SubjectKeyId)
+}
+
+func postOCSPRequest(url string, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Post(url, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	return readOCSPResponse(resp, issuer)
+}
+
+func getOCSPResponse(url string, issuer *x509.Certificate) (*ocsp.Response, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	return readOCSPResponse(resp, issuer)
+}
+
+func readOCSPResponse(resp *http.Response, issuer *x509.Certificate) (*ocsp.Response, error) {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ocsp.ParseResponse(body, issuer)
+}
@@ -0,0 +1,158 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib/attr"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+// provisionedByOIDC is the value of the 'hf.ProvisionedBy' attribute of the
+// identities which are added to the registry for ID tokens
+const provisionedByOIDC = "oidc"
+
+// idTokenAuthentication authenticates the caller by the OpenID Connect ID
+// token of the authorization header and returns the enrollment ID. Unless
+// the identity provider is the registry of the CA, the caller is the
+// identity of the registry, which is added when it first enrolls.
+func (ctx *serverRequestContextImpl) idTokenAuthentication(ca *CA, token string) (string, error) {
+	if ca.oidc == nil {
+		return "", caerrors.NewAuthenticationErr(caerrors.ErrInvalidIDToken, "Enrollment with OpenID Connect ID tokens is not enabled")
+	}
+	idUser, err := ca.oidc.Authenticate(token)
+	if err != nil {
+		return "", caerrors.NewAuthenticationErr(caerrors.ErrInvalidIDToken, "Invalid ID token: %s", err)
+	}
+	id := idUser.GetName()
+	err = ctx.limitIdentity(ca, id)
+	if err != nil {
+		return "", err
+	}
+	caller := idUser
+	if !ca.oidc.IsRegistry() {
+		caller, err = ca.provisionIdentity(idUser)
+		if err != nil {
+			if caerrors.GetCause(err) != nil {
+				return "", err
+			}
+			return "", caerrors.NewHTTPErr(500, caerrors.ErrGettingUser, "Failed to get identity of ID token: %s", err)
+		}
+		if caller.IsRevoked() {
+			return "", caerrors.NewAuthorizationErr(caerrors.ErrRevokedID, "Enrollment ID is revoked, unable to process request")
+		}
+	}
+	err = checkSuspended(caller)
+	if err != nil {
+		return "", err
+	}
+	// An ID token is not an enrollment secret, so its enrollments do not
+	// count against the maximum enrollments of the identity
+	ctx.ui = idUser
+	ctx.caller = caller
+	ctx.enrollmentID = id
+	log.Debugf("Authenticated '%s' by OpenID Connect ID token", id)
+	return id, nil
+}
+
+// provisionIdentity returns the identity of the registry for the identity
+// of an ID token. It is added to the registry, with a random secret, when
+// it first enrolls. When it enrolls again, its attributes are updated from
+// the claims of the token; its type and affiliation are those of the
+// registry. An ID token only maps to an identity which was added this way,
+// so that a token cannot take over an identity registered otherwise.
+func (ca *CA) provisionIdentity(idUser user.User) (user.User, error) {
+	name := idUser.GetName()
+	attrs, err := idUser.GetAttributes(nil)
+	if err != nil {
+		return nil, err
+	}
+	attrs = removeAttribute(attrs, attr.ProvisionedBy)
+	registered, err := ca.registry.GetUser(name, nil)
+	if err == nil {
+		err = checkProvisioned(registered)
+		if err != nil {
+			return nil, err
+		}
+		if len(attrs) == 0 {
+			return registered, nil
+		}
+		err = registered.ModifyAttributes(attrs)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "Failed to update attributes of identity '%s'", name)
+		}
+		return ca.registry.GetUser(name, nil)
+	}
+	affiliation := strings.Join(idUser.GetAffiliationPath(), ".")
+	if affiliation != "" {
+		_, err = ca.registry.GetAffiliation(affiliation)
+		if err != nil {
+			return nil, errors.Errorf("Affiliation '%s' of identity '%s' is not defined", affiliation, name)
+		}
+	}
+	registered, err = ca.insertProvisionedIdentity(&user.Info{
+		Name:        name,
+		Type:        idUser.GetType(),
+		Affiliation: affiliation,
+		Attributes:  append(attrs, api.Attribute{Name: attr.ProvisionedBy, Value: provisionedByOIDC}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Another enrollment may have registered the identity first
+	err = checkProvisioned(registered)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Added identity '%s' of an OpenID Connect ID token to the registry", name)
+	return registered, nil
+}
+
+// checkProvisioned returns an error if an identity of the registry was not
+// added for an ID token
+func checkProvisioned(registered user.User) error {
+	a, err := registered.GetAttribute(attr.ProvisionedBy)
+	if err != nil || a.Value != provisionedByOIDC {
+		return caerrors.NewAuthenticationErr(caerrors.ErrInvalidIDToken, "Identity '%s' of the ID token was not added by OpenID Connect", registered.GetName())
+	}
+	return nil
+}
+
+// removeAttribute returns a list of attributes without those with a name
+func removeAttribute(attrs []api.Attribute, name string) []api.Attribute {
+	var result []api.Attribute
+	for _, a := range attrs {
+		if a.Name != name {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// insertProvisionedIdentity adds an identity which authenticates other than
+// with its enrollment secret to the registry, with a random secret and no
+// maximum of enrollments, and returns it
+func (ca *CA) insertProvisionedIdentity(info *user.Info) (user.User, error) {
+	info.Pass = ca.newSecret()
+	info.MaxEnrollments = -1
+	info.Level = ca.server.levels.Identity
+	err := ca.registry.InsertUser(info)
+	if err != nil {
+		// Another enrollment of the identity may have added it first
+		registered, err2 := ca.registry.GetUser(info.Name, nil)
+		if err2 == nil {
+			return registered, nil
+		}
+		return nil, err
+	}
+	return ca.registry.GetUser(info.Name, nil)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/attr"
+	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvisionIdentity(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	// The identity of an ID token, as the identity provider returns it
+	idUser := func(name string) user.User {
+		return user.New(&user.Record{
+			Name:       name,
+			Type:       "client",
+			Attributes: `[{"name":"email","value":"someone@example.com"},{"name":"hf.ProvisionedBy","value":"oidc"}]`,
+		}, nil)
+	}
+
+	// The identity is added when it first enrolls, and found when it
+	// enrolls again
+	u, err := srv.CA.provisionIdentity(idUser("alice"))
+	util.FatalError(t, err, "Failed to provision identity 'alice'")
+	a, err := u.GetAttribute(attr.ProvisionedBy)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "oidc", a.Value)
+	}
+	_, err = srv.CA.provisionIdentity(idUser("alice"))
+	assert.NoError(t, err, "Failed to get provisioned identity 'alice'")
+
+	// An ID token does not map to an identity registered otherwise, even if
+	// the identity provider claims it was provisioned
+	_, err = srv.CA.provisionIdentity(idUser("admin"))
+	assert.Error(t, err, "An ID token should not map to the bootstrap admin")
+	admin, err := srv.CA.registry.GetUser("admin", nil)
+	util.FatalError(t, err, "Failed to get identity 'admin'")
+	_, err = admin.GetAttribute("email")
+	assert.Error(t, err, "The attributes of a registered identity should not change")
+
+	// The mark of a provisioned identity cannot be registered
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	_, err = resp.Identity.Register(&api.RegistrationRequest{
+		Name:       "bob",
+		Attributes: []api.Attribute{{Name: attr.ProvisionedBy, Value: "oidc"}},
+	})
+	assert.Error(t, err, "A registrar should not mark an identity as provisioned")
+}
@@ -0,0 +1,79 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/ratelimit"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+)
+
+// limitRequest rejects the request if its client IP address or its endpoint
+// exceeded their rate limit
+func (se *serverEndpoint) limitRequest(ctx *serverRequestContextImpl) error {
+	limiter := se.Server.limiter
+	if limiter == nil {
+		return nil
+	}
+	ip := clientIP(ctx.req)
+	ok, kind, wait := limiter.AllowRequest(ip, se.endpointName())
+	if ok {
+		return nil
+	}
+	return ctx.rateLimited(kind, ip, wait)
+}
+
+// limitIdentity rejects the request if the enrollment ID of the caller
+// exceeded its rate limit. The limit is only checked once per request.
+func (ctx *serverRequestContextImpl) limitIdentity(ca *CA, id string) error {
+	limiter := ctx.endpoint.Server.limiter
+	if limiter == nil || ctx.identityLimited {
+		return nil
+	}
+	ctx.identityLimited = true
+	ok, wait := limiter.AllowIdentity(ca.Config.CA.Name, id)
+	if ok {
+		return nil
+	}
+	return ctx.rateLimited(ratelimit.Identity, id, wait)
+}
+
+// rateLimited counts a request which exceeded a rate limit and returns the
+// error of its response, which tells the client when to retry
+func (ctx *serverRequestContextImpl) rateLimited(kind, client string, wait time.Duration) error {
+	se := ctx.endpoint
+	se.Server.Metrics.APIThrottledCounter.With("api_name", se.Path, "limit", kind).Add(1)
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	ctx.resp.Header().Set("Retry-After", strconv.Itoa(seconds))
+	log.Debugf("Request of %s to %s exceeded the %s rate limit; retry after %d seconds", client, se.Path, kind, seconds)
+	return caerrors.NewHTTPErr(http.StatusTooManyRequests, caerrors.ErrRateLimited, "Too many requests; retry after %d seconds", seconds)
+}
+
+// endpointName returns the name of the endpoint the rate limits of the
+// endpoints are configured for, which is the first segment of its path
+func (se *serverEndpoint) endpointName() string {
+	return strings.SplitN(se.Path, "/", 2)[0]
+}
+
+// clientIP returns the IP address of the client of a request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
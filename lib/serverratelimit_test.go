@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/server/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	srv := TestGetRootServer(t)
+	srv.Config.RateLimit = ratelimit.Config{
+		Enabled:   true,
+		Identity:  ratelimit.IdentityLimit{Rate: 1, Burst: 2},
+		Endpoints: []ratelimit.EndpointLimit{{Name: "cainfo", Rate: 1, Burst: 1}},
+	}
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	// The endpoint limit applies to all clients
+	c := TestGetRootClient()
+	_, err = c.GetCAInfo(&api.GetCAInfoRequest{})
+	util.FatalError(t, err, "Failed to get CA info")
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/cainfo", rootPort))
+	util.FatalError(t, err, "Failed to send cainfo request")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	// Failed logins do not use up the limit of the identity they claim
+	for i := 0; i < 2; i++ {
+		_, err = c.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "wrongpw"})
+		assert.Error(t, err, "Enrollment with a wrong password should fail")
+	}
+
+	// The identity limit applies to the authenticated caller
+	enrollResp, err := c.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll 'admin'")
+	admin := enrollResp.Identity
+	_, err = admin.GetIdentity("admin", "")
+	assert.NoError(t, err, "Request within the burst of 'admin' should be allowed")
+	_, err = admin.GetIdentity("admin", "")
+	if assert.Error(t, err, "Request after the burst of 'admin' should be limited") {
+		assert.Contains(t, err.Error(), "Error Code: 84")
+	}
+}
@@ -11,10 +11,12 @@ import (
 	"net/url"
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
-	"github.com/hyperledger/fabric-ca/internal/pkg/util"
 	"github.com/hyperledger/fabric-ca/lib/attr"
 	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/approval"
+	"github.com/hyperledger/fabric-ca/lib/server/totp"
 	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
 
 	"github.com/pkg/errors"
@@ -56,25 +58,26 @@ func register(ctx ServerRequestContext, ca *CA) (interface{}, error) {
 		return nil, caerrors.NewHTTPErr(403, caerrors.ErrInvalidLDAPAction, "Registration is not supported when using LDAP")
 	}
 	// Register User
-	secret, err := registerUser(&req.RegistrationRequest, callerID, ca, ctx)
+	regResp, err := registerUser(&req.RegistrationRequest, callerID, ca, ctx)
 	if err != nil {
 		return nil, err
 	}
 	// Return response
 	resp := &api.RegistrationResponseNet{
-		RegistrationResponse: api.RegistrationResponse{Secret: secret},
+		RegistrationResponse: *regResp,
 	}
 	return resp, nil
 }
 
-// RegisterUser will register a user and return the secret
-func registerUser(req *api.RegistrationRequest, registrar string, ca *CA, ctx ServerRequestContext) (string, error) {
+// RegisterUser will register a user and return the secret, and the TOTP
+// seed of a user which enrolls with a TOTP
+func registerUser(req *api.RegistrationRequest, registrar string, ca *CA, ctx ServerRequestContext) (*api.RegistrationResponse, error) {
 	var err error
 	var registrarUser user.User
 
 	registrarUser, err = ctx.GetCaller()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	normalizeRegistrationRequest(req, registrarUser)
@@ -83,16 +86,33 @@ func registerUser(req *api.RegistrationRequest, registrar string, ca *CA, ctx Se
 	err = canRegister(registrarUser, req, ca, ctx)
 	if err != nil {
 		log.Debugf("Registrar is not allowed to register user '%s': %s", req.Name, err)
-		return "", caerrors.NewAuthorizationErr(caerrors.ErrRegistrarRegAuth, "Registration of '%s' failed", req.Name)
+		return nil, caerrors.NewAuthorizationErr(caerrors.ErrRegistrarRegAuth, "Registration of '%s' failed", req.Name)
 	}
 
-	secret, err := registerUserID(req, ca)
+	// Give the identity the attributes of its roles
+	err = ca.addRoleAttributes(req, registrarUser)
 	if err != nil {
-		return "", errors.WithMessagef(err, "Registration of '%s' failed", req.Name)
+		return nil, err
 	}
+
+	err = ca.checkRegistrationAttrs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ca.requireApproval(ctx, approval.Register, req.Name, req.Affiliation, req.Type, attributeNames(req.Attributes))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := registerUserID(req, ca)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Registration of '%s' failed", req.Name)
+	}
+	ca.emitEvent(webhook.IdentityRegistered, &identityEvent{ID: req.Name, Type: req.Type, Affiliation: req.Affiliation, Caller: registrar})
 	// Set the location header to the URI of the identity that was created by the registration request
 	ctx.GetResp().Header().Set("Location", fmt.Sprintf("%sidentities/%s", apiPathPrefix, url.PathEscape(req.Name)))
-	return secret, nil
+	return resp, nil
 }
 
 func normalizeRegistrationRequest(req *api.RegistrationRequest, registrar user.User) {
@@ -132,17 +152,46 @@ func validateAffiliation(req *api.RegistrationRequest, ca *CA, ctx ServerRequest
 }
 
 // registerUserID registers a new user and its enrollmentID, role and state
-func registerUserID(req *api.RegistrationRequest, ca *CA) (string, error) {
+func registerUserID(req *api.RegistrationRequest, ca *CA) (*api.RegistrationResponse, error) {
 	log.Debugf("Registering user id: %s\n", req.Name)
+
+	insert, resp, err := newUserInfo(req, ca)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ca.registry.InsertUser(insert)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// newUserInfo returns the user to be inserted by a registration request and
+// the response to the request. A user which is required to enroll with a
+// TOTP, by the request or by the TOTP attributes of the CA, is given a new
+// TOTP seed.
+func newUserInfo(req *api.RegistrationRequest, ca *CA) (*user.Info, *api.RegistrationResponse, error) {
 	var err error
 
 	if req.Secret == "" {
-		req.Secret = util.RandomString(12)
+		req.Secret = ca.newSecret()
+	} else {
+		err = ca.checkPasswordPolicy(req.Secret)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
 	req.MaxEnrollments, err = getMaxEnrollments(req.MaxEnrollments, ca.Config.Registry.MaxEnrollments)
 	if err != nil {
-		return "", err
+		return nil, nil, err
+	}
+
+	secretExpiry, err := getSecretExpiry(req.SecretExpiry, ca.Config.Registry.SecretExpiry)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Add attributes containing the enrollment ID, type, and affiliation if not
@@ -159,21 +208,26 @@ func registerUserID(req *api.RegistrationRequest, ca *CA) (string, error) {
 		Attributes:     req.Attributes,
 		MaxEnrollments: req.MaxEnrollments,
 		Level:          ca.server.levels.Identity,
+		SecretExpiry:   secretExpiry,
 	}
-
-	registry := ca.registry
-
-	_, err = registry.GetUser(req.Name, nil)
-	if err == nil {
-		return "", caerrors.NewHTTPErr(409, caerrors.ErrDupIdentityReg, "Identity '%s' is already registered", req.Name)
+	resp := &api.RegistrationResponse{Secret: req.Secret}
+
+	if req.TOTP || ca.totp.Required(req.Attributes) {
+		seed, encSeed, err := ca.totp.NewSeed(req.Name)
+		if err != nil {
+			return nil, nil, caerrors.NewHTTPErr(500, caerrors.ErrTOTPSeed, "Failed to create TOTP seed: %s", err)
+		}
+		insert.TOTPSeed = encSeed
+		resp.TOTPSeed = totp.EncodeSeed(seed)
+		resp.TOTPURI = ca.totp.KeyURI(req.Name, seed)
 	}
 
-	err = registry.InsertUser(&insert)
-	if err != nil {
-		return "", err
+	_, err = ca.registry.GetUser(req.Name, nil)
+	if err == nil {
+		return nil, nil, caerrors.NewHTTPErr(409, caerrors.ErrDupIdentityReg, "Identity '%s' is already registered", req.Name)
 	}
 
-	return req.Secret, nil
+	return &insert, resp, nil
 }
 
 func canRegister(registrar user.User, req *api.RegistrationRequest, ca *CA, ctx ServerRequestContext) error {
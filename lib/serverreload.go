@@ -0,0 +1,503 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+
+	calog "github.com/hyperledger/fabric-ca/internal/pkg/log"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/cpabe"
+	"github.com/hyperledger/fabric-ca/lib/server/acme"
+	"github.com/hyperledger/fabric-ca/lib/server/ldap"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
+	stls "github.com/hyperledger/fabric-ca/lib/tls"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+const (
+	// reloadPath is the path of the endpoint of the operations listener
+	// which reloads the configuration
+	reloadPath = "/reload"
+)
+
+// ReloadResult is the result of reloading the configuration of the server
+type ReloadResult struct {
+	// CAs are the names of the CAs whose configuration was reloaded
+	CAs []string `json:"cas"`
+	// AddedCAs are the names of the CAs that were added from new CA files
+	AddedCAs []string `json:"added_cas,omitempty"`
+	// RestartRequired lists the changed settings that cannot be changed at
+	// runtime; they keep their running values until the server is restarted
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// setting is a setting that cannot be changed at runtime. Both fields are
+// pointers to the value of the setting.
+type setting struct {
+	name    string
+	running interface{}
+	loaded  interface{}
+}
+
+// keepRunningSettings sets the loaded value of the settings which changed to
+// their running value and returns the names of these settings
+func keepRunningSettings(prefix string, settings []setting) []string {
+	var changed []string
+	for _, s := range settings {
+		running := reflect.ValueOf(s.running).Elem()
+		loaded := reflect.ValueOf(s.loaded).Elem()
+		if reflect.DeepEqual(running.Interface(), loaded.Interface()) {
+			continue
+		}
+		changed = append(changed, prefix+s.name)
+		loaded.Set(running)
+	}
+	return changed
+}
+
+// Reload re-reads the configuration of the server and of its CAs, validates
+// it and swaps in the configuration, signers and signing profiles of each
+// CA. Identities and affiliations added to the registry section are added
+// to the registry, and the CAs of new CA files are started. Settings which
+// cannot be changed at runtime, such as the database of a CA, keep their
+// running values and are reported in the result. Nothing is changed if the
+// configuration is not valid.
+func (s *Server) Reload() (*ReloadResult, error) {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+	if s.listener == nil {
+		return nil, errors.New("The server is not running")
+	}
+	log.Info("Reloading configuration")
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed to load configuration")
+	}
+	defaults := cfg.CAcfg
+	result := &ReloadResult{}
+	restart, err := s.keepRunningServerSettings(cfg)
+	if err != nil {
+		return nil, err
+	}
+	result.RestartRequired = restart
+
+	// Load the configuration of the CAs of the CA files before the default
+	// configuration is initialized, as their missing values are taken from it
+	managed, err := s.readManagedCAs()
+	if err != nil {
+		return nil, err
+	}
+	allCAFiles, err := s.reloadCAFiles(cfg, managed)
+	if err != nil {
+		return nil, err
+	}
+	var caFiles []string
+	var caCfgs []*CAConfig
+	names := map[string]bool{s.CA.Config.CA.Name: true}
+	for _, caFile := range allCAFiles {
+		caCfg, err := s.loadCAConfig(caFile, &cfg.CAcfg)
+		if err != nil {
+			return nil, err
+		}
+		name := caCfg.CA.Name
+		if isCADisabled(managed, name) {
+			continue
+		}
+		if names[name] {
+			return nil, errors.Errorf("CA name '%s' is used by more than one CA", name)
+		}
+		names[name] = true
+		caFiles, caCfgs = append(caFiles, caFile), append(caCfgs, caCfg)
+	}
+
+	// Stage the new configuration of the default CA and of the CAs of the
+	// CA files, and load the CAs of new CA files
+	next, restart, err := s.CA.stageReload(&cfg.CAcfg)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Invalid configuration of CA '%s'", s.CA.Config.CA.Name)
+	}
+	cas, staged := []*CA{&s.CA}, []*CA{next}
+	result.RestartRequired = append(result.RestartRequired, restart...)
+	var added []*CA
+	abort := func() {
+		for _, ca := range added {
+			err := ca.closeDB()
+			if err != nil {
+				log.Errorf("Close DB failed: %s", err)
+			}
+		}
+	}
+	for i, caFile := range caFiles {
+		name := caCfgs[i].CA.Name
+		ca := s.lookupCA(name)
+		if ca == nil {
+			log.Infof("Loading new CA from %s", caFile)
+			ca, err = newCA(caFile, caCfgs[i], s, false)
+			if err != nil {
+				abort()
+				return nil, errors.WithMessagef(err, "Failed to load CA from '%s'", caFile)
+			}
+			added = append(added, ca)
+			s.caMapMutex.RLock()
+			err = s.checkCAConflicts(ca)
+			s.caMapMutex.RUnlock()
+			if err != nil {
+				abort()
+				return nil, err
+			}
+			continue
+		}
+		next, restart, err := ca.stageReload(caCfgs[i])
+		if err != nil {
+			abort()
+			return nil, errors.WithMessagef(err, "Invalid configuration of CA '%s'", name)
+		}
+		cas, staged = append(cas, ca), append(staged, next)
+		result.RestartRequired = append(result.RestartRequired, restart...)
+	}
+	for _, ca := range s.getCAs() {
+		if !names[ca.Config.CA.Name] {
+			result.RestartRequired = append(result.RestartRequired, fmt.Sprintf("cafiles: CA '%s' was removed", ca.Config.CA.Name))
+		}
+	}
+
+	// The configuration is valid, so swap it in while no request runs
+	s.stateMutex.Lock()
+	err = calog.SetLogLevel(cfg.LogLevel, cfg.Debug)
+	if err != nil {
+		s.stateMutex.Unlock()
+		abort()
+		return nil, err
+	}
+	rateLimit := s.Config.RateLimit
+	s.Config = cfg
+	s.caDefaults = &defaults
+	s.managedCAs = managed
+	// Keep the state of the rate limiter unless its configuration changed
+	if !reflect.DeepEqual(rateLimit, cfg.RateLimit) {
+		s.initRateLimiter()
+	}
+	s.stateMutex.Unlock()
+	var loadErr error
+	for i, ca := range cas {
+		err = ca.applyReload(staged[i])
+		if err != nil {
+			log.Errorf("Failed to reload CA '%s': %s", ca.Config.CA.Name, err)
+			loadErr = err
+		}
+		result.CAs = append(result.CAs, ca.Config.CA.Name)
+	}
+	for _, ca := range added {
+		err = s.addCA(ca)
+		if err != nil {
+			log.Errorf("Failed to add CA '%s': %s", ca.Config.CA.Name, err)
+			loadErr = err
+			continue
+		}
+		ca.startWorkers()
+		result.AddedCAs = append(result.AddedCAs, ca.Config.CA.Name)
+	}
+	for _, name := range result.RestartRequired {
+		log.Warningf("Configuration change requires a restart of the server: %s", name)
+	}
+	if loadErr != nil {
+		return result, errors.WithMessage(loadErr, "The configuration was reloaded with errors")
+	}
+	log.Infof("Reloaded configuration of CAs %v; added CAs %v", result.CAs, result.AddedCAs)
+	return result, nil
+}
+
+// loadConfig loads the configuration of the server with the ConfigLoader,
+// or from the configuration file of the default CA if none is set
+func (s *Server) loadConfig() (*ServerConfig, error) {
+	if s.ConfigLoader != nil {
+		return s.ConfigLoader()
+	}
+	if s.CA.ConfigFilePath == "" {
+		return nil, errors.New("The server has no configuration file")
+	}
+	cfg := &ServerConfig{}
+	err := UnmarshalConfig(cfg, viper.New(), s.CA.ConfigFilePath, true)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// keepRunningServerSettings keeps the running values of the server settings
+// which cannot be changed at runtime and returns the ones that changed
+func (s *Server) keepRunningServerSettings(cfg *ServerConfig) ([]string, error) {
+	running := s.Config
+	err := stls.AbsTLSServer(&cfg.TLS, s.HomeDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range []*string{&cfg.Operations.TLS.CertFile, &cfg.Operations.TLS.KeyFile} {
+		if *file != "" && !filepath.IsAbs(*file) {
+			*file = filepath.Join(s.HomeDir, *file)
+		}
+	}
+	cfg.Operations.Metrics = cfg.Metrics
+	cfg.Client = running.Client
+	cfg.CompMode1_3 = running.CompMode1_3
+	cfg.CompMode1_4 = running.CompMode1_4
+	return keepRunningSettings("", []setting{
+		{"port", &running.Port, &cfg.Port},
+		{"address", &running.Address, &cfg.Address},
+		{"tls", &running.TLS, &cfg.TLS},
+		{"cors", &running.CORS, &cfg.CORS},
+		{"cacount", &running.CAcount, &cfg.CAcount},
+		{"ocsp", &running.OCSP, &cfg.OCSP},
+		{"est", &running.EST, &cfg.EST},
+		{"token", &running.Token, &cfg.Token},
+		{"metrics", &running.Metrics, &cfg.Metrics},
+		{"operations", &running.Operations, &cfg.Operations},
+	}), nil
+}
+
+// reloadCAFiles returns the CA files of the configuration, including the
+// ones created for the CAs of the cacount option and the ones of the CAs
+// added at runtime
+func (s *Server) reloadCAFiles(cfg *ServerConfig, managed []ManagedCA) ([]string, error) {
+	caFiles, err := util.NormalizeFileList(cfg.CAfiles, s.HomeDir)
+	if err != nil {
+		return nil, err
+	}
+	cfg.CAfiles = util.NormalizeStringSlice(caFiles)
+	caFiles = cfg.CAfiles
+	for i := 1; i <= cfg.CAcount; i++ {
+		caFiles = append(caFiles, filepath.Join(s.HomeDir, "ca", fmt.Sprintf("ca%d", i), "fabric-ca-config.yaml"))
+	}
+	for _, m := range managed {
+		if !m.Disabled && !strContained(m.ConfigFile, caFiles) {
+			caFiles = append(caFiles, m.ConfigFile)
+		}
+	}
+	return caFiles, nil
+}
+
+// stageReload initializes the configuration, signers and profiles of the
+// CA for the loaded configuration without changing the CA. It returns them
+// in a CA which applyReload swaps in, along with the changed settings which
+// cannot be changed at runtime.
+func (ca *CA) stageReload(cfg *CAConfig) (*CA, []string, error) {
+	next := &CA{
+		HomeDir:        ca.HomeDir,
+		Config:         cfg,
+		ConfigFilePath: ca.ConfigFilePath,
+		db:             ca.db,
+		csp:            ca.csp,
+		certDBAccessor: ca.certDBAccessor,
+		registry:       ca.registry,
+		issuer:         ca.issuer,
+		cpabeKey:       ca.cpabeKey,
+		cpabeDeriver:   ca.cpabeDeriver,
+		retiredSigners: ca.retiredSigners,
+		verifyOptions:  ca.verifyOptions,
+		attrMgr:        ca.attrMgr,
+		server:         ca.server,
+		levels:         ca.levels,
+	}
+	err := next.initConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = next.makeFileNamesAbsolute()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = next.initPasswords()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = next.initAttributeSchemas()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = util.ConfigureBCCSP(&cfg.CSP, "", ca.HomeDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = normalizeDBConfig(&cfg.DB, ca.HomeDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	running := ca.Config
+	cfg.Client = running.Client
+	restart := keepRunningSettings(fmt.Sprintf("CA '%s': ", running.CA.Name), []setting{
+		{"ca.name", &running.CA.Name, &cfg.CA.Name},
+		{"ca.certfile", &running.CA.Certfile, &cfg.CA.Certfile},
+		{"ca.keyfile", &running.CA.Keyfile, &cfg.CA.Keyfile},
+		{"ca.chainfile", &running.CA.Chainfile, &cfg.CA.Chainfile},
+		{"registry.totp.keyfile", &running.Registry.TOTP.KeyFile, &cfg.Registry.TOTP.KeyFile},
+		{"db", &running.DB, &cfg.DB},
+		{"ldap", &running.LDAP, &cfg.LDAP},
+		{"oidc", &running.OIDC, &cfg.OIDC},
+		{"idemix", &running.Idemix, &cfg.Idemix},
+		{"bccsp", &running.CSP, &cfg.CSP},
+		{"intermediate", &running.Intermediate, &cfg.Intermediate},
+		{"audit", &running.Audit, &cfg.Audit},
+	})
+
+	// Create the TOTP authenticator with the running key file, which cannot
+	// be changed at runtime
+	err = next.initTOTP()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = next.initExternalCA()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = cfg.Approvals.Validate()
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "Invalid approval configuration")
+	}
+
+	err = next.initEnrollmentSigner()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = next.initOCSPSigner()
+	if err != nil {
+		return nil, nil, err
+	}
+	if ca.cpabeKey != nil && !reflect.DeepEqual(running.CPABE, cfg.CPABE) {
+		next.cpabeDeriver = cpabe.NewKeyDeriver(ca.csp, ca.cpabeKey, &cfg.CPABE)
+	}
+	// Keep the webhook dispatcher unless its configuration changed
+	next.webhooks = ca.webhooks
+	if !cfg.Webhooks.Enabled {
+		next.webhooks = nil
+	} else if ca.webhooks == nil || !reflect.DeepEqual(running.Webhooks, cfg.Webhooks) {
+		next.webhooks, err = webhook.NewDispatcher(&cfg.Webhooks, cfg.CA.Name, ca.db, ca.csp)
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "Failed to create webhook dispatcher")
+		}
+	}
+	return next, restart, nil
+}
+
+// applyReload swaps in the configuration, signers, profiles, password policy
+// and hasher, TOTP authenticator, external CA verifier and webhook dispatcher
+// staged by stageReload, restarts the CRL publisher and adds the identities
+// and affiliations of the configuration to the registry. The settings are
+// swapped while no request uses the CA, so that a request sees the settings
+// of a single configuration.
+func (ca *CA) applyReload(next *CA) error {
+	ca.stateMutex.Lock()
+	running := ca.Config
+	ca.Config = next.Config
+	ca.enrollSigner = next.enrollSigner
+	ca.ocspSigner = next.ocspSigner
+	ca.ocspIssuer = next.ocspIssuer
+	ca.ocspRetiredSigners = next.ocspRetiredSigners
+	ca.cpabeDeriver = next.cpabeDeriver
+	ca.passwordPolicy = next.passwordPolicy
+	ca.passwordHasher = next.passwordHasher
+	ca.totp = next.totp
+	ca.externalCA = next.externalCA
+	ca.attrSchemas = next.attrSchemas
+	if accessor, ok := ca.registry.(*Accessor); ok {
+		accessor.SetPasswordHasher(ca.passwordHasher)
+	}
+	if lc, ok := ca.registry.(*ldap.Client); ok {
+		lc.SetAttributeSchemas(ca.attrSchemas)
+	}
+	dispatcher := ca.webhooks
+	ca.webhooks = next.webhooks
+	publisher := ca.crlPublisher
+	ca.crlPublisher = nil
+	if ca.Config.CRL.Publish.Enabled {
+		ca.crlPublisher = newCRLPublisher(ca)
+	}
+	// Keep the state of the ACME server unless its configuration changed
+	if !ca.Config.ACME.Enabled {
+		ca.acme = nil
+	} else if ca.acme == nil || !reflect.DeepEqual(running.ACME, ca.Config.ACME) {
+		ca.acme = acme.NewServer(&ca.Config.ACME, &acmeCA{ca: ca})
+	}
+	ca.stateMutex.Unlock()
+
+	if publisher != nil {
+		publisher.Stop()
+	}
+	if ca.crlPublisher != nil {
+		ca.crlPublisher.Start()
+	}
+	if dispatcher != ca.webhooks {
+		if dispatcher != nil {
+			dispatcher.Stop()
+		}
+		if ca.webhooks != nil {
+			ca.webhooks.Start()
+		}
+	}
+	if !ca.hasDBRegistry() {
+		return nil
+	}
+	err := ca.loadRolesTable()
+	if err != nil {
+		return err
+	}
+	err = ca.loadUsersTable()
+	if err != nil {
+		return err
+	}
+	return ca.loadAffiliationsTable()
+}
+
+// registerReloadHandler registers the endpoint of the operations listener
+// which reloads the configuration
+func (s *Server) registerReloadHandler() {
+	s.Operations.RegisterHandler(reloadPath, http.HandlerFunc(s.serveReload))
+}
+
+// serveReload reloads the configuration. The caller must authenticate with
+// a client certificate issued by one of the client CAs of the operations
+// listener.
+func (s *Server) serveReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	caller, ok := operationsCaller(w, r)
+	if !ok {
+		return
+	}
+	log.Infof("Configuration reload requested by '%s'", caller)
+	result, err := s.Reload()
+	if err != nil && result == nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// operationsCaller returns the common name of the client certificate with
+// which the caller of an administrative endpoint of the operations listener
+// authenticated. If there is none, it responds with 401 and returns false.
+func operationsCaller(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		http.Error(w, "A client certificate is required", http.StatusUnauthorized)
+		return "", false
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName, true
+}
@@ -0,0 +1,147 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	srv := TestGetRootServer(t)
+	srv.Config.Operations.ListenAddress = "localhost:0"
+	_, err := srv.Reload()
+	assert.Error(t, err, "Reloading a server which is not running should fail")
+
+	err = srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+	defer os.RemoveAll(rootDir)
+	caName := srv.CA.Config.CA.Name
+	running := *srv.Config
+	// The TOTP key file defaults to one in the home directory of the CA
+	assert.FileExists(t, filepath.Join(srv.CA.HomeDir, "totp.key"))
+
+	caDir, err := ioutil.TempDir("", "reloadca")
+	util.FatalError(t, err, "Failed to create temporary directory")
+	defer os.RemoveAll(caDir)
+	caFile := filepath.Join(caDir, "fabric-ca-server-config.yaml")
+	err = ioutil.WriteFile(caFile, []byte("ca:\n  name: reloadca\ncsr:\n  cn: reloadca\n"), 0644)
+	util.FatalError(t, err, "Failed to write CA configuration file")
+
+	// An invalid configuration changes nothing
+	srv.ConfigLoader = func() (*ServerConfig, error) {
+		cfg := running
+		cfg.CAcfg = *srv.CA.Config
+		cfg.CAfiles = []string{caFile, caFile}
+		return &cfg, nil
+	}
+	_, err = srv.Reload()
+	assert.Error(t, err, "Reloading CA files with the same CA name should fail")
+	assert.Nil(t, srv.lookupCA("reloadca"))
+
+	// Signing profiles, identities, affiliations and CA files are reloaded,
+	// and the database keeps its running configuration
+	srv.ConfigLoader = func() (*ServerConfig, error) {
+		cfg := running
+		cfg.CAfiles = []string{caFile}
+		cfg.CAcfg = *srv.CA.Config
+		cfg.CAcfg.DB.Type = "postgres"
+		cfg.CAcfg.Signing = &config.Signing{
+			Profiles: map[string]*config.SigningProfile{
+				"reload": {Usage: []string{"digital signature"}, ExpiryString: "1h"},
+			},
+			Default: config.DefaultConfig(),
+		}
+		cfg.CAcfg.Registry.Identities = append([]CAConfigIdentity{{
+			Name:        "reloaduser",
+			Pass:        "reloaduserpw",
+			Type:        "client",
+			Affiliation: "org3",
+		}}, cfg.CAcfg.Registry.Identities...)
+		cfg.CAcfg.Affiliations = map[string]interface{}{"org3": nil}
+		return &cfg, nil
+	}
+	result, err := srv.Reload()
+	util.FatalError(t, err, "Failed to reload configuration")
+	assert.Equal(t, []string{caName}, result.CAs)
+	assert.Equal(t, []string{"reloadca"}, result.AddedCAs)
+	assert.Equal(t, []string{"CA '" + caName + "': db"}, result.RestartRequired)
+	assert.Equal(t, defaultDatabaseType, srv.CA.Config.DB.Type)
+	assert.Contains(t, srv.CA.Config.Signing.Profiles, "reload")
+	_, err = srv.CA.registry.GetUser("reloaduser", nil)
+	assert.NoError(t, err, "The identity of the reloaded configuration should be registered")
+	_, err = srv.CA.registry.GetAffiliation("org3")
+	assert.NoError(t, err, "The affiliation of the reloaded configuration should be added")
+	_, err = srv.GetCA("reloadca")
+	assert.NoError(t, err, "The CA of the new CA file should be served")
+
+	// Removing a CA file requires a restart
+	srv.ConfigLoader = func() (*ServerConfig, error) {
+		cfg := running
+		cfg.CAcfg = *srv.CA.Config
+		return &cfg, nil
+	}
+	result, err = srv.Reload()
+	util.FatalError(t, err, "Failed to reload configuration")
+	assert.Equal(t, []string{"cafiles: CA 'reloadca' was removed"}, result.RestartRequired)
+
+	// The operations endpoint requires a client certificate
+	resp, err := http.Post("http://"+srv.Operations.Addr()+reloadPath, "application/json", nil)
+	util.FatalError(t, err, "Failed to send reload request")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestReloadDuringRequests(t *testing.T) {
+	srv := TestGetRootServer(t)
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	admin := resp.Identity
+
+	// The settings of the server are swapped while no request runs, which
+	// the race detector checks
+	running := *srv.Config
+	levels := []string{"debug", "info"}
+	reloads := 0
+	srv.ConfigLoader = func() (*ServerConfig, error) {
+		cfg := running
+		cfg.Debug = false
+		cfg.LogLevel = levels[reloads%len(levels)]
+		reloads++
+		cfg.CAcfg = *srv.CA.Config
+		return &cfg, nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			_, err := admin.GetIdentity("admin", "")
+			assert.NoError(t, err, "Failed to get identity while reloading")
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		_, err = srv.Reload()
+		assert.NoError(t, err, "Failed to reload configuration")
+	}
+	<-done
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/hyperledger/fabric-ca/lib/caerrors"
 	cr "github.com/hyperledger/fabric-ca/lib/server/certificaterequest"
 	"github.com/hyperledger/fabric-ca/lib/server/idemix"
+	"github.com/hyperledger/fabric-ca/lib/server/oidc"
 	"github.com/hyperledger/fabric-ca/lib/server/user"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/config"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
@@ -67,6 +68,10 @@ type serverRequestContextImpl struct {
 		err  error  // any error from reading the body
 	}
 	callerRoles map[string]bool
+	// identityLimited is true once the rate limit of the caller is checked
+	identityLimited bool
+	// caLocked is true while the settings of the CA are locked for reading
+	caLocked bool
 }
 
 // newServerRequestContext is the constructor for a serverRequestContextImpl
@@ -79,19 +84,24 @@ func newServerRequestContext(r *http.Request, w http.ResponseWriter, se *serverE
 }
 
 // BasicAuthentication authenticates the caller's username and password
-// found in the authorization header and returns the username
+// found in the authorization header and returns the username, along with
+// the TOTP of a user which enrolls with one. If OpenID Connect is enabled,
+// the header may instead contain an ID token. If enrollment with the
+// certificates of external CAs is enabled, the header may instead contain
+// an x509 token of such a certificate, or the request may have no header
+// and the certificate be the TLS client certificate.
 func (ctx *serverRequestContextImpl) BasicAuthentication() (string, error) {
 	r := ctx.req
 	// Get the authorization header
 	authHdr := r.Header.Get("authorization")
-	if authHdr == "" {
+	if authHdr == "" && (r.TLS == nil || len(r.TLS.PeerCertificates) == 0) {
 		return "", caerrors.NewHTTPErr(401, caerrors.ErrNoAuthHdr, "No authorization header")
 	}
-	// Extract the username and password from the header
+	token, isBearer := oidc.BearerToken(authHdr)
+	// Extract the username and password from the header; without them, the
+	// caller may authenticate with the certificate of an external CA
 	username, password, ok := r.BasicAuth()
-	if !ok {
-		return "", caerrors.NewAuthenticationErr(caerrors.ErrNoUserPass, "No user/pass in authorization header")
-	}
+	isExternalCert := !ok && !isBearer
 	// Get the CA that is targeted by this request
 	ca, err := ctx.GetCA()
 	if err != nil {
@@ -103,6 +113,12 @@ func (ctx *serverRequestContextImpl) BasicAuthentication() (string, error) {
 	if caMaxEnrollments == 0 {
 		return "", caerrors.NewAuthenticationErr(caerrors.ErrEnrollDisabled, "Enroll is disabled")
 	}
+	if isBearer {
+		return ctx.idTokenAuthentication(ca, token)
+	}
+	if isExternalCert {
+		return ctx.externalCertAuthentication(ca, authHdr)
+	}
 	// Get the user info object for this user
 	ctx.ui, err = ca.registry.GetUser(username, nil)
 	if err != nil {
@@ -124,6 +140,25 @@ func (ctx *serverRequestContextImpl) BasicAuthentication() (string, error) {
 	if err != nil {
 		return "", caerrors.NewAuthenticationErr(caerrors.ErrInvalidPass, "Login failure: %s", err)
 	}
+	// Check the TOTP of a user which enrolls with one. It is only checked
+	// once the password is, so that a caller without the password neither
+	// uses up the TOTP nor learns whether it is valid.
+	err = ctx.checkTOTP(ca, attempts)
+	if err != nil {
+		return "", err
+	}
+	// The limit of the identity is only charged once the caller proves who it
+	// is, so that others cannot use it up; until then only the limit of its
+	// IP address applies
+	err = ctx.limitIdentity(ca, username)
+	if err != nil {
+		return "", err
+	}
+	// A suspended identity is only told so once it proves who it is
+	err = checkSuspended(ctx.ui)
+	if err != nil {
+		return "", err
+	}
 	// Store the enrollment ID associated with this server request context
 	ctx.enrollmentID = username
 	ctx.caller, err = ctx.GetCaller()
@@ -139,6 +174,10 @@ func (ctx *serverRequestContextImpl) BasicAuthentication() (string, error) {
 // Returns the enrollment ID or error.
 func (ctx *serverRequestContextImpl) TokenAuthentication() (string, error) {
 	r := ctx.req
+	// An approved request runs as the caller which made it
+	if rec := approvalFromRequest(r); rec != nil {
+		return ctx.approvedAuthentication(rec)
+	}
 	// Get the authorization header
 	authHdr := r.Header.Get("authorization")
 	if authHdr == "" {
@@ -154,10 +193,28 @@ func (ctx *serverRequestContextImpl) TokenAuthentication() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	var id string
 	if idemix.IsToken(authHdr) {
-		return ctx.verifyIdemixToken(authHdr, r.Method, r.URL.RequestURI(), body)
+		id, err = ctx.verifyIdemixToken(authHdr, r.Method, r.URL.RequestURI(), body)
+	} else {
+		id, err = ctx.verifyX509Token(ca, authHdr, r.Method, r.URL.RequestURI(), body)
+	}
+	if err != nil {
+		return "", err
+	}
+	caller, err := ctx.GetCaller()
+	if err != nil {
+		return "", err
+	}
+	err = checkSuspended(caller)
+	if err != nil {
+		return "", err
 	}
-	return ctx.verifyX509Token(ca, authHdr, r.Method, r.URL.RequestURI(), body)
+	err = ctx.limitIdentity(ca, id)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
 }
 
 func (ctx *serverRequestContextImpl) verifyIdemixToken(authHdr, method, uri string, body []byte) (string, error) {
@@ -184,10 +241,15 @@ func (ctx *serverRequestContextImpl) verifyIdemixToken(authHdr, method, uri stri
 func (ctx *serverRequestContextImpl) verifyX509Token(ca *CA, authHdr, method, uri string, body []byte) (string, error) {
 	log.Debug("Caller is using a x509 certificate")
 	// Verify the token; the signature is over the header and body
-	cert, err2 := util.VerifyToken(ca.csp, authHdr, method, uri, body, ca.server.Config.CompMode1_3)
+	cert, tokenNonce, err2 := util.VerifyTokenNonce(ca.csp, authHdr, method, uri, body, ca.server.Config.CompMode1_3)
 	if err2 != nil {
 		return "", caerrors.NewAuthenticationErr(caerrors.ErrInvalidToken, "Invalid token in authorization header: %s", err2)
 	}
+	// Tokens without a time and nonce cannot be checked for replay, so they
+	// are only accepted in compatibility mode with 1.4 clients
+	if tokenNonce == nil && !ca.server.Config.CompMode1_4 {
+		return "", caerrors.NewAuthenticationErr(caerrors.ErrInvalidToken, "Invalid token in authorization header: the token has no time and nonce")
+	}
 	// Make sure the caller's cert was issued by this CA
 	err2 = ca.VerifyCertificate(cert)
 	if err2 != nil {
@@ -218,6 +280,16 @@ func (ctx *serverRequestContextImpl) verifyX509Token(ca *CA, authHdr, method, ur
 	if certificate.Status == "revoked" {
 		return "", caerrors.NewAuthenticationErr(caerrors.ErrCertRevoked, "The certificate in the authorization header is a revoked certificate")
 	}
+	// Remember the nonce of the token only once its certificate is trusted
+	if tokenNonce != nil {
+		if ca.replayGuard == nil {
+			return "", caerrors.NewHTTPErr(500, caerrors.ErrTokenReplayed, "Failed to check the authorization token for replay")
+		}
+		err = ca.replayGuard.Check(tokenNonce.Time, tokenNonce.Nonce)
+		if err != nil {
+			return "", caerrors.NewAuthenticationErr(caerrors.ErrTokenReplayed, "Invalid token in authorization header: %s", err)
+		}
+	}
 
 	ctx.enrollmentID = id
 	ctx.enrollmentCert = cert
@@ -263,14 +335,32 @@ func (ctx *serverRequestContextImpl) getCA() (*CA, error) {
 			return nil, err
 		}
 		// Get the CA by its name
-		ctx.ca, err = ctx.endpoint.Server.GetCA(name)
+		ca, err := ctx.endpoint.Server.GetCA(name)
 		if err != nil {
 			return nil, err
 		}
+		ctx.setCA(ca)
 	}
 	return ctx.ca, nil
 }
 
+// setCA sets the CA to which this request is targeted. The settings of the
+// CA are locked for reading until the request ends, so that a reload of the
+// configuration does not change them while the request uses them.
+func (ctx *serverRequestContextImpl) setCA(ca *CA) {
+	ca.stateMutex.RLock()
+	ctx.ca = ca
+	ctx.caLocked = true
+}
+
+// releaseCA unlocks the settings of the CA of the request once it ends
+func (ctx *serverRequestContextImpl) releaseCA() {
+	if ctx.caLocked {
+		ctx.caLocked = false
+		ctx.ca.stateMutex.RUnlock()
+	}
+}
+
 // GetAttrExtension returns an attribute extension to place into a signing request
 func (ctx *serverRequestContextImpl) GetAttrExtension(attrReqs []*api.AttributeRequest, profile string) (*signer.Extension, error) {
 	ca, err := ctx.GetCA()
@@ -322,6 +412,10 @@ type caNameReqBody struct {
 
 // getCAName returns the targeted CA name for this request
 func (ctx *serverRequestContextImpl) getCAName() (string, error) {
+	// The name of the CA of the request, once it is known
+	if ctx.ca != nil {
+		return ctx.ca.Config.CA.Name, nil
+	}
 	// Check the query parameters first
 	ca := ctx.req.URL.Query().Get("ca")
 	if ca != "" {
@@ -337,7 +431,7 @@ func (ctx *serverRequestContextImpl) getCAName() (string, error) {
 		return body.CAName, nil
 	}
 	// No CA name in the request body either, so use the default CA name
-	return ctx.endpoint.Server.CA.Config.CA.Name, nil
+	return ctx.endpoint.Server.getCAName(), nil
 }
 
 // ReadBody reads the request body and JSON unmarshals into 'body'
@@ -0,0 +1,68 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	cax509 "github.com/hyperledger/fabric-ca/lib/client/credential/x509"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/hyperledger/fabric/bccsp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenReplay(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	admin := resp.Identity
+
+	req, err := admin.client.newGet("identities/admin")
+	util.FatalError(t, err, "Failed to create request")
+	err = admin.addTokenAuthHdr(req, nil)
+	util.FatalError(t, err, "Failed to add token")
+	err = admin.client.SendReq(req, &api.GetIDResponse{})
+	assert.NoError(t, err, "Failed to get identity with a fresh token")
+	err = admin.client.SendReq(req, &api.GetIDResponse{})
+	if assert.Error(t, err, "A replayed token should be rejected") {
+		assert.Contains(t, err.Error(), "Error Code: 87")
+	}
+
+	// A token of a 1.4 client, which has no time and nonce, is only
+	// accepted in compatibility mode
+	val, err := admin.creds[0].Val()
+	util.FatalError(t, err, "Failed to get credential")
+	signer := val.(*cax509.Signer)
+	csp := admin.client.GetCSP()
+	b64cert := util.B64Encode(signer.Cert())
+	payload := "GET." + util.B64Encode([]byte(req.URL.RequestURI())) + "." + util.B64Encode(nil) + "." + b64cert
+	digest, err := csp.Hash([]byte(payload), &bccsp.SHAOpts{})
+	util.FatalError(t, err, "Failed to hash token payload")
+	sig, err := csp.Sign(signer.Key(), digest, nil)
+	util.FatalError(t, err, "Failed to sign token payload")
+	legacyReq, err := admin.client.newGet("identities/admin")
+	util.FatalError(t, err, "Failed to create request")
+	legacyReq.Header.Set("authorization", b64cert+"."+util.B64Encode(sig))
+
+	srv.Config.CompMode1_4 = true
+	err = admin.client.SendReq(legacyReq, &api.GetIDResponse{})
+	assert.NoError(t, err, "A token of a 1.4 client should be accepted in compatibility mode")
+	srv.Config.CompMode1_4 = false
+	err = admin.client.SendReq(legacyReq, &api.GetIDResponse{})
+	assert.Error(t, err, "A token of a 1.4 client should be rejected outside compatibility mode")
+}
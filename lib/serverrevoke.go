@@ -14,13 +14,15 @@ import (
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
 	"github.com/hyperledger/fabric-ca/lib/caerrors"
 	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
 	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
 	"golang.org/x/crypto/ocsp"
 )
 
 type revocationResponseNet struct {
-	RevokedCerts []api.RevokedCert
-	CRL          string
+	RevokedCerts  []api.RevokedCert
+	ReleasedCerts []api.RevokedCert `json:",omitempty"`
+	CRL           string
 }
 
 // CertificateStatus represents status of an enrollment certificate
@@ -82,11 +84,14 @@ func revokeHandler(ctx *serverRequestContextImpl) (interface{}, error) {
 	registry := ca.registry
 	reason := revocationReasonCodes[req.Reason]
 
+	// The removeFromCRL reason releases certificates on hold, as a release
+	// request does
+	if req.Release || reason == ocsp.RemoveFromCRL {
+		return releaseCertificates(ctx, ca, caller, &req.RevocationRequest)
+	}
+
 	result := &revocationResponseNet{}
 	if req.Serial != "" && req.AKI != "" {
-		calleraki := strings.ToLower(strings.TrimLeft(hex.EncodeToString(ctx.enrollmentCert.AuthorityKeyId), "0"))
-		callerserial := strings.ToLower(strings.TrimLeft(util.GetSerialAsHex(ctx.enrollmentCert.SerialNumber), "0"))
-
 		certificate, err := certDBAccessor.GetCertificateWithID(req.Serial, req.AKI)
 		if err != nil {
 			return nil, caerrors.NewHTTPErr(404, caerrors.ErrRevCertNotFound, "Certificate with serial %s and AKI %s was not found: %s",
@@ -99,7 +104,8 @@ func revokeHandler(ctx *serverRequestContextImpl) (interface{}, error) {
 			return nil, err
 		}
 
-		if certificate.Status == string(Revoked) {
+		// A certificate on hold can still be revoked for good
+		if certificate.Status == string(Revoked) && (certificate.Reason != ocsp.CertificateHold || reason == ocsp.CertificateHold) {
 			return nil, caerrors.NewHTTPErr(404, caerrors.ErrCertAlreadyRevoked, "Certificate with serial %s and AKI %s was already revoked",
 				req.Serial, req.AKI)
 		}
@@ -114,11 +120,17 @@ func revokeHandler(ctx *serverRequestContextImpl) (interface{}, error) {
 			return nil, caerrors.NewHTTPErr(404, caerrors.ErrRevokeIDNotFound, "Identity %s was not found: %s", certificate.ID, err)
 		}
 
-		if !((req.AKI == calleraki) && (req.Serial == callerserial)) {
+		// Callers may revoke their own certificate; an approved request runs
+		// without one
+		if !ctx.isCallerCert(req.Serial, req.AKI) {
 			err = ctx.CanManageUser(userInfo)
 			if err != nil {
 				return nil, err
 			}
+			err = ca.requireRevokeApproval(ctx, req.Serial, userInfo)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		err = certDBAccessor.RevokeCertificate(req.Serial, req.AKI, reason)
@@ -126,6 +138,7 @@ func revokeHandler(ctx *serverRequestContextImpl) (interface{}, error) {
 			return nil, caerrors.NewHTTPErr(500, caerrors.ErrRevokeFailure, "Revoke of certificate <%s,%s> failed: %s", req.Serial, req.AKI, err)
 		}
 		result.RevokedCerts = append(result.RevokedCerts, api.RevokedCert{Serial: req.Serial, AKI: req.AKI})
+		ca.emitEvent(webhook.CertificateRevoked, &certificateEvent{ID: certificate.ID, Serial: req.Serial, AKI: req.AKI, Reason: req.Reason})
 	} else if req.Name != "" {
 		// Authorization
 		err = checkAuth(caller, req.Name, ca)
@@ -150,6 +163,10 @@ func revokeHandler(ctx *serverRequestContextImpl) (interface{}, error) {
 				if err != nil {
 					return nil, err
 				}
+				err = ca.requireRevokeApproval(ctx, req.Name, user)
+				if err != nil {
+					return nil, err
+				}
 			}
 
 			err = user.Revoke()
@@ -171,6 +188,7 @@ func revokeHandler(ctx *serverRequestContextImpl) (interface{}, error) {
 			log.Debugf("Revoked the following certificates owned by '%s': %+v", req.Name, recs)
 			for _, certRec := range recs {
 				result.RevokedCerts = append(result.RevokedCerts, api.RevokedCert{AKI: certRec.AKI, Serial: certRec.Serial})
+				ca.emitEvent(webhook.CertificateRevoked, &certificateEvent{ID: req.Name, Serial: certRec.Serial, AKI: certRec.AKI, Reason: req.Reason})
 			}
 		}
 	} else {
@@ -179,15 +197,138 @@ func revokeHandler(ctx *serverRequestContextImpl) (interface{}, error) {
 
 	log.Debugf("Revoke was successful: %+v", req)
 
-	if req.GenCRL && len(result.RevokedCerts) > 0 {
+	err = ca.revocationsChanged(result.RevokedCerts, req.GenCRL, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isCallerCert returns true if the certificate with the serial number and
+// AKI is the one the caller authenticated with
+func (ctx *serverRequestContextImpl) isCallerCert(serial, aki string) bool {
+	cert := ctx.enrollmentCert
+	if cert == nil {
+		return false
+	}
+	calleraki := strings.ToLower(strings.TrimLeft(hex.EncodeToString(cert.AuthorityKeyId), "0"))
+	callerserial := strings.ToLower(strings.TrimLeft(util.GetSerialAsHex(cert.SerialNumber), "0"))
+	return aki == calleraki && serial == callerserial
+}
+
+// releaseCertificates releases a certificate on hold, or the certificates on
+// hold of an identity, which are then good again. They are left out of the
+// next CRL.
+func releaseCertificates(ctx *serverRequestContextImpl, ca *CA, caller string, req *api.RevocationRequest) (*revocationResponseNet, error) {
+	certDBAccessor := ca.certDBAccessor
+	registry := ca.registry
+	result := &revocationResponseNet{}
+	if req.Serial != "" && req.AKI != "" {
+		certificate, err := certDBAccessor.GetCertificateWithID(req.Serial, req.AKI)
+		if err != nil {
+			return nil, caerrors.NewHTTPErr(404, caerrors.ErrRevCertNotFound, "Certificate with serial %s and AKI %s was not found: %s",
+				req.Serial, req.AKI, err)
+		}
+
+		// Authorization
+		err = checkReleaseAuth(caller, ca)
+		if err != nil {
+			return nil, err
+		}
+
+		if certificate.Status != string(Revoked) || certificate.Reason != ocsp.CertificateHold {
+			return nil, caerrors.NewHTTPErr(400, caerrors.ErrCertNotOnHold, "Certificate with serial %s and AKI %s is not on hold",
+				req.Serial, req.AKI)
+		}
+
+		if req.Name != "" && req.Name != certificate.ID {
+			return nil, caerrors.NewHTTPErr(400, caerrors.ErrCertWrongOwner, "Certificate with serial %s and AKI %s is not owned by %s",
+				req.Serial, req.AKI, req.Name)
+		}
+
+		userInfo, err := registry.GetUser(certificate.ID, nil)
+		if err != nil {
+			return nil, caerrors.NewHTTPErr(404, caerrors.ErrRevokeIDNotFound, "Identity %s was not found: %s", certificate.ID, err)
+		}
+
+		err = ctx.CanManageUser(userInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		if userInfo.IsRevoked() {
+			return nil, caerrors.NewHTTPErr(400, caerrors.ErrRevokedID, "Certificate with serial %s and AKI %s cannot be released because identity %s is revoked",
+				req.Serial, req.AKI, certificate.ID)
+		}
+
+		err = certDBAccessor.ReleaseCertificate(req.Serial, req.AKI)
+		if err != nil {
+			return nil, caerrors.NewHTTPErr(500, caerrors.ErrRevokeFailure, "Release of certificate <%s,%s> failed: %s", req.Serial, req.AKI, err)
+		}
+		result.ReleasedCerts = append(result.ReleasedCerts, api.RevokedCert{Serial: req.Serial, AKI: req.AKI})
+		ca.emitEvent(webhook.CertificateReleased, &certificateEvent{ID: certificate.ID, Serial: req.Serial, AKI: req.AKI})
+	} else if req.Name != "" {
+		// Authorization
+		err := checkReleaseAuth(caller, ca)
+		if err != nil {
+			return nil, err
+		}
+
+		userInfo, err := registry.GetUser(req.Name, nil)
+		if err != nil {
+			return nil, caerrors.NewHTTPErr(404, caerrors.ErrRevokeIDNotFound, "Identity %s was not found: %s", req.Name, err)
+		}
+
+		err = ctx.CanManageUser(userInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		if userInfo.IsRevoked() {
+			return nil, caerrors.NewHTTPErr(400, caerrors.ErrRevokedID, "The certificates of identity %s cannot be released because it is revoked", req.Name)
+		}
+
+		recs, err := certDBAccessor.ReleaseCertificatesByID(req.Name)
+		if err != nil {
+			return nil, caerrors.NewHTTPErr(500, caerrors.ErrRevokeFailure, "Failed to release certificates for '%s': %s", req.Name, err)
+		}
+		for _, certRec := range recs {
+			result.ReleasedCerts = append(result.ReleasedCerts, api.RevokedCert{AKI: certRec.AKI, Serial: certRec.Serial})
+			ca.emitEvent(webhook.CertificateReleased, &certificateEvent{ID: req.Name, Serial: certRec.Serial, AKI: certRec.AKI})
+		}
+	} else {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrMissingRevokeArgs, "Either Name or Serial and AKI are required for a release request")
+	}
+
+	log.Debugf("Release was successful: %+v", req)
+
+	err := ca.revocationsChanged(result.ReleasedCerts, req.GenCRL, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// revocationsChanged invalidates the cached OCSP responses of certificates
+// which were revoked or released and regenerates the CRL. The CRL is
+// returned with the result if it is requested.
+func (ca *CA) revocationsChanged(certs []api.RevokedCert, genCRLReq bool, result *revocationResponseNet) error {
+	for _, cert := range certs {
+		ca.invalidateOCSPResponse(cert.Serial, cert.AKI)
+	}
+	if ca.crlPublisher != nil && len(certs) > 0 {
+		ca.crlPublisher.Trigger()
+	}
+
+	if genCRLReq && len(certs) > 0 {
 		log.Debugf("Generating CRL")
 		crl, err := genCRL(ca, api.GenCRLRequest{CAName: ca.Config.CA.Name})
 		if err != nil {
-			return nil, err
+			return err
 		}
 		result.CRL = util.B64Encode(crl)
 	}
-	return result, nil
+	return nil
 }
 
 func parseInput(input string) string {
@@ -204,3 +345,14 @@ func checkAuth(callerName, revokeUserName string, ca *CA) error {
 	}
 	return nil
 }
+
+// checkReleaseAuth makes sure that the caller has the "hf.Revoker" attribute.
+// Unlike a revocation, a release needs it even for the caller's own
+// certificates, as a hold is placed by a revoker.
+func checkReleaseAuth(callerName string, ca *CA) error {
+	err := ca.attributeIsTrue(callerName, "hf.Revoker")
+	if err != nil {
+		return caerrors.NewAuthorizationErr(caerrors.ErrNotRevoker, "Caller does not have authority to release")
+	}
+	return nil
+}
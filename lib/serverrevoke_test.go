@@ -7,12 +7,15 @@ SPDX-License-Identifier: Apache-2.0
 package lib
 
 import (
+	"crypto/x509"
+	"encoding/hex"
 	"os"
 	"testing"
 
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
 	"github.com/hyperledger/fabric-ca/internal/pkg/util"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
 )
 
 func TestParseInput(t *testing.T) {
@@ -148,3 +151,111 @@ func TestRevokeSelf(t *testing.T) {
 	_, err = testuser.RevokeSelf()
 	assert.NoError(t, err, "Failed to revoke one self")
 }
+
+func TestCertificateHold(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	admin := resp.Identity
+
+	rr, err := admin.Register(&api.RegistrationRequest{Name: "user1"})
+	util.FatalError(t, err, "Failed to register user 'user1'")
+	resp, err = client.Enroll(&api.EnrollmentRequest{Name: "user1", Secret: rr.Secret})
+	util.FatalError(t, err, "Failed to enroll 'user1'")
+	user1 := resp.Identity
+	// A second certificate of 'user1', which is not placed on hold
+	resp, err = user1.Reenroll(&api.ReenrollmentRequest{})
+	util.FatalError(t, err, "Failed to reenroll 'user1'")
+	other := resp.Identity
+
+	db := srv.CA.CertDBAccessor()
+	user1Cert := user1.GetECert().GetX509Cert()
+	serial, aki := util.GetSerialAsHex(user1Cert.SerialNumber), parseInput(hex.EncodeToString(user1Cert.AuthorityKeyId))
+	certStatus := func() (string, int) {
+		rec, err := db.GetCertificateWithID(serial, aki)
+		util.FatalError(t, err, "Failed to get certificate of 'user1'")
+		return rec.Status, rec.Reason
+	}
+	inCRL := func() bool {
+		crlResp, err := admin.GenCRL(&api.GenCRLRequest{})
+		util.FatalError(t, err, "Failed to generate CRL")
+		crl, err := x509.ParseCRL(crlResp.CRL)
+		util.FatalError(t, err, "Failed to parse CRL")
+		for _, rc := range crl.TBSCertList.RevokedCertificates {
+			if util.GetSerialAsHex(rc.SerialNumber) == serial {
+				return true
+			}
+		}
+		return false
+	}
+
+	_, err = admin.Revoke(&api.RevocationRequest{Serial: serial, AKI: aki, Release: true})
+	if assert.Error(t, err, "Releasing a certificate which is not on hold should fail") {
+		assert.Contains(t, err.Error(), "Error Code: 92")
+	}
+
+	_, err = admin.Revoke(&api.RevocationRequest{Serial: serial, AKI: aki, Reason: "certificatehold"})
+	util.FatalError(t, err, "Failed to place the certificate of 'user1' on hold")
+	status, reason := certStatus()
+	assert.Equal(t, "revoked", status)
+	assert.Equal(t, ocsp.CertificateHold, reason)
+	assert.True(t, inCRL(), "A certificate on hold should be in the CRL")
+	_, err = user1.Reenroll(&api.ReenrollmentRequest{})
+	assert.Error(t, err, "Reenrollment with a certificate on hold should fail")
+
+	// The owner of a certificate on hold cannot release it
+	_, err = other.Revoke(&api.RevocationRequest{Serial: serial, AKI: aki, Release: true})
+	if assert.Error(t, err, "The owner of a certificate should not release its hold") {
+		assert.Contains(t, err.Error(), "Error Code: 7 -")
+	}
+	_, err = other.Revoke(&api.RevocationRequest{Name: "user1", Release: true})
+	assert.Error(t, err, "The owner of certificates should not release their hold")
+	status, _ = certStatus()
+	assert.Equal(t, "revoked", status)
+
+	revResp, err := admin.Revoke(&api.RevocationRequest{Serial: serial, AKI: aki, Release: true})
+	util.FatalError(t, err, "Failed to release the certificate of 'user1'")
+	assert.Len(t, revResp.ReleasedCerts, 1)
+	status, _ = certStatus()
+	assert.Equal(t, "good", status)
+	assert.False(t, inCRL(), "A released certificate should be left out of the CRL")
+	_, err = user1.Reenroll(&api.ReenrollmentRequest{})
+	assert.NoError(t, err, "Failed to reenroll with a released certificate")
+
+	// The removeFromCRL reason releases the certificates on hold of an identity
+	_, err = admin.Revoke(&api.RevocationRequest{Name: "user1", Reason: "certificatehold"})
+	util.FatalError(t, err, "Failed to place the certificates of 'user1' on hold")
+	_, err = admin.Revoke(&api.RevocationRequest{Name: "user1", Reason: "removefromcrl"})
+	if assert.Error(t, err, "The certificates of a revoked identity should not be released") {
+		assert.Contains(t, err.Error(), "Error Code: 70")
+	}
+
+	// A certificate on hold can be revoked for good
+	rr, err = admin.Register(&api.RegistrationRequest{Name: "user2"})
+	util.FatalError(t, err, "Failed to register user 'user2'")
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "user2", Secret: rr.Secret})
+	util.FatalError(t, err, "Failed to enroll 'user2'")
+	certs, err := db.GetCertificatesByID("user2")
+	util.FatalError(t, err, "Failed to get certificates of 'user2'")
+	serial, aki = certs[0].Serial, certs[0].AKI
+	_, err = admin.Revoke(&api.RevocationRequest{Serial: serial, AKI: aki, Reason: "certificatehold"})
+	util.FatalError(t, err, "Failed to place the certificate of 'user2' on hold")
+	_, err = admin.Revoke(&api.RevocationRequest{Serial: serial, AKI: aki, Reason: "certificatehold"})
+	assert.Error(t, err, "Placing a certificate on hold twice should fail")
+	_, err = admin.Revoke(&api.RevocationRequest{Serial: serial, AKI: aki, Reason: "keycompromise"})
+	util.FatalError(t, err, "Failed to revoke a certificate on hold")
+	certs, err = db.GetCertificatesByID("user2")
+	util.FatalError(t, err, "Failed to get certificates of 'user2'")
+	assert.Equal(t, ocsp.KeyCompromise, certs[0].Reason)
+	_, err = admin.Revoke(&api.RevocationRequest{Serial: serial, AKI: aki, Release: true})
+	assert.Error(t, err, "Releasing a certificate which was revoked for good should fail")
+}
@@ -0,0 +1,605 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib/attr"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/approval"
+	"github.com/hyperledger/fabric-ca/lib/server/role"
+	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"github.com/pkg/errors"
+)
+
+func newRolesEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:      "roles",
+		Methods:   []string{"GET", "POST"},
+		Handler:   rolesHandler,
+		Server:    s,
+		successRC: 200,
+	}
+}
+
+func newRoleEndpoint(s *Server) *serverEndpoint {
+	return &serverEndpoint{
+		Path:      "roles/{role}",
+		Methods:   []string{"GET", "PUT", "DELETE"},
+		Handler:   roleHandler,
+		Server:    s,
+		successRC: 200,
+	}
+}
+
+// Handle a request to list the roles or to add one
+func rolesHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	caname, err := ctx.authenticateRoleRequest()
+	if err != nil {
+		return nil, err
+	}
+	method := ctx.req.Method
+	switch method {
+	case "GET":
+		return processGetAllRolesRequest(ctx, caname)
+	case "POST":
+		return processAddRoleRequest(ctx, caname)
+	default:
+		return nil, errors.Errorf("Invalid request: %s", method)
+	}
+}
+
+// Handle a request to get, modify or remove a role
+func roleHandler(ctx *serverRequestContextImpl) (interface{}, error) {
+	caname, err := ctx.authenticateRoleRequest()
+	if err != nil {
+		return nil, err
+	}
+	name, err := ctx.GetVar("role")
+	if err != nil {
+		return nil, err
+	}
+	method := ctx.req.Method
+	switch method {
+	case "GET":
+		return processGetRoleRequest(ctx, name, caname)
+	case "PUT":
+		return processModifyRoleRequest(ctx, name, caname)
+	case "DELETE":
+		return processRemoveRoleRequest(ctx, name, caname)
+	default:
+		return nil, errors.Errorf("Invalid request: %s", method)
+	}
+}
+
+// authenticateRoleRequest authenticates the caller of a role request and
+// checks that it may make it. Registrars, which assign the roles, may get
+// them, while only a caller with the 'hf.RoleMgr' attribute may add, modify
+// or remove them.
+func (ctx *serverRequestContextImpl) authenticateRoleRequest() (string, error) {
+	callerID, err := ctx.TokenAuthentication()
+	log.Debugf("Received role request from %s", callerID)
+	if err != nil {
+		return "", err
+	}
+	caname, err := ctx.getCAName()
+	if err != nil {
+		return "", err
+	}
+	_, err = ctx.ca.roleAccessor()
+	if err != nil {
+		return "", err
+	}
+	if ctx.req.Method == "GET" {
+		isRoleMgr, _ := ctx.hasRole(attr.RoleMgr)
+		if isRoleMgr {
+			return caname, nil
+		}
+		err = ctx.IsRegistrar()
+	} else {
+		err = ctx.HasRole(attr.RoleMgr)
+	}
+	if err != nil {
+		return "", err
+	}
+	return caname, nil
+}
+
+func processGetAllRolesRequest(ctx *serverRequestContextImpl, caname string) (*api.GetRolesResponse, error) {
+	log.Debug("Processing request to get all roles")
+	recs, err := ctx.ca.roles().List()
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	members, err := ctx.ca.roleMembers()
+	if err != nil {
+		return nil, err
+	}
+	resp := &api.GetRolesResponse{
+		Roles:  []api.RoleInfo{},
+		CAName: caname,
+	}
+	for _, rec := range recs {
+		info, err := roleInfo(rec, members)
+		if err != nil {
+			return nil, err
+		}
+		resp.Roles = append(resp.Roles, *info)
+	}
+	return resp, nil
+}
+
+func processGetRoleRequest(ctx *serverRequestContextImpl, name, caname string) (*api.RoleResponse, error) {
+	log.Debugf("Processing request to get role '%s'", name)
+	rec, err := ctx.ca.getRole(name)
+	if err != nil {
+		return nil, err
+	}
+	members, err := ctx.ca.roleMembers()
+	if err != nil {
+		return nil, err
+	}
+	info, err := roleInfo(rec, members)
+	if err != nil {
+		return nil, err
+	}
+	return &api.RoleResponse{RoleInfo: *info, CAName: caname}, nil
+}
+
+func processAddRoleRequest(ctx *serverRequestContextImpl, caname string) (*api.RoleResponse, error) {
+	var req api.AddRoleRequest
+	err := ctx.ReadBody(&req)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Processing request to add role '%s'", req.Name)
+	err = role.ValidateName(req.Name)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrRoleRequest, "%s", err)
+	}
+	err = ctx.checkRoleAttributes(req.Name, nil, req.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	_, err = ctx.ca.roles().Get(req.Name)
+	if err == nil {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrRoleRequest, "Role '%s' already exists", req.Name)
+	}
+	rec, err := role.NewRecord(req.Name, req.Attributes)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	err = ctx.ca.roles().Insert(rec)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	ctx.ca.emitEvent(webhook.RoleAdded, &roleEvent{Name: req.Name, Caller: ctx.enrollmentID})
+
+	ctx.endpoint.successRC = 201
+	return &api.RoleResponse{
+		RoleInfo: api.RoleInfo{Name: req.Name, Attributes: req.Attributes},
+		CAName:   caname,
+	}, nil
+}
+
+func processModifyRoleRequest(ctx *serverRequestContextImpl, name, caname string) (*api.RoleResponse, error) {
+	var req api.ModifyRoleRequest
+	err := ctx.ReadBody(&req)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Processing request to modify role '%s'", name)
+	rec, err := ctx.ca.getRole(name)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := rec.GetAttributes()
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	err = ctx.checkRoleAttributes(name, prev, req.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	prevDefs, err := ctx.ca.roles().Definitions()
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	nextDefs := map[string][]api.Attribute{}
+	for n, attrs := range prevDefs {
+		nextDefs[n] = attrs
+	}
+	nextDefs[name] = req.Attributes
+	members, updates, err := ctx.roleMemberUpdates(name, prevDefs, nextDefs, false)
+	if err != nil {
+		return nil, err
+	}
+	next, err := role.NewRecord(name, req.Attributes)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	updated, err := ctx.updateRole(&roleUpdate{rec: next, members: updates, reissue: req.Reissue}, webhook.RoleModified)
+	if err != nil {
+		return nil, err
+	}
+	return &api.RoleResponse{
+		RoleInfo: api.RoleInfo{Name: name, Attributes: req.Attributes, Members: members},
+		Updated:  updated,
+		CAName:   caname,
+	}, nil
+}
+
+func processRemoveRoleRequest(ctx *serverRequestContextImpl, name, caname string) (*api.RoleResponse, error) {
+	log.Debugf("Processing request to remove role '%s'", name)
+	force, err := ctx.GetBoolQueryParm("force")
+	if err != nil {
+		return nil, err
+	}
+	reissue, err := ctx.GetBoolQueryParm("reissue")
+	if err != nil {
+		return nil, err
+	}
+	rec, err := ctx.ca.getRole(name)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := rec.GetAttributes()
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	err = ctx.checkRoleAttributes(name, attrs, nil)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := ctx.ca.roles().Definitions()
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	members, updates, err := ctx.roleMemberUpdates(name, defs, defs, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) > 0 && !force {
+		return nil, caerrors.NewHTTPErr(400, caerrors.ErrRoleRequest, "Role '%s' has %d members; use force to remove it from them", name, len(members))
+	}
+	updated, err := ctx.updateRole(&roleUpdate{rec: rec, remove: true, members: updates, reissue: reissue}, webhook.RoleRemoved)
+	if err != nil {
+		return nil, err
+	}
+	return &api.RoleResponse{
+		RoleInfo: api.RoleInfo{Name: name, Attributes: attrs, Members: members},
+		Updated:  updated,
+		CAName:   caname,
+	}, nil
+}
+
+// checkRoleAttributes returns an error if the attributes a role gives are not
+// valid, or if the caller cannot register them or remove those the role no
+// longer gives, since the role gives and takes them from its members
+func (ctx *serverRequestContextImpl) checkRoleAttributes(name string, prev, next []api.Attribute) error {
+	err := role.ValidateAttributes(next)
+	if err != nil {
+		return caerrors.NewHTTPErr(400, caerrors.ErrRoleRequest, "Invalid attributes of role '%s': %s", name, err)
+	}
+	requested := append([]api.Attribute{}, next...)
+	for i := range next {
+		err = ctx.ca.attrSchemas.CheckValue(&next[i])
+		if err != nil {
+			return caerrors.NewHTTPErr(400, caerrors.ErrAttrSchema, "Invalid attributes of role '%s': %s", name, err)
+		}
+	}
+	for _, a := range prev {
+		if attr.GetAttrValue(next, a.Name) == "" {
+			requested = append(requested, api.Attribute{Name: a.Name, Value: ""})
+		}
+	}
+	caller, err := ctx.GetCaller()
+	if err != nil {
+		return err
+	}
+	err = attr.CanRegisterRequestedAttributes(requested, nil, caller)
+	if err != nil {
+		return caerrors.NewAuthorizationErr(caerrors.ErrRegAttrAuth, "Failed to set the attributes of role '%s': %s", name, err)
+	}
+	return nil
+}
+
+// updateRole stores the change of a role with the changes of its members,
+// and returns the names of the members it updated
+func (ctx *serverRequestContextImpl) updateRole(update *roleUpdate, event string) ([]string, error) {
+	accessor, err := ctx.ca.roleAccessor()
+	if err != nil {
+		return nil, err
+	}
+	err = accessor.updateRole(update)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "Failed to update role '%s': %s", update.rec.Name, err)
+	}
+	updated := []string{}
+	for _, m := range update.members {
+		updated = append(updated, m.name)
+		ctx.ca.emitEvent(webhook.IdentityModified, &identityEvent{
+			ID:          m.name,
+			Type:        m.typ,
+			Affiliation: m.affiliation,
+			Caller:      ctx.enrollmentID,
+		})
+	}
+	ctx.ca.emitEvent(event, &roleEvent{
+		Name:    update.rec.Name,
+		Members: updated,
+		Reissue: update.reissue && len(updated) > 0,
+		Caller:  ctx.enrollmentID,
+	})
+	return updated, nil
+}
+
+// clearReissue clears the flag which tells that the caller must reissue its
+// certificate after a change of its roles, once it has a new certificate
+func (ctx *serverRequestContextImpl) clearReissue() {
+	caller, err := ctx.GetCaller()
+	if err != nil {
+		return
+	}
+	u, ok := caller.(*user.Impl)
+	if !ok || !u.NeedsReissue() {
+		return
+	}
+	err = u.SetReissue(false)
+	if err != nil {
+		log.Warningf("Failed to clear the reissue flag of identity '%s': %s", u.GetName(), err)
+	}
+}
+
+// roles returns the store of the roles
+func (ca *CA) roles() *role.DBStore {
+	return role.NewDBStore(ca.db)
+}
+
+// roleAccessor returns the accessor of the registry, which must be the
+// database for the CA to support roles
+func (ca *CA) roleAccessor() (*Accessor, error) {
+	accessor, ok := ca.registry.(*Accessor)
+	if !ok || !ca.hasDBRegistry() {
+		return nil, caerrors.NewHTTPErr(403, caerrors.ErrRoleRequest, "Roles are not supported by the registry of CA '%s'", ca.Config.CA.Name)
+	}
+	return accessor, nil
+}
+
+// getRole returns a role, or an error if it does not exist
+func (ca *CA) getRole(name string) (*role.Record, error) {
+	rec, err := ca.roles().Get(name)
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(404, caerrors.ErrRoleRequest, "Role '%s' does not exist: %s", name, err)
+	}
+	return rec, nil
+}
+
+// roleMembers returns the identities which have at least one role
+func (ca *CA) roleMembers() ([]*user.Impl, error) {
+	accessor, err := ca.roleAccessor()
+	if err != nil {
+		return nil, err
+	}
+	members, err := accessor.getRoleMembers()
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	return members, nil
+}
+
+// roleMemberUpdates returns the members of a role, and the changes of the
+// attributes of those whose attributes change when the definitions of the
+// roles change from prevDefs to nextDefs, or when the role is taken from them
+// if remove is true. The caller must be able to manage every member of the
+// role, as it would to modify them.
+func (ctx *serverRequestContextImpl) roleMemberUpdates(name string, prevDefs, nextDefs map[string][]api.Attribute, remove bool) ([]string, []*roleMember, error) {
+	ca := ctx.ca
+	all, err := ca.roleMembers()
+	if err != nil {
+		return nil, nil, err
+	}
+	members := []string{}
+	var updates []*roleMember
+	for _, u := range all {
+		prevNames := userRoles(u)
+		if !strContained(name, prevNames) {
+			continue
+		}
+		members = append(members, u.GetName())
+		err = ctx.CanManageUser(u)
+		if err != nil {
+			log.Debugf("Caller cannot manage identity '%s' of role '%s': %s", u.GetName(), name, err)
+			return nil, nil, caerrors.NewAuthorizationErr(caerrors.ErrRoleRequest, "The change of role '%s' modifies identity '%s', which the caller cannot manage", name, u.GetName())
+		}
+		nextNames := prevNames
+		if remove {
+			nextNames = removeString(prevNames, name)
+		}
+		prevBundle, err := role.Bundle(prevNames, prevDefs)
+		if err != nil {
+			return nil, nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "Invalid roles of identity '%s': %s", u.GetName(), err)
+		}
+		nextBundle, err := role.Bundle(nextNames, nextDefs)
+		if err != nil {
+			return nil, nil, caerrors.NewHTTPErr(400, caerrors.ErrRoleRequest, "The change of role '%s' conflicts with the roles of identity '%s': %s", name, u.GetName(), err)
+		}
+		attrs, err := u.GetAttributes(nil)
+		if err != nil {
+			return nil, nil, caerrors.NewHTTPErr(500, caerrors.ErrGettingUser, "Failed to get the attributes of identity '%s': %s", u.GetName(), err)
+		}
+		changes := role.Changes(attrs, prevBundle, nextBundle, nil)
+		if remove {
+			changes = append(changes, api.Attribute{Name: attr.AssignedRoles, Value: strings.Join(nextNames, ",")})
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		next := user.GetNewAttributes(append([]api.Attribute{}, attrs...), changes)
+		err = ca.checkModifiedAttrs(u.GetName(), u.GetType(), attrs, next)
+		if err != nil {
+			return nil, nil, err
+		}
+		required, policy := ca.Config.Approvals.Required(approval.Modify, attributeNames(changes))
+		if required > 0 {
+			return nil, nil, caerrors.NewHTTPErr(403, caerrors.ErrApprovalRequest, "The change of role '%s' modifies identity '%s', which needs %d approvals by policy '%s'",
+				name, u.GetName(), required, policy)
+		}
+		updates = append(updates, &roleMember{
+			name:        u.GetName(),
+			typ:         u.GetType(),
+			affiliation: user.GetAffiliation(u),
+			attributes:  next,
+		})
+	}
+	return members, updates, nil
+}
+
+// addRoleAttributes adds to a registration request the attributes which the
+// roles it assigns give the identity. The request cannot also set these
+// attributes itself, and the registrar, if any, must be able to register them.
+func (ca *CA) addRoleAttributes(req *api.RegistrationRequest, registrar user.User) error {
+	names := role.Names(attr.GetAttrValue(req.Attributes, attr.AssignedRoles))
+	if len(names) == 0 {
+		return nil
+	}
+	defs, err := ca.roleDefinitions()
+	if err != nil {
+		return err
+	}
+	bundle, err := role.Bundle(names, defs)
+	if err != nil {
+		return caerrors.NewHTTPErr(400, caerrors.ErrRoleRequest, "Registration of '%s' failed: %s", req.Name, err)
+	}
+	for _, a := range bundle {
+		if attr.GetAttrValue(req.Attributes, a.Name) != "" {
+			return caerrors.NewHTTPErr(400, caerrors.ErrRoleRequest, "Registration of '%s' failed: attribute '%s' is given by its roles", req.Name, a.Name)
+		}
+	}
+	if registrar != nil {
+		err = attr.CanRegisterRequestedAttributes(bundle, nil, registrar)
+		if err != nil {
+			return caerrors.NewAuthorizationErr(caerrors.ErrRegAttrAuth, "Registration of '%s' failed: cannot register the attributes of its roles: %s", req.Name, err)
+		}
+	}
+	setRolesAttribute(&req.Attributes, names)
+	req.Attributes = append(req.Attributes, bundle...)
+	return nil
+}
+
+// addRoleChanges adds to a modify request the changes of the attributes of
+// an identity, which has the attributes prev, if the request changes its
+// roles. The request cannot change the attributes its roles give.
+func (ca *CA) addRoleChanges(req *api.ModifyIdentityRequest, prev []api.Attribute) error {
+	prevNames := role.Names(attr.GetAttrValue(prev, attr.AssignedRoles))
+	nextNames := prevNames
+	setRoles := false
+	for _, a := range req.Attributes {
+		if a.Name == attr.AssignedRoles {
+			nextNames = role.Names(a.Value)
+			setRoles = true
+		}
+	}
+	if len(prevNames) == 0 && len(nextNames) == 0 {
+		return nil
+	}
+	defs, err := ca.roleDefinitions()
+	if err != nil {
+		return err
+	}
+	prevBundle, err := role.Bundle(prevNames, defs)
+	if err != nil {
+		return caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "Invalid roles of identity '%s': %s", req.ID, err)
+	}
+	nextBundle, err := role.Bundle(nextNames, defs)
+	if err != nil {
+		return caerrors.NewHTTPErr(400, caerrors.ErrRoleRequest, "Modification of '%s' failed: %s", req.ID, err)
+	}
+	for _, a := range nextBundle {
+		if hasAttribute(req.Attributes, a.Name) {
+			return caerrors.NewHTTPErr(400, caerrors.ErrRoleRequest, "Modification of '%s' failed: attribute '%s' is given by its roles", req.ID, a.Name)
+		}
+	}
+	if !setRoles {
+		return nil
+	}
+	setRolesAttribute(&req.Attributes, nextNames)
+	req.Attributes = append(req.Attributes, role.Changes(prev, prevBundle, nextBundle, attributeNames(req.Attributes))...)
+	return nil
+}
+
+// roleDefinitions returns the attributes of all the roles by role name
+func (ca *CA) roleDefinitions() (map[string][]api.Attribute, error) {
+	if !ca.hasDBRegistry() {
+		return nil, caerrors.NewHTTPErr(403, caerrors.ErrRoleRequest, "Roles are not supported by the registry of CA '%s'", ca.Config.CA.Name)
+	}
+	defs, err := ca.roles().Definitions()
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	return defs, nil
+}
+
+// setRolesAttribute sets the attribute which lists the roles of an identity
+// to the normalized list of its roles
+func setRolesAttribute(attrs *[]api.Attribute, names []string) {
+	for i := range *attrs {
+		if (*attrs)[i].Name == attr.AssignedRoles {
+			(*attrs)[i].Value = strings.Join(names, ",")
+			(*attrs)[i].ECert = false
+		}
+	}
+}
+
+// userRoles returns the roles of an identity
+func userRoles(u user.User) []string {
+	a, err := u.GetAttribute(attr.AssignedRoles)
+	if err != nil {
+		return nil
+	}
+	return role.Names(a.Value)
+}
+
+// roleInfo returns the information of a role with the names of its members
+func roleInfo(rec *role.Record, members []*user.Impl) (*api.RoleInfo, error) {
+	attrs, err := rec.GetAttributes()
+	if err != nil {
+		return nil, caerrors.NewHTTPErr(500, caerrors.ErrRoleRequest, "%s", err)
+	}
+	info := &api.RoleInfo{Name: rec.Name, Attributes: attrs}
+	for _, u := range members {
+		if strContained(rec.Name, userRoles(u)) {
+			info.Members = append(info.Members, u.GetName())
+		}
+	}
+	return info, nil
+}
+
+// hasAttribute returns true if attrs has an attribute with a name
+func hasAttribute(attrs []api.Attribute, name string) bool {
+	for _, a := range attrs {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString returns a list without a string
+func removeString(list []string, s string) []string {
+	var result []string
+	for _, e := range list {
+		if e != s {
+			result = append(result, e)
+		}
+	}
+	return result
+}
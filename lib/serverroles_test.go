@@ -0,0 +1,175 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/attr"
+	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoles(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	srv.CA.Config.Registry.Roles = []CAConfigRole{
+		{Name: "auditor", Attrs: map[string]string{"department": "audit:ecert"}},
+	}
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	admin := resp.Identity
+
+	// The configured role is loaded, and more roles can be added
+	roles, err := admin.GetAllRoles("")
+	util.FatalError(t, err, "Failed to list roles")
+	if assert.Len(t, roles.Roles, 1) {
+		assert.Equal(t, "auditor", roles.Roles[0].Name)
+	}
+	_, err = admin.AddRole(&api.AddRoleRequest{
+		Name:       "revoker",
+		Attributes: []api.Attribute{{Name: attr.Revoker, Value: "true"}},
+	})
+	util.FatalError(t, err, "Failed to add role 'revoker'")
+	_, err = admin.AddRole(&api.AddRoleRequest{Name: "revoker"})
+	assert.Error(t, err, "A role should not be added twice")
+	_, err = admin.AddRole(&api.AddRoleRequest{Name: "bad role"})
+	assert.Error(t, err, "A role name with a space should fail")
+
+	// A registered identity is given the attributes of its roles
+	member1, err := admin.Register(&api.RegistrationRequest{
+		Name:       "member1",
+		Attributes: []api.Attribute{{Name: attr.AssignedRoles, Value: "auditor, revoker"}},
+	})
+	util.FatalError(t, err, "Failed to register identity with roles")
+	_, err = admin.Register(&api.RegistrationRequest{
+		Name:       "member2",
+		Attributes: []api.Attribute{{Name: attr.AssignedRoles, Value: "auditor"}, {Name: "department", Value: "sales"}},
+	})
+	assert.Error(t, err, "An identity should not set an attribute its roles give")
+	_, err = admin.Register(&api.RegistrationRequest{
+		Name:       "member2",
+		Attributes: []api.Attribute{{Name: attr.AssignedRoles, Value: "unknown"}},
+	})
+	assert.Error(t, err, "An identity should not be given a role which does not exist")
+
+	id, err := admin.GetIdentity("member1", "")
+	util.FatalError(t, err, "Failed to get identity 'member1'")
+	assert.Equal(t, []string{"auditor", "revoker"}, id.Roles)
+	assert.Equal(t, "audit", attr.GetAttrValue(id.Attributes, "department"))
+	assert.Equal(t, "true", attr.GetAttrValue(id.Attributes, attr.Revoker))
+
+	// A caller without 'hf.RoleMgr' cannot change the roles
+	rr, err := admin.Register(&api.RegistrationRequest{
+		Name:       "registrar1",
+		Attributes: []api.Attribute{{Name: attr.Roles, Value: "client"}},
+	})
+	util.FatalError(t, err, "Failed to register registrar")
+	resp, err = client.Enroll(&api.EnrollmentRequest{Name: "registrar1", Secret: rr.Secret})
+	util.FatalError(t, err, "Failed to enroll registrar")
+	registrar := resp.Identity
+	_, err = registrar.GetAllRoles("")
+	assert.NoError(t, err, "A registrar should list the roles")
+	_, err = registrar.AddRole(&api.AddRoleRequest{Name: "other"})
+	assert.Error(t, err, "A caller without 'hf.RoleMgr' should not add a role")
+
+	// A registrar cannot assign a role whose attributes it cannot register,
+	// and a role manager cannot change a role of identities it cannot manage
+	rr, err = admin.Register(&api.RegistrationRequest{
+		Name:        "registrar2",
+		Affiliation: "org1",
+		Attributes: []api.Attribute{
+			{Name: attr.Roles, Value: "client"},
+			{Name: attr.RegistrarAttr, Value: "hf.Roles,department"},
+			{Name: attr.RoleMgr, Value: "true"},
+		},
+	})
+	util.FatalError(t, err, "Failed to register registrar")
+	resp, err = client.Enroll(&api.EnrollmentRequest{Name: "registrar2", Secret: rr.Secret})
+	util.FatalError(t, err, "Failed to enroll registrar")
+	registrar2 := resp.Identity
+	_, err = registrar2.Register(&api.RegistrationRequest{
+		Name:       "member3",
+		Attributes: []api.Attribute{{Name: attr.AssignedRoles, Value: "revoker"}},
+	})
+	assert.Error(t, err, "A registrar should not assign a role whose attributes it cannot register")
+	_, err = registrar2.ModifyRole(&api.ModifyRoleRequest{
+		Name:       "auditor",
+		Attributes: []api.Attribute{{Name: "department", Value: "sales"}},
+	})
+	assert.Error(t, err, "A role manager should not change the attributes of identities it cannot manage")
+	_, err = registrar2.RemoveRole(&api.RemoveRoleRequest{Name: "auditor", Force: true})
+	assert.Error(t, err, "A role manager should not take a role from identities it cannot manage")
+	id, err = admin.GetIdentity("member1", "")
+	util.FatalError(t, err, "Failed to get identity 'member1'")
+	assert.Equal(t, "audit", attr.GetAttrValue(id.Attributes, "department"))
+
+	// Changing a role updates its members, which are flagged for reissue
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "member1", Secret: member1.Secret})
+	util.FatalError(t, err, "Failed to enroll 'member1'")
+	u, err := srv.CA.registry.GetUser("member1", nil)
+	util.FatalError(t, err, "Failed to get identity 'member1'")
+	prevState := u.(*user.Impl).State
+	mr, err := admin.ModifyRole(&api.ModifyRoleRequest{
+		Name:       "auditor",
+		Attributes: []api.Attribute{{Name: "department", Value: "compliance", ECert: true}, {Name: attr.GenCRL, Value: "true"}},
+		Reissue:    true,
+	})
+	util.FatalError(t, err, "Failed to modify role 'auditor'")
+	assert.Equal(t, []string{"member1"}, mr.Updated)
+	u, err = srv.CA.registry.GetUser("member1", nil)
+	util.FatalError(t, err, "Failed to get identity 'member1'")
+	attrs, err := u.GetAttributes(nil)
+	util.FatalError(t, err, "Failed to get attributes of identity 'member1'")
+	assert.Equal(t, "compliance", attr.GetAttrValue(attrs, "department"))
+	assert.Equal(t, "true", attr.GetAttrValue(attrs, attr.GenCRL))
+	assert.True(t, u.(*user.Impl).NeedsReissue())
+	assert.Equal(t, prevState, u.(*user.Impl).State, "Only the attributes of a member should change")
+
+	_, err = admin.ModifyRole(&api.ModifyRoleRequest{
+		Name:       "auditor",
+		Attributes: []api.Attribute{{Name: attr.Revoker, Value: "false"}},
+	})
+	assert.Error(t, err, "A change which conflicts with the other roles of a member should fail")
+
+	// Modifying the roles of an identity gives and takes their attributes
+	_, err = admin.ModifyIdentity(&api.ModifyIdentityRequest{
+		ID:         "member1",
+		Attributes: []api.Attribute{{Name: attr.AssignedRoles, Value: "revoker"}},
+	})
+	util.FatalError(t, err, "Failed to modify the roles of identity 'member1'")
+	id, err = admin.GetIdentity("member1", "")
+	util.FatalError(t, err, "Failed to get identity 'member1'")
+	assert.Equal(t, []string{"revoker"}, id.Roles)
+	assert.Empty(t, attr.GetAttrValue(id.Attributes, "department"))
+	assert.Empty(t, attr.GetAttrValue(id.Attributes, attr.GenCRL))
+	assert.True(t, id.Reissue)
+
+	// A role with members is only removed with force, which takes it from them
+	_, err = admin.RemoveRole(&api.RemoveRoleRequest{Name: "revoker"})
+	assert.Error(t, err, "A role with members should not be removed without force")
+	rm, err := admin.RemoveRole(&api.RemoveRoleRequest{Name: "revoker", Force: true})
+	util.FatalError(t, err, "Failed to remove role 'revoker'")
+	assert.Equal(t, []string{"member1"}, rm.Updated)
+	id, err = admin.GetIdentity("member1", "")
+	util.FatalError(t, err, "Failed to get identity 'member1'")
+	assert.Empty(t, id.Roles)
+	assert.Empty(t, attr.GetAttrValue(id.Attributes, attr.Revoker))
+	_, err = admin.GetRole("revoker", "")
+	assert.Error(t, err, "A removed role should not be found")
+}
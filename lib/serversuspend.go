@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+	"golang.org/x/crypto/ocsp"
+)
+
+// checkSuspended returns an error if the identity is suspended. Only the
+// identities of the database registry can be suspended.
+func checkSuspended(u user.User) error {
+	if dbUser, ok := u.(*user.Impl); ok && dbUser.IsSuspended() {
+		return caerrors.NewAuthorizationErr(caerrors.ErrIdentitySuspended, "Identity '%s' is suspended, unable to process request", u.GetName())
+	}
+	return nil
+}
+
+// checkSuspendRequest validates the suspension options of a request to
+// modify an identity
+func (ctx *serverRequestContextImpl) checkSuspendRequest(req *api.ModifyIdentityRequest, userToModify user.User) error {
+	if !req.Suspend && !req.Resume {
+		if req.Hold {
+			return caerrors.NewHTTPErr(400, caerrors.ErrModifyingIdentity, "The 'hold' option requires either the 'suspend' or the 'resume' option")
+		}
+		return nil
+	}
+	if req.Suspend && req.Resume {
+		return caerrors.NewHTTPErr(400, caerrors.ErrModifyingIdentity, "An identity cannot be both suspended and resumed")
+	}
+	if _, ok := userToModify.(*user.Impl); !ok {
+		return caerrors.NewHTTPErr(400, caerrors.ErrInvalidLDAPAction, "Identity '%s' cannot be suspended or resumed when LDAP is enabled", userToModify.GetName())
+	}
+	if req.Suspend && userToModify.GetName() == ctx.enrollmentID {
+		return caerrors.NewAuthorizationErr(caerrors.ErrModifyingIdentity, "Identity '%s' cannot suspend itself", ctx.enrollmentID)
+	}
+	return nil
+}
+
+// suspendIdentity suspends an identity, or resumes it if suspend is false.
+// With hold, the current certificates of an identity which is suspended are
+// placed on hold, and the certificates on hold of an identity which is
+// resumed are released. The enrollments of the identity are not changed.
+func (ca *CA) suspendIdentity(u *user.Impl, suspend, hold bool) error {
+	id := u.GetName()
+	err := u.SetSuspended(suspend)
+	if err != nil {
+		return caerrors.NewHTTPErr(500, caerrors.ErrModifyingIdentity, "Failed to update identity '%s': %s", id, err)
+	}
+	if !hold {
+		return nil
+	}
+
+	var recs []db.CertRecord
+	if suspend {
+		recs, err = ca.certDBAccessor.RevokeCertificatesByID(id, ocsp.CertificateHold)
+	} else {
+		recs, err = ca.certDBAccessor.ReleaseCertificatesByID(id)
+	}
+	if err != nil {
+		return caerrors.NewHTTPErr(500, caerrors.ErrModifyingIdentity, "Failed to update the certificates of identity '%s': %s", id, err)
+	}
+	for _, rec := range recs {
+		ca.invalidateOCSPResponse(rec.Serial, rec.AKI)
+		if suspend {
+			ca.emitEvent(webhook.CertificateRevoked, &certificateEvent{ID: id, Serial: rec.Serial, AKI: rec.AKI, Reason: "certificatehold"})
+		} else {
+			ca.emitEvent(webhook.CertificateReleased, &certificateEvent{ID: id, Serial: rec.Serial, AKI: rec.AKI})
+		}
+	}
+	if ca.crlPublisher != nil && len(recs) > 0 {
+		ca.crlPublisher.Trigger()
+	}
+	log.Debugf("Suspension of identity '%s' set to %t; %d certificates were updated", id, suspend, len(recs))
+	return nil
+}
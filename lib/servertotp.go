@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/lib/caerrors"
+	"github.com/hyperledger/fabric-ca/lib/server/totp"
+	"github.com/hyperledger/fabric-ca/lib/server/user"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+)
+
+// setTOTPSeed gives an identity a new TOTP seed, replacing the one it has,
+// and returns the encoding of the seed and its key URI
+func (ca *CA) setTOTPSeed(u *user.Impl) (string, string, error) {
+	id := u.GetName()
+	seed, encSeed, err := ca.totp.NewSeed(id)
+	if err != nil {
+		return "", "", caerrors.NewHTTPErr(500, caerrors.ErrTOTPSeed, "Failed to create TOTP seed: %s", err)
+	}
+	err = u.SetTOTPSeed(encSeed)
+	if err != nil {
+		return "", "", caerrors.NewHTTPErr(500, caerrors.ErrTOTPSeed, "Failed to set the TOTP seed of identity '%s': %s", id, err)
+	}
+	log.Debugf("Set a new TOTP seed for identity '%s'", id)
+	return totp.EncodeSeed(seed), ca.totp.KeyURI(id, seed), nil
+}
+
+// checkTOTP verifies the TOTP in the header of an enroll request if the
+// identity enrolling has a TOTP seed. It is called once the password was
+// checked, which reset the incorrect password attempts; attempts is their
+// number before. An invalid TOTP counts as an incorrect password attempt on
+// top of them, so that TOTPs cannot be guessed by retrying.
+func (ctx *serverRequestContextImpl) checkTOTP(ca *CA, attempts int) error {
+	u, ok := ctx.ui.(*user.Impl)
+	if !ok || u.TOTPSeed == "" {
+		return nil
+	}
+	id := u.GetName()
+	code := ctx.req.Header.Get(api.TOTPHeader)
+	if code == "" {
+		return caerrors.NewAuthenticationErr(caerrors.ErrInvalidTOTP, "Identity '%s' must enroll with a TOTP", id)
+	}
+	step, err := ca.totp.Verify(id, u.TOTPSeed, code, u.TOTPStep)
+	if err != nil {
+		err2 := u.SetIncorrectPasswordAttempts(attempts + 1)
+		if err2 != nil {
+			log.Warningf("Failed to mark incorrect TOTP attempt of identity '%s': %s", id, err2)
+		}
+		return caerrors.NewAuthenticationErr(caerrors.ErrInvalidTOTP, "Invalid TOTP of identity '%s': %s", id, err)
+	}
+	err = u.UseTOTPStep(step)
+	if err != nil {
+		return caerrors.NewAuthenticationErr(caerrors.ErrInvalidTOTP, "Invalid TOTP of identity '%s': %s", id, err)
+	}
+	log.Debugf("Verified TOTP of identity '%s'", id)
+	return nil
+}
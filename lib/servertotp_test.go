@@ -0,0 +1,57 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"encoding/base32"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/server/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTPEnroll(t *testing.T) {
+	os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	srv := TestGetRootServer(t)
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+
+	client := TestGetRootClient()
+	resp, err := client.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll user 'admin'")
+	rr, err := resp.Identity.Register(&api.RegistrationRequest{Name: "totpuser", Affiliation: "org1", TOTP: true})
+	util.FatalError(t, err, "Failed to register user 'totpuser'")
+	seed, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(rr.TOTPSeed)
+	util.FatalError(t, err, "Failed to decode TOTP seed")
+	code := totp.Code(seed, time.Now())
+
+	// A caller without the password neither uses up the TOTP nor learns
+	// whether it is valid
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "totpuser", Secret: "wrongpw", TOTP: code})
+	assert.Error(t, err, "Enrollment with a wrong password should fail")
+
+	// An invalid TOTP counts as an incorrect password attempt, even though
+	// the password is correct
+	for i := 1; i <= 2; i++ {
+		_, err = client.Enroll(&api.EnrollmentRequest{Name: "totpuser", Secret: rr.Secret, TOTP: "000000"})
+		assert.Error(t, err, "Enrollment with an invalid TOTP should fail")
+		u, err := srv.CA.registry.GetUser("totpuser", nil)
+		util.FatalError(t, err, "Failed to get user 'totpuser'")
+		assert.Equal(t, 1+i, u.GetFailedLoginAttempts())
+	}
+
+	_, err = client.Enroll(&api.EnrollmentRequest{Name: "totpuser", Secret: rr.Secret, TOTP: code})
+	assert.NoError(t, err, "Enrollment with the password and the TOTP should succeed")
+}
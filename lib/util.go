@@ -16,6 +16,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/grantae/certinfo"
 	"github.com/hyperledger/fabric-ca/internal/pkg/api"
@@ -127,6 +128,32 @@ func getMaxEnrollments(userMaxEnrollments int, caMaxEnrollments int) (int, error
 	}
 }
 
+// getSecretExpiry returns when a secret issued now expires, given the secret
+// expiry duration of a request and of the CA, or nil if it does not expire.
+// The CA secret expiry is both the default and the maximum of the request.
+func getSecretExpiry(userSecretExpiry string, caSecretExpiry time.Duration) (*time.Time, error) {
+	log.Debugf("Secret expiry verification - User specified secret expiry: '%s', CA secret expiry: %s", userSecretExpiry, caSecretExpiry)
+	expiry := caSecretExpiry
+	if userSecretExpiry != "" {
+		d, err := time.ParseDuration(userSecretExpiry)
+		if err != nil {
+			return nil, caerrors.NewHTTPErr(400, caerrors.ErrInvalidSecretExpiry, "Invalid secret expiry '%s' in request: %s", userSecretExpiry, err)
+		}
+		if d <= 0 {
+			return nil, caerrors.NewHTTPErr(400, caerrors.ErrInvalidSecretExpiry, "Secret expiry in request must be positive, but was '%s'", userSecretExpiry)
+		}
+		if caSecretExpiry > 0 && d > caSecretExpiry {
+			return nil, caerrors.NewHTTPErr(400, caerrors.ErrInvalidSecretExpiry, "Requested secret expiry (%s) exceeds maximum allowable secret expiry (%s)", d, caSecretExpiry)
+		}
+		expiry = d
+	}
+	if expiry <= 0 {
+		return nil, nil
+	}
+	t := time.Now().UTC().Add(expiry)
+	return &t, nil
+}
+
 func addQueryParm(req *http.Request, name, value string) {
 	url := req.URL.Query()
 	url.Add(name, value)
@@ -140,10 +167,19 @@ func IdentityDecoder(decoder *json.Decoder) error {
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Name: %s, Type: %s, Affiliation: %s, Max Enrollments: %d, Attributes: %+v\n", id.ID, id.Type, id.Affiliation, id.MaxEnrollments, id.Attributes)
+	fmt.Printf("Name: %s, Type: %s, Affiliation: %s, Max Enrollments: %d, Secret: %s, Suspended: %t, Roles: %v, Reissue: %t, Attributes: %+v\n", id.ID, id.Type, id.Affiliation, id.MaxEnrollments, SecretStateString(id.SecretState, id.SecretExpiry), id.Suspended, id.Roles, id.Reissue, id.Attributes)
 	return nil
 }
 
+// SecretStateString returns the state of the enrollment secret of an
+// identity, followed by when it expires if it does
+func SecretStateString(state string, expiry *time.Time) string {
+	if expiry == nil {
+		return state
+	}
+	return fmt.Sprintf("%s (expires %s)", state, expiry.Format(time.RFC3339))
+}
+
 // CertificateDecoder is needed to keep track of state, to see how many certificates
 // have been returned for each enrollment ID.
 type CertificateDecoder struct {
@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-ca/lib/server/db"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
+	"github.com/hyperledger/fabric-ca/third_party/github.com/cloudflare/cfssl/log"
+)
+
+// certificateEvent is the data of the certificate.issued,
+// certificate.revoked and certificate.released events
+type certificateEvent struct {
+	// ID is the enrollment ID of the owner of the certificate
+	ID       string     `json:"id,omitempty"`
+	Serial   string     `json:"serial"`
+	AKI      string     `json:"aki"`
+	NotAfter *time.Time `json:"not_after,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+	PEM      string     `json:"pem,omitempty"`
+}
+
+// identityEvent is the data of the identity events
+type identityEvent struct {
+	ID          string `json:"id"`
+	Type        string `json:"type,omitempty"`
+	Affiliation string `json:"affiliation,omitempty"`
+	// Caller is the enrollment ID of the identity which made the change
+	Caller string `json:"caller,omitempty"`
+}
+
+// affiliationEvent is the data of the affiliation events
+type affiliationEvent struct {
+	Name    string `json:"name"`
+	NewName string `json:"new_name,omitempty"`
+	// Caller is the enrollment ID of the identity which made the change
+	Caller string `json:"caller,omitempty"`
+}
+
+// roleEvent is the data of the role events
+type roleEvent struct {
+	Name string `json:"name"`
+	// Members are the identities whose attributes the change updated
+	Members []string `json:"members,omitempty"`
+	// Reissue is true if the members must reissue their certificates
+	Reissue bool `json:"reissue,omitempty"`
+	// Caller is the enrollment ID of the identity which made the change
+	Caller string `json:"caller,omitempty"`
+}
+
+// emitEvent sends an event to the webhook endpoints of the CA, if webhooks
+// are enabled. The change the event reports is already done, so a failure
+// to store the event is logged rather than failing the request.
+func (ca *CA) emitEvent(eventType string, data interface{}) {
+	dispatcher := ca.webhooks
+	if dispatcher == nil {
+		return
+	}
+	err := dispatcher.Emit(eventType, data)
+	if err != nil {
+		log.Errorf("Failed to send %s event of CA '%s': %s", eventType, ca.Config.CA.Name, err)
+	}
+}
+
+// certificateIssued is called by the certificate DB accessor with each
+// certificate the CA issues
+func (ca *CA) certificateIssued(rec *db.CertRecord) {
+	notAfter := rec.Expiry
+	ca.emitEvent(webhook.CertificateIssued, &certificateEvent{
+		ID:       rec.ID,
+		Serial:   rec.Serial,
+		AKI:      rec.AKI,
+		NotAfter: &notAfter,
+		PEM:      rec.PEM,
+	})
+}
@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-ca/internal/pkg/api"
+	"github.com/hyperledger/fabric-ca/internal/pkg/util"
+	"github.com/hyperledger/fabric-ca/lib/server/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhooks(t *testing.T) {
+	events := make(chan *webhook.Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil || !webhook.Verify("hooksecret", body, r.Header.Get(webhook.SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		event := &webhook.Event{}
+		if json.Unmarshal(body, event) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events <- event
+	}))
+	defer receiver.Close()
+
+	srv := TestGetRootServer(t)
+	srv.CA.Config.Webhooks = webhook.Config{
+		Enabled:   true,
+		Endpoints: []webhook.EndpointConfig{{URL: receiver.URL, Secret: "hooksecret"}},
+	}
+	err := srv.Start()
+	util.FatalError(t, err, "Failed to start server")
+	defer srv.Stop()
+	defer os.RemoveAll(rootDir)
+	defer os.RemoveAll(rootClientDir)
+
+	c := TestGetRootClient()
+	enrollResp, err := c.Enroll(&api.EnrollmentRequest{Name: "admin", Secret: "adminpw"})
+	util.FatalError(t, err, "Failed to enroll 'admin'")
+	admin := enrollResp.Identity
+	regResp, err := admin.Register(&api.RegistrationRequest{Name: "hookuser", Affiliation: "org1"})
+	util.FatalError(t, err, "Failed to register 'hookuser'")
+	_, err = c.Enroll(&api.EnrollmentRequest{Name: "hookuser", Secret: regResp.Secret})
+	util.FatalError(t, err, "Failed to enroll 'hookuser'")
+	_, err = admin.Revoke(&api.RevocationRequest{Name: "hookuser", Reason: "keycompromise"})
+	util.FatalError(t, err, "Failed to revoke 'hookuser'")
+
+	received := map[string]map[string]interface{}{}
+	for len(received) < 4 {
+		select {
+		case event := <-events:
+			assert.Equal(t, srv.CA.Config.CA.Name, event.CA)
+			data, _ := event.Data.(map[string]interface{})
+			id, _ := data["id"].(string)
+			received[event.Type+" "+id] = data
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Timed out waiting for webhook events; received %v", received)
+		}
+	}
+	assert.Contains(t, received, "certificate.issued admin")
+	assert.Contains(t, received, "certificate.issued hookuser")
+	if assert.Contains(t, received, "identity.registered hookuser") {
+		data := received["identity.registered hookuser"]
+		assert.Equal(t, "org1", data["affiliation"])
+		assert.Equal(t, "admin", data["caller"])
+	}
+	if assert.Contains(t, received, "certificate.revoked hookuser") {
+		assert.Equal(t, "keycompromise", received["certificate.revoked hookuser"]["reason"])
+	}
+}